@@ -1,25 +1,171 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	_ "time/tzdata"
 
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"gorm.io/gorm"
+
+	"github.com/peconote/peconote/internal/infrastructure/config"
 	"github.com/peconote/peconote/internal/infrastructure/db"
+	"github.com/peconote/peconote/internal/infrastructure/metrics"
+	"github.com/peconote/peconote/internal/infrastructure/migrate"
 	"github.com/peconote/peconote/internal/infrastructure/router"
+	"github.com/peconote/peconote/internal/infrastructure/tracing"
 )
 
 func main() {
-	gormDB, err := db.NewDB()
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:], os.Getenv)
 	if err != nil {
-		log.Fatalf("failed to connect database: %v", err)
+		log.Fatalf("invalid configuration: %v", err)
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing, os.Stdout)
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
 	}
 
-	sqlxDB, err := db.NewSqlxDB()
+	gormDB, err := db.NewDB(cfg.Database.UsersPath)
 	if err != nil {
 		log.Fatalf("failed to connect database: %v", err)
 	}
 
-	r := router.NewRouter(gormDB, sqlxDB)
-	if err := r.Run(); err != nil {
+	bg := router.NewBackground()
+	m := metrics.New()
+	var (
+		r      *gin.Engine
+		sqlxDB *sqlx.DB
+	)
+	if dir, ok := db.GitDir(cfg.Database.URL); ok {
+		if err := migrateIfEnabled(cfg, gormDB, false); err != nil {
+			log.Fatalf("failed to migrate database: %v", err)
+		}
+		r, err = router.NewGitRouter(bg, m, cfg, gormDB, dir)
+		if err != nil {
+			log.Fatalf("failed to open git storage: %v", err)
+		}
+	} else {
+		sqlxDB, err = db.Open(cfg.Database.URL)
+		if err != nil {
+			log.Fatalf("failed to connect database: %v", err)
+		}
+		sqlxDB.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+		sqlxDB.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+		sqlxDB.SetConnMaxLifetime(time.Duration(cfg.Database.ConnMaxLifetime))
+		if err := migrateIfEnabled(cfg, gormDB, true); err != nil {
+			log.Fatalf("failed to migrate database: %v", err)
+		}
+		r, err = router.NewRouter(bg, m, cfg, gormDB, sqlxDB)
+		if err != nil {
+			log.Fatalf("failed to set up routes: %v", err)
+		}
+	}
+
+	srv := &http.Server{
+		Addr:         cfg.Server.Addr,
+		Handler:      r,
+		ReadTimeout:  time.Duration(cfg.Server.ReadTimeout),
+		WriteTimeout: time.Duration(cfg.Server.WriteTimeout),
+		IdleTimeout:  time.Duration(cfg.Server.IdleTimeout),
+	}
+	srv.RegisterOnShutdown(bg.EndStreams)
+	servers := []*http.Server{srv}
+	if cfg.Metrics.Addr != "" {
+		servers = append(servers, &http.Server{
+			Addr:         cfg.Metrics.Addr,
+			Handler:      m.Handler(),
+			ReadTimeout:  time.Duration(cfg.Server.ReadTimeout),
+			WriteTimeout: time.Duration(cfg.Server.WriteTimeout),
+			IdleTimeout:  time.Duration(cfg.Server.IdleTimeout),
+		})
+	}
+	serveErr := make(chan error, len(servers))
+	for _, s := range servers {
+		s := s
+		go func() { serveErr <- s.ListenAndServe() }()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	select {
+	case err := <-serveErr:
 		log.Fatalf("failed to run server: %v", err)
+	case <-ctx.Done():
+	}
+	// A second signal kills the process instead of waiting.
+	stop()
+	log.Printf("shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeout))
+	defer cancel()
+	for _, s := range servers {
+		if err := s.Shutdown(shutdownCtx); err != nil {
+			log.Printf("failed to drain requests: %v", err)
+		}
+		if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("server stopped: %v", err)
+		}
+	}
+	if err := bg.Stop(shutdownCtx); err != nil {
+		log.Printf("failed to stop background work: %v", err)
+	}
+	if sqlxDB != nil {
+		if err := sqlxDB.Close(); err != nil {
+			log.Printf("failed to close memo database: %v", err)
+		}
+	}
+	if usersDB, err := gormDB.DB(); err == nil {
+		if err := usersDB.Close(); err != nil {
+			log.Printf("failed to close users database: %v", err)
+		}
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Printf("failed to flush spans: %v", err)
+	}
+}
+
+// migrateIfEnabled applies the pending migrations of the users database and,
+// unless it is stored in git, the memo database when auto-migration is
+// configured. The memo database is migrated over its own connections.
+func migrateIfEnabled(cfg *config.Config, gormDB *gorm.DB, memoDB bool) error {
+	if !cfg.Database.AutoMigrate {
+		return nil
+	}
+	userMigrator, err := db.UserMigrator(gormDB)
+	if err != nil {
+		return err
+	}
+	migrators := []*migrate.Migrator{userMigrator}
+	if memoDB {
+		sqlxDB, err := db.OpenMigrations(cfg.Database.URL)
+		if err != nil {
+			return err
+		}
+		defer sqlxDB.Close()
+		memoMigrator, err := db.MemoMigrator(sqlxDB)
+		if err != nil {
+			return err
+		}
+		migrators = append(migrators, memoMigrator)
+	}
+	for _, m := range migrators {
+		done, err := m.Up(context.Background())
+		if err != nil {
+			return err
+		}
+		for _, mig := range done {
+			log.Printf("applied migration %04d_%s", mig.Version, mig.Name)
+		}
 	}
+	return nil
 }
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/peconote/peconote/internal/infrastructure/config"
+)
+
+func runConfig(args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return errors.New("expected print")
+	}
+	fs := flag.NewFlagSet("config print", flag.ContinueOnError)
+	redacted := fs.Bool("redacted", false, "mask the database password")
+	cfg, err := config.Load(fs, args[1:], os.Getenv)
+	if err != nil {
+		return err
+	}
+	if *redacted {
+		cfg = cfg.Redacted()
+	}
+	enc := yaml.NewEncoder(os.Stdout)
+	enc.SetIndent(2)
+	if err := enc.Encode(cfg); err != nil {
+		return err
+	}
+	return enc.Close()
+}
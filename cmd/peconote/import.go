@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"os/signal"
+
+	"github.com/peconote/peconote/internal/adapter/importer"
+	adapterrepo "github.com/peconote/peconote/internal/adapter/repository"
+	"github.com/peconote/peconote/internal/infrastructure/config"
+	"github.com/peconote/peconote/internal/infrastructure/db"
+	"github.com/peconote/peconote/internal/usecase"
+)
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "validate and report without writing")
+	cfg, err := config.Load(fs, args, os.Getenv)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("expected exactly one directory or zip file")
+	}
+
+	src, closer, err := importer.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	sqlxDB, err := db.Open(cfg.Database.URL)
+	if err != nil {
+		return err
+	}
+	defer sqlxDB.Close()
+	if sqlxDB.DriverName() != db.DriverPostgres {
+		return errors.New("importing needs a Postgres DATABASE_URL")
+	}
+
+	u := usecase.NewImportUsecase(
+		adapterrepo.NewMemoRepository(sqlxDB),
+		adapterrepo.NewMemoLinkRepository(sqlxDB),
+		adapterrepo.NewTransactor(sqlxDB),
+		// There are no live subscribers in this process; event streams
+		// pick the imported memos up from the event log.
+		adapterrepo.NewMemoEventRepository(sqlxDB),
+		adapterrepo.NewOutboxRepository(sqlxDB),
+		nil,
+		adapterrepo.NewMemoImportRepository(sqlxDB),
+		adapterrepo.NewFileAttachmentRepository(cfg.Storage.AttachmentsDir),
+		cfg.Limits.MemoLimits(),
+	)
+	// An interrupted import keeps what was already committed; running the
+	// command again resumes where it stopped.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	report, importErr := u.Import(ctx, src, *dryRun)
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if report != nil {
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	}
+	if importErr != nil {
+		return importErr
+	}
+	if report.Failed > 0 {
+		return errors.New("some files could not be imported")
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `usage: peconote <command> [arguments]
+
+commands:
+  import [--dry-run] <dir|zip>   import Markdown, JSON, CSV, Evernote and Keep notes
+  migrate [-db memo|users] [-steps n] up|down|status|redo
+                                 apply, roll back or list schema migrations
+  config print [--redacted]      print the effective configuration
+
+Every command takes the server's configuration flags, such as -config and
+-database-url; run a command with -h to list them.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "import":
+		err = runImport(os.Args[2:])
+	case "migrate":
+		err = runMigrate(os.Args[2:])
+	case "config":
+		err = runConfig(os.Args[2:])
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "peconote %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+
+	"github.com/peconote/peconote/internal/infrastructure/config"
+	"github.com/peconote/peconote/internal/infrastructure/db"
+	"github.com/peconote/peconote/internal/infrastructure/migrate"
+)
+
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	database := fs.String("db", "memo", "database to migrate: memo or users")
+	steps := fs.Int("steps", 1, "number of migrations down rolls back")
+	cfg, err := config.Load(fs, args, os.Getenv)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("expected one of up, down, status or redo")
+	}
+
+	m, closeDB, err := openMigrator(cfg, *database)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	switch fs.Arg(0) {
+	case "up":
+		done, err := m.Up(ctx)
+		printMigrations("applied", done)
+		return err
+	case "down":
+		done, err := m.Down(ctx, *steps)
+		printMigrations("rolled back", done)
+		return err
+	case "redo":
+		mig, err := m.Redo(ctx)
+		if err != nil {
+			return err
+		}
+		printMigrations("redone", []migrate.Migration{*mig})
+		return nil
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.UTC().Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown migrate command %q", fs.Arg(0))
+	}
+}
+
+func openMigrator(cfg *config.Config, database string) (*migrate.Migrator, func(), error) {
+	switch database {
+	case "memo":
+		sqlxDB, err := db.OpenMigrations(cfg.Database.URL)
+		if err != nil {
+			return nil, nil, err
+		}
+		m, err := db.MemoMigrator(sqlxDB)
+		if err != nil {
+			sqlxDB.Close()
+			return nil, nil, err
+		}
+		return m, func() { sqlxDB.Close() }, nil
+	case "users":
+		gormDB, err := db.NewDB(cfg.Database.UsersPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		sqlDB, err := gormDB.DB()
+		if err != nil {
+			return nil, nil, err
+		}
+		m, err := db.UserMigrator(gormDB)
+		if err != nil {
+			sqlDB.Close()
+			return nil, nil, err
+		}
+		return m, func() { sqlDB.Close() }, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown database %q", database)
+	}
+}
+
+func printMigrations(verb string, ms []migrate.Migration) {
+	for _, m := range ms {
+		fmt.Printf("%s %04d_%s\n", verb, m.Version, m.Name)
+	}
+}
@@ -0,0 +1,205 @@
+package exporter
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/peconote/peconote/internal/adapter/importer"
+	"github.com/peconote/peconote/internal/domain"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrUnknownFormat = errors.New("unknown export format")
+
+const (
+	FormatJSONL       = "jsonl"
+	FormatMarkdownZip = "markdown-zip"
+	FormatCSV         = "csv"
+)
+
+var ContentTypes = map[string]string{
+	FormatJSONL:       "application/x-ndjson",
+	FormatMarkdownZip: "application/zip",
+	FormatCSV:         "text/csv; charset=utf-8",
+}
+
+var FileExtensions = map[string]string{
+	FormatJSONL:       ".jsonl",
+	FormatMarkdownZip: ".zip",
+	FormatCSV:         ".csv",
+}
+
+// Encoder writes memos one at a time. Close must be called after the last
+// memo to flush buffered output and finish the archive.
+type Encoder interface {
+	Encode(m *domain.Memo) error
+	Close() error
+}
+
+func NewEncoder(format string, w io.Writer) (Encoder, error) {
+	switch format {
+	case FormatJSONL:
+		bw := bufio.NewWriter(w)
+		return &jsonlEncoder{w: bw, enc: json.NewEncoder(bw)}, nil
+	case FormatMarkdownZip:
+		return &markdownZipEncoder{zw: zip.NewWriter(w)}, nil
+	case FormatCSV:
+		return &csvEncoder{w: csv.NewWriter(w)}, nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+func record(m *domain.Memo) importer.Record {
+	tags := m.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return importer.Record{
+		ID:        m.ID.String(),
+		Title:     m.Title,
+		Body:      m.Body,
+		Tags:      tags,
+		Pinned:    m.Pinned,
+		Archived:  m.Archived,
+		Favorite:  m.Favorite,
+		CreatedAt: m.CreatedAt.UTC(),
+		UpdatedAt: m.UpdatedAt.UTC(),
+	}
+}
+
+type jsonlEncoder struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (e *jsonlEncoder) Encode(m *domain.Memo) error {
+	return e.enc.Encode(record(m))
+}
+
+func (e *jsonlEncoder) Close() error {
+	return e.w.Flush()
+}
+
+type csvEncoder struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+func (e *csvEncoder) Encode(m *domain.Memo) error {
+	if !e.wroteHeader {
+		if err := e.w.Write(importer.CSVHeader); err != nil {
+			return err
+		}
+		e.wroteHeader = true
+	}
+	rec := record(m)
+	tags, err := json.Marshal(rec.Tags)
+	if err != nil {
+		return err
+	}
+	return e.w.Write([]string{
+		rec.ID,
+		rec.Title,
+		rec.Body,
+		string(tags),
+		strconv.FormatBool(rec.Pinned),
+		strconv.FormatBool(rec.Archived),
+		strconv.FormatBool(rec.Favorite),
+		rec.CreatedAt.Format(time.RFC3339Nano),
+		rec.UpdatedAt.Format(time.RFC3339Nano),
+	})
+}
+
+func (e *csvEncoder) Close() error {
+	if !e.wroteHeader {
+		if err := e.w.Write(importer.CSVHeader); err != nil {
+			return err
+		}
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type markdownZipEncoder struct {
+	zw *zip.Writer
+}
+
+// markdownFrontMatter mirrors the keys the importer reads back. The id marks
+// the file as a peconote export so its tag list is taken verbatim.
+type markdownFrontMatter struct {
+	ID       string    `yaml:"id"`
+	Title    string    `yaml:"title"`
+	Tags     []string  `yaml:"tags,flow"`
+	Created  time.Time `yaml:"created"`
+	Updated  time.Time `yaml:"updated"`
+	Pinned   bool      `yaml:"pinned,omitempty"`
+	Archived bool      `yaml:"archived,omitempty"`
+	Favorite bool      `yaml:"favorite,omitempty"`
+}
+
+func (e *markdownZipEncoder) Encode(m *domain.Memo) error {
+	rec := record(m)
+	fm, err := yaml.Marshal(markdownFrontMatter{
+		ID:       rec.ID,
+		Title:    rec.Title,
+		Tags:     rec.Tags,
+		Created:  rec.CreatedAt,
+		Updated:  rec.UpdatedAt,
+		Pinned:   rec.Pinned,
+		Archived: rec.Archived,
+		Favorite: rec.Favorite,
+	})
+	if err != nil {
+		return err
+	}
+	w, err := e.zw.CreateHeader(&zip.FileHeader{
+		Name:     markdownFileName(rec.Title, rec.ID),
+		Method:   zip.Deflate,
+		Modified: rec.UpdatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, "---\n"); err != nil {
+		return err
+	}
+	if _, err := w.Write(fm); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "---\n"+rec.Body)
+	return err
+}
+
+func (e *markdownZipEncoder) Close() error {
+	return e.zw.Close()
+}
+
+const maxFileNameRunes = 80
+
+// markdownFileName derives a readable, unique file name from the title. The
+// id prefix keeps names unique without remembering the names already used.
+func markdownFileName(title, id string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case strings.ContainsRune(`/\:*?"<>|#^[]`, r), r < 0x20:
+			return '-'
+		}
+		return r
+	}, strings.TrimSpace(title))
+	name = strings.Trim(name, ". -")
+	if utf8.RuneCountInString(name) > maxFileNameRunes {
+		name = string([]rune(name)[:maxFileNameRunes])
+	}
+	if name == "" {
+		return id + ".md"
+	}
+	return name + " " + id[:8] + ".md"
+}
@@ -0,0 +1,94 @@
+package exporter
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/fs"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/peconote/peconote/internal/adapter/importer"
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/usecase"
+)
+
+func TestEncoders_RoundTrip(t *testing.T) {
+	created := time.Date(2024, 3, 1, 10, 0, 0, 123000000, time.UTC)
+	memos := []*domain.Memo{
+		{ID: uuid.New(), Title: "Plan: Q1/Q2", Body: "# Plan\n\nSee [[Ideas]], \"quoted\", #inline\n", Tags: []string{"work", "a,b"}, Pinned: true, CreatedAt: created, UpdatedAt: created.Add(time.Hour)},
+		{ID: uuid.New(), Title: "Ideas", Body: "line one\nline two", Archived: true, Favorite: true, CreatedAt: created, UpdatedAt: created},
+	}
+	files := map[string]string{FormatJSONL: "export.jsonl", FormatCSV: "export.csv"}
+	for _, format := range []string{FormatJSONL, FormatCSV, FormatMarkdownZip} {
+		var buf bytes.Buffer
+		enc, err := NewEncoder(format, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range memos {
+			if err := enc.Encode(m); err != nil {
+				t.Fatalf("%s: %v", format, err)
+			}
+		}
+		if err := enc.Close(); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+
+		var fsys fs.FS = fstest.MapFS{files[format]: {Data: buf.Bytes()}}
+		if format == FormatMarkdownZip {
+			zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			fsys = zr
+		}
+		var items []usecase.ImportItem
+		err = importer.NewSource(fsys).Each(context.Background(), func(it usecase.ImportItem) error {
+			items = append(items, it)
+			return nil
+		})
+		if err != nil || len(items) != len(memos) {
+			t.Fatalf("%s: unexpected import %v %+v", format, err, items)
+		}
+		for _, it := range items {
+			if it.Err != nil {
+				t.Fatalf("%s: %s: %v", format, it.Path, it.Err)
+			}
+			var m *domain.Memo
+			for _, candidate := range memos {
+				if candidate.Title == it.Title {
+					m = candidate
+				}
+			}
+			if m == nil || it.Body != m.Body || it.Pinned != m.Pinned || it.Archived != m.Archived || it.Favorite != m.Favorite {
+				t.Fatalf("%s: unexpected item %+v", format, it)
+			}
+			if len(m.Tags) > 0 && !reflect.DeepEqual(it.Tags, m.Tags) {
+				t.Fatalf("%s: unexpected tags %q", format, it.Tags)
+			}
+			if !it.CreatedAt.Equal(m.CreatedAt) || !it.UpdatedAt.Equal(m.UpdatedAt) {
+				t.Fatalf("%s: unexpected times %v %v", format, it.CreatedAt, it.UpdatedAt)
+			}
+		}
+	}
+}
+
+func TestNewEncoder_UnknownFormat(t *testing.T) {
+	if _, err := NewEncoder("xml", &bytes.Buffer{}); err != ErrUnknownFormat {
+		t.Fatalf("expected unknown format, got %v", err)
+	}
+}
+
+func TestMarkdownFileName(t *testing.T) {
+	id := "0123456789abcdef"
+	if got := markdownFileName(" a/b: c? ", id); got != "a-b- c 01234567.md" {
+		t.Fatalf("unexpected name %q", got)
+	}
+	if got := markdownFileName("...", id); got != id+".md" {
+		t.Fatalf("unexpected name %q", got)
+	}
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/peconote/peconote/internal/adapter/importer"
+)
+
+// AttachmentHandler serves imported attachments from a directory. Files
+// are sent with the content type of their extension if it is a passive
+// type and as a download otherwise, so an attachment cannot run scripts
+// on the API's origin.
+type AttachmentHandler struct {
+	dir string
+}
+
+func NewAttachmentHandler(dir string) *AttachmentHandler {
+	return &AttachmentHandler{dir: dir}
+}
+
+func (h *AttachmentHandler) GetAttachment(c *gin.Context) {
+	name := c.Param("name")
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "attachment not found"})
+		return
+	}
+	f, err := os.Open(filepath.Join(h.dir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "attachment not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "attachment not found"})
+		return
+	}
+
+	contentType, ok := importer.AttachmentTypes[strings.ToLower(path.Ext(name))]
+	if !ok {
+		contentType = "application/octet-stream"
+	}
+	header := c.Writer.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Content-Security-Policy", "sandbox")
+	if !strings.HasPrefix(contentType, "image/") {
+		header.Set("Content-Disposition", "attachment")
+	}
+	http.ServeContent(c.Writer, c.Request, name, fi.ModTime(), f)
+}
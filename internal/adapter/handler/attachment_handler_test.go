@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gin-gonic/gin"
+	"github.com/peconote/peconote/internal/adapter/importer"
+	"github.com/peconote/peconote/internal/usecase"
+)
+
+func TestAttachmentHandler_ServesImportedFilesSafely(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	resource := func(mime, name, data string) string {
+		return `<resource><data encoding="base64">` + base64.StdEncoding.EncodeToString([]byte(data)) + `</data><mime>` + mime +
+			`</mime><resource-attributes><file-name>` + name + `</file-name></resource-attributes></resource>`
+	}
+	enex := `<?xml version="1.0" encoding="UTF-8"?>
+<en-export><note><title>x</title><content><![CDATA[<en-note>x</en-note>]]></content>` +
+		resource("text/html", "page.html", "<script>alert(1)</script>") +
+		resource("image/svg+xml", "icon.svg", `<svg xmlns="http://www.w3.org/2000/svg" onload="alert(1)"/>`) +
+		resource("image/png", "a.png", "png") +
+		`</note></en-export>`
+
+	dir := t.TempDir()
+	var names []string
+	err := importer.NewSource(fstest.MapFS{"n.enex": {Data: []byte(enex)}}).Each(context.Background(), func(it usecase.ImportItem) error {
+		for _, a := range it.Attachments {
+			names = append(names, a.Name)
+			if err := os.WriteFile(filepath.Join(dir, a.Name), a.Data, 0o644); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil || len(names) != 3 {
+		t.Fatalf("unexpected attachments %v %v", names, err)
+	}
+	// Files saved before attachments were restricted keep their extension.
+	if err := os.WriteFile(filepath.Join(dir, "old.html"), []byte("<script></script>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.GET("/attachments/:name", NewAttachmentHandler(dir).GetAttachment)
+	for _, name := range append(names, "old.html") {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/attachments/"+name, nil))
+		contentType := w.Header().Get("Content-Type")
+		if w.Code != http.StatusOK || w.Header().Get("X-Content-Type-Options") != "nosniff" || w.Header().Get("Content-Security-Policy") != "sandbox" {
+			t.Fatalf("%s: unexpected response %d %v", name, w.Code, w.Header())
+		}
+		if strings.HasSuffix(name, ".png") {
+			if contentType != "image/png" || w.Header().Get("Content-Disposition") != "" {
+				t.Fatalf("%s: expected an inline image, got %v", name, w.Header())
+			}
+			continue
+		}
+		if contentType != "application/octet-stream" || w.Header().Get("Content-Disposition") != "attachment" {
+			t.Fatalf("%s: expected a download, got %v", name, w.Header())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/attachments/.upload-1", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 got %d", w.Code)
+	}
+}
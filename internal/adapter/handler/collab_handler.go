@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/peconote/peconote/internal/domain/ot"
+	"github.com/peconote/peconote/internal/usecase"
+)
+
+const (
+	collabWriteWait  = 10 * time.Second
+	collabPongWait   = 60 * time.Second
+	collabPingPeriod = collabPongWait * 9 / 10
+	collabSendBuffer = 256
+	maxCollabMessage = 64 << 10
+	anonymousUserID  = "anonymous"
+)
+
+var (
+	errCollabSlowClient     = errors.New("client is not keeping up")
+	errCollabInvalidMessage = errors.New("invalid message")
+)
+
+type CollabHandler struct {
+	usecase  usecase.CollabUsecase
+	upgrader websocket.Upgrader
+}
+
+func NewCollabHandler(u usecase.CollabUsecase) *CollabHandler {
+	return &CollabHandler{usecase: u}
+}
+
+// Connect upgrades to a WebSocket on which the memo body is edited together
+// with the other connected clients. Browsers cannot set headers on
+// WebSockets, so the user may also be given as the user_id query parameter.
+func (h *CollabHandler) Connect(c *gin.Context) {
+	memoID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	userID := usecase.UserIDFromContext(c.Request.Context())
+	if userID == "" {
+		userID = c.Query("user_id")
+	}
+	if len(userID) > maxUserIDLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+		return
+	}
+	if userID == "" {
+		userID = anonymousUserID
+	}
+	if !websocket.IsWebSocketUpgrade(c.Request) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "websocket upgrade required"})
+		return
+	}
+
+	client := &collabClient{send: make(chan CollabMessage, collabSendBuffer), done: make(chan struct{})}
+	clientID := uuid.NewString()
+	snap, err := h.usecase.Join(c.Request.Context(), memoID, clientID, userID, client)
+	if err != nil {
+		if errors.Is(err, usecase.ErrMemoNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	defer h.usecase.Leave(memoID, clientID)
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	// The snapshot is written before anything queued since Join, all of
+	// which is newer than it.
+	snapshot := CollabMessage{Type: "snapshot", Revision: &snap.Revision, Body: &snap.Body, ClientID: clientID, Peers: toCollabPeers(snap.Peers)}
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		client.writeLoop(c.Request.Context(), conn, snapshot)
+	}()
+	h.readLoop(c, conn, client, memoID, clientID)
+	client.Close(nil)
+	<-written
+}
+
+// readLoop handles client messages until the connection fails. A rejected
+// operation ends the session; the client reconnects to resynchronize.
+func (h *CollabHandler) readLoop(c *gin.Context, conn *websocket.Conn, client *collabClient, memoID uuid.UUID, clientID string) {
+	conn.SetReadLimit(maxCollabMessage)
+	conn.SetReadDeadline(time.Now().Add(collabPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(collabPongWait))
+	})
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(collabPongWait))
+		var m CollabMessage
+		if err := json.Unmarshal(data, &m); err != nil || m.Type != "op" || m.Revision == nil || m.Operation == nil {
+			client.Close(errCollabInvalidMessage)
+			return
+		}
+		if err := h.usecase.Submit(c.Request.Context(), memoID, clientID, *m.Revision, m.Operation); err != nil {
+			client.Close(err)
+			return
+		}
+	}
+}
+
+// collabClient queues session updates for the connection's writer. It
+// never blocks: a client whose queue is full is disconnected.
+type collabClient struct {
+	send chan CollabMessage
+
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+func (cl *collabClient) push(m CollabMessage) {
+	select {
+	case cl.send <- m:
+	default:
+		cl.Close(errCollabSlowClient)
+	}
+}
+
+func (cl *collabClient) Operation(rev int, op *ot.Operation, clientID string) {
+	cl.push(CollabMessage{Type: "op", Revision: &rev, Operation: op, ClientID: clientID})
+}
+
+func (cl *collabClient) Ack(rev int) {
+	cl.push(CollabMessage{Type: "ack", Revision: &rev})
+}
+
+func (cl *collabClient) Presence(peers []usecase.CollabPeer) {
+	cl.push(CollabMessage{Type: "presence", Peers: toCollabPeers(peers)})
+}
+
+func (cl *collabClient) Close(err error) {
+	cl.once.Do(func() {
+		cl.err = err
+		close(cl.done)
+	})
+}
+
+// writeLoop sends queued messages until the session is closed or ctx ends,
+// as it does when the server shuts down.
+func (cl *collabClient) writeLoop(ctx context.Context, conn *websocket.Conn, first CollabMessage) {
+	defer conn.Close()
+	ticker := time.NewTicker(collabPingPeriod)
+	defer ticker.Stop()
+	write := func(m CollabMessage) error {
+		conn.SetWriteDeadline(time.Now().Add(collabWriteWait))
+		return conn.WriteJSON(m)
+	}
+	if err := write(first); err != nil {
+		return
+	}
+	for {
+		select {
+		case m := <-cl.send:
+			if err := write(m); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(collabWriteWait)); err != nil {
+				return
+			}
+		case <-cl.done:
+			if cl.err != nil {
+				if write(CollabMessage{Type: "error", Error: collabErrorMessage(cl.err)}) != nil {
+					return
+				}
+			}
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(collabWriteWait))
+			return
+		case <-ctx.Done():
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(collabWriteWait))
+			return
+		}
+	}
+}
+
+func collabErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, usecase.ErrCollabRevision), errors.Is(err, usecase.ErrCollabOperation),
+		errors.Is(err, usecase.ErrMemoNotFound), errors.Is(err, errCollabSlowClient), errors.Is(err, errCollabInvalidMessage):
+		return err.Error()
+	}
+	return "internal error"
+}
+
+func toCollabPeers(peers []usecase.CollabPeer) []CollabPeer {
+	out := make([]CollabPeer, len(peers))
+	for i, p := range peers {
+		out[i] = CollabPeer{ClientID: p.ClientID, UserID: p.UserID}
+	}
+	return out
+}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/usecase"
+)
+
+func newCollabServer(memos usecase.MemoUsecase) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(UserID())
+	h := NewCollabHandler(usecase.NewCollabUsecase(memos, time.Hour, usecase.DefaultMemoLimits.MaxBodyBytes))
+	r.GET("/api/memos/:id/collab", h.Connect)
+	return httptest.NewServer(r)
+}
+
+func dialCollab(t *testing.T, srv *httptest.Server, path string, header http.Header) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+path, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readCollab(t *testing.T, conn *websocket.Conn) CollabMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var m CollabMessage
+	if err := conn.ReadJSON(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestCollabHandler(t *testing.T) {
+	id := uuid.New()
+	srv := newCollabServer(&stubMemoUsecase{memo: &domain.Memo{ID: id, Body: "hi"}})
+	defer srv.Close()
+	path := "/api/memos/" + id.String() + "/collab"
+
+	alice := dialCollab(t, srv, path+"?user_id=alice", nil)
+	snap := readCollab(t, alice)
+	if snap.Type != "snapshot" || *snap.Revision != 0 || *snap.Body != "hi" || len(snap.Peers) != 1 || snap.Peers[0].UserID != "alice" {
+		t.Fatalf("unexpected snapshot %+v", snap)
+	}
+
+	bob := dialCollab(t, srv, path, http.Header{UserIDHeader: {"bob"}})
+	if m := readCollab(t, bob); m.Type != "snapshot" || len(m.Peers) != 2 {
+		t.Fatalf("unexpected snapshot %+v", m)
+	}
+	if m := readCollab(t, alice); m.Type != "presence" || len(m.Peers) != 2 || m.Peers[1].UserID != "bob" {
+		t.Fatalf("unexpected presence %+v", m)
+	}
+
+	if err := alice.WriteMessage(websocket.TextMessage, []byte(`{"type":"op","revision":0,"operation":[2," there"]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if m := readCollab(t, alice); m.Type != "ack" || *m.Revision != 1 {
+		t.Fatalf("unexpected ack %+v", m)
+	}
+	m := readCollab(t, bob)
+	op, _ := json.Marshal(m.Operation)
+	if m.Type != "op" || *m.Revision != 1 || m.ClientID != snap.ClientID || string(op) != `[2," there"]` {
+		t.Fatalf("unexpected op %+v", m)
+	}
+
+	if err := bob.WriteMessage(websocket.TextMessage, []byte(`{"type":"op","revision":1,"operation":[3]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if m := readCollab(t, bob); m.Type != "error" || !strings.HasPrefix(m.Error, "invalid operation") {
+		t.Fatalf("unexpected error %+v", m)
+	}
+	if m := readCollab(t, alice); m.Type != "presence" || len(m.Peers) != 1 {
+		t.Fatalf("unexpected presence %+v", m)
+	}
+}
+
+func TestCollabHandler_Errors(t *testing.T) {
+	srv := newCollabServer(&stubMemoUsecase{err: usecase.ErrMemoNotFound})
+	defer srv.Close()
+
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/api/memos/"+uuid.NewString()+"/collab", nil)
+	if err == nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404, got %v %v", resp, err)
+	}
+	for _, path := range []string{"/api/memos/abc/collab", "/api/memos/" + uuid.NewString() + "/collab"} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", path, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// extendDeadlines replaces the server's timeouts for a request that
+// outlives them, such as an event stream, a large export or an upload.
+// The connection gets timeout from now, or no deadline if it is zero. The
+// read deadline is only replaced with read, for requests still receiving
+// their body.
+func extendDeadlines(c *gin.Context, timeout time.Duration, read bool) {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	rc := http.NewResponseController(c.Writer)
+	if read {
+		rc.SetReadDeadline(deadline)
+	}
+	rc.SetWriteDeadline(deadline)
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/peconote/peconote/internal/adapter/exporter"
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/domain/model"
+	"github.com/peconote/peconote/internal/usecase"
+)
+
+type ExportHandler struct {
+	usecase usecase.ExportUsecase
+}
+
+func NewExportHandler(u usecase.ExportUsecase) *ExportHandler {
+	return &ExportHandler{usecase: u}
+}
+
+func (h *ExportHandler) Export(c *gin.Context) {
+	format := c.DefaultQuery("format", exporter.FormatJSONL)
+	contentType, ok := exporter.ContentTypes[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid format"})
+		return
+	}
+	var filter model.MemoFilter
+	if tag, ok := c.GetQuery("tag"); ok {
+		if tag == "" || len(tag) > 30 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tag"})
+			return
+		}
+		filter.Tag = &tag
+	}
+	if err := bindTimeQuery(c, nil, []timeQueryParam{
+		{"created_after", &filter.CreatedAfter},
+		{"created_before", &filter.CreatedBefore},
+		{"updated_after", &filter.UpdatedAfter},
+		{"updated_before", &filter.UpdatedBefore},
+	}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	enc, err := exporter.NewEncoder(format, c.Writer)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid format"})
+		return
+	}
+	extendDeadlines(c, 0, false)
+	filename := "peconote-" + time.Now().UTC().Format("20060102") + exporter.FileExtensions[format]
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	err = h.usecase.ExportMemos(c.Request.Context(), filter, func(m *domain.Memo) error {
+		return enc.Encode(m)
+	})
+	if err == nil {
+		err = enc.Close()
+	}
+	if err != nil {
+		// Once the body has started the status cannot change; the
+		// truncated output is left unterminated so clients can tell.
+		if c.Writer.Written() {
+			c.Error(err)
+			return
+		}
+		c.Writer.Header().Del("Content-Type")
+		c.Writer.Header().Del("Content-Disposition")
+		if errors.Is(err, usecase.ErrInvalidExportQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+	}
+}
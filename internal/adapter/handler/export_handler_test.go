@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/domain/model"
+	"github.com/peconote/peconote/internal/domain/repository"
+	"github.com/peconote/peconote/internal/usecase"
+)
+
+func exportTestRepo(t *testing.T) repository.MemoRepository {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	return seedMemos(t,
+		&domain.Memo{ID: uuid.New(), Title: "one", Body: "first", Tags: []string{"work"}, CreatedAt: base, UpdatedAt: base},
+		&domain.Memo{ID: uuid.New(), Title: "two", Body: "second", Tags: []string{"home"}, Archived: true, CreatedAt: base.AddDate(0, 1, 0), UpdatedAt: base.AddDate(0, 1, 0)},
+		&domain.Memo{ID: uuid.New(), Title: "three", Body: "third", Tags: []string{"work"}, CreatedAt: base.AddDate(0, 2, 0), UpdatedAt: base.AddDate(0, 2, 0)},
+	)
+}
+
+func TestExportHandler_JSONLFiltered(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewExportHandler(usecase.NewExportUsecase(exportTestRepo(t)))
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/export?tag=work&created_after=2024-01-15", nil)
+	h.Export(c)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("unexpected response %d %v", w.Code, w.Header())
+	}
+	if !strings.Contains(w.Header().Get("Content-Disposition"), ".jsonl") {
+		t.Fatalf("unexpected disposition %q", w.Header().Get("Content-Disposition"))
+	}
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], `"title":"three"`) {
+		t.Fatalf("unexpected body %s", w.Body.String())
+	}
+}
+
+func TestExportHandler_CSVIncludesArchived(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewExportHandler(usecase.NewExportUsecase(exportTestRepo(t)))
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/export?format=csv", nil)
+	h.Export(c)
+	rows, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 || rows[0][0] != "id" || rows[2][5] != "true" {
+		t.Fatalf("unexpected csv %q", rows)
+	}
+}
+
+func TestExportHandler_BadRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewExportHandler(usecase.NewExportUsecase(exportTestRepo(t)))
+	for _, q := range []string{"format=xml", "tag=", "created_after=2024-02-01&created_before=2024-01-01"} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/export?"+q, nil)
+		h.Export(c)
+		if w.Code != http.StatusBadRequest || w.Header().Get("Content-Disposition") != "" {
+			t.Fatalf("%s: expected 400 got %d", q, w.Code)
+		}
+	}
+}
+
+type slowExportUsecase struct {
+	usecase.ExportUsecase
+	delay time.Duration
+}
+
+func (s slowExportUsecase) ExportMemos(ctx context.Context, f model.MemoFilter, fn func(*domain.Memo) error) error {
+	time.Sleep(s.delay)
+	return s.ExportUsecase.ExportMemos(ctx, f, fn)
+}
+
+func TestExportHandler_OutlivesWriteTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewExportHandler(slowExportUsecase{usecase.NewExportUsecase(exportTestRepo(t)), 200 * time.Millisecond})
+	r := gin.New()
+	r.GET("/api/export", h.Export)
+	srv := httptest.NewUnstartedServer(r)
+	srv.Config.WriteTimeout = 50 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(body)), "\n"); len(lines) != 3 {
+		t.Fatalf("export cut off: %s", body)
+	}
+}
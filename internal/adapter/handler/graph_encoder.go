@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/peconote/peconote/internal/domain"
+)
+
+type graphEncoder interface {
+	Node(n domain.GraphNode) error
+	Edge(e domain.GraphEdge) error
+	Close() error
+}
+
+var graphContentTypes = map[string]string{
+	"json":    "application/json",
+	"dot":     "text/vnd.graphviz",
+	"graphml": "application/graphml+xml",
+}
+
+func newGraphEncoder(format string, w io.Writer) graphEncoder {
+	bw := bufio.NewWriter(w)
+	switch format {
+	case "dot":
+		return &dotGraphEncoder{w: bw}
+	case "graphml":
+		return &graphMLEncoder{w: bw}
+	default:
+		return &jsonGraphEncoder{w: bw}
+	}
+}
+
+type graphNodeItem struct {
+	ID    string `json:"id"`
+	Kind  string `json:"kind"`
+	Label string `json:"label"`
+}
+
+type graphEdgeItem struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Kind   string `json:"kind"`
+}
+
+// jsonGraphEncoder writes {"nodes":[...],"edges":[...]}. Nodes are always
+// emitted before edges, so the document is produced in a single pass.
+type jsonGraphEncoder struct {
+	w       *bufio.Writer
+	started bool
+	inEdges bool
+	count   int
+}
+
+func (e *jsonGraphEncoder) Node(n domain.GraphNode) error {
+	if !e.started {
+		e.started = true
+		e.w.WriteString(`{"nodes":[`)
+	}
+	return e.write(graphNodeItem{ID: n.ID, Kind: string(n.Kind), Label: n.Label})
+}
+
+func (e *jsonGraphEncoder) Edge(ed domain.GraphEdge) error {
+	e.startEdges()
+	return e.write(graphEdgeItem{Source: ed.Source, Target: ed.Target, Kind: string(ed.Kind)})
+}
+
+func (e *jsonGraphEncoder) Close() error {
+	e.startEdges()
+	e.w.WriteString("]}\n")
+	return e.w.Flush()
+}
+
+func (e *jsonGraphEncoder) startEdges() {
+	if !e.started {
+		e.started = true
+		e.w.WriteString(`{"nodes":[`)
+	}
+	if !e.inEdges {
+		e.inEdges = true
+		e.count = 0
+		e.w.WriteString(`],"edges":[`)
+	}
+}
+
+func (e *jsonGraphEncoder) write(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if e.count > 0 {
+		e.w.WriteByte(',')
+	}
+	e.count++
+	_, err = e.w.Write(b)
+	return err
+}
+
+type dotGraphEncoder struct {
+	w       *bufio.Writer
+	started bool
+}
+
+func (e *dotGraphEncoder) start() {
+	if !e.started {
+		e.started = true
+		e.w.WriteString("digraph peconote {\n")
+	}
+}
+
+func (e *dotGraphEncoder) Node(n domain.GraphNode) error {
+	e.start()
+	shape := "box"
+	if n.Kind == domain.GraphNodeTag {
+		shape = "ellipse"
+	}
+	_, err := fmt.Fprintf(e.w, "  %s [label=%s, kind=%s, shape=%s];\n", dotQuote(n.ID), dotQuote(n.Label), dotQuote(string(n.Kind)), shape)
+	return err
+}
+
+func (e *dotGraphEncoder) Edge(ed domain.GraphEdge) error {
+	e.start()
+	_, err := fmt.Fprintf(e.w, "  %s -> %s [kind=%s];\n", dotQuote(ed.Source), dotQuote(ed.Target), dotQuote(string(ed.Kind)))
+	return err
+}
+
+func (e *dotGraphEncoder) Close() error {
+	e.start()
+	e.w.WriteString("}\n")
+	return e.w.Flush()
+}
+
+func dotQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", "")
+	return `"` + r.Replace(s) + `"`
+}
+
+type graphMLEncoder struct {
+	w       *bufio.Writer
+	started bool
+	edges   int
+}
+
+func (e *graphMLEncoder) start() {
+	if e.started {
+		return
+	}
+	e.started = true
+	e.w.WriteString(xml.Header)
+	e.w.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	e.w.WriteString(`  <key id="kind" for="all" attr.name="kind" attr.type="string"/>` + "\n")
+	e.w.WriteString(`  <key id="label" for="node" attr.name="label" attr.type="string"/>` + "\n")
+	e.w.WriteString(`  <graph id="peconote" edgedefault="directed">` + "\n")
+}
+
+func (e *graphMLEncoder) Node(n domain.GraphNode) error {
+	e.start()
+	_, err := fmt.Fprintf(e.w, "    <node id=\"%s\"><data key=\"kind\">%s</data><data key=\"label\">%s</data></node>\n",
+		xmlEscape(n.ID), xmlEscape(string(n.Kind)), xmlEscape(n.Label))
+	return err
+}
+
+func (e *graphMLEncoder) Edge(ed domain.GraphEdge) error {
+	e.start()
+	e.edges++
+	_, err := fmt.Fprintf(e.w, "    <edge id=\"e%d\" source=\"%s\" target=\"%s\"><data key=\"kind\">%s</data></edge>\n",
+		e.edges, xmlEscape(ed.Source), xmlEscape(ed.Target), xmlEscape(string(ed.Kind)))
+	return err
+}
+
+func (e *graphMLEncoder) Close() error {
+	e.start()
+	e.w.WriteString("  </graph>\n</graphml>\n")
+	return e.w.Flush()
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/peconote/peconote/internal/usecase"
+)
+
+type GraphHandler struct {
+	usecase usecase.GraphUsecase
+}
+
+func NewGraphHandler(u usecase.GraphUsecase) *GraphHandler {
+	return &GraphHandler{usecase: u}
+}
+
+func (h *GraphHandler) GetGraph(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	contentType, ok := graphContentTypes[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid format"})
+		return
+	}
+	var q usecase.GraphQuery
+	if tag, ok := c.GetQuery("tag"); ok {
+		if tag == "" || len(tag) > 30 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tag"})
+			return
+		}
+		q.Tag = &tag
+	}
+	if err := bindTimeQuery(c, nil, []timeQueryParam{
+		{"created_after", &q.CreatedAfter},
+		{"created_before", &q.CreatedBefore},
+	}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	extendDeadlines(c, 0, false)
+	enc := newGraphEncoder(format, c.Writer)
+	c.Header("Content-Type", contentType)
+	if err := h.usecase.StreamGraph(c.Request.Context(), q, enc); err != nil {
+		if c.Writer.Written() {
+			c.Error(err)
+			return
+		}
+		c.Writer.Header().Del("Content-Type")
+		if errors.Is(err, usecase.ErrInvalidGraphQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	if err := enc.Close(); err != nil {
+		c.Error(err)
+	}
+}
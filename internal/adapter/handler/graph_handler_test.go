@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/usecase"
+)
+
+type stubGraphUsecase struct {
+	err   error
+	query *usecase.GraphQuery
+}
+
+func (s *stubGraphUsecase) StreamGraph(ctx context.Context, q usecase.GraphQuery, sink usecase.GraphSink) error {
+	s.query = &q
+	if s.err != nil {
+		return s.err
+	}
+	sink.Node(domain.GraphNode{ID: "memo:1", Kind: domain.GraphNodeMemo, Label: `say "hi"`})
+	sink.Node(domain.GraphNode{ID: "tag:t", Kind: domain.GraphNodeTag, Label: "t"})
+	return sink.Edge(domain.GraphEdge{Source: "memo:1", Target: "tag:t", Kind: domain.GraphEdgeTag})
+}
+
+func TestGetGraphHandler_Formats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := map[string]string{
+		"json":    `{"nodes":[{"id":"memo:1","kind":"memo","label":"say \"hi\""},{"id":"tag:t","kind":"tag","label":"t"}],"edges":[{"source":"memo:1","target":"tag:t","kind":"tag"}]}`,
+		"dot":     `"memo:1" -> "tag:t" [kind="tag"];`,
+		"graphml": `<edge id="e1" source="memo:1" target="tag:t">`,
+	}
+	for format, want := range cases {
+		h := NewGraphHandler(&stubGraphUsecase{})
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/graph?format="+format, nil)
+		h.GetGraph(c)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200 got %d", format, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), want) {
+			t.Fatalf("%s: unexpected body %s", format, w.Body.String())
+		}
+	}
+}
+
+func TestGetGraphHandler_Query(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	stub := &stubGraphUsecase{}
+	h := NewGraphHandler(stub)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/graph?tag=work&created_after=2024-01-01&tz=Asia/Tokyo", nil)
+	h.GetGraph(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d", w.Code)
+	}
+	q := stub.query
+	if q.Tag == nil || *q.Tag != "work" || q.CreatedAfter == nil || q.CreatedAfter.UTC().Format(time.RFC3339) != "2023-12-31T15:00:00Z" || q.CreatedBefore != nil {
+		t.Fatalf("unexpected query %+v", q)
+	}
+}
+
+// Malformed parameters are rejected by the handler before the usecase runs;
+// an inverted date range is rejected by the usecase's validation.
+func TestGetGraphHandler_BadRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, q := range []string{"format=png", "tag=", "created_after=last-week", "created_before=2024-13-01", "tz=Nowhere/City&created_after=2024-01-01",
+		"created_after=2024-01-02T00:00:00Z&created_before=2024-01-01T00:00:00Z"} {
+		stub := &stubGraphUsecase{}
+		h := NewGraphHandler(stub)
+		if strings.Contains(q, "created_before=2024-01-01") {
+			h = NewGraphHandler(usecase.NewGraphUsecase(nil, nil, nil))
+		}
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/graph?"+q, nil)
+		h.GetGraph(c)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400 got %d", q, w.Code)
+		}
+		if stub.query != nil {
+			t.Fatalf("%s: usecase called with %+v", q, stub.query)
+		}
+	}
+}
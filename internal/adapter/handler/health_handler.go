@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const DefaultReadinessTimeout = 2 * time.Second
+
+// Pinger is a dependency checked for readiness, such as *sql.DB.
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+type HealthHandler struct {
+	timeout time.Duration
+	checks  map[string]Pinger
+}
+
+func NewHealthHandler(timeout time.Duration, checks map[string]Pinger) *HealthHandler {
+	return &HealthHandler{timeout: timeout, checks: checks}
+}
+
+// Live reports that the process is serving requests.
+func (h *HealthHandler) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Ready pings every dependency concurrently and fails unless all answer
+// within the timeout.
+func (h *HealthHandler) Ready(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeout)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]string, len(h.checks))
+		ready   = true
+	)
+	for name, p := range h.checks {
+		name, p := name, p
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := p.PingContext(ctx)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				c.Error(fmt.Errorf("%s: %w", name, err))
+				results[name], ready = "unavailable", false
+				return
+			}
+			results[name] = "ok"
+		}()
+	}
+	wg.Wait()
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "not ready", "checks": results})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "checks": results})
+}
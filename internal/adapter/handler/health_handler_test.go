@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type pingFunc func(ctx context.Context) error
+
+func (f pingFunc) PingContext(ctx context.Context) error { return f(ctx) }
+
+func TestHealthHandler_Ready(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ok := pingFunc(func(context.Context) error { return nil })
+	hanging := pingFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	for _, tc := range []struct {
+		name   string
+		checks map[string]Pinger
+		code   int
+		want   map[string]string
+	}{
+		{"ready", map[string]Pinger{"memo": ok, "users": ok}, http.StatusOK, map[string]string{"memo": "ok", "users": "ok"}},
+		{"down", map[string]Pinger{"memo": pingFunc(func(context.Context) error { return errors.New("refused") }), "users": ok}, http.StatusServiceUnavailable, map[string]string{"memo": "unavailable", "users": "ok"}},
+		{"deadline", map[string]Pinger{"memo": hanging}, http.StatusServiceUnavailable, map[string]string{"memo": "unavailable"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewHealthHandler(10*time.Millisecond, tc.checks)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/readyz", nil)
+			h.Ready(c)
+			if w.Code != tc.code {
+				t.Fatalf("expected %d, got %d", tc.code, w.Code)
+			}
+			var body struct {
+				Checks map[string]string `json:"checks"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			for name, want := range tc.want {
+				if body.Checks[name] != want {
+					t.Fatalf("check %s: expected %q, got %q", name, want, body.Checks[name])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/peconote/peconote/internal/usecase"
+)
+
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// idempotencyFinishTimeout bounds storing or releasing a key after the
+// request, which no longer depends on the client's connection.
+const idempotencyFinishTimeout = 5 * time.Second
+
+type capturingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *capturingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *capturingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency replays the stored response for requests that repeat an
+// Idempotency-Key, so that clients can safely retry non-idempotent requests.
+// Keys are scoped by the X-User-ID of the request, so it must run after
+// UserID.
+// Responses with a 5xx status are not stored and the key is released, as it
+// is when the handler panics. Both happen even if the client has gone away,
+// which is when it is most likely to retry.
+func Idempotency(u usecase.IdempotencyUsecase) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		userID := usecase.UserIDFromContext(c.Request.Context())
+		rec, err := u.Begin(c.Request.Context(), key, requestFingerprint(c.Request, userID, body))
+		if err != nil {
+			switch {
+			case errors.Is(err, usecase.ErrInvalidIdempotencyKey):
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			case errors.Is(err, usecase.ErrIdempotencyKeyReused):
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			case errors.Is(err, usecase.ErrIdempotencyInProgress):
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+			default:
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+			}
+			return
+		}
+		if rec != nil {
+			if rec.Location != "" {
+				c.Header("Location", rec.Location)
+			}
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(rec.StatusCode, "application/json; charset=utf-8", rec.ResponseBody)
+			c.Abort()
+			return
+		}
+
+		w := &capturingWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		handled := false
+		defer func() {
+			ctx, cancel := context.WithTimeout(usecase.WithUserID(context.Background(), userID), idempotencyFinishTimeout)
+			defer cancel()
+			var err error
+			if !handled || w.Status() >= http.StatusInternalServerError {
+				err = u.Abort(ctx, key)
+			} else {
+				err = u.Complete(ctx, key, w.Status(), w.Header().Get("Location"), w.body.Bytes())
+			}
+			if err != nil {
+				c.Error(err)
+			}
+		}()
+		c.Next()
+		handled = true
+	}
+}
+
+func requestFingerprint(r *http.Request, userID string, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.Path+"\n"+userID+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
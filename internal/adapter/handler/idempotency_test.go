@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/usecase"
+)
+
+type memoryIdempotencyUsecase struct {
+	records map[string]*domain.IdempotencyRecord
+}
+
+func (m *memoryIdempotencyUsecase) Begin(ctx context.Context, key, fingerprint string) (*domain.IdempotencyRecord, error) {
+	key = usecase.UserIDFromContext(ctx) + "\n" + key
+	rec, ok := m.records[key]
+	if !ok {
+		m.records[key] = &domain.IdempotencyRecord{Key: key, Fingerprint: fingerprint}
+		return nil, nil
+	}
+	if rec.Fingerprint != fingerprint {
+		return nil, usecase.ErrIdempotencyKeyReused
+	}
+	if !rec.Completed {
+		return nil, usecase.ErrIdempotencyInProgress
+	}
+	return rec, nil
+}
+
+func (m *memoryIdempotencyUsecase) Complete(ctx context.Context, key string, statusCode int, location string, body []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	rec := m.records[usecase.UserIDFromContext(ctx)+"\n"+key]
+	rec.Completed, rec.StatusCode, rec.Location, rec.ResponseBody = true, statusCode, location, body
+	return nil
+}
+
+func (m *memoryIdempotencyUsecase) Abort(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	delete(m.records, usecase.UserIDFromContext(ctx)+"\n"+key)
+	return nil
+}
+
+type countingMemoUsecase struct {
+	stubMemoUsecase
+	creates  int
+	onCreate func()
+}
+
+func (s *countingMemoUsecase) CreateMemo(ctx context.Context, title, body string, tags []string) (uuid.UUID, error) {
+	s.creates++
+	if s.onCreate != nil {
+		s.onCreate()
+	}
+	return uuid.New(), nil
+}
+
+func TestIdempotency_ReplaysCreate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	memos := &countingMemoUsecase{}
+	r := gin.New()
+	r.POST("/api/memos", Idempotency(&memoryIdempotencyUsecase{records: map[string]*domain.IdempotencyRecord{}}), NewMemoHandler(memos).CreateMemo)
+
+	send := func(key, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/memos", bytes.NewBufferString(body))
+		req.Header.Set(IdempotencyKeyHeader, key)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	first := send("k1", `{"body":"hi"}`)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("expected 201 got %d", first.Code)
+	}
+	retry := send("k1", `{"body":"hi"}`)
+	if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+		t.Fatalf("expected replayed response, got %d %s", retry.Code, retry.Body.String())
+	}
+	if retry.Header().Get("Location") != first.Header().Get("Location") || retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("expected replayed Location header")
+	}
+	if memos.creates != 1 {
+		t.Fatalf("expected 1 create got %d", memos.creates)
+	}
+	if w := send("k1", `{"body":"other"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 got %d", w.Code)
+	}
+}
+
+func TestIdempotency_FinishesAfterDisconnectAndPanic(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	memos := &countingMemoUsecase{}
+	h := NewMemoHandler(memos)
+	panics := true
+	r := gin.New()
+	r.Use(gin.RecoveryWithWriter(io.Discard))
+	r.POST("/api/memos", Idempotency(&memoryIdempotencyUsecase{records: map[string]*domain.IdempotencyRecord{}}), func(c *gin.Context) {
+		if c.GetHeader(IdempotencyKeyHeader) == "panic" && panics {
+			panics = false
+			panic("boom")
+		}
+		h.CreateMemo(c)
+	})
+
+	send := func(ctx context.Context, key string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/memos", bytes.NewBufferString(`{"body":"hi"}`)).WithContext(ctx)
+		req.Header.Set(IdempotencyKeyHeader, key)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// The client is gone before the response is stored.
+	ctx, cancel := context.WithCancel(context.Background())
+	memos.onCreate = cancel
+	if w := send(ctx, "gone"); w.Code != http.StatusCreated {
+		t.Fatalf("expected 201 got %d", w.Code)
+	}
+	memos.onCreate = nil
+	if w := send(context.Background(), "gone"); w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("expected replayed 201, got %d", w.Code)
+	}
+
+	if w := send(context.Background(), "panic"); w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500 got %d", w.Code)
+	}
+	if w := send(context.Background(), "panic"); w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("expected the key to be released after the panic, got %d", w.Code)
+	}
+	if memos.creates != 2 {
+		t.Fatalf("expected 2 creates got %d", memos.creates)
+	}
+}
+
+func TestIdempotency_KeysAreScopedByUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	memos := &countingMemoUsecase{}
+	r := gin.New()
+	r.Use(UserID())
+	r.POST("/api/memos", Idempotency(&memoryIdempotencyUsecase{records: map[string]*domain.IdempotencyRecord{}}), NewMemoHandler(memos).CreateMemo)
+
+	send := func(user string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/memos", bytes.NewBufferString(`{"body":"hi"}`))
+		req.Header.Set(IdempotencyKeyHeader, "1")
+		req.Header.Set(UserIDHeader, user)
+		r.ServeHTTP(w, req)
+		return w
+	}
+	alice, bob := send("alice"), send("bob")
+	if bob.Code != http.StatusCreated || bob.Header().Get("Idempotent-Replayed") != "" || bob.Body.String() == alice.Body.String() {
+		t.Fatalf("bob got alice's response: %d %s", bob.Code, bob.Body.String())
+	}
+	if retry := send("alice"); retry.Body.String() != alice.Body.String() || memos.creates != 2 {
+		t.Fatalf("expected alice's retry to be replayed, got %s after %d creates", retry.Body.String(), memos.creates)
+	}
+}
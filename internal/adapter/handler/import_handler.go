@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/peconote/peconote/internal/adapter/importer"
+	"github.com/peconote/peconote/internal/usecase"
+)
+
+const MaxImportSize = 32 << 20
+
+// ImportHandler bounds an import, upload included, by its own timeout
+// instead of the server's read and write timeouts, which a large archive
+// would outlive.
+type ImportHandler struct {
+	usecase usecase.ImportUsecase
+	timeout time.Duration
+}
+
+func NewImportHandler(u usecase.ImportUsecase, timeout time.Duration) *ImportHandler {
+	return &ImportHandler{usecase: u, timeout: timeout}
+}
+
+// Import accepts a zip archive either as the raw request body or as the
+// "file" field of a multipart form.
+func (h *ImportHandler) Import(c *gin.Context) {
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid dry_run"})
+		return
+	}
+	extendDeadlines(c, h.timeout, true)
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, MaxImportSize)
+	var src io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		f, _, err := c.Request.FormFile("file")
+		if err != nil {
+			h.uploadError(c, err)
+			return
+		}
+		defer f.Close()
+		src = f
+	}
+
+	tmp, err := os.CreateTemp("", "peconote-import-*.zip")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	n, err := io.Copy(tmp, src)
+	if err != nil {
+		h.uploadError(c, err)
+		return
+	}
+	zr, err := zip.NewReader(tmp, n)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid zip archive"})
+		return
+	}
+
+	report, err := h.usecase.Import(c.Request.Context(), importer.NewSource(zr), dryRun)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func (h *ImportHandler) uploadError(c *gin.Context, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "archive too large"})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "invalid upload"})
+}
@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/peconote/peconote/internal/usecase"
+)
+
+type stubImportUsecase struct {
+	items  []usecase.ImportItem
+	dryRun bool
+}
+
+func (s *stubImportUsecase) Import(ctx context.Context, src usecase.ImportSource, dryRun bool) (*usecase.ImportReport, error) {
+	s.dryRun = dryRun
+	report := &usecase.ImportReport{DryRun: dryRun, Errors: []usecase.ImportFileError{}}
+	err := src.Each(ctx, func(it usecase.ImportItem) error {
+		s.items = append(s.items, it)
+		report.Total++
+		return nil
+	})
+	return report, err
+}
+
+func testZip(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range map[string]string{"notes/a.md": "hello #tag", "notes/b.md": "world"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImportHandler_RawZip(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	u := &stubImportUsecase{}
+	h := NewImportHandler(u, time.Minute)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/import?dry_run=true", bytes.NewReader(testZip(t)))
+	c.Request.Header.Set("Content-Type", "application/zip")
+	h.Import(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+	var report usecase.ImportReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if !u.dryRun || report.Total != 2 || len(u.items) != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
+
+func TestImportHandler_Multipart(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	u := &stubImportUsecase{}
+	h := NewImportHandler(u, time.Minute)
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "vault.zip")
+	fw.Write(testZip(t))
+	mw.Close()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/import", &body)
+	c.Request.Header.Set("Content-Type", mw.FormDataContentType())
+	h.Import(c)
+	if w.Code != http.StatusOK || u.dryRun || len(u.items) != 2 {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestImportHandler_BadRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, q := range []string{"dry_run=maybe", ""} {
+		h := NewImportHandler(&stubImportUsecase{}, time.Minute)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/import?"+q, bytes.NewReader([]byte("not a zip")))
+		h.Import(c)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%q: expected 400 got %d", q, w.Code)
+		}
+	}
+}
+
+func TestImportHandler_SlowUploadOutlivesReadTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	u := &stubImportUsecase{}
+	r := gin.New()
+	r.POST("/api/import", NewImportHandler(u, time.Minute).Import)
+	srv := httptest.NewUnstartedServer(r)
+	srv.Config.ReadTimeout = 100 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	archive := testZip(t)
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write(archive[:10])
+		time.Sleep(300 * time.Millisecond)
+		pw.Write(archive[10:])
+		pw.Close()
+	}()
+	resp, err := http.Post(srv.URL+"/api/import?dry_run=true", "application/zip", pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(u.items) != 2 {
+		t.Fatalf("expected 2 imported items, got %d %v", resp.StatusCode, u.items)
+	}
+}
+
+func TestImportHandler_UploadBoundedByImportTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	u := &stubImportUsecase{}
+	r := gin.New()
+	r.POST("/api/import", NewImportHandler(u, 100*time.Millisecond).Import)
+	srv := httptest.NewUnstartedServer(r)
+	srv.Config.ReadTimeout = time.Hour
+	srv.Start()
+	defer srv.Close()
+
+	archive := testZip(t)
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write(archive[:10])
+		time.Sleep(400 * time.Millisecond)
+		pw.Write(archive[10:])
+		pw.Close()
+	}()
+	resp, err := http.Post(srv.URL+"/api/import?dry_run=true", "application/zip", pr)
+	if err == nil {
+		resp.Body.Close()
+	}
+	if (err == nil && resp.StatusCode == http.StatusOK) || len(u.items) != 0 {
+		t.Fatalf("expected the upload to time out, got %v %v", resp, u.items)
+	}
+}
@@ -1,19 +1,25 @@
 package handler
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/peconote/peconote/internal/domain/model"
+	"github.com/peconote/peconote/internal/domain/ot"
 )
 
+// MemoCreateRequest leaves size checks to the usecase, which applies the
+// configured limits.
 type MemoCreateRequest struct {
-	Body string   `json:"body" binding:"required,max=2000"`
-	Tags []string `json:"tags" binding:"max=10"`
+	Title string   `json:"title"`
+	Body  string   `json:"body" binding:"required"`
+	Tags  []string `json:"tags"`
 }
 
 type MemoUpdateRequest struct {
-	Body string   `json:"body" binding:"required,max=2000"`
-	Tags []string `json:"tags" binding:"max=10"`
+	Title string   `json:"title"`
+	Body  string   `json:"body" binding:"required"`
+	Tags  []string `json:"tags"`
 }
 
 type MemoCreateResponse struct {
@@ -22,8 +28,12 @@ type MemoCreateResponse struct {
 
 type MemoItem struct {
 	ID        string    `json:"id"`
+	Title     string    `json:"title"`
 	Body      string    `json:"body"`
 	Tags      []string  `json:"tags"`
+	Pinned    bool      `json:"pinned"`
+	Archived  bool      `json:"archived"`
+	Favorite  bool      `json:"favorite"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -32,3 +42,114 @@ type MemoListResponse struct {
 	Items      []MemoItem       `json:"items"`
 	Pagination model.Pagination `json:"pagination"`
 }
+
+type MemoLinkItem struct {
+	SourceID  string  `json:"source_id"`
+	TargetRef string  `json:"target_ref"`
+	TargetID  *string `json:"target_id"`
+	Broken    bool    `json:"broken"`
+}
+
+type MemoLinkListResponse struct {
+	Items []MemoLinkItem `json:"items"`
+}
+
+type MemoEventItem struct {
+	ID        int64     `json:"id"`
+	Type      string    `json:"type"`
+	MemoID    string    `json:"memo_id"`
+	Version   int64     `json:"version"`
+	UserID    string    `json:"user_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type MemoBatchRequest struct {
+	Mode       string               `json:"mode" binding:"omitempty,oneof=atomic best_effort"`
+	Operations []MemoBatchOperation `json:"operations" binding:"required,min=1,max=100,dive"`
+}
+
+type MemoBatchOperation struct {
+	Op    string   `json:"op" binding:"required,oneof=create update delete add_tag remove_tag"`
+	ID    string   `json:"id"`
+	Title string   `json:"title"`
+	Body  string   `json:"body"`
+	Tags  []string `json:"tags"`
+	Tag   string   `json:"tag"`
+}
+
+type MemoBatchResult struct {
+	Op     string `json:"op"`
+	ID     string `json:"id,omitempty"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type MemoBatchResponse struct {
+	Mode    string            `json:"mode"`
+	Results []MemoBatchResult `json:"results"`
+}
+
+// CollabMessage is exchanged over the collaborative editing WebSocket.
+// Clients send "op" messages; the server sends "snapshot", "op", "ack",
+// "presence" and "error".
+type CollabMessage struct {
+	Type      string        `json:"type"`
+	Revision  *int          `json:"revision,omitempty"`
+	Operation *ot.Operation `json:"operation,omitempty"`
+	Body      *string       `json:"body,omitempty"`
+	ClientID  string        `json:"client_id,omitempty"`
+	Peers     []CollabPeer  `json:"peers,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+type CollabPeer struct {
+	ClientID string `json:"client_id"`
+	UserID   string `json:"user_id"`
+}
+
+type WebhookCreateRequest struct {
+	URL    string   `json:"url" binding:"required"`
+	Events []string `json:"events" binding:"max=3"`
+	Tag    string   `json:"tag"`
+	Secret string   `json:"secret"`
+}
+
+// WebhookItem includes the secret only in the response to its creation.
+type WebhookItem struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Tag       string    `json:"tag,omitempty"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebhookListResponse struct {
+	Items []WebhookItem `json:"items"`
+}
+
+type WebhookDeliveryItem struct {
+	ID            int64                `json:"id"`
+	WebhookID     string               `json:"webhook_id"`
+	EventID       int64                `json:"event_id"`
+	EventType     string               `json:"event_type"`
+	Status        string               `json:"status"`
+	Attempts      int                  `json:"attempts"`
+	NextAttemptAt *time.Time           `json:"next_attempt_at,omitempty"`
+	LastError     string               `json:"last_error,omitempty"`
+	CreatedAt     time.Time            `json:"created_at"`
+	UpdatedAt     time.Time            `json:"updated_at"`
+	Payload       json.RawMessage      `json:"payload,omitempty"`
+	Log           []WebhookAttemptItem `json:"log,omitempty"`
+}
+
+type WebhookAttemptItem struct {
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type WebhookDeliveryListResponse struct {
+	Items []WebhookDeliveryItem `json:"items"`
+}
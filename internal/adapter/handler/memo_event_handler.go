@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/usecase"
+)
+
+const (
+	UserIDHeader              = "X-User-ID"
+	maxUserIDLength           = 64
+	DefaultMemoEventHeartbeat = 15 * time.Second
+)
+
+// UserID puts the X-User-ID request header into the request context so
+// that changes are attributed to that user.
+func UserID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(UserIDHeader)
+		if len(id) > maxUserIDLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid " + UserIDHeader})
+			return
+		}
+		if id != "" {
+			c.Request = c.Request.WithContext(usecase.WithUserID(c.Request.Context(), id))
+		}
+		c.Next()
+	}
+}
+
+type MemoEventHandler struct {
+	usecase   usecase.MemoEventUsecase
+	heartbeat time.Duration
+}
+
+func NewMemoEventHandler(u usecase.MemoEventUsecase, heartbeat time.Duration) *MemoEventHandler {
+	return &MemoEventHandler{usecase: u, heartbeat: heartbeat}
+}
+
+// Stream serves memo events as server-sent events. Clients resume with the
+// Last-Event-ID header, which EventSource sends on reconnect, or with the
+// last_event_id query parameter.
+func (h *MemoEventHandler) Stream(c *gin.Context) {
+	var q usecase.MemoEventQuery
+	lastID := c.GetHeader("Last-Event-ID")
+	if lastID == "" {
+		lastID = c.Query("last_event_id")
+	}
+	if lastID != "" {
+		id, err := strconv.ParseInt(lastID, 10, 64)
+		if err != nil || id < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid Last-Event-ID"})
+			return
+		}
+		q.After = &id
+	}
+	if userID, ok := c.GetQuery("user_id"); ok {
+		if userID == "" || len(userID) > maxUserIDLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+			return
+		}
+		q.UserID = userID
+	}
+
+	ctx := c.Request.Context()
+	events, err := h.usecase.StreamEvents(ctx, q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	extendDeadlines(c, 0, false)
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	fmt.Fprint(c.Writer, "retry: 3000\n\n")
+	c.Writer.Flush()
+
+	ticker := time.NewTicker(h.heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(toMemoEventItem(e))
+			if err != nil {
+				c.Error(err)
+				return
+			}
+			if _, err := fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(c.Writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+		c.Writer.Flush()
+	}
+}
+
+func toMemoEventItem(e domain.MemoEvent) MemoEventItem {
+	return MemoEventItem{
+		ID:        e.ID,
+		Type:      string(e.Type),
+		MemoID:    e.MemoID.String(),
+		Version:   e.Version,
+		UserID:    e.UserID,
+		CreatedAt: e.CreatedAt,
+	}
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/usecase"
+)
+
+type stubMemoEventUsecase struct {
+	query  usecase.MemoEventQuery
+	events []domain.MemoEvent
+}
+
+func (s *stubMemoEventUsecase) StreamEvents(ctx context.Context, q usecase.MemoEventQuery) (<-chan domain.MemoEvent, error) {
+	s.query = q
+	ch := make(chan domain.MemoEvent, len(s.events))
+	for _, e := range s.events {
+		ch <- e
+	}
+	close(ch)
+	return ch, nil
+}
+
+func TestMemoEventHandler_Stream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	id := uuid.New()
+	u := &stubMemoEventUsecase{events: []domain.MemoEvent{
+		{ID: 7, Type: domain.MemoEventUpdated, MemoID: id, Version: 3, UserID: "alice", CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}}
+	h := NewMemoEventHandler(u, time.Hour)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/memos/events?user_id=alice", nil)
+	c.Request.Header.Set("Last-Event-ID", "6")
+	h.Stream(c)
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected response %d %v", w.Code, w.Header())
+	}
+	if u.query.After == nil || *u.query.After != 6 || u.query.UserID != "alice" {
+		t.Fatalf("unexpected query %+v", u.query)
+	}
+	want := "id: 7\nevent: updated\ndata: {\"id\":7,\"type\":\"updated\",\"memo_id\":\"" + id.String() + "\",\"version\":3,\"user_id\":\"alice\",\"created_at\":\"2024-01-01T00:00:00Z\"}\n\n"
+	if !strings.HasPrefix(w.Body.String(), "retry: 3000\n\n") || !strings.Contains(w.Body.String(), want) {
+		t.Fatalf("unexpected body %q", w.Body.String())
+	}
+}
+
+func TestMemoEventHandler_BadRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, q := range []string{"last_event_id=abc", "last_event_id=-1", "user_id="} {
+		h := NewMemoEventHandler(&stubMemoEventUsecase{}, time.Hour)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/memos/events?"+q, nil)
+		h.Stream(c)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400 got %d", q, w.Code)
+		}
+	}
+}
+
+func TestUserIDMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(UserID())
+	var got string
+	r.GET("/", func(c *gin.Context) { got = usecase.UserIDFromContext(c.Request.Context()) })
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(UserIDHeader, "bob")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	if got != "bob" {
+		t.Fatalf("unexpected user id %q", got)
+	}
+	req.Header.Set(UserIDHeader, strings.Repeat("x", 65))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 got %d", w.Code)
+	}
+}
@@ -1,13 +1,20 @@
 package handler
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/peconote/peconote/internal/adapter/handler/util"
+	"github.com/peconote/peconote/internal/adapter/markdown"
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/domain/model"
 	"github.com/peconote/peconote/internal/usecase"
 )
 
@@ -26,7 +33,7 @@ func (h *MemoHandler) CreateMemo(c *gin.Context) {
 		return
 	}
 
-	id, err := h.usecase.CreateMemo(c.Request.Context(), req.Body, req.Tags)
+	id, err := h.usecase.CreateMemo(c.Request.Context(), req.Title, req.Body, req.Tags)
 	if err != nil {
 		if errors.Is(err, usecase.ErrInvalidMemo) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -48,20 +55,69 @@ func (h *MemoHandler) ListMemos(c *gin.Context) {
 	}
 	sizeStr := c.DefaultQuery("page_size", "20")
 	pageSize, err := strconv.Atoi(sizeStr)
-	if err != nil || pageSize < 1 || pageSize > 100 {
+	// The usecase enforces the configured maximum.
+	if err != nil || pageSize < 1 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid page_size"})
 		return
 	}
-	var tagPtr *string
+	var filter model.MemoFilter
+	params := url.Values{}
+	if q, ok := c.GetQuery("q"); ok {
+		if q == "" || len(q) > 200 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid q"})
+			return
+		}
+		filter.Search = &q
+		params.Set("q", q)
+	}
 	if tag, ok := c.GetQuery("tag"); ok {
 		if tag == "" || len(tag) > 30 {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tag"})
 			return
 		}
-		tagPtr = &tag
+		filter.Tag = &tag
+		params.Set("tag", tag)
+	}
+	for _, f := range []struct {
+		name string
+		dst  **bool
+	}{
+		{"pinned", &filter.Pinned},
+		{"archived", &filter.Archived},
+		{"favorite", &filter.Favorite},
+	} {
+		v, ok := c.GetQuery(f.name)
+		if !ok {
+			continue
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + f.name})
+			return
+		}
+		*f.dst = &b
+		params.Set(f.name, strconv.FormatBool(b))
 	}
 
-	items, pagination, err := h.usecase.ListMemos(c.Request.Context(), page, pageSize, tagPtr)
+	if err := bindTimeQuery(c, params, []timeQueryParam{
+		{"created_after", &filter.CreatedAfter},
+		{"created_before", &filter.CreatedBefore},
+		{"updated_after", &filter.UpdatedAfter},
+		{"updated_before", &filter.UpdatedBefore},
+	}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var sort model.MemoSort
+	if v, ok := c.GetQuery("sort"); ok {
+		if sort, err = model.ParseMemoSort(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sort"})
+			return
+		}
+	}
+
+	items, pagination, err := h.usecase.ListMemos(c.Request.Context(), page, pageSize, filter, sort)
 	if err != nil {
 		if errors.Is(err, usecase.ErrInvalidMemoQuery) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -73,16 +129,10 @@ func (h *MemoHandler) ListMemos(c *gin.Context) {
 
 	resItems := make([]MemoItem, len(items))
 	for i, m := range items {
-		resItems[i] = MemoItem{
-			ID:        m.ID.String(),
-			Body:      m.Body,
-			Tags:      m.Tags,
-			CreatedAt: m.CreatedAt,
-			UpdatedAt: m.UpdatedAt,
-		}
+		resItems[i] = toMemoItem(m)
 	}
 	resp := MemoListResponse{Items: resItems, Pagination: *pagination}
-	if link := util.BuildLinkHeader("/api/memos", resp.Pagination, tagPtr); link != "" {
+	if link := util.BuildLinkHeader("/api/memos", resp.Pagination, params); link != "" {
 		c.Header("Link", link)
 	}
 	c.JSON(http.StatusOK, resp)
@@ -94,6 +144,11 @@ func (h *MemoHandler) GetMemo(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
 		return
 	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "html" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid format"})
+		return
+	}
 	memo, err := h.usecase.GetMemo(c.Request.Context(), id)
 	if err != nil {
 		switch {
@@ -104,13 +159,16 @@ func (h *MemoHandler) GetMemo(c *gin.Context) {
 		}
 		return
 	}
-	c.JSON(http.StatusOK, MemoItem{
-		ID:        memo.ID.String(),
-		Body:      memo.Body,
-		Tags:      memo.Tags,
-		CreatedAt: memo.CreatedAt,
-		UpdatedAt: memo.UpdatedAt,
-	})
+	if format == "html" {
+		html, err := markdown.ToHTML(memo.Body)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+			return
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(html))
+		return
+	}
+	c.JSON(http.StatusOK, toMemoItem(memo))
 }
 
 func (h *MemoHandler) UpdateMemo(c *gin.Context) {
@@ -124,7 +182,7 @@ func (h *MemoHandler) UpdateMemo(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err := h.usecase.UpdateMemo(c.Request.Context(), id, req.Body, req.Tags); err != nil {
+	if err := h.usecase.UpdateMemo(c.Request.Context(), id, req.Title, req.Body, req.Tags); err != nil {
 		switch {
 		case errors.Is(err, usecase.ErrInvalidMemo):
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -155,3 +213,209 @@ func (h *MemoHandler) DeleteMemo(c *gin.Context) {
 	}
 	c.Status(http.StatusNoContent)
 }
+
+func (h *MemoHandler) SetFlag(flag domain.MemoFlag, value bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+		if err := h.usecase.SetMemoFlag(c.Request.Context(), id, flag, value); err != nil {
+			switch {
+			case errors.Is(err, usecase.ErrMemoNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+			}
+			return
+		}
+		c.Status(http.StatusNoContent)
+		c.Writer.WriteHeaderNow()
+	}
+}
+
+func (h *MemoHandler) Batch(c *gin.Context) {
+	var req MemoBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = "atomic"
+	}
+	ops := make([]usecase.BatchOperation, len(req.Operations))
+	for i, o := range req.Operations {
+		ops[i] = usecase.BatchOperation{Op: usecase.BatchOp(o.Op), Title: o.Title, Body: o.Body, Tags: o.Tags, Tag: o.Tag}
+		if ops[i].Op == usecase.BatchCreate {
+			continue
+		}
+		id, err := uuid.Parse(o.ID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid id in operations[%d]", i)})
+			return
+		}
+		ops[i].ID = id
+	}
+
+	atomic := req.Mode == "atomic"
+	results, err := h.usecase.Batch(c.Request.Context(), ops, atomic)
+	if err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrInvalidBatch):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, usecase.ErrAtomicBatchUnsupported):
+			c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	status := http.StatusOK
+	resp := MemoBatchResponse{Mode: req.Mode, Results: make([]MemoBatchResult, len(results))}
+	for i, r := range results {
+		item := MemoBatchResult{Op: string(ops[i].Op), Status: http.StatusOK}
+		if r.ID != uuid.Nil {
+			item.ID = r.ID.String()
+		}
+		switch {
+		case r.Err != nil:
+			item.Status = batchErrorStatus(r.Err)
+			item.Error = r.Err.Error()
+			if item.Status == http.StatusInternalServerError {
+				item.Error = "internal error"
+			}
+			if !atomic {
+				status = http.StatusMultiStatus
+			} else if !errors.Is(r.Err, usecase.ErrBatchAborted) {
+				status = item.Status
+			}
+		case ops[i].Op == usecase.BatchCreate:
+			item.Status = http.StatusCreated
+		}
+		resp.Results[i] = item
+	}
+	c.JSON(status, resp)
+}
+
+func batchErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, usecase.ErrInvalidMemo), errors.Is(err, usecase.ErrInvalidBatch):
+		return http.StatusBadRequest
+	case errors.Is(err, usecase.ErrMemoNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, usecase.ErrBatchAborted):
+		return http.StatusFailedDependency
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (h *MemoHandler) ListLinks(c *gin.Context) {
+	h.listLinks(c, h.usecase.ListLinks)
+}
+
+func (h *MemoHandler) ListBacklinks(c *gin.Context) {
+	h.listLinks(c, h.usecase.ListBacklinks)
+}
+
+func (h *MemoHandler) ListBrokenLinks(c *gin.Context) {
+	links, err := h.usecase.ListBrokenLinks(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, usecase.ErrLinksUnsupported) {
+			c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	c.JSON(http.StatusOK, MemoLinkListResponse{Items: toMemoLinkItems(links)})
+}
+
+func (h *MemoHandler) listLinks(c *gin.Context, list func(ctx context.Context, id uuid.UUID) ([]domain.MemoLink, error)) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	links, err := list(c.Request.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrMemoNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		case errors.Is(err, usecase.ErrLinksUnsupported):
+			c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, MemoLinkListResponse{Items: toMemoLinkItems(links)})
+}
+
+type timeQueryParam struct {
+	name string
+	dst  **time.Time
+}
+
+// bindTimeQuery resolves time query parameters against the time zone given
+// in tz (UTC by default) and records the absolute values in params, so that
+// pagination links do not drift when relative expressions are used.
+func bindTimeQuery(c *gin.Context, params url.Values, specs []timeQueryParam) error {
+	loc := time.UTC
+	if tz, ok := c.GetQuery("tz"); ok {
+		l, err := time.LoadLocation(tz)
+		if err != nil || tz == "" || tz == "Local" {
+			return errors.New("invalid tz")
+		}
+		loc = l
+	}
+	now := time.Now()
+	for _, p := range specs {
+		v, ok := c.GetQuery(p.name)
+		if !ok {
+			continue
+		}
+		t, err := util.ParseTimeExpr(v, now, loc)
+		if err != nil {
+			return errors.New("invalid " + p.name)
+		}
+		*p.dst = &t
+		if params != nil {
+			params.Set(p.name, t.In(loc).Format(time.RFC3339Nano))
+		}
+	}
+	return nil
+}
+
+func toMemoItem(m *domain.Memo) MemoItem {
+	return MemoItem{
+		ID:        m.ID.String(),
+		Title:     m.Title,
+		Body:      m.Body,
+		Tags:      m.Tags,
+		Pinned:    m.Pinned,
+		Archived:  m.Archived,
+		Favorite:  m.Favorite,
+		CreatedAt: m.CreatedAt,
+		UpdatedAt: m.UpdatedAt,
+	}
+}
+
+func toMemoLinkItems(links []domain.MemoLink) []MemoLinkItem {
+	items := make([]MemoLinkItem, len(links))
+	for i, l := range links {
+		items[i] = MemoLinkItem{
+			SourceID:  l.SourceID.String(),
+			TargetRef: l.TargetRef,
+			Broken:    l.Broken(),
+		}
+		if l.TargetID != nil {
+			target := l.TargetID.String()
+			items[i].TargetID = &target
+		}
+	}
+	return items
+}
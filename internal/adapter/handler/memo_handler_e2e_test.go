@@ -2,93 +2,39 @@ package handler
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	adapterrepo "github.com/peconote/peconote/internal/adapter/repository"
 	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/domain/repository"
 	"github.com/peconote/peconote/internal/usecase"
 )
 
-type memoryMemoRepo struct {
-	memos []*domain.Memo
-}
-
-func (m *memoryMemoRepo) Create(ctx context.Context, memo *domain.Memo) error {
-	m.memos = append(m.memos, memo)
-	return nil
-}
-
-func (m *memoryMemoRepo) List(ctx context.Context, tag *string, limit, offset int) ([]*domain.Memo, int, error) {
-	filtered := make([]*domain.Memo, 0, len(m.memos))
-	for _, me := range m.memos {
-		if tag != nil {
-			ok := false
-			for _, t := range me.Tags {
-				if t == *tag {
-					ok = true
-					break
-				}
-			}
-			if !ok {
-				continue
-			}
-		}
-		filtered = append(filtered, me)
-	}
-	total := len(filtered)
-	end := offset + limit
-	if end > total {
-		end = total
-	}
-	if offset > total {
-		return []*domain.Memo{}, total, nil
-	}
-	return filtered[offset:end], total, nil
-}
-
-func (m *memoryMemoRepo) Get(ctx context.Context, id uuid.UUID) (*domain.Memo, error) {
-	for _, me := range m.memos {
-		if me.ID == id {
-			return me, nil
-		}
-	}
-	return nil, sql.ErrNoRows
-}
-
-func (m *memoryMemoRepo) Update(ctx context.Context, memo *domain.Memo) error {
-	for i, me := range m.memos {
-		if me.ID == memo.ID {
-			memo.CreatedAt = me.CreatedAt
-			m.memos[i] = memo
-			return nil
-		}
-	}
-	return sql.ErrNoRows
-}
-
-func (m *memoryMemoRepo) Delete(ctx context.Context, id uuid.UUID) error {
-	for i, me := range m.memos {
-		if me.ID == id {
-			m.memos = append(m.memos[:i], m.memos[i+1:]...)
-			return nil
+func seedMemos(t *testing.T, memos ...*domain.Memo) repository.MemoRepository {
+	t.Helper()
+	repo := adapterrepo.NewMemoryMemoRepository()
+	for _, m := range memos {
+		if err := repo.Create(context.Background(), m); err != nil {
+			t.Fatal(err)
 		}
 	}
-	return sql.ErrNoRows
+	return repo
 }
 
 func TestListMemos_E2E(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	repo := &memoryMemoRepo{}
+	var memos []*domain.Memo
 	now := time.Now()
 	for i := 0; i < 30; i++ {
-		repo.memos = append(repo.memos, &domain.Memo{
+		memos = append(memos, &domain.Memo{
 			ID:        uuid.New(),
 			Body:      fmt.Sprintf("memo %d", i),
 			Tags:      []string{"t"},
@@ -96,7 +42,7 @@ func TestListMemos_E2E(t *testing.T) {
 			UpdatedAt: now.Add(-time.Duration(i) * time.Minute),
 		})
 	}
-	u := usecase.NewMemoUsecase(repo)
+	u := usecase.NewMemoUsecase(seedMemos(t, memos...), nil, nil, nil, nil, nil, usecase.DefaultMemoLimits)
 	h := NewMemoHandler(u)
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
@@ -119,3 +65,129 @@ func TestListMemos_E2E(t *testing.T) {
 		t.Fatalf("items not sorted")
 	}
 }
+
+func TestArchivedMemos_E2E(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var memos []*domain.Memo
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		memos = append(memos, &domain.Memo{ID: uuid.New(), Body: fmt.Sprintf("memo %d", i), CreatedAt: now, UpdatedAt: now})
+	}
+	h := NewMemoHandler(usecase.NewMemoUsecase(seedMemos(t, memos...), nil, nil, nil, nil, nil, usecase.DefaultMemoLimits))
+	r := gin.New()
+	r.GET("/api/memos", h.ListMemos)
+	r.PUT("/api/memos/:id/archived", h.SetFlag(domain.MemoFlagArchived, true))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/api/memos/"+memos[0].ID.String()+"/archived", nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 got %d", w.Code)
+	}
+
+	for query, want := range map[string]int{"": 2, "?archived=true": 1} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/memos"+query, nil))
+		var resp MemoListResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid json: %v", err)
+		}
+		if resp.Pagination.TotalCount != want {
+			t.Fatalf("%q: expected %d memos got %d", query, want, resp.Pagination.TotalCount)
+		}
+	}
+}
+
+func TestListMemosDateRange_E2E(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var memos []*domain.Memo
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		created := now.AddDate(0, 0, -i)
+		memos = append(memos, &domain.Memo{ID: uuid.New(), Body: fmt.Sprintf("memo %d", i), CreatedAt: created, UpdatedAt: created})
+	}
+	h := NewMemoHandler(usecase.NewMemoUsecase(seedMemos(t, memos...), nil, nil, nil, nil, nil, usecase.DefaultMemoLimits))
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/memos?page_size=2&created_after=-7d&tz=Asia/Tokyo", nil)
+	h.ListMemos(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d", w.Code)
+	}
+	var resp MemoListResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if resp.Pagination.TotalCount != 7 {
+		t.Fatalf("expected 7 memos got %d", resp.Pagination.TotalCount)
+	}
+	link := w.Header().Get("Link")
+	if !strings.Contains(link, "created_after=") || strings.Contains(link, "created_after=-7d") {
+		t.Fatalf("expected resolved created_after in Link header: %s", link)
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/memos?created_after=today&created_before=-1d", nil)
+	h.ListMemos(c)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 got %d", w.Code)
+	}
+}
+
+func TestBatchAtomicWithoutTransactions_E2E(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := seedMemos(t)
+	h := NewMemoHandler(usecase.NewMemoUsecase(repo, nil, nil, nil, nil, nil, usecase.DefaultMemoLimits))
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	body := `{"operations":[{"op":"create","body":"kept?"},{"op":"delete","id":"` + uuid.NewString() + `"}]}`
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/memos:batch", strings.NewReader(body))
+	h.Batch(c)
+	if w.Code != http.StatusNotImplemented {
+		t.Fatalf("expected 501 got %d: %s", w.Code, w.Body.String())
+	}
+	if stats, err := repo.Stats(context.Background()); err != nil || stats.Memos != 0 {
+		t.Fatalf("expected no memo to be written, got %+v %v", stats, err)
+	}
+}
+
+func TestMemoLimits_E2E(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limits := usecase.MemoLimits{MaxBodyBytes: 10000, MaxTags: 20, MaxPageSize: 100}
+	h := NewMemoHandler(usecase.NewMemoUsecase(seedMemos(t), nil, nil, nil, nil, nil, limits))
+	r := gin.New()
+	r.POST("/api/memos", h.CreateMemo)
+	r.PUT("/api/memos/:id", h.UpdateMemo)
+	request := func(method, path string, body string, tags int) *httptest.ResponseRecorder {
+		t.Helper()
+		var names []string
+		for i := 0; i < tags; i++ {
+			names = append(names, fmt.Sprintf("%q", fmt.Sprintf("tag%d", i)))
+		}
+		payload := fmt.Sprintf(`{"body":%q,"tags":[%s]}`, body, strings.Join(names, ","))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(payload)))
+		return w
+	}
+
+	// Raised limits allow memos beyond the defaults.
+	w := request(http.MethodPost, "/api/memos", strings.Repeat("a", 5000), 15)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201 got %d: %s", w.Code, w.Body.String())
+	}
+	var created MemoCreateResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if w := request(http.MethodPut, "/api/memos/"+created.ID, strings.Repeat("b", 10000), 20); w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 got %d: %s", w.Code, w.Body.String())
+	}
+	for _, tc := range []struct {
+		body string
+		tags int
+	}{{strings.Repeat("a", 10001), 1}, {"a", 21}} {
+		if w := request(http.MethodPost, "/api/memos", tc.body, tc.tags); w.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %d bytes and %d tags, got %d", len(tc.body), tc.tags, w.Code)
+		}
+	}
+}
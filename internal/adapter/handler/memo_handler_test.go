@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -22,13 +23,15 @@ type stubMemoUsecase struct {
 	items      []*domain.Memo
 	pagination *model.Pagination
 	memo       *domain.Memo
+	links      []domain.MemoLink
+	results    []usecase.BatchResult
 }
 
-func (s *stubMemoUsecase) CreateMemo(ctx context.Context, body string, tags []string) (uuid.UUID, error) {
+func (s *stubMemoUsecase) CreateMemo(ctx context.Context, title, body string, tags []string) (uuid.UUID, error) {
 	return s.id, s.err
 }
 
-func (s *stubMemoUsecase) ListMemos(ctx context.Context, page, pageSize int, tag *string) ([]*domain.Memo, *model.Pagination, error) {
+func (s *stubMemoUsecase) ListMemos(ctx context.Context, page, pageSize int, f model.MemoFilter, sort model.MemoSort) ([]*domain.Memo, *model.Pagination, error) {
 	return s.items, s.pagination, s.err
 }
 
@@ -36,7 +39,11 @@ func (s *stubMemoUsecase) GetMemo(ctx context.Context, id uuid.UUID) (*domain.Me
 	return s.memo, s.err
 }
 
-func (s *stubMemoUsecase) UpdateMemo(ctx context.Context, id uuid.UUID, body string, tags []string) error {
+func (s *stubMemoUsecase) UpdateMemo(ctx context.Context, id uuid.UUID, title, body string, tags []string) error {
+	return s.err
+}
+
+func (s *stubMemoUsecase) ReplaceMemoBody(ctx context.Context, id uuid.UUID, base, body string) error {
 	return s.err
 }
 
@@ -44,6 +51,26 @@ func (s *stubMemoUsecase) DeleteMemo(ctx context.Context, id uuid.UUID) error {
 	return s.err
 }
 
+func (s *stubMemoUsecase) SetMemoFlag(ctx context.Context, id uuid.UUID, flag domain.MemoFlag, value bool) error {
+	return s.err
+}
+
+func (s *stubMemoUsecase) Batch(ctx context.Context, ops []usecase.BatchOperation, atomic bool) ([]usecase.BatchResult, error) {
+	return s.results, s.err
+}
+
+func (s *stubMemoUsecase) ListLinks(ctx context.Context, id uuid.UUID) ([]domain.MemoLink, error) {
+	return s.links, s.err
+}
+
+func (s *stubMemoUsecase) ListBacklinks(ctx context.Context, id uuid.UUID) ([]domain.MemoLink, error) {
+	return s.links, s.err
+}
+
+func (s *stubMemoUsecase) ListBrokenLinks(ctx context.Context) ([]domain.MemoLink, error) {
+	return s.links, s.err
+}
+
 func TestCreateMemoHandler_Success(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	id := uuid.New()
@@ -111,6 +138,54 @@ func TestListMemosHandler_BadRequest(t *testing.T) {
 	}
 }
 
+func TestListMemosHandler_Sort(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	stub := &stubMemoUsecase{items: []*domain.Memo{}, pagination: &model.Pagination{Page: 2, PageSize: 1, TotalPages: 2, TotalCount: 2, Sort: "-relevance"}}
+	h := NewMemoHandler(stub)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/memos?page=2&page_size=1&q=go&sort=-relevance", nil)
+	h.ListMemos(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d", w.Code)
+	}
+	if link := w.Header().Get("Link"); link != "</api/memos?page=1&page_size=1&q=go&sort=-relevance>; rel=\"prev\"" {
+		t.Fatalf("unexpected Link header: %s", link)
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/memos?sort=id", nil)
+	h.ListMemos(c)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 got %d", w.Code)
+	}
+}
+
+func TestListMemosHandler_FlagFilters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	stub := &stubMemoUsecase{items: []*domain.Memo{}, pagination: &model.Pagination{Page: 1, PageSize: 1, TotalPages: 2, TotalCount: 2}}
+	h := NewMemoHandler(stub)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/memos?page_size=1&pinned=1&tag=a+b", nil)
+	h.ListMemos(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d", w.Code)
+	}
+	if link := w.Header().Get("Link"); link != "</api/memos?page=2&page_size=1&pinned=true&tag=a+b>; rel=\"next\"" {
+		t.Fatalf("unexpected Link header: %s", link)
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/memos?archived=maybe", nil)
+	h.ListMemos(c)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 got %d", w.Code)
+	}
+}
+
 func TestGetMemoHandler_Success(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	id := uuid.New()
@@ -134,6 +209,29 @@ func TestGetMemoHandler_Success(t *testing.T) {
 	}
 }
 
+func TestGetMemoHandler_HTML(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	id := uuid.New()
+	now := time.Now()
+	memo := &domain.Memo{ID: id, Body: "# Hi\n\n**bold**\n\n<script>x</script>", CreatedAt: now, UpdatedAt: now}
+	h := NewMemoHandler(&stubMemoUsecase{memo: memo})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = gin.Params{gin.Param{Key: "id", Value: id.String()}}
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/memos/"+id.String()+"?format=html", nil)
+	h.GetMemo(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Fatalf("unexpected content type %s", ct)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "<h1>Hi</h1>") || !strings.Contains(body, "<strong>bold</strong>") || strings.Contains(body, "<script") {
+		t.Fatalf("unexpected html: %s", body)
+	}
+}
+
 func TestGetMemoHandler_NotFound(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	id := uuid.New()
@@ -157,6 +255,8 @@ func TestUpdateMemoHandler_Success(t *testing.T) {
 	c.Params = gin.Params{gin.Param{Key: "id", Value: id.String()}}
 	c.Request = httptest.NewRequest(http.MethodPut, "/api/memos/"+id.String(), bytes.NewBufferString(`{"body":"hi","tags":["t"]}`))
 	h.UpdateMemo(c)
+	// The engine writes the status after the handlers.
+	c.Writer.WriteHeaderNow()
 	if w.Code != http.StatusNoContent {
 		t.Fatalf("expected 204 got %d", w.Code)
 	}
@@ -176,6 +276,28 @@ func TestUpdateMemoHandler_UsecaseError(t *testing.T) {
 	}
 }
 
+func TestSetFlagHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	id := uuid.New()
+	for _, tc := range []struct {
+		err  error
+		code int
+	}{
+		{nil, http.StatusNoContent},
+		{usecase.ErrMemoNotFound, http.StatusNotFound},
+	} {
+		h := NewMemoHandler(&stubMemoUsecase{err: tc.err})
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = gin.Params{gin.Param{Key: "id", Value: id.String()}}
+		c.Request = httptest.NewRequest(http.MethodPut, "/api/memos/"+id.String()+"/pinned", nil)
+		h.SetFlag(domain.MemoFlagPinned, true)(c)
+		if w.Code != tc.code {
+			t.Fatalf("expected %d got %d", tc.code, w.Code)
+		}
+	}
+}
+
 func TestDeleteMemoHandler_Success(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	id := uuid.New()
@@ -185,6 +307,8 @@ func TestDeleteMemoHandler_Success(t *testing.T) {
 	c.Params = gin.Params{gin.Param{Key: "id", Value: id.String()}}
 	c.Request = httptest.NewRequest(http.MethodDelete, "/api/memos/"+id.String(), nil)
 	h.DeleteMemo(c)
+	// The engine writes the status after the handlers.
+	c.Writer.WriteHeaderNow()
 	if w.Code != http.StatusNoContent {
 		t.Fatalf("expected 204 got %d", w.Code)
 	}
@@ -203,3 +327,127 @@ func TestDeleteMemoHandler_NotFound(t *testing.T) {
 		t.Fatalf("expected 404 got %d", w.Code)
 	}
 }
+
+func TestListBacklinksHandler_Success(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	id := uuid.New()
+	source := uuid.New()
+	links := []domain.MemoLink{{SourceID: source, TargetRef: id.String(), TargetID: &id}}
+	h := NewMemoHandler(&stubMemoUsecase{links: links})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = gin.Params{gin.Param{Key: "id", Value: id.String()}}
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/memos/"+id.String()+"/backlinks", nil)
+	h.ListBacklinks(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d", w.Code)
+	}
+	var resp MemoLinkListResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if len(resp.Items) != 1 || resp.Items[0].SourceID != source.String() || resp.Items[0].Broken {
+		t.Fatalf("unexpected items: %+v", resp.Items)
+	}
+}
+
+func TestListLinksHandler_NotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	id := uuid.New()
+	h := NewMemoHandler(&stubMemoUsecase{err: usecase.ErrMemoNotFound})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = gin.Params{gin.Param{Key: "id", Value: id.String()}}
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/memos/"+id.String()+"/links", nil)
+	h.ListLinks(c)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 got %d", w.Code)
+	}
+}
+
+func TestLinkHandlers_Unsupported(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewMemoHandler(&stubMemoUsecase{err: usecase.ErrLinksUnsupported})
+	r := gin.New()
+	r.GET("/api/memos/:id/links", h.ListLinks)
+	r.GET("/api/links/broken", h.ListBrokenLinks)
+	for _, path := range []string{"/api/memos/" + uuid.NewString() + "/links", "/api/links/broken"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusNotImplemented {
+			t.Fatalf("%s: expected 501 got %d", path, w.Code)
+		}
+	}
+}
+
+func TestBatchHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	id := uuid.New()
+	cases := []struct {
+		name    string
+		body    string
+		results []usecase.BatchResult
+		code    int
+		items   []int
+	}{
+		{
+			name:    "atomic success",
+			body:    `{"operations":[{"op":"create","body":"a"},{"op":"add_tag","id":"` + id.String() + `","tag":"t"}]}`,
+			results: []usecase.BatchResult{{ID: id}, {ID: id}},
+			code:    http.StatusOK,
+			items:   []int{http.StatusCreated, http.StatusOK},
+		},
+		{
+			name:    "atomic failure",
+			body:    `{"mode":"atomic","operations":[{"op":"create","body":"a"},{"op":"delete","id":"` + id.String() + `"}]}`,
+			results: []usecase.BatchResult{{ID: id, Err: usecase.ErrBatchAborted}, {ID: id, Err: usecase.ErrMemoNotFound}},
+			code:    http.StatusNotFound,
+			items:   []int{http.StatusFailedDependency, http.StatusNotFound},
+		},
+		{
+			name:    "best effort partial",
+			body:    `{"mode":"best_effort","operations":[{"op":"create","body":""},{"op":"delete","id":"` + id.String() + `"}]}`,
+			results: []usecase.BatchResult{{Err: usecase.ErrInvalidMemo}, {ID: id}},
+			code:    http.StatusMultiStatus,
+			items:   []int{http.StatusBadRequest, http.StatusOK},
+		},
+	}
+	for _, tc := range cases {
+		h := NewMemoHandler(&stubMemoUsecase{results: tc.results})
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/memos:batch", bytes.NewBufferString(tc.body))
+		h.Batch(c)
+		if w.Code != tc.code {
+			t.Fatalf("%s: expected %d got %d", tc.name, tc.code, w.Code)
+		}
+		var resp MemoBatchResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: invalid json: %v", tc.name, err)
+		}
+		for i, want := range tc.items {
+			if resp.Results[i].Status != want {
+				t.Fatalf("%s: item %d expected %d got %d", tc.name, i, want, resp.Results[i].Status)
+			}
+		}
+	}
+}
+
+func TestBatchHandler_BadRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, body := range []string{
+		`{"operations":[]}`,
+		`{"operations":[{"op":"merge"}]}`,
+		`{"operations":[{"op":"delete","id":"nope"}]}`,
+		`{"mode":"eventually","operations":[{"op":"create","body":"a"}]}`,
+	} {
+		h := NewMemoHandler(&stubMemoUsecase{})
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/memos:batch", bytes.NewBufferString(body))
+		h.Batch(c)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400 got %d", body, w.Code)
+		}
+	}
+}
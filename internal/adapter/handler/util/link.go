@@ -8,18 +8,25 @@ import (
 	"github.com/peconote/peconote/internal/domain/model"
 )
 
-func BuildLinkHeader(base string, p model.Pagination, tag *string) string {
+func BuildLinkHeader(base string, p model.Pagination, params url.Values) string {
 	var links []string
-	tagParam := ""
-	if tag != nil {
-		tagParam = "&tag=" + url.QueryEscape(*tag)
+	query := url.Values{}
+	for k, v := range params {
+		query[k] = v
+	}
+	if p.Sort != "" {
+		query.Set("sort", p.Sort)
+	}
+	extra := ""
+	if len(query) > 0 {
+		extra = "&" + query.Encode()
 	}
 	if p.Page < p.TotalPages {
-		next := fmt.Sprintf("%s?page=%d&page_size=%d%s", base, p.Page+1, p.PageSize, tagParam)
+		next := fmt.Sprintf("%s?page=%d&page_size=%d%s", base, p.Page+1, p.PageSize, extra)
 		links = append(links, fmt.Sprintf("<%s>; rel=\"next\"", next))
 	}
 	if p.Page > 1 {
-		prev := fmt.Sprintf("%s?page=%d&page_size=%d%s", base, p.Page-1, p.PageSize, tagParam)
+		prev := fmt.Sprintf("%s?page=%d&page_size=%d%s", base, p.Page-1, p.PageSize, extra)
 		links = append(links, fmt.Sprintf("<%s>; rel=\"prev\"", prev))
 	}
 	return strings.Join(links, ", ")
@@ -0,0 +1,57 @@
+package util
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var ErrInvalidTimeExpr = errors.New("invalid time expression")
+
+var relativeTimePattern = regexp.MustCompile(`^([+-])(\d+)([mhdw])$`)
+
+// ParseTimeExpr resolves an RFC 3339 timestamp, a date (YYYY-MM-DD), one of
+// now/today/yesterday/tomorrow, or an offset from now such as -7d or +2h.
+// Dates and day keywords are midnight in loc.
+func ParseTimeExpr(s string, now time.Time, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, loc); err == nil {
+		return t, nil
+	}
+	now = now.In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	switch s {
+	case "now":
+		return now, nil
+	case "today":
+		return today, nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), nil
+	}
+	m := relativeTimePattern.FindStringSubmatch(s)
+	if m == nil {
+		return time.Time{}, ErrInvalidTimeExpr
+	}
+	n, err := strconv.Atoi(m[2])
+	if err != nil {
+		return time.Time{}, ErrInvalidTimeExpr
+	}
+	if m[1] == "-" {
+		n = -n
+	}
+	switch m[3] {
+	case "m":
+		return now.Add(time.Duration(n) * time.Minute), nil
+	case "h":
+		return now.Add(time.Duration(n) * time.Hour), nil
+	case "d":
+		return now.AddDate(0, 0, n), nil
+	default:
+		return now.AddDate(0, 0, 7*n), nil
+	}
+}
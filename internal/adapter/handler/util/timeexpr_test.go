@@ -0,0 +1,38 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeExpr(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	now := time.Date(2024, 3, 10, 20, 30, 0, 0, time.UTC) // 2024-03-11 05:30 in Tokyo
+	cases := map[string]time.Time{
+		"2024-01-02T03:04:05Z": time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		"2024-01-02":           time.Date(2024, 1, 2, 0, 0, 0, 0, tokyo),
+		"now":                  now,
+		"today":                time.Date(2024, 3, 11, 0, 0, 0, 0, tokyo),
+		"yesterday":            time.Date(2024, 3, 10, 0, 0, 0, 0, tokyo),
+		"-7d":                  now.AddDate(0, 0, -7),
+		"+2h":                  now.Add(2 * time.Hour),
+		"-1w":                  now.AddDate(0, 0, -7),
+	}
+	for expr, want := range cases {
+		got, err := ParseTimeExpr(expr, now, tokyo)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", expr, err)
+		}
+		if !got.Equal(want) {
+			t.Fatalf("%s: expected %s got %s", expr, want, got)
+		}
+	}
+	for _, expr := range []string{"", "last week", "7d", "-7y"} {
+		if _, err := ParseTimeExpr(expr, now, tokyo); err == nil {
+			t.Fatalf("%q: expected error", expr)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/usecase"
+)
+
+type WebhookHandler struct {
+	usecase usecase.WebhookUsecase
+}
+
+func NewWebhookHandler(u usecase.WebhookUsecase) *WebhookHandler {
+	return &WebhookHandler{usecase: u}
+}
+
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	var req WebhookCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	events := make([]domain.MemoEventType, len(req.Events))
+	for i, e := range req.Events {
+		events[i] = domain.MemoEventType(e)
+	}
+	w, err := h.usecase.CreateWebhook(c.Request.Context(), req.URL, events, req.Tag, req.Secret)
+	if err != nil {
+		if errors.Is(err, usecase.ErrInvalidWebhook) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	item := toWebhookItem(*w)
+	item.Secret = w.Secret
+	c.Header("Location", "/api/webhooks/"+w.ID.String())
+	c.JSON(http.StatusCreated, item)
+}
+
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	hooks, err := h.usecase.ListWebhooks(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	items := make([]WebhookItem, len(hooks))
+	for i, w := range hooks {
+		items[i] = toWebhookItem(w)
+	}
+	c.JSON(http.StatusOK, WebhookListResponse{Items: items})
+}
+
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if err := h.usecase.DeleteWebhook(c.Request.Context(), id); err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+	deliveries, err := h.usecase.ListDeliveries(c.Request.Context(), id, limit)
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	items := make([]WebhookDeliveryItem, len(deliveries))
+	for i, d := range deliveries {
+		items[i] = toWebhookDeliveryItem(d)
+	}
+	c.JSON(http.StatusOK, WebhookDeliveryListResponse{Items: items})
+}
+
+// GetDelivery returns a delivery with its payload and the log of attempts.
+func (h *WebhookHandler) GetDelivery(c *gin.Context) {
+	id, deliveryID, ok := deliveryParams(c)
+	if !ok {
+		return
+	}
+	d, attempts, err := h.usecase.GetDelivery(c.Request.Context(), id, deliveryID)
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	item := toWebhookDeliveryItem(*d)
+	item.Payload = d.Payload
+	item.Log = make([]WebhookAttemptItem, len(attempts))
+	for i, a := range attempts {
+		item.Log[i] = WebhookAttemptItem{StatusCode: a.StatusCode, Error: a.Error, DurationMS: a.Duration.Milliseconds(), CreatedAt: a.CreatedAt}
+	}
+	c.JSON(http.StatusOK, item)
+}
+
+func (h *WebhookHandler) Redeliver(c *gin.Context) {
+	id, deliveryID, ok := deliveryParams(c)
+	if !ok {
+		return
+	}
+	if err := h.usecase.Redeliver(c.Request.Context(), id, deliveryID); err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+func deliveryParams(c *gin.Context) (uuid.UUID, int64, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return uuid.Nil, 0, false
+	}
+	deliveryID, err := strconv.ParseInt(c.Param("delivery_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid delivery id"})
+		return uuid.Nil, 0, false
+	}
+	return id, deliveryID, true
+}
+
+func webhookError(c *gin.Context, err error) {
+	if errors.Is(err, usecase.ErrWebhookNotFound) || errors.Is(err, usecase.ErrWebhookDeliveryNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+}
+
+func toWebhookItem(w domain.Webhook) WebhookItem {
+	events := make([]string, len(w.Events))
+	for i, e := range w.Events {
+		events[i] = string(e)
+	}
+	return WebhookItem{ID: w.ID.String(), URL: w.URL, Events: events, Tag: w.Tag, CreatedAt: w.CreatedAt}
+}
+
+func toWebhookDeliveryItem(d domain.WebhookDelivery) WebhookDeliveryItem {
+	item := WebhookDeliveryItem{
+		ID:        d.ID,
+		WebhookID: d.WebhookID.String(),
+		EventID:   d.EventID,
+		EventType: string(d.EventType),
+		Status:    string(d.Status),
+		Attempts:  d.Attempts,
+		LastError: d.LastError,
+		CreatedAt: d.CreatedAt,
+		UpdatedAt: d.UpdatedAt,
+	}
+	if d.Status == domain.WebhookDeliveryPending {
+		next := d.NextAttemptAt
+		item.NextAttemptAt = &next
+	}
+	return item
+}
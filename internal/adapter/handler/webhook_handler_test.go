@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/usecase"
+)
+
+type stubWebhookUsecase struct {
+	usecase.WebhookUsecase
+	hooks       []domain.Webhook
+	redelivered int64
+}
+
+func (s *stubWebhookUsecase) CreateWebhook(ctx context.Context, rawURL string, events []domain.MemoEventType, tag, secret string) (*domain.Webhook, error) {
+	if !strings.HasPrefix(rawURL, "http") {
+		return nil, usecase.ErrInvalidWebhook
+	}
+	w := domain.Webhook{ID: uuid.New(), URL: rawURL, Events: events, Tag: tag, Secret: "generated"}
+	s.hooks = append(s.hooks, w)
+	return &w, nil
+}
+
+func (s *stubWebhookUsecase) ListWebhooks(ctx context.Context) ([]domain.Webhook, error) {
+	return s.hooks, nil
+}
+
+func (s *stubWebhookUsecase) GetDelivery(ctx context.Context, webhookID uuid.UUID, id int64) (*domain.WebhookDelivery, []domain.WebhookAttempt, error) {
+	if id != 1 {
+		return nil, nil, usecase.ErrWebhookDeliveryNotFound
+	}
+	d := &domain.WebhookDelivery{ID: 1, WebhookID: webhookID, Status: domain.WebhookDeliveryDead, Attempts: 2, Payload: []byte(`{"id":9}`)}
+	return d, []domain.WebhookAttempt{{StatusCode: 500, Error: "unexpected status 500", Duration: 20 * time.Millisecond}, {Error: "timeout"}}, nil
+}
+
+func (s *stubWebhookUsecase) Redeliver(ctx context.Context, webhookID uuid.UUID, id int64) error {
+	if id != 1 {
+		return usecase.ErrWebhookDeliveryNotFound
+	}
+	s.redelivered = id
+	return nil
+}
+
+func newWebhookRouter(u usecase.WebhookUsecase) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	h := NewWebhookHandler(u)
+	r.POST("/api/webhooks", h.CreateWebhook)
+	r.GET("/api/webhooks", h.ListWebhooks)
+	r.GET("/api/webhooks/:id/deliveries/:delivery_id", h.GetDelivery)
+	r.POST("/api/webhooks/:id/deliveries/:delivery_id/redeliver", h.Redeliver)
+	return r
+}
+
+func TestWebhookHandler_CreateAndList(t *testing.T) {
+	r := newWebhookRouter(&stubWebhookUsecase{})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/webhooks", strings.NewReader(`{"url":"https://example.com/hook","events":["created"],"tag":"ci"}`)))
+	var created WebhookItem
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if w.Code != http.StatusCreated || created.Secret != "generated" || created.Events[0] != "created" || created.Tag != "ci" {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/webhooks", nil))
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "generated") || !strings.Contains(w.Body.String(), created.ID) {
+		t.Fatalf("unexpected list %d %s", w.Code, w.Body.String())
+	}
+
+	for _, body := range []string{`{}`, `{"url":"ftp://example.com"}`} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/webhooks", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400 got %d", body, w.Code)
+		}
+	}
+}
+
+func TestWebhookHandler_DeliveryLogAndRedeliver(t *testing.T) {
+	u := &stubWebhookUsecase{}
+	r := newWebhookRouter(u)
+	base := "/api/webhooks/" + uuid.NewString() + "/deliveries/"
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, base+"1", nil))
+	var item WebhookDeliveryItem
+	json.Unmarshal(w.Body.Bytes(), &item)
+	if w.Code != http.StatusOK || item.Status != "dead" || string(item.Payload) != `{"id":9}` || len(item.Log) != 2 || item.Log[0].DurationMS != 20 || item.NextAttemptAt != nil {
+		t.Fatalf("unexpected delivery %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, base+"1/redeliver", nil))
+	if w.Code != http.StatusAccepted || u.redelivered != 1 {
+		t.Fatalf("expected 202 got %d", w.Code)
+	}
+	for path, code := range map[string]int{base + "2/redeliver": http.StatusNotFound, base + "x/redeliver": http.StatusBadRequest} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+		if w.Code != code {
+			t.Fatalf("%s: expected %d got %d", path, code, w.Code)
+		}
+	}
+}
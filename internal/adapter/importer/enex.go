@@ -0,0 +1,164 @@
+package importer
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/peconote/peconote/internal/usecase"
+)
+
+// AttachmentURLPrefix is the path under which imported attachments are
+// served; memo bodies link to attachments below it.
+const AttachmentURLPrefix = "/attachments/"
+
+const enexTimeLayout = "20060102T150405Z"
+
+type enexNote struct {
+	Title     string         `xml:"title"`
+	Content   string         `xml:"content"`
+	Created   string         `xml:"created"`
+	Updated   string         `xml:"updated"`
+	Tags      []string       `xml:"tag"`
+	Resources []enexResource `xml:"resource"`
+}
+
+type enexResource struct {
+	Data     string `xml:"data"`
+	Mime     string `xml:"mime"`
+	FileName string `xml:"resource-attributes>file-name"`
+}
+
+// readENEX decodes an Evernote export one <note> at a time, so only the
+// note being converted is held in memory.
+func (s *Source) readENEX(p string, fn func(usecase.ImportItem) error) error {
+	f, err := s.fsys.Open(p)
+	if err != nil {
+		return fn(usecase.ImportItem{Path: p, Err: err})
+	}
+	defer f.Close()
+	dec := xml.NewDecoder(f)
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+	for i := 1; ; i++ {
+		start, err := nextElement(dec, "note")
+		if err == io.EOF {
+			return nil
+		}
+		itemPath := fmt.Sprintf("%s#%d", p, i)
+		if err != nil {
+			return fn(usecase.ImportItem{Path: itemPath, Err: err})
+		}
+		var note enexNote
+		if err := dec.DecodeElement(&note, start); err != nil {
+			return fn(usecase.ImportItem{Path: itemPath, Err: err})
+		}
+		if err := fn(note.item(itemPath)); err != nil {
+			return err
+		}
+	}
+}
+
+func nextElement(dec *xml.Decoder, name string) (*xml.StartElement, error) {
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if se, ok := tok.(xml.StartElement); ok && se.Name.Local == name {
+			return &se, nil
+		}
+	}
+}
+
+func (n enexNote) item(p string) usecase.ImportItem {
+	item := usecase.ImportItem{Path: p, Title: strings.TrimSpace(n.Title), Tags: n.Tags}
+	var err error
+	if item.CreatedAt, err = parseENEXTime(n.Created); err != nil {
+		item.Err = err
+		return item
+	}
+	if item.UpdatedAt, err = parseENEXTime(n.Updated); err != nil {
+		item.Err = err
+		return item
+	}
+
+	media := make(map[string]enmlMedia, len(n.Resources))
+	for _, r := range n.Resources {
+		data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(r.Data), ""))
+		if err != nil {
+			item.Err = fmt.Errorf("resource %q: %w", r.FileName, err)
+			return item
+		}
+		sum := md5.Sum(data)
+		hash := hex.EncodeToString(sum[:])
+		name := hash + attachmentExt(r.Mime, r.FileName)
+		label := r.FileName
+		if label == "" {
+			label = name
+		}
+		media[hash] = enmlMedia{URL: AttachmentURLPrefix + name, Label: label, Image: isImageAttachment(name)}
+		item.Attachments = append(item.Attachments, usecase.ImportAttachment{Name: name, Data: data})
+	}
+
+	body, err := ENMLToMarkdown(n.Content, media)
+	if err != nil {
+		item.Err = fmt.Errorf("content: %w", err)
+		return item
+	}
+	item.Body = body
+	return item
+}
+
+func parseENEXTime(v string) (time.Time, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(enexTimeLayout, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", v)
+	}
+	return t, nil
+}
+
+// AttachmentTypes maps the extensions attachments are stored under to their
+// content types. Only passive types are listed, which browsers do not run
+// scripts in; any other attachment is stored as .bin.
+var AttachmentTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".pdf":  "application/pdf",
+	".mp3":  "audio/mpeg",
+	".wav":  "audio/wav",
+	".mp4":  "video/mp4",
+	".txt":  "text/plain",
+}
+
+func attachmentExt(mimeType, fileName string) string {
+	for ext, t := range AttachmentTypes {
+		if t == mimeType {
+			return ext
+		}
+	}
+	ext := strings.ToLower(path.Ext(fileName))
+	if ext == ".jpeg" {
+		return ".jpg"
+	}
+	if _, ok := AttachmentTypes[ext]; ok {
+		return ext
+	}
+	return ".bin"
+}
+
+func isImageAttachment(name string) bool {
+	return strings.HasPrefix(AttachmentTypes[path.Ext(name)], "image/")
+}
@@ -0,0 +1,98 @@
+package importer
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/peconote/peconote/internal/usecase"
+)
+
+func TestENMLToMarkdown(t *testing.T) {
+	content := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE en-note SYSTEM "http://xml.evernote.com/pub/enml2.dtd">
+<en-note><h1>Trip</h1><div>Bring <b>passport</b> &amp; <i>tickets</i>&nbsp;now</div>
+<div><en-todo checked="true"/>book hotel</div><div><en-todo/>pack</div>
+<ul><li>one</li><li>two<ol><li>nested</li></ol></li></ul>
+<div>See <a href="https://example.com">site</a> <en-media type="image/png" hash="ABC"/></div>
+<blockquote>quoted</blockquote><pre>x  = 1
+y = 2</pre><en-crypt>secret</en-crypt>
+<table><tr><th>a</th><th>b</th></tr><tr><td>1</td><td>2</td></tr></table></en-note>`
+	media := map[string]enmlMedia{"abc": {URL: "/attachments/abc.png", Label: "map.png", Image: true}}
+	got, err := ENMLToMarkdown(content, media)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "# Trip\n\n" +
+		"Bring **passport** & *tickets* now\n" +
+		"- [x] book hotel\n" +
+		"- [ ] pack\n\n" +
+		"- one\n" +
+		"- two\n" +
+		"  1. nested\n\n" +
+		"See [site](https://example.com) ![map.png](/attachments/abc.png)\n\n" +
+		"> quoted\n\n" +
+		"```\nx  = 1\ny = 2\n```\n\n" +
+		"| a | b |\n| --- | --- |\n| 1 | 2 |"
+	if got != want {
+		t.Fatalf("unexpected markdown:\n%s\n--- want ---\n%s", got, want)
+	}
+}
+
+func TestSource_ENEX(t *testing.T) {
+	data := []byte("fake png")
+	sum := md5.Sum(data)
+	hash := hex.EncodeToString(sum[:])
+	enex := `<?xml version="1.0" encoding="UTF-8"?>
+<en-export>
+<note><title>First</title><content><![CDATA[<en-note><div>hello <en-media type="image/png" hash="` + hash + `"/></div></en-note>]]></content>
+<created>20210304T050607Z</created><updated>20220304T050607Z</updated><tag>travel</tag><tag>2021</tag>
+<resource><data encoding="base64">` + base64.StdEncoding.EncodeToString(data) + `</data><mime>image/png</mime><resource-attributes><file-name>a.png</file-name></resource-attributes></resource>
+</note>
+<note><title>Second</title><content><![CDATA[<en-note>bye</en-note>]]></content><created>bad</created></note>
+</en-export>`
+	var items []usecase.ImportItem
+	err := NewSource(fstest.MapFS{"notes.enex": {Data: []byte(enex)}}).Each(context.Background(), func(it usecase.ImportItem) error {
+		items = append(items, it)
+		return nil
+	})
+	if err != nil || len(items) != 2 {
+		t.Fatalf("unexpected items %v %+v", err, items)
+	}
+	first := items[0]
+	if first.Err != nil || first.Path != "notes.enex#1" || first.Title != "First" || strings.Join(first.Tags, ",") != "travel,2021" {
+		t.Fatalf("unexpected note %+v", first)
+	}
+	if first.Body != "hello ![a.png](/attachments/"+hash+".png)" {
+		t.Fatalf("unexpected body %q", first.Body)
+	}
+	if !first.CreatedAt.Equal(time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)) || first.UpdatedAt.Year() != 2022 {
+		t.Fatalf("unexpected times %v %v", first.CreatedAt, first.UpdatedAt)
+	}
+	if len(first.Attachments) != 1 || first.Attachments[0].Name != hash+".png" || string(first.Attachments[0].Data) != "fake png" {
+		t.Fatalf("unexpected attachments %+v", first.Attachments)
+	}
+	if items[1].Err == nil {
+		t.Fatalf("expected timestamp error")
+	}
+}
+
+func TestAttachmentExt(t *testing.T) {
+	for _, tc := range []struct{ mime, name, want string }{
+		{"image/png", "", ".png"},
+		{"image/svg+xml", "icon.svg", ".bin"},
+		{"text/html", "page.html", ".bin"},
+		{"", "photo.JPEG", ".jpg"},
+		{"application/octet-stream", "song.mp3", ".mp3"},
+		{"", "script.js", ".bin"},
+	} {
+		if got := attachmentExt(tc.mime, tc.name); got != tc.want {
+			t.Fatalf("attachmentExt(%q, %q) = %q, want %q", tc.mime, tc.name, got, tc.want)
+		}
+	}
+}
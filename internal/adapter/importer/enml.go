@@ -0,0 +1,310 @@
+package importer
+
+import (
+	"encoding/xml"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// enmlMedia describes the attachment an <en-media> element refers to.
+type enmlMedia struct {
+	URL   string
+	Label string
+	Image bool
+}
+
+type enmlList struct {
+	ordered bool
+	n       int
+	indent  int
+}
+
+type enmlWriter struct {
+	b     strings.Builder
+	quote int
+	pre   bool
+	lists []enmlList
+	links []string
+	skip  int
+	cell  bool
+	rows  int
+	cells int
+}
+
+var (
+	enmlSpace      = regexp.MustCompile(`[ \t\r\n]+`)
+	enmlBlankLines = regexp.MustCompile(`\n{3,}`)
+	enmlTrailing   = regexp.MustCompile(`[ \t]+\n`)
+)
+
+// ENMLToMarkdown converts the XHTML dialect Evernote stores note content in
+// to Markdown. en-media elements are replaced by links from media, keyed by
+// the MD5 hash of the resource.
+func ENMLToMarkdown(content string, media map[string]enmlMedia) (string, error) {
+	dec := xml.NewDecoder(strings.NewReader(content))
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+	w := &enmlWriter{}
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			w.start(t, media)
+		case xml.EndElement:
+			w.end(t.Name.Local)
+		case xml.CharData:
+			w.text(string(t))
+		}
+	}
+	out := enmlTrailing.ReplaceAllString(w.b.String(), "\n")
+	out = enmlBlankLines.ReplaceAllString(out, "\n\n")
+	return strings.TrimSpace(out), nil
+}
+
+func attr(e xml.StartElement, name string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func (w *enmlWriter) atLineStart() bool {
+	s := w.b.String()
+	return s == "" || strings.HasSuffix(s, "\n")
+}
+
+// write emits s, starting the line with blockquote markers when needed.
+func (w *enmlWriter) write(s string) {
+	if s == "" {
+		return
+	}
+	if w.quote > 0 && w.atLineStart() {
+		w.b.WriteString(strings.Repeat("> ", w.quote))
+	}
+	w.b.WriteString(s)
+}
+
+func (w *enmlWriter) newline() {
+	if !w.atLineStart() {
+		w.b.WriteString("\n")
+	}
+}
+
+func (w *enmlWriter) blankLine() {
+	w.newline()
+	if s := w.b.String(); s != "" && !strings.HasSuffix(s, "\n\n") {
+		w.b.WriteString("\n")
+	}
+}
+
+func (w *enmlWriter) start(e xml.StartElement, media map[string]enmlMedia) {
+	name := e.Name.Local
+	if w.skip > 0 {
+		w.skip++
+		return
+	}
+	switch name {
+	case "en-crypt", "head", "title", "style", "script":
+		w.skip = 1
+	case "div", "section", "article", "header", "footer", "center":
+		if w.cell {
+			w.write(" ")
+		} else if len(w.lists) == 0 {
+			w.newline()
+		}
+	case "p":
+		if w.cell {
+			w.write(" ")
+		} else {
+			w.blankLine()
+		}
+	case "br":
+		if w.cell {
+			w.write(" ")
+		} else if w.pre || len(w.lists) == 0 {
+			w.b.WriteString("\n")
+		}
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		w.blankLine()
+		level, _ := strconv.Atoi(name[1:])
+		w.write(strings.Repeat("#", level) + " ")
+	case "ul", "ol":
+		if len(w.lists) == 0 {
+			w.blankLine()
+		}
+		indent := 0
+		if n := len(w.lists); n > 0 {
+			parent := w.lists[n-1]
+			indent = parent.indent + 2
+			if parent.ordered {
+				indent = parent.indent + len(strconv.Itoa(parent.n)) + 2
+			}
+		}
+		w.lists = append(w.lists, enmlList{ordered: name == "ol", indent: indent})
+	case "li":
+		w.newline()
+		if n := len(w.lists); n > 0 {
+			l := &w.lists[n-1]
+			w.write(strings.Repeat(" ", l.indent))
+			if l.ordered {
+				l.n++
+				w.write(strconv.Itoa(l.n) + ". ")
+			} else {
+				w.write("- ")
+			}
+		} else {
+			w.write("- ")
+		}
+	case "en-todo":
+		box := "[ ] "
+		if attr(e, "checked") == "true" {
+			box = "[x] "
+		}
+		if len(w.lists) == 0 && w.atLineStart() {
+			box = "- " + box
+		}
+		w.write(box)
+	case "b", "strong":
+		w.write("**")
+	case "i", "em":
+		w.write("*")
+	case "s", "strike", "del":
+		w.write("~~")
+	case "code":
+		if !w.pre {
+			w.write("`")
+		}
+	case "pre":
+		w.blankLine()
+		w.write("```\n")
+		w.pre = true
+	case "blockquote":
+		w.blankLine()
+		w.quote++
+	case "a":
+		href := attr(e, "href")
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(href)), "javascript:") {
+			href = ""
+		}
+		w.links = append(w.links, href)
+		if href != "" {
+			w.write("[")
+		}
+	case "img":
+		if src := attr(e, "src"); src != "" {
+			w.write("![" + attr(e, "alt") + "](" + src + ")")
+		}
+	case "en-media":
+		if m, ok := media[strings.ToLower(attr(e, "hash"))]; ok {
+			if m.Image {
+				w.write("![" + m.Label + "](" + m.URL + ")")
+			} else {
+				w.write("[" + m.Label + "](" + m.URL + ")")
+			}
+		}
+	case "hr":
+		w.blankLine()
+		w.write("---")
+		w.blankLine()
+	case "table":
+		w.blankLine()
+		w.rows = 0
+	case "tr":
+		w.newline()
+		w.write("|")
+		w.cells = 0
+	case "td", "th":
+		w.write(" ")
+		w.cell = true
+		w.cells++
+	}
+}
+
+func (w *enmlWriter) end(name string) {
+	if w.skip > 0 {
+		w.skip--
+		return
+	}
+	switch name {
+	case "div", "section", "article", "header", "footer", "center":
+		if !w.cell && len(w.lists) == 0 {
+			w.newline()
+		}
+	case "p":
+		if !w.cell {
+			w.blankLine()
+		}
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		w.blankLine()
+	case "ul", "ol":
+		if n := len(w.lists); n > 0 {
+			w.lists = w.lists[:n-1]
+		}
+		if len(w.lists) == 0 {
+			w.blankLine()
+		}
+	case "b", "strong":
+		w.write("**")
+	case "i", "em":
+		w.write("*")
+	case "s", "strike", "del":
+		w.write("~~")
+	case "code":
+		if !w.pre {
+			w.write("`")
+		}
+	case "pre":
+		w.pre = false
+		w.newline()
+		w.write("```")
+		w.blankLine()
+	case "blockquote":
+		if w.quote > 0 {
+			w.quote--
+		}
+		w.blankLine()
+	case "a":
+		if n := len(w.links); n > 0 {
+			if href := w.links[n-1]; href != "" {
+				w.write("](" + href + ")")
+			}
+			w.links = w.links[:n-1]
+		}
+	case "td", "th":
+		w.write(" |")
+		w.cell = false
+	case "tr":
+		if w.rows == 0 {
+			w.b.WriteString("\n|" + strings.Repeat(" --- |", w.cells))
+		}
+		w.rows++
+	case "table":
+		w.blankLine()
+	}
+}
+
+func (w *enmlWriter) text(s string) {
+	if w.skip > 0 {
+		return
+	}
+	if w.pre {
+		w.write(s)
+		return
+	}
+	s = enmlSpace.ReplaceAllString(s, " ")
+	if w.atLineStart() || strings.HasSuffix(w.b.String(), " ") {
+		s = strings.TrimLeft(s, " ")
+	}
+	w.write(s)
+}
@@ -0,0 +1,393 @@
+package importer
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/peconote/peconote/internal/usecase"
+	"gopkg.in/yaml.v3"
+)
+
+// Source reads Markdown notes and JSON exports from a directory tree or a
+// zip archive. Hidden files and folders such as .obsidian are skipped.
+type Source struct {
+	fsys fs.FS
+}
+
+func NewSource(fsys fs.FS) *Source {
+	return &Source{fsys: fsys}
+}
+
+// Open returns a source for a directory or a zip file on disk. The returned
+// closer must be closed once the import is done.
+func Open(name string) (*Source, io.Closer, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if fi.IsDir() {
+		return NewSource(os.DirFS(name)), io.NopCloser(nil), nil
+	}
+	zr, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return NewSource(zr), zr, nil
+}
+
+func (s *Source) Each(ctx context.Context, fn func(usecase.ImportItem) error) error {
+	return fs.WalkDir(s.fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if p != "." && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(path.Ext(p)) {
+		case ".md", ".markdown":
+			return fn(s.readMarkdown(p, d))
+		case ".json", ".jsonl":
+			return s.readJSON(p, fn)
+		case ".csv":
+			return s.readCSV(p, fn)
+		case ".enex":
+			return s.readENEX(p, fn)
+		}
+		return nil
+	})
+}
+
+func (s *Source) readMarkdown(p string, d fs.DirEntry) usecase.ImportItem {
+	item := usecase.ImportItem{Path: p}
+	info, err := d.Info()
+	if err != nil {
+		item.Err = err
+		return item
+	}
+	data, err := fs.ReadFile(s.fsys, p)
+	if err != nil {
+		item.Err = err
+		return item
+	}
+	item.CreatedAt = info.ModTime()
+	item.UpdatedAt = info.ModTime()
+	if err := parseMarkdown(&item, string(data)); err != nil {
+		item.Err = err
+	}
+	return item
+}
+
+type frontMatter struct {
+	ID       string      `yaml:"id"`
+	Title    string      `yaml:"title"`
+	Tags     interface{} `yaml:"tags"`
+	Created  interface{} `yaml:"created"`
+	Date     interface{} `yaml:"date"`
+	Updated  interface{} `yaml:"updated"`
+	Pinned   bool        `yaml:"pinned"`
+	Archived bool        `yaml:"archived"`
+	Favorite bool        `yaml:"favorite"`
+}
+
+func parseMarkdown(item *usecase.ImportItem, src string) error {
+	src = strings.TrimPrefix(strings.ReplaceAll(src, "\r\n", "\n"), "\ufeff")
+	var fm frontMatter
+	if strings.HasPrefix(src, "---\n") {
+		rest := src[3:]
+		end := strings.Index(rest, "\n---\n")
+		switch {
+		case end >= 0:
+			src = rest[end+5:]
+		case strings.HasSuffix(rest, "\n---"):
+			end, src = len(rest)-4, ""
+		default:
+			return errors.New("unterminated front matter")
+		}
+		if err := yaml.Unmarshal([]byte(rest[:end]), &fm); err != nil {
+			return fmt.Errorf("front matter: %w", err)
+		}
+	}
+	// The body is kept exactly as written after the closing delimiter.
+	item.Body = src
+	item.SourceID = fm.ID
+	item.Title = strings.TrimSpace(fm.Title)
+	if item.Title == "" {
+		item.Title = strings.TrimSuffix(path.Base(item.Path), path.Ext(item.Path))
+	}
+	tags, err := frontMatterTags(fm.Tags)
+	if err != nil {
+		return err
+	}
+	// Files written by the Markdown exporter carry their id and an exact tag
+	// list, so inline hashtags are only collected from other notes.
+	if fm.ID == "" {
+		tags = append(tags, Hashtags(item.Body)...)
+	}
+	item.Tags = tags
+	item.Pinned, item.Archived, item.Favorite = fm.Pinned, fm.Archived, fm.Favorite
+	if fm.Updated != nil {
+		t, err := frontMatterTime(fm.Updated)
+		if err != nil {
+			return err
+		}
+		item.UpdatedAt = t
+	}
+	for _, v := range []interface{}{fm.Created, fm.Date} {
+		if v == nil {
+			continue
+		}
+		t, err := frontMatterTime(v)
+		if err != nil {
+			return err
+		}
+		item.CreatedAt = t
+		if item.UpdatedAt.Before(t) {
+			item.UpdatedAt = t
+		}
+		break
+	}
+	return nil
+}
+
+func frontMatterTags(v interface{}) ([]string, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' }), nil
+	case []interface{}:
+		tags := make([]string, 0, len(v))
+		for _, t := range v {
+			tags = append(tags, fmt.Sprint(t))
+		}
+		return tags, nil
+	}
+	return nil, fmt.Errorf("front matter: tags must be a list or a string")
+}
+
+func frontMatterTime(v interface{}) (time.Time, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"} {
+			if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+				return t, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("front matter: invalid date %v", v)
+}
+
+var (
+	fencePattern      = regexp.MustCompile("(?ms)^(```|~~~).*?^(```|~~~)[^\n]*$")
+	inlineCodePattern = regexp.MustCompile("`[^`\n]*`")
+	hashtagPattern    = regexp.MustCompile(`(?:^|\s)#([\p{L}\p{N}_/-]+)`)
+	numericPattern    = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// Hashtags returns the inline #tags of a Markdown body in order of
+// appearance. Tags inside code and purely numeric ones such as issue
+// references are ignored.
+func Hashtags(body string) []string {
+	body = fencePattern.ReplaceAllString(body, "")
+	body = inlineCodePattern.ReplaceAllString(body, "")
+	var tags []string
+	for _, m := range hashtagPattern.FindAllStringSubmatch(body, -1) {
+		if !numericPattern.MatchString(m[1]) {
+			tags = append(tags, m[1])
+		}
+	}
+	return tags
+}
+
+// Record is the JSON representation of a memo in exports and imports.
+type Record struct {
+	ID        string    `json:"id,omitempty"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	Tags      []string  `json:"tags"`
+	Pinned    bool      `json:"pinned,omitempty"`
+	Archived  bool      `json:"archived,omitempty"`
+	Favorite  bool      `json:"favorite,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (rec Record) item(p string) usecase.ImportItem {
+	return usecase.ImportItem{
+		Path:      p,
+		SourceID:  rec.ID,
+		Title:     rec.Title,
+		Body:      rec.Body,
+		Tags:      rec.Tags,
+		Pinned:    rec.Pinned,
+		Archived:  rec.Archived,
+		Favorite:  rec.Favorite,
+		CreatedAt: rec.CreatedAt,
+		UpdatedAt: rec.UpdatedAt,
+	}
+}
+
+// CSVHeader lists the columns of CSV exports. Tags are stored as a JSON
+// array so that tags containing commas survive a round trip.
+var CSVHeader = []string{"id", "title", "body", "tags", "pinned", "archived", "favorite", "created_at", "updated_at"}
+
+// jsonNote holds either a Record or a Google Keep note; Keep Takeout
+// writes one note per JSON file.
+type jsonNote struct {
+	Record
+	keepNote
+}
+
+// readJSON accepts either a JSON array of records or JSON Lines.
+func (s *Source) readJSON(p string, fn func(usecase.ImportItem) error) error {
+	f, err := s.fsys.Open(p)
+	if err != nil {
+		return fn(usecase.ImportItem{Path: p, Err: err})
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	first, err := peekNonSpace(r)
+	if err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return fn(usecase.ImportItem{Path: p, Err: err})
+	}
+	dec := json.NewDecoder(r)
+	if first == '[' {
+		if _, err := dec.Token(); err != nil {
+			return fn(usecase.ImportItem{Path: p, Err: err})
+		}
+	}
+	for i := 1; dec.More(); i++ {
+		itemPath := fmt.Sprintf("%s#%d", p, i)
+		var note jsonNote
+		if err := dec.Decode(&note); err != nil {
+			return fn(usecase.ImportItem{Path: itemPath, Err: err})
+		}
+		item := note.Record.item(itemPath)
+		if note.isKeep() {
+			if note.IsTrashed {
+				continue
+			}
+			item = s.keepItem(p, note)
+		}
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func peekNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		if strings.IndexByte(" \t\r\n\xef\xbb\xbf", b[0]) < 0 {
+			return b[0], nil
+		}
+		if _, err := r.ReadByte(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (s *Source) readCSV(p string, fn func(usecase.ImportItem) error) error {
+	f, err := s.fsys.Open(p)
+	if err != nil {
+		return fn(usecase.ImportItem{Path: p, Err: err})
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return fn(usecase.ImportItem{Path: p, Err: err})
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	if _, ok := columns["body"]; !ok {
+		return fn(usecase.ImportItem{Path: p, Err: errors.New("csv: missing body column")})
+	}
+	for i := 1; ; i++ {
+		fields, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		itemPath := fmt.Sprintf("%s#%d", p, i)
+		if err != nil {
+			return fn(usecase.ImportItem{Path: itemPath, Err: err})
+		}
+		rec, err := csvRecord(columns, fields)
+		item := rec.item(itemPath)
+		item.Err = err
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+}
+
+func csvRecord(columns map[string]int, fields []string) (Record, error) {
+	get := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(fields) {
+			return fields[i]
+		}
+		return ""
+	}
+	rec := Record{ID: get("id"), Title: get("title"), Body: get("body")}
+	if tags := get("tags"); tags != "" {
+		if err := json.Unmarshal([]byte(tags), &rec.Tags); err != nil {
+			return rec, fmt.Errorf("csv: tags: %w", err)
+		}
+	}
+	for name, dst := range map[string]*bool{"pinned": &rec.Pinned, "archived": &rec.Archived, "favorite": &rec.Favorite} {
+		if v := get(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return rec, fmt.Errorf("csv: %s: %w", name, err)
+			}
+			*dst = b
+		}
+	}
+	for name, dst := range map[string]*time.Time{"created_at": &rec.CreatedAt, "updated_at": &rec.UpdatedAt} {
+		if v := get(name); v != "" {
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return rec, fmt.Errorf("csv: %s: %w", name, err)
+			}
+			*dst = t
+		}
+	}
+	return rec, nil
+}
@@ -0,0 +1,82 @@
+package importer
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/peconote/peconote/internal/usecase"
+)
+
+func TestSource_Each(t *testing.T) {
+	mtime := time.Date(2022, 5, 6, 7, 8, 9, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"vault/Daily.md":           {Data: []byte("---\ntags: [journal, work]\ncreated: 2021-01-02T03:04:05Z\n---\n\n# Today\nSee [[Ideas]] #focus and #123\n```\n#notatag\n```\n"), ModTime: mtime},
+		"vault/Ideas.md":           {Data: []byte("plain note #idea\n"), ModTime: mtime},
+		"vault/.obsidian/app.json": {Data: []byte("{}")},
+		"vault/image.png":          {Data: []byte("png")},
+		"export.jsonl":             {Data: []byte(`{"title":"t","body":"b","tags":["x"],"created_at":"2020-01-01T00:00:00Z","updated_at":"2020-01-02T00:00:00Z"}` + "\nnot json\n")},
+		"broken.md":                {Data: []byte("---\ntitle: x\n")},
+	}
+	var items []usecase.ImportItem
+	err := NewSource(fsys).Each(context.Background(), func(it usecase.ImportItem) error {
+		items = append(items, it)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	byPath := map[string]usecase.ImportItem{}
+	for _, it := range items {
+		byPath[it.Path] = it
+	}
+	if len(items) != 5 {
+		t.Fatalf("unexpected items %+v", items)
+	}
+
+	daily := byPath["vault/Daily.md"]
+	if daily.Err != nil || daily.Title != "Daily" || !strings.HasPrefix(daily.Body, "\n# Today") {
+		t.Fatalf("unexpected daily %+v", daily)
+	}
+	if got := strings.Join(daily.Tags, ","); got != "journal,work,focus" {
+		t.Fatalf("unexpected tags %q", got)
+	}
+	if !daily.CreatedAt.Equal(time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)) || !daily.UpdatedAt.Equal(mtime) {
+		t.Fatalf("unexpected times %v %v", daily.CreatedAt, daily.UpdatedAt)
+	}
+
+	ideas := byPath["vault/Ideas.md"]
+	if !ideas.CreatedAt.Equal(mtime) || strings.Join(ideas.Tags, ",") != "idea" {
+		t.Fatalf("unexpected ideas %+v", ideas)
+	}
+
+	rec := byPath["export.jsonl#1"]
+	if rec.Err != nil || rec.Body != "b" || rec.Tags[0] != "x" || rec.UpdatedAt.Day() != 2 {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+	if byPath["export.jsonl#2"].Err == nil || byPath["broken.md"].Err == nil {
+		t.Fatalf("expected parse errors")
+	}
+}
+
+func TestParseMarkdown_KeepsBodyAndSourceID(t *testing.T) {
+	for src, want := range map[string]string{
+		"---\nid: 5f0c6c1e-2b57-4b0e-9a53-2f7b1c0d9e11\ntitle: t\n---\n\n\n  indented\n": "\n\n  indented\n",
+		"---\r\nid: x\r\n---\r\n---\r\nrule":                                             "---\nrule",
+		"---\nid: x\n---":                                                                "",
+	} {
+		item := usecase.ImportItem{Path: "n.md"}
+		if err := parseMarkdown(&item, src); err != nil {
+			t.Fatalf("%q: unexpected error: %v", src, err)
+		}
+		if item.Body != want || item.SourceID == "" {
+			t.Fatalf("%q: got body %q id %q", src, item.Body, item.SourceID)
+		}
+	}
+	item := usecase.ImportItem{Path: "n.md"}
+	if err := parseMarkdown(&item, "---\ntitle: x\n---trailing\nbody"); err == nil {
+		t.Fatalf("expected an unterminated front matter error")
+	}
+}
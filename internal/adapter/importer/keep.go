@@ -0,0 +1,140 @@
+package importer
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/peconote/peconote/internal/usecase"
+)
+
+type keepNote struct {
+	TextContent string `json:"textContent"`
+	ListContent []struct {
+		Text      string `json:"text"`
+		IsChecked bool   `json:"isChecked"`
+	} `json:"listContent"`
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	Annotations []struct {
+		URL   string `json:"url"`
+		Title string `json:"title"`
+	} `json:"annotations"`
+	Attachments []struct {
+		FilePath string `json:"filePath"`
+		Mimetype string `json:"mimetype"`
+	} `json:"attachments"`
+	IsPinned                bool  `json:"isPinned"`
+	IsArchived              bool  `json:"isArchived"`
+	IsTrashed               bool  `json:"isTrashed"`
+	CreatedTimestampUsec    int64 `json:"createdTimestampUsec"`
+	UserEditedTimestampUsec int64 `json:"userEditedTimestampUsec"`
+}
+
+func (n jsonNote) isKeep() bool {
+	return n.CreatedTimestampUsec != 0 || n.UserEditedTimestampUsec != 0 || n.TextContent != "" || n.ListContent != nil
+}
+
+// keepItem maps a Keep note: labels become tags, checklists become task
+// lists, and attached files next to the JSON file become attachments.
+func (s *Source) keepItem(p string, n jsonNote) usecase.ImportItem {
+	item := usecase.ImportItem{
+		Path:      p,
+		Title:     strings.TrimSpace(n.Title),
+		Pinned:    n.IsPinned,
+		Archived:  n.IsArchived,
+		CreatedAt: time.UnixMicro(n.CreatedTimestampUsec).UTC(),
+		UpdatedAt: time.UnixMicro(n.UserEditedTimestampUsec).UTC(),
+	}
+	if n.CreatedTimestampUsec == 0 {
+		item.CreatedAt = item.UpdatedAt
+	}
+	for _, l := range n.Labels {
+		item.Tags = append(item.Tags, l.Name)
+	}
+
+	var parts []string
+	if text := strings.TrimSpace(n.TextContent); text != "" {
+		parts = append(parts, text)
+	}
+	if len(n.ListContent) > 0 {
+		lines := make([]string, len(n.ListContent))
+		for i, li := range n.ListContent {
+			box := "[ ]"
+			if li.IsChecked {
+				box = "[x]"
+			}
+			lines[i] = "- " + box + " " + strings.TrimSpace(li.Text)
+		}
+		parts = append(parts, strings.Join(lines, "\n"))
+	}
+	if len(n.Annotations) > 0 {
+		lines := make([]string, 0, len(n.Annotations))
+		for _, a := range n.Annotations {
+			if a.URL == "" {
+				continue
+			}
+			label := a.Title
+			if label == "" {
+				label = a.URL
+			}
+			lines = append(lines, "- ["+label+"]("+a.URL+")")
+		}
+		if len(lines) > 0 {
+			parts = append(parts, strings.Join(lines, "\n"))
+		}
+	}
+	var media []string
+	for _, a := range n.Attachments {
+		data, err := s.readKeepAttachment(path.Join(path.Dir(p), a.FilePath))
+		if err != nil {
+			item.Err = fmt.Errorf("attachment %q: %w", a.FilePath, err)
+			return item
+		}
+		sum := md5.Sum(data)
+		name := hex.EncodeToString(sum[:]) + attachmentExt(a.Mimetype, a.FilePath)
+		item.Attachments = append(item.Attachments, usecase.ImportAttachment{Name: name, Data: data})
+		if isImageAttachment(name) {
+			media = append(media, "!["+a.FilePath+"]("+AttachmentURLPrefix+name+")")
+		} else {
+			media = append(media, "["+a.FilePath+"]("+AttachmentURLPrefix+name+")")
+		}
+	}
+	if len(media) > 0 {
+		parts = append(parts, strings.Join(media, "\n"))
+	}
+	item.Body = strings.Join(parts, "\n\n")
+	return item
+}
+
+// readKeepAttachment reads an attached file. Takeout sometimes lists a
+// different extension than the one written (.jpeg for .jpg), so a file with
+// the same name and any extension is accepted as well.
+func (s *Source) readKeepAttachment(name string) ([]byte, error) {
+	data, err := fs.ReadFile(s.fsys, name)
+	if err == nil {
+		return data, nil
+	}
+	stem := strings.TrimSuffix(name, path.Ext(name))
+	matches, globErr := fs.Glob(s.fsys, escapeGlob(stem)+".*")
+	if globErr != nil || len(matches) == 0 {
+		return nil, err
+	}
+	return fs.ReadFile(s.fsys, matches[0])
+}
+
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,51 @@
+package importer
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/peconote/peconote/internal/usecase"
+)
+
+func TestSource_Keep(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Takeout/Keep/Groceries.json": {Data: []byte(`{"title":"Groceries","isPinned":true,"isTrashed":false,"isArchived":false,
+			"listContent":[{"text":"milk","isChecked":true},{"text":"eggs","isChecked":false}],
+			"labels":[{"name":"home"}],"createdTimestampUsec":1600000000000000,"userEditedTimestampUsec":1600000100000000}`)},
+		"Takeout/Keep/Photo.json": {Data: []byte(`{"title":"","textContent":"look","isTrashed":false,
+			"attachments":[{"filePath":"photo.jpeg","mimetype":"image/jpeg"}],
+			"annotations":[{"url":"https://example.com","title":"Example"}],"userEditedTimestampUsec":1600000000000000}`)},
+		"Takeout/Keep/photo.jpg":    {Data: []byte("jpg")},
+		"Takeout/Keep/Trashed.json": {Data: []byte(`{"title":"gone","textContent":"x","isTrashed":true,"userEditedTimestampUsec":1}`)},
+	}
+	var items []usecase.ImportItem
+	err := NewSource(fsys).Each(context.Background(), func(it usecase.ImportItem) error {
+		items = append(items, it)
+		return nil
+	})
+	if err != nil || len(items) != 2 {
+		t.Fatalf("unexpected items %v %+v", err, items)
+	}
+	list := items[0]
+	if list.Err != nil || list.Path != "Takeout/Keep/Groceries.json" || !list.Pinned || strings.Join(list.Tags, ",") != "home" {
+		t.Fatalf("unexpected note %+v", list)
+	}
+	if list.Body != "- [x] milk\n- [ ] eggs" {
+		t.Fatalf("unexpected body %q", list.Body)
+	}
+	if !list.CreatedAt.Equal(time.Unix(1600000000, 0)) || !list.UpdatedAt.Equal(time.Unix(1600000100, 0)) {
+		t.Fatalf("unexpected times %v %v", list.CreatedAt, list.UpdatedAt)
+	}
+	photo := items[1]
+	if photo.Err != nil || len(photo.Attachments) != 1 || string(photo.Attachments[0].Data) != "jpg" {
+		t.Fatalf("unexpected photo %+v", photo)
+	}
+	name := photo.Attachments[0].Name
+	want := "look\n\n- [Example](https://example.com)\n\n![photo.jpeg](/attachments/" + name + ")"
+	if !strings.HasSuffix(name, ".jpg") || photo.Body != want {
+		t.Fatalf("unexpected body %q", photo.Body)
+	}
+}
@@ -0,0 +1,40 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestToHTML_GFM(t *testing.T) {
+	out, err := ToHTML("# Title\n\n| a | b |\n|---|---|\n| 1 | 2 |\n\n- [x] done\n\n~~old~~ https://example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"<h1>Title</h1>", "<table>", `<input checked="" disabled="" type="checkbox"`, "<del>old</del>", `<a href="https://example.com"`} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in %s", want, out)
+		}
+	}
+}
+
+func TestToHTML_Sanitizes(t *testing.T) {
+	out, err := ToHTML("<script>alert(1)</script>\n\n[x](javascript:alert(1)) <img src=x onerror=alert(1)>")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, bad := range []string{"<script", "javascript:", "onerror"} {
+		if strings.Contains(out, bad) {
+			t.Fatalf("unexpected %q in %s", bad, out)
+		}
+	}
+}
+
+func TestToHTML_HighlightsCode(t *testing.T) {
+	out, err := ToHTML("```go\nfunc main() {}\n```")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, `<pre class="chroma">`) || !strings.Contains(out, `<span class="kd">func</span>`) {
+		t.Fatalf("expected highlighted code, got %s", out)
+	}
+}
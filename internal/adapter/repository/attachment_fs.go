@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	domainRepo "github.com/peconote/peconote/internal/domain/repository"
+)
+
+var errInvalidAttachmentName = errors.New("invalid attachment name")
+
+type fileAttachmentRepository struct {
+	dir string
+}
+
+func NewFileAttachmentRepository(dir string) domainRepo.AttachmentRepository {
+	return &fileAttachmentRepository{dir: dir}
+}
+
+func (r *fileAttachmentRepository) Save(ctx context.Context, name string, data []byte) error {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return errInvalidAttachmentName
+	}
+	dst := filepath.Join(r.dir, name)
+	if _, err := os.Stat(dst); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(r.dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(r.dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/domain/model"
+	domainRepo "github.com/peconote/peconote/internal/domain/repository"
+)
+
+type graphRepository struct {
+	db *sqlx.DB
+}
+
+func NewGraphRepository(db *sqlx.DB) domainRepo.GraphRepository {
+	return &graphRepository{db: db}
+}
+
+func (r *graphRepository) StreamTags(ctx context.Context, f model.MemoFilter, fn func(tag string) error) error {
+	query := `SELECT DISTINCT tag FROM memo, unnest(tags) AS tag
+` + memoFilterWhere + `
+ORDER BY tag`
+	return r.stream(ctx, query, memoFilterArgs(f), func(rows *sqlx.Rows) error {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return err
+		}
+		return fn(tag)
+	})
+}
+
+func (r *graphRepository) StreamTagEdges(ctx context.Context, f model.MemoFilter, fn func(memoID uuid.UUID, tag string) error) error {
+	query := `SELECT id, t.tag FROM memo, unnest(tags) WITH ORDINALITY AS t(tag, n)
+` + memoFilterWhere + `
+ORDER BY created_at, id, t.n`
+	return r.stream(ctx, query, memoFilterArgs(f), func(rows *sqlx.Rows) error {
+		var id uuid.UUID
+		var tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			return err
+		}
+		return fn(id, tag)
+	})
+}
+
+func (r *graphRepository) StreamLinks(ctx context.Context, f model.MemoFilter, fn func(domain.MemoLink) error) error {
+	query := `SELECT source_id, target_ref, target_id FROM memo_link
+WHERE source_id IN (SELECT id FROM memo ` + memoFilterWhere + `)
+	AND target_id IN (SELECT id FROM memo ` + memoFilterWhere + `)
+ORDER BY source_id, target_ref`
+	return r.stream(ctx, query, memoFilterArgs(f), func(rows *sqlx.Rows) error {
+		var row memoLinkRow
+		if err := rows.StructScan(&row); err != nil {
+			return err
+		}
+		return fn(row.toDomain())
+	})
+}
+
+func (r *graphRepository) stream(ctx context.Context, query string, args []interface{}, scan func(*sqlx.Rows) error) error {
+	rows, err := conn(ctx, r.db).QueryxContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
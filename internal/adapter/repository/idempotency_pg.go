@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/peconote/peconote/internal/domain"
+	domainRepo "github.com/peconote/peconote/internal/domain/repository"
+)
+
+type idempotencyRepository struct {
+	db *sqlx.DB
+}
+
+func NewIdempotencyRepository(db *sqlx.DB) domainRepo.IdempotencyRepository {
+	return &idempotencyRepository{db: db}
+}
+
+type idempotencyRow struct {
+	UserID       string    `db:"user_id"`
+	Key          string    `db:"key"`
+	Fingerprint  string    `db:"fingerprint"`
+	Completed    bool      `db:"completed"`
+	StatusCode   int       `db:"status_code"`
+	Location     string    `db:"location"`
+	ResponseBody []byte    `db:"response_body"`
+	CreatedAt    time.Time `db:"created_at"`
+	ExpiresAt    time.Time `db:"expires_at"`
+}
+
+func (r *idempotencyRepository) Reserve(ctx context.Context, rec *domain.IdempotencyRecord, now time.Time) (*domain.IdempotencyRecord, bool, error) {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM idempotency_key WHERE expires_at < $1`, now); err != nil {
+		return nil, false, err
+	}
+	res, err := r.db.ExecContext(ctx,
+		`INSERT INTO idempotency_key (user_id, key, fingerprint, created_at, expires_at) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (user_id, key) DO NOTHING`,
+		rec.UserID, rec.Key, rec.Fingerprint, rec.CreatedAt, rec.ExpiresAt)
+	if err != nil {
+		return nil, false, err
+	}
+	if cnt, err := res.RowsAffected(); err == nil && cnt == 1 {
+		return nil, true, nil
+	}
+	var row idempotencyRow
+	query := `SELECT user_id, key, fingerprint, completed, status_code, location, response_body, created_at, expires_at
+FROM idempotency_key WHERE user_id = $1 AND key = $2`
+	if err := r.db.GetContext(ctx, &row, query, rec.UserID, rec.Key); err != nil {
+		return nil, false, err
+	}
+	return &domain.IdempotencyRecord{
+		UserID:       row.UserID,
+		Key:          row.Key,
+		Fingerprint:  row.Fingerprint,
+		Completed:    row.Completed,
+		StatusCode:   row.StatusCode,
+		Location:     row.Location,
+		ResponseBody: row.ResponseBody,
+		CreatedAt:    row.CreatedAt,
+		ExpiresAt:    row.ExpiresAt,
+	}, false, nil
+}
+
+func (r *idempotencyRepository) Complete(ctx context.Context, userID, key string, statusCode int, location string, body []byte) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE idempotency_key SET completed = TRUE, status_code = $3, location = $4, response_body = $5 WHERE user_id = $1 AND key = $2`,
+		userID, key, statusCode, location, body)
+	return err
+}
+
+func (r *idempotencyRepository) Release(ctx context.Context, userID, key string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM idempotency_key WHERE user_id = $1 AND key = $2 AND NOT completed`, userID, key)
+	return err
+}
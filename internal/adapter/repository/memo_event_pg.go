@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/peconote/peconote/internal/domain"
+	domainRepo "github.com/peconote/peconote/internal/domain/repository"
+)
+
+type memoEventRepository struct {
+	db *sqlx.DB
+}
+
+func NewMemoEventRepository(db *sqlx.DB) domainRepo.MemoEventRepository {
+	return &memoEventRepository{db: db}
+}
+
+type memoEventRow struct {
+	ID        int64          `db:"id"`
+	Type      string         `db:"type"`
+	MemoID    uuid.UUID      `db:"memo_id"`
+	Version   int64          `db:"version"`
+	Tags      pq.StringArray `db:"tags"`
+	UserID    string         `db:"user_id"`
+	CreatedAt time.Time      `db:"created_at"`
+}
+
+func (r *memoEventRepository) Append(ctx context.Context, e *domain.MemoEvent) error {
+	// The change to the memo row already holds its lock, so concurrent
+	// writers of the same memo cannot compute the same version.
+	query := `INSERT INTO memo_event (type, memo_id, version, tags, user_id, created_at)
+VALUES ($1, $2, (SELECT COALESCE(MAX(version), 0) + 1 FROM memo_event WHERE memo_id = $2), $3, $4, $5)
+RETURNING id, version`
+	var row memoEventRow
+	if err := conn(ctx, r.db).GetContext(ctx, &row, query, e.Type, e.MemoID, pq.StringArray(e.Tags), e.UserID, e.CreatedAt); err != nil {
+		return err
+	}
+	e.ID, e.Version = row.ID, row.Version
+	return nil
+}
+
+func (r *memoEventRepository) ListAfter(ctx context.Context, afterID int64, limit int) ([]domain.MemoEvent, error) {
+	var rows []memoEventRow
+	query := `SELECT id, type, memo_id, version, tags, user_id, created_at FROM memo_event WHERE id > $1 ORDER BY id LIMIT $2`
+	if err := conn(ctx, r.db).SelectContext(ctx, &rows, query, afterID, limit); err != nil {
+		return nil, err
+	}
+	events := make([]domain.MemoEvent, len(rows))
+	for i, row := range rows {
+		events[i] = domain.MemoEvent{
+			ID:        row.ID,
+			Type:      domain.MemoEventType(row.Type),
+			MemoID:    row.MemoID,
+			Version:   row.Version,
+			Tags:      []string(row.Tags),
+			UserID:    row.UserID,
+			CreatedAt: row.CreatedAt,
+		}
+	}
+	return events, nil
+}
+
+func (r *memoEventRepository) LastID(ctx context.Context) (int64, error) {
+	var id int64
+	err := conn(ctx, r.db).GetContext(ctx, &id, `SELECT COALESCE(MAX(id), 0) FROM memo_event`)
+	return id, err
+}
@@ -0,0 +1,331 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/google/uuid"
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/domain/model"
+	domainRepo "github.com/peconote/peconote/internal/domain/repository"
+	"gopkg.in/yaml.v3"
+)
+
+// gitMemoRepository stores each memo as <id>.md, Markdown with YAML front
+// matter, in a git working tree and commits every change. Reads are served
+// from an in-memory index built from the files on startup. Like the memory
+// repository it is not transactional.
+type gitMemoRepository struct {
+	dir   string
+	repo  *git.Repository
+	index *memoryMemoRepository
+	// mu serializes writes, which share the worktree and its index.
+	mu sync.Mutex
+}
+
+// NewGitMemoRepository opens the git repository at dir, creating it if
+// needed, and indexes the memo files in it.
+func NewGitMemoRepository(dir string) (domainRepo.MemoRepository, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	repo, err := git.PlainOpen(dir)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		repo, err = git.PlainInit(dir, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r := &gitMemoRepository{dir: dir, repo: repo, index: &memoryMemoRepository{memos: map[uuid.UUID]*domain.Memo{}}}
+	if err := r.rebuildIndex(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// rebuildIndex reads every memo file. Other Markdown files, such as a
+// README, have no id in their front matter and are skipped, and so are
+// files whose front matter does not parse, so that one bad edit does not
+// keep the server from starting.
+func (r *gitMemoRepository) rebuildIndex() error {
+	files, err := filepath.Glob(filepath.Join(r.dir, "*.md"))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		src, err := os.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		m, err := decodeGitMemo(src)
+		if err != nil {
+			log.Printf("git storage: skipping %s: %v", filepath.Base(f), err)
+			continue
+		}
+		if m != nil {
+			r.index.memos[m.ID] = m
+		}
+	}
+	return nil
+}
+
+// gitMemoFrontMatter uses the keys of the Markdown export, so the files can
+// be imported elsewhere as they are.
+type gitMemoFrontMatter struct {
+	ID       string    `yaml:"id"`
+	Title    string    `yaml:"title"`
+	Tags     []string  `yaml:"tags,flow"`
+	Created  time.Time `yaml:"created"`
+	Updated  time.Time `yaml:"updated"`
+	Pinned   bool      `yaml:"pinned,omitempty"`
+	Archived bool      `yaml:"archived,omitempty"`
+	Favorite bool      `yaml:"favorite,omitempty"`
+}
+
+func encodeGitMemo(m *domain.Memo) ([]byte, error) {
+	fm, err := yaml.Marshal(gitMemoFrontMatter{
+		ID:       m.ID.String(),
+		Title:    m.Title,
+		Tags:     m.Tags,
+		Created:  m.CreatedAt.UTC(),
+		Updated:  m.UpdatedAt.UTC(),
+		Pinned:   m.Pinned,
+		Archived: m.Archived,
+		Favorite: m.Favorite,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteString("---\n")
+	buf.Write(fm)
+	buf.WriteString("---\n")
+	buf.WriteString(m.Body)
+	return buf.Bytes(), nil
+}
+
+// decodeGitMemo returns nil for a file without front matter or id. Files
+// edited on Windows may end their lines with CRLF.
+func decodeGitMemo(src []byte) (*domain.Memo, error) {
+	s := string(src)
+	nl := "\n"
+	if strings.HasPrefix(s, "---\r\n") {
+		nl = "\r\n"
+	} else if !strings.HasPrefix(s, "---\n") {
+		return nil, nil
+	}
+	rest := s[len("---"+nl):]
+	end := strings.Index(rest, nl+"---"+nl)
+	if end < 0 {
+		return nil, errors.New("unterminated front matter")
+	}
+	var fm gitMemoFrontMatter
+	if err := yaml.Unmarshal([]byte(rest[:end+len(nl)]), &fm); err != nil {
+		return nil, fmt.Errorf("front matter: %w", err)
+	}
+	if fm.ID == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(fm.ID)
+	if err != nil {
+		return nil, fmt.Errorf("front matter: %w", err)
+	}
+	tags := fm.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return &domain.Memo{
+		ID:        id,
+		Title:     fm.Title,
+		Body:      rest[end+len(nl+"---"+nl):],
+		Tags:      tags,
+		Pinned:    fm.Pinned,
+		Archived:  fm.Archived,
+		Favorite:  fm.Favorite,
+		CreatedAt: fm.Created.UTC(),
+		UpdatedAt: fm.Updated.UTC(),
+	}, nil
+}
+
+func gitMemoFileName(id uuid.UUID) string {
+	return id.String() + ".md"
+}
+
+// commit writes m to its file, or removes the file when m is nil, and
+// commits the change with message. Writes that leave the file as it was
+// are not committed. When the commit fails the file is restored, so that it
+// keeps matching the index.
+func (r *gitMemoRepository) commit(id uuid.UUID, m *domain.Memo, message string) (err error) {
+	wt, err := r.repo.Worktree()
+	if err != nil {
+		return err
+	}
+	name := gitMemoFileName(id)
+	prev, err := os.ReadFile(filepath.Join(r.dir, name))
+	existed := err == nil
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	var src []byte
+	if m != nil {
+		if src, err = encodeGitMemo(m); err != nil {
+			return err
+		}
+		if existed && bytes.Equal(prev, src) {
+			// Nothing changed, so there is nothing to commit.
+			return nil
+		}
+	}
+	staged := false
+	defer func() {
+		if err != nil {
+			r.restore(wt, name, prev, existed, staged)
+		}
+	}()
+	if m == nil {
+		if _, err := wt.Remove(name); err != nil {
+			return err
+		}
+	} else {
+		if err := os.WriteFile(filepath.Join(r.dir, name), src, 0o644); err != nil {
+			return err
+		}
+		if _, err := wt.Add(name); err != nil {
+			return err
+		}
+	}
+	staged = true
+	_, err = wt.Commit(message, &git.CommitOptions{
+		Author: &object.Signature{Name: "peconote", Email: "peconote@localhost", When: time.Now()},
+		// Deleting the last memo leaves an empty tree, which go-git
+		// otherwise refuses to commit.
+		AllowEmptyCommits: true,
+	})
+	return err
+}
+
+// restore puts back the file as it was before a failed commit, and its
+// index entry when the change was staged.
+func (r *gitMemoRepository) restore(wt *git.Worktree, name string, prev []byte, existed, staged bool) {
+	var err error
+	switch {
+	case existed:
+		if err = os.WriteFile(filepath.Join(r.dir, name), prev, 0o644); err == nil && staged {
+			_, err = wt.Add(name)
+		}
+	case staged:
+		// Removes the new file from the index and the working tree.
+		_, err = wt.Remove(name)
+	default:
+		err = os.Remove(filepath.Join(r.dir, name))
+	}
+	if err != nil {
+		log.Printf("git storage: restore %s: %v", name, err)
+	}
+}
+
+func (r *gitMemoRepository) Create(ctx context.Context, m *domain.Memo) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.index.Get(ctx, m.ID); err == nil {
+		return errDuplicateMemo
+	}
+	if err := r.commit(m.ID, m, "Create memo "+m.ID.String()); err != nil {
+		return err
+	}
+	return r.index.Create(ctx, m)
+}
+
+func (r *gitMemoRepository) List(ctx context.Context, f model.MemoFilter, s model.MemoSort, limit, offset int) ([]*domain.Memo, int, error) {
+	return r.index.List(ctx, f, s, limit, offset)
+}
+
+func (r *gitMemoRepository) Stream(ctx context.Context, f model.MemoFilter, fn func(*domain.Memo) error) error {
+	return r.index.Stream(ctx, f, fn)
+}
+
+func (r *gitMemoRepository) Stats(ctx context.Context) (domain.MemoStats, error) {
+	return r.index.Stats(ctx)
+}
+
+func (r *gitMemoRepository) Get(ctx context.Context, id uuid.UUID) (*domain.Memo, error) {
+	return r.index.Get(ctx, id)
+}
+
+func (r *gitMemoRepository) Update(ctx context.Context, m *domain.Memo) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cur, err := r.index.Get(ctx, m.ID)
+	if err != nil {
+		return err
+	}
+	cur.Title, cur.Body, cur.UpdatedAt = m.Title, m.Body, m.UpdatedAt
+	cur.Tags = append([]string{}, m.Tags...)
+	if err := r.commit(m.ID, cur, "Update memo "+m.ID.String()); err != nil {
+		return err
+	}
+	return r.index.Update(ctx, m)
+}
+
+func (r *gitMemoRepository) UpdateBody(ctx context.Context, id uuid.UUID, base, body string, updatedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cur, err := r.index.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if cur.Body != base {
+		return domainRepo.ErrMemoChanged
+	}
+	cur.Body, cur.UpdatedAt = body, updatedAt
+	if err := r.commit(id, cur, "Update memo "+id.String()); err != nil {
+		return err
+	}
+	return r.index.UpdateBody(ctx, id, base, body, updatedAt)
+}
+
+func (r *gitMemoRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.index.Get(ctx, id); err != nil {
+		return err
+	}
+	if err := r.commit(id, nil, "Delete memo "+id.String()); err != nil {
+		return err
+	}
+	return r.index.Delete(ctx, id)
+}
+
+func (r *gitMemoRepository) SetFlag(ctx context.Context, id uuid.UUID, flag domain.MemoFlag, value bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cur, err := r.index.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	switch flag {
+	case domain.MemoFlagPinned:
+		cur.Pinned = value
+	case domain.MemoFlagArchived:
+		cur.Archived = value
+	case domain.MemoFlagFavorite:
+		cur.Favorite = value
+	default:
+		return errUnknownMemoFlag
+	}
+	if err := r.commit(id, cur, fmt.Sprintf("Set %s to %t on memo %s", flag, value, id)); err != nil {
+		return err
+	}
+	return r.index.SetFlag(ctx, id, flag, value)
+}
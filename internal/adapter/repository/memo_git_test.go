@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/google/uuid"
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/domain/model"
+)
+
+func TestGitMemoRepository_CommitsAndReindexes(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	repo, err := NewGitMemoRepository(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2024, 1, 1, 9, 30, 0, 0, time.UTC)
+	m := &domain.Memo{ID: uuid.New(), Title: "Plan", Body: "# Plan\n\n---\nnot front matter\n", Tags: []string{"work", "q1"}, CreatedAt: at, UpdatedAt: at}
+	gone := &domain.Memo{ID: uuid.New(), Body: "temporary", Tags: []string{}, CreatedAt: at, UpdatedAt: at}
+	for _, memo := range []*domain.Memo{m, gone} {
+		if err := repo.Create(ctx, memo); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.SetFlag(ctx, m.ID, domain.MemoFlagPinned, true); err != nil {
+		t.Fatal(err)
+	}
+	// Setting a flag to its current value changes no file.
+	if err := repo.SetFlag(ctx, m.ID, domain.MemoFlagPinned, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete(ctx, gone.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("# Notes\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := os.ReadFile(filepath.Join(dir, m.ID.String()+".md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(src), "---\nid: "+m.ID.String()+"\n") || !strings.Contains(string(src), "tags: [work, q1]\n") {
+		t.Fatalf("unexpected file:\n%s", src)
+	}
+
+	g, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, err := g.Log(&git.LogOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []string
+	log.ForEach(func(c *object.Commit) error {
+		messages = append(messages, strings.Fields(c.Message)[0])
+		return nil
+	})
+	if strings.Join(messages, " ") != "Delete Set Create Create" {
+		t.Fatalf("unexpected commits %v", messages)
+	}
+
+	reopened, err := NewGitMemoRepository(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := reopened.Get(ctx, m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Body != m.Body || got.Title != m.Title || !got.Pinned || !got.CreatedAt.Equal(at) || strings.Join(got.Tags, ",") != "work,q1" {
+		t.Fatalf("unexpected memo after reopening: %+v", got)
+	}
+	if _, total, _ := reopened.List(ctx, model.MemoFilter{}, model.DefaultMemoSort, 10, 0); total != 1 {
+		t.Fatalf("expected 1 memo after reopening, got %d", total)
+	}
+}
+
+func TestGitMemoRepository_HandEditedFilesAndFailedCommits(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	repo, err := NewGitMemoRepository(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2024, 1, 1, 9, 30, 0, 0, time.UTC)
+	m := &domain.Memo{ID: uuid.New(), Title: "Plan", Body: "first", Tags: []string{}, CreatedAt: at, UpdatedAt: at}
+	if err := repo.Create(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, m.ID.String()+".md")
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changes fail while the object store, which staging writes to, or the
+	// branches, which committing writes to, cannot be written.
+	for _, broken := range []string{"objects", filepath.Join("refs", "heads")} {
+		broken = filepath.Join(dir, ".git", broken)
+		if err := os.Rename(broken, broken+".bak"); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(broken, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.Update(ctx, &domain.Memo{ID: m.ID, Title: "Plan", Body: "second", Tags: []string{}, UpdatedAt: at}); err == nil {
+			t.Fatal("expected the commit to fail")
+		}
+		if after, _ := os.ReadFile(path); string(after) != string(before) {
+			t.Fatalf("file not restored:\n%s", after)
+		}
+		if got, _ := repo.Get(ctx, m.ID); got.Body != "first" {
+			t.Fatalf("index changed by a failed commit: %+v", got)
+		}
+		created := &domain.Memo{ID: uuid.New(), Body: "new", Tags: []string{}, CreatedAt: at, UpdatedAt: at}
+		if err := repo.Create(ctx, created); err == nil {
+			t.Fatal("expected the commit to fail")
+		}
+		if _, err := os.Stat(filepath.Join(dir, created.ID.String()+".md")); !os.IsNotExist(err) {
+			t.Fatalf("file of a failed create left behind: %v", err)
+		}
+		if err := os.Remove(broken); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(broken+".bak", broken); err != nil {
+			t.Fatal(err)
+		}
+		g, err := git.PlainOpen(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wt, err := g.Worktree()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status, err := wt.Status(); err != nil || !status.IsClean() {
+			t.Fatalf("failed changes left in the worktree: %v %v", status, err)
+		}
+	}
+	if err := repo.Update(ctx, &domain.Memo{ID: m.ID, Title: "Plan", Body: "second", Tags: []string{}, UpdatedAt: at}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Files edited by hand may use CRLF or be broken; broken ones are
+	// skipped.
+	crlf := uuid.New()
+	src := "---\r\nid: " + crlf.String() + "\r\ntitle: Windows\r\ntags: [a]\r\n---\r\nline one\r\nline two\r\n"
+	if err := os.WriteFile(filepath.Join(dir, crlf.String()+".md"), []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "broken.md"), []byte("---\nid: [\n---\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := NewGitMemoRepository(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := reopened.Get(ctx, crlf); err != nil || got.Title != "Windows" || got.Body != "line one\r\nline two\r\n" || got.Tags[0] != "a" {
+		t.Fatalf("unexpected CRLF memo %+v %v", got, err)
+	}
+	if got, err := reopened.Get(ctx, m.ID); err != nil || got.Body != "second" {
+		t.Fatalf("unexpected memo after reopening %+v %v", got, err)
+	}
+}
@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	domainRepo "github.com/peconote/peconote/internal/domain/repository"
+)
+
+type memoImportRepository struct {
+	db *sqlx.DB
+}
+
+func NewMemoImportRepository(db *sqlx.DB) domainRepo.MemoImportRepository {
+	return &memoImportRepository{db: db}
+}
+
+func (r *memoImportRepository) IsImported(ctx context.Context, sourceKey string) (bool, error) {
+	var exists bool
+	err := conn(ctx, r.db).GetContext(ctx, &exists, `SELECT EXISTS (SELECT 1 FROM memo_import WHERE source_key = $1)`, sourceKey)
+	return exists, err
+}
+
+func (r *memoImportRepository) MarkImported(ctx context.Context, sourceKey, sourcePath string, memoID uuid.UUID) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx,
+		`INSERT INTO memo_import (source_key, memo_id, source_path, imported_at) VALUES ($1, $2, $3, $4)`,
+		sourceKey, memoID, sourcePath, time.Now().UTC())
+	return err
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/peconote/peconote/internal/domain"
+	domainRepo "github.com/peconote/peconote/internal/domain/repository"
+)
+
+type memoLinkRepository struct {
+	db *sqlx.DB
+}
+
+func NewMemoLinkRepository(db *sqlx.DB) domainRepo.MemoLinkRepository {
+	return &memoLinkRepository{db: db}
+}
+
+type memoLinkRow struct {
+	SourceID  uuid.UUID     `db:"source_id"`
+	TargetRef string        `db:"target_ref"`
+	TargetID  uuid.NullUUID `db:"target_id"`
+}
+
+func (row memoLinkRow) toDomain() domain.MemoLink {
+	l := domain.MemoLink{SourceID: row.SourceID, TargetRef: row.TargetRef}
+	if row.TargetID.Valid {
+		id := row.TargetID.UUID
+		l.TargetID = &id
+	}
+	return l
+}
+
+func (r *memoLinkRepository) Resolve(ctx context.Context, refs []string) (map[string]uuid.UUID, error) {
+	resolved := make(map[string]uuid.UUID, len(refs))
+	if len(refs) == 0 {
+		return resolved, nil
+	}
+	type resolveRow struct {
+		Ref string    `db:"ref"`
+		ID  uuid.UUID `db:"id"`
+	}
+	var rows []resolveRow
+	query := `SELECT DISTINCT ON (ref) ref, memo.id
+FROM unnest($1::text[]) AS ref
+JOIN memo ON memo.id::text = lower(ref) OR lower(memo.title) = lower(ref)
+ORDER BY ref, (memo.id::text = lower(ref)) DESC, memo.created_at`
+	if err := conn(ctx, r.db).SelectContext(ctx, &rows, query, pq.StringArray(refs)); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		resolved[row.Ref] = row.ID
+	}
+	return resolved, nil
+}
+
+func (r *memoLinkRepository) Replace(ctx context.Context, sourceID uuid.UUID, links []domain.MemoLink) error {
+	return withTx(ctx, r.db, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM memo_link WHERE source_id = $1`, sourceID); err != nil {
+			return err
+		}
+		for _, l := range links {
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO memo_link (source_id, target_ref, target_id) VALUES ($1, $2, $3)`,
+				sourceID, l.TargetRef, l.TargetID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *memoLinkRepository) Retarget(ctx context.Context, targetID uuid.UUID, title string) error {
+	return withTx(ctx, r.db, func(tx *sqlx.Tx) error {
+		// Stale links fall back to another memo with the title, as Resolve
+		// picks it, or become broken.
+		_, err := tx.ExecContext(ctx, `UPDATE memo_link SET target_id = (
+	SELECT memo.id FROM memo
+	WHERE lower(memo.title) = lower(memo_link.target_ref) AND memo.id <> $1
+	ORDER BY memo.created_at LIMIT 1
+)
+WHERE target_id = $1 AND lower(target_ref) <> lower($2) AND lower(target_ref) <> $1::text`, targetID, title)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE memo_link SET target_id = $1
+WHERE target_id IS NULL AND (lower(target_ref) = lower($2) OR lower(target_ref) = $1::text)`, targetID, title)
+		return err
+	})
+}
+
+func (r *memoLinkRepository) ListOutgoing(ctx context.Context, sourceID uuid.UUID) ([]domain.MemoLink, error) {
+	return r.list(ctx, `SELECT source_id, target_ref, target_id FROM memo_link WHERE source_id = $1 ORDER BY target_ref`, sourceID)
+}
+
+func (r *memoLinkRepository) ListBacklinks(ctx context.Context, targetID uuid.UUID) ([]domain.MemoLink, error) {
+	return r.list(ctx, `SELECT source_id, target_ref, target_id FROM memo_link WHERE target_id = $1 ORDER BY source_id`, targetID)
+}
+
+func (r *memoLinkRepository) ListBroken(ctx context.Context) ([]domain.MemoLink, error) {
+	return r.list(ctx, `SELECT source_id, target_ref, target_id FROM memo_link WHERE target_id IS NULL ORDER BY source_id, target_ref`)
+}
+
+func (r *memoLinkRepository) list(ctx context.Context, query string, args ...interface{}) ([]domain.MemoLink, error) {
+	var rows []memoLinkRow
+	if err := conn(ctx, r.db).SelectContext(ctx, &rows, query, args...); err != nil {
+		return nil, err
+	}
+	links := make([]domain.MemoLink, len(rows))
+	for i, row := range rows {
+		links[i] = row.toDomain()
+	}
+	return links, nil
+}
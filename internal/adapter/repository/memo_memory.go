@@ -0,0 +1,257 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/domain/model"
+	domainRepo "github.com/peconote/peconote/internal/domain/repository"
+)
+
+var errDuplicateMemo = errors.New("duplicate memo id")
+
+// memoryMemoRepository keeps memos in memory. It is safe for concurrent
+// use, but is not transactional: changes made inside a transaction are
+// not rolled back.
+type memoryMemoRepository struct {
+	mu    sync.RWMutex
+	memos map[uuid.UUID]*domain.Memo
+}
+
+func NewMemoryMemoRepository() domainRepo.MemoRepository {
+	return &memoryMemoRepository{memos: map[uuid.UUID]*domain.Memo{}}
+}
+
+// copyMemo keeps callers from sharing memos, or their tags, with the
+// repository.
+func copyMemo(m *domain.Memo) *domain.Memo {
+	c := *m
+	c.Tags = append([]string{}, m.Tags...)
+	return &c
+}
+
+func (r *memoryMemoRepository) Create(ctx context.Context, m *domain.Memo) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.memos[m.ID]; ok {
+		return errDuplicateMemo
+	}
+	r.memos[m.ID] = copyMemo(m)
+	return nil
+}
+
+// memorySearchDocument matches search terms the way the SQLite repository
+// does.
+func memorySearchDocument(m *domain.Memo) string {
+	return strings.ToLower(m.Title + " " + m.Body)
+}
+
+func memoryMemoMatches(m *domain.Memo, f model.MemoFilter) bool {
+	if (f.Pinned != nil && m.Pinned != *f.Pinned) ||
+		(f.Archived != nil && m.Archived != *f.Archived) ||
+		(f.Favorite != nil && m.Favorite != *f.Favorite) {
+		return false
+	}
+	if (f.CreatedAfter != nil && m.CreatedAt.Before(*f.CreatedAfter)) ||
+		(f.CreatedBefore != nil && !m.CreatedAt.Before(*f.CreatedBefore)) ||
+		(f.UpdatedAfter != nil && m.UpdatedAt.Before(*f.UpdatedAfter)) ||
+		(f.UpdatedBefore != nil && !m.UpdatedAt.Before(*f.UpdatedBefore)) {
+		return false
+	}
+	if f.Tag != nil && !containsTag(m.Tags, *f.Tag) {
+		return false
+	}
+	doc := memorySearchDocument(m)
+	for _, term := range sqliteSearchTerms(f) {
+		if !strings.Contains(doc, term) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// filter returns copies of the matching memos in no particular order.
+func (r *memoryMemoRepository) filter(f model.MemoFilter) []*domain.Memo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []*domain.Memo
+	for _, m := range r.memos {
+		if memoryMemoMatches(m, f) {
+			out = append(out, copyMemo(m))
+		}
+	}
+	return out
+}
+
+// memoryLess orders memos like memoOrderBy.
+func memoryLess(a, b *domain.Memo, s model.MemoSort, f model.MemoFilter) bool {
+	if a.Pinned != b.Pinned {
+		return a.Pinned
+	}
+	var cmp int
+	switch s.Field {
+	case model.MemoSortUpdatedAt:
+		cmp = compareInt64(a.UpdatedAt.UnixNano(), b.UpdatedAt.UnixNano())
+	case model.MemoSortBodyLength:
+		cmp = compareInt64(int64(utf8.RuneCountInString(a.Body)), int64(utf8.RuneCountInString(b.Body)))
+	case model.MemoSortRelevance:
+		cmp = compareInt64(int64(memoryRelevance(a, f)), int64(memoryRelevance(b, f)))
+	default:
+		cmp = compareInt64(a.CreatedAt.UnixNano(), b.CreatedAt.UnixNano())
+	}
+	if cmp == 0 {
+		cmp = strings.Compare(a.ID.String(), b.ID.String())
+	}
+	if s.Asc {
+		return cmp < 0
+	}
+	return cmp > 0
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func memoryRelevance(m *domain.Memo, f model.MemoFilter) int {
+	doc := memorySearchDocument(m)
+	n := 0
+	for _, term := range sqliteSearchTerms(f) {
+		n += strings.Count(doc, term)
+	}
+	return n
+}
+
+func (r *memoryMemoRepository) List(ctx context.Context, f model.MemoFilter, s model.MemoSort, limit, offset int) ([]*domain.Memo, int, error) {
+	memos := r.filter(f)
+	sort.Slice(memos, func(i, j int) bool { return memoryLess(memos[i], memos[j], s, f) })
+	total := len(memos)
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	return memos[offset:end], total, nil
+}
+
+func (r *memoryMemoRepository) Stream(ctx context.Context, f model.MemoFilter, fn func(*domain.Memo) error) error {
+	memos := r.filter(f)
+	sort.Slice(memos, func(i, j int) bool {
+		a, b := memos[i], memos[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID.String() < b.ID.String()
+	})
+	for _, m := range memos {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *memoryMemoRepository) Stats(ctx context.Context) (domain.MemoStats, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tags := map[string]struct{}{}
+	for _, m := range r.memos {
+		for _, t := range m.Tags {
+			tags[t] = struct{}{}
+		}
+	}
+	return domain.MemoStats{Memos: len(r.memos), Tags: len(tags)}, nil
+}
+
+func (r *memoryMemoRepository) Get(ctx context.Context, id uuid.UUID) (*domain.Memo, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	m, ok := r.memos[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return copyMemo(m), nil
+}
+
+func (r *memoryMemoRepository) Update(ctx context.Context, m *domain.Memo) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cur, ok := r.memos[m.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	cur.Title, cur.Body, cur.UpdatedAt = m.Title, m.Body, m.UpdatedAt
+	cur.Tags = append([]string{}, m.Tags...)
+	return nil
+}
+
+func (r *memoryMemoRepository) UpdateBody(ctx context.Context, id uuid.UUID, base, body string, updatedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cur, ok := r.memos[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if cur.Body != base {
+		return domainRepo.ErrMemoChanged
+	}
+	cur.Body, cur.UpdatedAt = body, updatedAt
+	return nil
+}
+
+func (r *memoryMemoRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.memos[id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(r.memos, id)
+	return nil
+}
+
+func (r *memoryMemoRepository) SetFlag(ctx context.Context, id uuid.UUID, flag domain.MemoFlag, value bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m, ok := r.memos[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	switch flag {
+	case domain.MemoFlagPinned:
+		m.Pinned = value
+	case domain.MemoFlagArchived:
+		m.Archived = value
+	case domain.MemoFlagFavorite:
+		m.Favorite = value
+	default:
+		return errUnknownMemoFlag
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/domain/model"
+	domainRepo "github.com/peconote/peconote/internal/domain/repository"
+)
+
+// mysqlMemoRepository stores memos in MySQL. Tags live in the memo_tag
+// join table and search uses the FULLTEXT index with the ngram parser.
+// InnoDB indexes text on commit, so a search inside a transaction misses
+// memos written by it.
+type mysqlMemoRepository struct {
+	db *sqlx.DB
+}
+
+func NewMySQLMemoRepository(db *sqlx.DB) domainRepo.MemoRepository {
+	return &mysqlMemoRepository{db: db}
+}
+
+type mysqlMemoRow struct {
+	ID        uuid.UUID `db:"id"`
+	Title     string    `db:"title"`
+	Body      string    `db:"body"`
+	Tags      string    `db:"tags"`
+	Pinned    bool      `db:"pinned"`
+	Archived  bool      `db:"archived"`
+	Favorite  bool      `db:"favorite"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+func (row mysqlMemoRow) toDomain() (*domain.Memo, error) {
+	var tags []string
+	if err := json.Unmarshal([]byte(row.Tags), &tags); err != nil {
+		return nil, err
+	}
+	return &domain.Memo{
+		ID:        row.ID,
+		Title:     row.Title,
+		Body:      row.Body,
+		Tags:      tags,
+		Pinned:    row.Pinned,
+		Archived:  row.Archived,
+		Favorite:  row.Favorite,
+		CreatedAt: row.CreatedAt.UTC(),
+		UpdatedAt: row.UpdatedAt.UTC(),
+	}, nil
+}
+
+// JSON_ARRAYAGG does not take an ORDER BY, so the tag array is built with
+// GROUP_CONCAT to keep the tags in order.
+const mysqlMemoColumns = `id, title, body, pinned, archived, favorite, created_at, updated_at,
+	(SELECT COALESCE(CONCAT('[', GROUP_CONCAT(JSON_QUOTE(tag) ORDER BY position SEPARATOR ','), ']'), '[]')
+		FROM memo_tag WHERE memo_id = memo.id) AS tags`
+
+func (r *mysqlMemoRepository) Create(ctx context.Context, m *domain.Memo) error {
+	return withTx(ctx, r.db, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO memo (id, title, body, pinned, archived, favorite, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			m.ID, m.Title, m.Body, m.Pinned, m.Archived, m.Favorite, m.CreatedAt.UTC(), m.UpdatedAt.UTC())
+		if err != nil {
+			return err
+		}
+		return insertMemoTags(ctx, tx, m.ID, m.Tags)
+	})
+}
+
+const mysqlMemoMatch = `MATCH (title, body) AGAINST (? IN BOOLEAN MODE)`
+
+// mysqlSearchQuery turns the search into a boolean mode query requiring
+// every term. Terms are quoted as phrases, which the ngram parser matches
+// as consecutive n-grams, and lose any quotes of their own.
+func mysqlSearchQuery(f model.MemoFilter) string {
+	if f.Search == nil {
+		return ""
+	}
+	var terms []string
+	for _, term := range strings.Fields(strings.ReplaceAll(*f.Search, `"`, " ")) {
+		terms = append(terms, `+"`+term+`"`)
+	}
+	return strings.Join(terms, " ")
+}
+
+func mysqlMemoFilter(f model.MemoFilter) (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		conds = append(conds, cond)
+		args = append(args, arg)
+	}
+	if f.Tag != nil {
+		add(`EXISTS (SELECT 1 FROM memo_tag WHERE memo_tag.memo_id = memo.id AND memo_tag.tag = ?)`, *f.Tag)
+	}
+	if f.Pinned != nil {
+		add(`pinned = ?`, *f.Pinned)
+	}
+	if f.Archived != nil {
+		add(`archived = ?`, *f.Archived)
+	}
+	if f.Favorite != nil {
+		add(`favorite = ?`, *f.Favorite)
+	}
+	if q := mysqlSearchQuery(f); q != "" {
+		add(mysqlMemoMatch, q)
+	}
+	for _, b := range []struct {
+		cond string
+		t    *time.Time
+	}{
+		{`created_at >= ?`, f.CreatedAfter},
+		{`created_at < ?`, f.CreatedBefore},
+		{`updated_at >= ?`, f.UpdatedAfter},
+		{`updated_at < ?`, f.UpdatedBefore},
+	} {
+		if b.t != nil {
+			add(b.cond, b.t.UTC())
+		}
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+// mysqlMemoOrderBy mirrors memoOrderBy. Relevance is the FULLTEXT score,
+// which needs the search query as an argument.
+func mysqlMemoOrderBy(sort model.MemoSort, f model.MemoFilter) (string, []interface{}) {
+	var column string
+	var args []interface{}
+	switch sort.Field {
+	case model.MemoSortUpdatedAt:
+		column = "updated_at"
+	case model.MemoSortBodyLength:
+		column = "CHAR_LENGTH(body)"
+	case model.MemoSortRelevance:
+		column = "0"
+		if q := mysqlSearchQuery(f); q != "" {
+			column = mysqlMemoMatch
+			args = append(args, q)
+		}
+	default:
+		column = "created_at"
+	}
+	dir := "DESC"
+	if sort.Asc {
+		dir = "ASC"
+	}
+	return "ORDER BY pinned DESC, " + column + " " + dir + ", id " + dir, args
+}
+
+func (r *mysqlMemoRepository) List(ctx context.Context, f model.MemoFilter, sort model.MemoSort, limit, offset int) ([]*domain.Memo, int, error) {
+	where, args := mysqlMemoFilter(f)
+	orderBy, orderArgs := mysqlMemoOrderBy(sort, f)
+	query := `SELECT ` + mysqlMemoColumns + ` FROM memo ` + where + ` ` + orderBy + ` LIMIT ? OFFSET ?`
+	queryArgs := append(append(append([]interface{}{}, args...), orderArgs...), limit, offset)
+	var rows []mysqlMemoRow
+	if err := conn(ctx, r.db).SelectContext(ctx, &rows, query, queryArgs...); err != nil {
+		return nil, 0, err
+	}
+	memos := make([]*domain.Memo, len(rows))
+	for i, row := range rows {
+		m, err := row.toDomain()
+		if err != nil {
+			return nil, 0, err
+		}
+		memos[i] = m
+	}
+	var total int
+	if err := conn(ctx, r.db).GetContext(ctx, &total, `SELECT COUNT(*) FROM memo `+where, args...); err != nil {
+		return nil, 0, err
+	}
+	return memos, total, nil
+}
+
+func (r *mysqlMemoRepository) Stream(ctx context.Context, f model.MemoFilter, fn func(*domain.Memo) error) error {
+	where, args := mysqlMemoFilter(f)
+	rows, err := conn(ctx, r.db).QueryxContext(ctx, `SELECT `+mysqlMemoColumns+` FROM memo `+where+` ORDER BY created_at, id`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var row mysqlMemoRow
+		if err := rows.StructScan(&row); err != nil {
+			return err
+		}
+		m, err := row.toDomain()
+		if err != nil {
+			return err
+		}
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (r *mysqlMemoRepository) Get(ctx context.Context, id uuid.UUID) (*domain.Memo, error) {
+	var row mysqlMemoRow
+	if err := conn(ctx, r.db).GetContext(ctx, &row, `SELECT `+mysqlMemoColumns+` FROM memo WHERE id = ?`, id); err != nil {
+		return nil, err
+	}
+	return row.toDomain()
+}
+
+func (r *mysqlMemoRepository) Update(ctx context.Context, m *domain.Memo) error {
+	return withTx(ctx, r.db, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, `UPDATE memo SET title = ?, body = ?, updated_at = ? WHERE id = ?`,
+			m.Title, m.Body, m.UpdatedAt.UTC(), m.ID)
+		if err != nil {
+			return err
+		}
+		if cnt, err := res.RowsAffected(); err == nil && cnt == 0 {
+			return sql.ErrNoRows
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM memo_tag WHERE memo_id = ?`, m.ID); err != nil {
+			return err
+		}
+		return insertMemoTags(ctx, tx, m.ID, m.Tags)
+	})
+}
+
+func (r *mysqlMemoRepository) UpdateBody(ctx context.Context, id uuid.UUID, base, body string, updatedAt time.Time) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE memo SET body = ?, updated_at = ? WHERE id = ? AND body = ?`, body, updatedAt.UTC(), id, base)
+	if err != nil {
+		return err
+	}
+	if cnt, err := res.RowsAffected(); err == nil && cnt == 0 {
+		return memoChangedOrMissing(ctx, conn(ctx, r.db), `SELECT 1 FROM memo WHERE id = ?`, id)
+	}
+	return nil
+}
+
+func (r *mysqlMemoRepository) Stats(ctx context.Context) (domain.MemoStats, error) {
+	return memoTagStats(ctx, conn(ctx, r.db))
+}
+
+func (r *mysqlMemoRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM memo WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if cnt, err := res.RowsAffected(); err == nil && cnt == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *mysqlMemoRepository) SetFlag(ctx context.Context, id uuid.UUID, flag domain.MemoFlag, value bool) error {
+	column, ok := memoFlagColumns[flag]
+	if !ok {
+		return errUnknownMemoFlag
+	}
+	res, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE memo SET `+column+` = ? WHERE id = ?`, value, id)
+	if err != nil {
+		return err
+	}
+	if cnt, err := res.RowsAffected(); err == nil && cnt == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -3,15 +3,25 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/domain/model"
 	domainRepo "github.com/peconote/peconote/internal/domain/repository"
 )
 
+var errUnknownMemoFlag = errors.New("unknown memo flag")
+
+var memoFlagColumns = map[domain.MemoFlag]string{
+	domain.MemoFlagPinned:   "pinned",
+	domain.MemoFlagArchived: "archived",
+	domain.MemoFlagFavorite: "favorite",
+}
+
 type memoRepository struct {
 	db *sqlx.DB
 }
@@ -20,80 +30,150 @@ func NewMemoRepository(db *sqlx.DB) domainRepo.MemoRepository {
 	return &memoRepository{db: db}
 }
 
+type memoRow struct {
+	ID        uuid.UUID      `db:"id"`
+	Title     string         `db:"title"`
+	Body      string         `db:"body"`
+	Tags      pq.StringArray `db:"tags"`
+	Pinned    bool           `db:"pinned"`
+	Archived  bool           `db:"archived"`
+	Favorite  bool           `db:"favorite"`
+	CreatedAt time.Time      `db:"created_at"`
+	UpdatedAt time.Time      `db:"updated_at"`
+}
+
+func (row memoRow) toDomain() *domain.Memo {
+	return &domain.Memo{
+		ID:        row.ID,
+		Title:     row.Title,
+		Body:      row.Body,
+		Tags:      []string(row.Tags),
+		Pinned:    row.Pinned,
+		Archived:  row.Archived,
+		Favorite:  row.Favorite,
+		CreatedAt: row.CreatedAt,
+		UpdatedAt: row.UpdatedAt,
+	}
+}
+
 func (r *memoRepository) Create(ctx context.Context, m *domain.Memo) error {
-	query := `INSERT INTO memo (id, body, tags, created_at, updated_at) VALUES (:id, :body, :tags, :created_at, :updated_at)`
-	_, err := r.db.NamedExecContext(ctx, query, map[string]interface{}{
+	query := `INSERT INTO memo (id, title, body, tags, pinned, archived, favorite, created_at, updated_at)
+VALUES (:id, :title, :body, :tags, :pinned, :archived, :favorite, :created_at, :updated_at)`
+	_, err := conn(ctx, r.db).NamedExecContext(ctx, query, map[string]interface{}{
 		"id":         m.ID,
+		"title":      m.Title,
 		"body":       m.Body,
 		"tags":       pq.StringArray(m.Tags),
+		"pinned":     m.Pinned,
+		"archived":   m.Archived,
+		"favorite":   m.Favorite,
 		"created_at": m.CreatedAt,
 		"updated_at": m.UpdatedAt,
 	})
 	return err
 }
 
-func (r *memoRepository) List(ctx context.Context, tag *string, limit, offset int) ([]*domain.Memo, int, error) {
-	type memoRow struct {
-		ID        uuid.UUID      `db:"id"`
-		Body      string         `db:"body"`
-		Tags      pq.StringArray `db:"tags"`
-		CreatedAt time.Time      `db:"created_at"`
-		UpdatedAt time.Time      `db:"updated_at"`
+const memoSearchDocument = `to_tsvector('simple', title || ' ' || body)`
+
+const memoFilterWhere = `WHERE ($1::text IS NULL OR $1 = ANY(tags))
+	AND ($2::boolean IS NULL OR pinned = $2)
+	AND ($3::boolean IS NULL OR archived = $3)
+	AND ($4::boolean IS NULL OR favorite = $4)
+	AND ($5::text IS NULL OR ` + memoSearchDocument + ` @@ plainto_tsquery('simple', $5))
+	AND ($6::timestamptz IS NULL OR created_at >= $6)
+	AND ($7::timestamptz IS NULL OR created_at < $7)
+	AND ($8::timestamptz IS NULL OR updated_at >= $8)
+	AND ($9::timestamptz IS NULL OR updated_at < $9)`
+
+func memoFilterArgs(f model.MemoFilter) []interface{} {
+	return []interface{}{
+		f.Tag, f.Pinned, f.Archived, f.Favorite, f.Search,
+		f.CreatedAfter, f.CreatedBefore, f.UpdatedAfter, f.UpdatedBefore,
 	}
+}
 
+var memoSortColumns = map[model.MemoSortField]string{
+	model.MemoSortCreatedAt:  "created_at",
+	model.MemoSortUpdatedAt:  "updated_at",
+	model.MemoSortRelevance:  "ts_rank(" + memoSearchDocument + ", plainto_tsquery('simple', coalesce($5, '')))",
+	model.MemoSortBodyLength: "char_length(body)",
+}
+
+// memoOrderBy only ever emits expressions from memoSortColumns, so the
+// result is safe to concatenate into a query.
+func memoOrderBy(sort model.MemoSort) string {
+	column, ok := memoSortColumns[sort.Field]
+	if !ok {
+		column = memoSortColumns[model.MemoSortCreatedAt]
+	}
+	dir := "DESC"
+	if sort.Asc {
+		dir = "ASC"
+	}
+	return "ORDER BY pinned DESC, " + column + " " + dir + ", id " + dir
+}
+
+func (r *memoRepository) List(ctx context.Context, f model.MemoFilter, sort model.MemoSort, limit, offset int) ([]*domain.Memo, int, error) {
 	var rows []memoRow
-	query := `SELECT id, body, tags, created_at, updated_at
+	query := `SELECT id, title, body, tags, pinned, archived, favorite, created_at, updated_at
 FROM memo
-WHERE ($1::text IS NULL OR $1 = ANY(tags))
-ORDER BY created_at DESC
-LIMIT $2 OFFSET $3`
-	if err := r.db.SelectContext(ctx, &rows, query, tag, limit, offset); err != nil {
+` + memoFilterWhere + `
+` + memoOrderBy(sort) + `
+LIMIT $10 OFFSET $11`
+	args := memoFilterArgs(f)
+	if err := conn(ctx, r.db).SelectContext(ctx, &rows, query, append(args, limit, offset)...); err != nil {
 		return nil, 0, err
 	}
 	memos := make([]*domain.Memo, len(rows))
 	for i, row := range rows {
-		memos[i] = &domain.Memo{
-			ID:        row.ID,
-			Body:      row.Body,
-			Tags:      []string(row.Tags),
-			CreatedAt: row.CreatedAt,
-			UpdatedAt: row.UpdatedAt,
-		}
+		memos[i] = row.toDomain()
 	}
 	var total int
-	countQuery := `SELECT COUNT(*) FROM memo WHERE ($1::text IS NULL OR $1 = ANY(tags))`
-	if err := r.db.GetContext(ctx, &total, countQuery, tag); err != nil {
+	countQuery := `SELECT COUNT(*) FROM memo ` + memoFilterWhere
+	if err := conn(ctx, r.db).GetContext(ctx, &total, countQuery, args...); err != nil {
 		return nil, 0, err
 	}
 	return memos, total, nil
 }
 
-func (r *memoRepository) Get(ctx context.Context, id uuid.UUID) (*domain.Memo, error) {
-	type memoRow struct {
-		ID        uuid.UUID      `db:"id"`
-		Body      string         `db:"body"`
-		Tags      pq.StringArray `db:"tags"`
-		CreatedAt time.Time      `db:"created_at"`
-		UpdatedAt time.Time      `db:"updated_at"`
+// Stream reads rows from the open result cursor one at a time; lib/pq does
+// not buffer the result set, so memory use does not grow with its size.
+func (r *memoRepository) Stream(ctx context.Context, f model.MemoFilter, fn func(*domain.Memo) error) error {
+	query := `SELECT id, title, body, tags, pinned, archived, favorite, created_at, updated_at
+FROM memo
+` + memoFilterWhere + `
+ORDER BY created_at, id`
+	rows, err := conn(ctx, r.db).QueryxContext(ctx, query, memoFilterArgs(f)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var row memoRow
+		if err := rows.StructScan(&row); err != nil {
+			return err
+		}
+		if err := fn(row.toDomain()); err != nil {
+			return err
+		}
 	}
+	return rows.Err()
+}
+
+func (r *memoRepository) Get(ctx context.Context, id uuid.UUID) (*domain.Memo, error) {
 	var row memoRow
-	query := `SELECT id, body, tags, created_at, updated_at FROM memo WHERE id = $1`
-	if err := r.db.GetContext(ctx, &row, query, id); err != nil {
+	query := `SELECT id, title, body, tags, pinned, archived, favorite, created_at, updated_at FROM memo WHERE id = $1`
+	if err := conn(ctx, r.db).GetContext(ctx, &row, query, id); err != nil {
 		return nil, err
 	}
-	return &domain.Memo{
-		ID:        row.ID,
-		Body:      row.Body,
-		Tags:      []string(row.Tags),
-		CreatedAt: row.CreatedAt,
-		UpdatedAt: row.UpdatedAt,
-	}, nil
+	return row.toDomain(), nil
 }
 
 func (r *memoRepository) Update(ctx context.Context, m *domain.Memo) error {
-	query := `UPDATE memo SET body = :body, tags = :tags, updated_at = :updated_at WHERE id = :id`
-	res, err := r.db.NamedExecContext(ctx, query, map[string]interface{}{
+	query := `UPDATE memo SET title = :title, body = :body, tags = :tags, updated_at = :updated_at WHERE id = :id`
+	res, err := conn(ctx, r.db).NamedExecContext(ctx, query, map[string]interface{}{
 		"id":         m.ID,
+		"title":      m.Title,
 		"body":       m.Body,
 		"tags":       pq.StringArray(m.Tags),
 		"updated_at": m.UpdatedAt,
@@ -107,8 +187,57 @@ func (r *memoRepository) Update(ctx context.Context, m *domain.Memo) error {
 	return nil
 }
 
+func (r *memoRepository) UpdateBody(ctx context.Context, id uuid.UUID, base, body string, updatedAt time.Time) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE memo SET body = $3, updated_at = $4 WHERE id = $1 AND body = $2`, id, base, body, updatedAt)
+	if err != nil {
+		return err
+	}
+	if cnt, err := res.RowsAffected(); err == nil && cnt == 0 {
+		return memoChangedOrMissing(ctx, conn(ctx, r.db), `SELECT 1 FROM memo WHERE id = $1`, id)
+	}
+	return nil
+}
+
+// memoChangedOrMissing tells why a conditional update of a memo matched no
+// row, given a query selecting the memo.
+func memoChangedOrMissing(ctx context.Context, c sqlxConn, query string, id uuid.UUID) error {
+	var found int
+	if err := c.GetContext(ctx, &found, query, id); err != nil {
+		return err
+	}
+	return domainRepo.ErrMemoChanged
+}
+
+type memoStatsRow struct {
+	Memos int `db:"memos"`
+	Tags  int `db:"tags"`
+}
+
+func (r *memoRepository) Stats(ctx context.Context) (domain.MemoStats, error) {
+	var row memoStatsRow
+	err := conn(ctx, r.db).GetContext(ctx, &row, `SELECT
+    (SELECT COUNT(*) FROM memo) AS memos,
+    (SELECT COUNT(DISTINCT tag) FROM memo, unnest(tags) AS tag) AS tags`)
+	return domain.MemoStats{Memos: row.Memos, Tags: row.Tags}, err
+}
+
 func (r *memoRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	res, err := r.db.ExecContext(ctx, `DELETE FROM memo WHERE id = $1`, id)
+	res, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM memo WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if cnt, err := res.RowsAffected(); err == nil && cnt == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *memoRepository) SetFlag(ctx context.Context, id uuid.UUID, flag domain.MemoFlag, value bool) error {
+	column, ok := memoFlagColumns[flag]
+	if !ok {
+		return errUnknownMemoFlag
+	}
+	res, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE memo SET `+column+` = $2 WHERE id = $1`, id, value)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	domainRepo "github.com/peconote/peconote/internal/domain/repository"
+	"github.com/peconote/peconote/internal/domain/repository/repotest"
+	"github.com/peconote/peconote/internal/infrastructure/db"
+)
+
+func TestMemoryMemoRepository(t *testing.T) {
+	repotest.TestMemoRepository(t, func(t *testing.T) domainRepo.MemoRepository {
+		return NewMemoryMemoRepository()
+	})
+}
+
+func TestSQLiteMemoRepository(t *testing.T) {
+	repotest.TestMemoRepository(t, func(t *testing.T) domainRepo.MemoRepository {
+		sqliteDB, err := db.OpenSQLite(filepath.Join(t.TempDir(), "memo.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { sqliteDB.Close() })
+		migrateUp(t, sqliteDB)
+		return NewSQLiteMemoRepository(sqliteDB)
+	})
+}
+
+func TestGitMemoRepository(t *testing.T) {
+	repotest.TestMemoRepository(t, func(t *testing.T) domainRepo.MemoRepository {
+		repo, err := NewGitMemoRepository(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repo
+	})
+}
+
+// TestPostgresMemoRepository runs against the database in
+// TEST_DATABASE_URL, which is emptied first.
+func TestPostgresMemoRepository(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	pgDB, err := sqlx.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pgDB.Close()
+	migrateUp(t, pgDB)
+	repotest.TestMemoRepository(t, func(t *testing.T) domainRepo.MemoRepository {
+		if _, err := pgDB.Exec(`TRUNCATE memo CASCADE`); err != nil {
+			t.Fatal(err)
+		}
+		return NewMemoRepository(pgDB)
+	})
+}
+
+// TestMySQLMemoRepository runs against the database in TEST_MYSQL_URL, a
+// mysql:// URL, which is emptied first.
+func TestMySQLMemoRepository(t *testing.T) {
+	dsn := os.Getenv("TEST_MYSQL_URL")
+	if dsn == "" {
+		t.Skip("TEST_MYSQL_URL is not set")
+	}
+	mysqlDB, err := db.OpenMySQL(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mysqlDB.Close()
+	migrationDB, err := db.OpenMigrations(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer migrationDB.Close()
+	migrateUp(t, migrationDB)
+	repotest.TestMemoRepository(t, func(t *testing.T) domainRepo.MemoRepository {
+		if _, err := mysqlDB.Exec(`DELETE FROM memo`); err != nil {
+			t.Fatal(err)
+		}
+		return NewMySQLMemoRepository(mysqlDB)
+	})
+}
+
+func migrateUp(t *testing.T, memoDB *sqlx.DB) {
+	t.Helper()
+	m, err := db.MemoMigrator(memoDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,286 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/domain/model"
+	domainRepo "github.com/peconote/peconote/internal/domain/repository"
+)
+
+// sqliteMemoRepository stores memos in SQLite. Tags live in the memo_tag
+// join table and timestamps are Unix nanoseconds.
+type sqliteMemoRepository struct {
+	db *sqlx.DB
+}
+
+func NewSQLiteMemoRepository(db *sqlx.DB) domainRepo.MemoRepository {
+	return &sqliteMemoRepository{db: db}
+}
+
+type sqliteMemoRow struct {
+	ID        uuid.UUID `db:"id"`
+	Title     string    `db:"title"`
+	Body      string    `db:"body"`
+	Tags      string    `db:"tags"`
+	Pinned    bool      `db:"pinned"`
+	Archived  bool      `db:"archived"`
+	Favorite  bool      `db:"favorite"`
+	CreatedAt int64     `db:"created_at"`
+	UpdatedAt int64     `db:"updated_at"`
+}
+
+func (row sqliteMemoRow) toDomain() (*domain.Memo, error) {
+	var tags []string
+	if err := json.Unmarshal([]byte(row.Tags), &tags); err != nil {
+		return nil, err
+	}
+	return &domain.Memo{
+		ID:        row.ID,
+		Title:     row.Title,
+		Body:      row.Body,
+		Tags:      tags,
+		Pinned:    row.Pinned,
+		Archived:  row.Archived,
+		Favorite:  row.Favorite,
+		CreatedAt: time.Unix(0, row.CreatedAt).UTC(),
+		UpdatedAt: time.Unix(0, row.UpdatedAt).UTC(),
+	}, nil
+}
+
+const sqliteMemoColumns = `id, title, body, pinned, archived, favorite, created_at, updated_at,
+	(SELECT json_group_array(tag) FROM (SELECT tag FROM memo_tag WHERE memo_id = memo.id ORDER BY position)) AS tags`
+
+func (r *sqliteMemoRepository) Create(ctx context.Context, m *domain.Memo) error {
+	return withTx(ctx, r.db, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO memo (id, title, body, pinned, archived, favorite, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			m.ID, m.Title, m.Body, m.Pinned, m.Archived, m.Favorite, m.CreatedAt.UnixNano(), m.UpdatedAt.UnixNano())
+		if err != nil {
+			return err
+		}
+		return insertMemoTags(ctx, tx, m.ID, m.Tags)
+	})
+}
+
+// memoTagStats counts the memos and distinct tags of the SQLite and MySQL
+// schemas, which keep tags in memo_tag.
+func memoTagStats(ctx context.Context, c sqlxConn) (domain.MemoStats, error) {
+	var row memoStatsRow
+	err := c.GetContext(ctx, &row, `SELECT
+    (SELECT COUNT(*) FROM memo) AS memos,
+    (SELECT COUNT(DISTINCT tag) FROM memo_tag) AS tags`)
+	return domain.MemoStats{Memos: row.Memos, Tags: row.Tags}, err
+}
+
+func insertMemoTags(ctx context.Context, tx *sqlx.Tx, id uuid.UUID, tags []string) error {
+	for i, t := range tags {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO memo_tag (memo_id, position, tag) VALUES (?, ?, ?)`, id, i, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqliteMemoDocument is what search terms are matched against. SQLite has
+// no text search configuration like Postgres' 'simple', so every term
+// must occur in the title or body, case-insensitively.
+const sqliteMemoDocument = `lower(title || ' ' || body)`
+
+func sqliteSearchTerms(f model.MemoFilter) []string {
+	if f.Search == nil {
+		return nil
+	}
+	return strings.Fields(strings.ToLower(*f.Search))
+}
+
+func sqliteMemoFilter(f model.MemoFilter) (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		conds = append(conds, cond)
+		args = append(args, arg)
+	}
+	if f.Tag != nil {
+		add(`EXISTS (SELECT 1 FROM memo_tag WHERE memo_tag.memo_id = memo.id AND memo_tag.tag = ?)`, *f.Tag)
+	}
+	if f.Pinned != nil {
+		add(`pinned = ?`, *f.Pinned)
+	}
+	if f.Archived != nil {
+		add(`archived = ?`, *f.Archived)
+	}
+	if f.Favorite != nil {
+		add(`favorite = ?`, *f.Favorite)
+	}
+	for _, term := range sqliteSearchTerms(f) {
+		add(`instr(`+sqliteMemoDocument+`, ?) > 0`, term)
+	}
+	for _, b := range []struct {
+		cond string
+		t    *time.Time
+	}{
+		{`created_at >= ?`, f.CreatedAfter},
+		{`created_at < ?`, f.CreatedBefore},
+		{`updated_at >= ?`, f.UpdatedAfter},
+		{`updated_at < ?`, f.UpdatedBefore},
+	} {
+		if b.t != nil {
+			add(b.cond, b.t.UnixNano())
+		}
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+// sqliteMemoOrderBy mirrors memoOrderBy. Relevance counts how often the
+// search terms occur, which needs the terms as arguments.
+func sqliteMemoOrderBy(sort model.MemoSort, f model.MemoFilter) (string, []interface{}) {
+	var column string
+	var args []interface{}
+	switch sort.Field {
+	case model.MemoSortUpdatedAt:
+		column = "updated_at"
+	case model.MemoSortBodyLength:
+		column = "length(body)"
+	case model.MemoSortRelevance:
+		column = "0"
+		for _, term := range sqliteSearchTerms(f) {
+			column += " + (length(" + sqliteMemoDocument + ") - length(replace(" + sqliteMemoDocument + ", ?, ''))) / length(?)"
+			args = append(args, term, term)
+		}
+	default:
+		column = "created_at"
+	}
+	dir := "DESC"
+	if sort.Asc {
+		dir = "ASC"
+	}
+	return "ORDER BY pinned DESC, " + column + " " + dir + ", id " + dir, args
+}
+
+func (r *sqliteMemoRepository) List(ctx context.Context, f model.MemoFilter, sort model.MemoSort, limit, offset int) ([]*domain.Memo, int, error) {
+	where, args := sqliteMemoFilter(f)
+	orderBy, orderArgs := sqliteMemoOrderBy(sort, f)
+	query := `SELECT ` + sqliteMemoColumns + ` FROM memo ` + where + ` ` + orderBy + ` LIMIT ? OFFSET ?`
+	queryArgs := append(append(append([]interface{}{}, args...), orderArgs...), limit, offset)
+	var rows []sqliteMemoRow
+	if err := conn(ctx, r.db).SelectContext(ctx, &rows, query, queryArgs...); err != nil {
+		return nil, 0, err
+	}
+	memos := make([]*domain.Memo, len(rows))
+	for i, row := range rows {
+		m, err := row.toDomain()
+		if err != nil {
+			return nil, 0, err
+		}
+		memos[i] = m
+	}
+	var total int
+	if err := conn(ctx, r.db).GetContext(ctx, &total, `SELECT COUNT(*) FROM memo `+where, args...); err != nil {
+		return nil, 0, err
+	}
+	return memos, total, nil
+}
+
+func (r *sqliteMemoRepository) Stream(ctx context.Context, f model.MemoFilter, fn func(*domain.Memo) error) error {
+	where, args := sqliteMemoFilter(f)
+	rows, err := conn(ctx, r.db).QueryxContext(ctx, `SELECT `+sqliteMemoColumns+` FROM memo `+where+` ORDER BY created_at, id`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var row sqliteMemoRow
+		if err := rows.StructScan(&row); err != nil {
+			return err
+		}
+		m, err := row.toDomain()
+		if err != nil {
+			return err
+		}
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (r *sqliteMemoRepository) Get(ctx context.Context, id uuid.UUID) (*domain.Memo, error) {
+	var row sqliteMemoRow
+	if err := conn(ctx, r.db).GetContext(ctx, &row, `SELECT `+sqliteMemoColumns+` FROM memo WHERE id = ?`, id); err != nil {
+		return nil, err
+	}
+	return row.toDomain()
+}
+
+func (r *sqliteMemoRepository) Update(ctx context.Context, m *domain.Memo) error {
+	return withTx(ctx, r.db, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, `UPDATE memo SET title = ?, body = ?, updated_at = ? WHERE id = ?`,
+			m.Title, m.Body, m.UpdatedAt.UnixNano(), m.ID)
+		if err != nil {
+			return err
+		}
+		if cnt, err := res.RowsAffected(); err == nil && cnt == 0 {
+			return sql.ErrNoRows
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM memo_tag WHERE memo_id = ?`, m.ID); err != nil {
+			return err
+		}
+		return insertMemoTags(ctx, tx, m.ID, m.Tags)
+	})
+}
+
+func (r *sqliteMemoRepository) UpdateBody(ctx context.Context, id uuid.UUID, base, body string, updatedAt time.Time) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE memo SET body = ?, updated_at = ? WHERE id = ? AND body = ?`, body, updatedAt.UnixNano(), id, base)
+	if err != nil {
+		return err
+	}
+	if cnt, err := res.RowsAffected(); err == nil && cnt == 0 {
+		return memoChangedOrMissing(ctx, conn(ctx, r.db), `SELECT 1 FROM memo WHERE id = ?`, id)
+	}
+	return nil
+}
+
+func (r *sqliteMemoRepository) Stats(ctx context.Context) (domain.MemoStats, error) {
+	return memoTagStats(ctx, conn(ctx, r.db))
+}
+
+func (r *sqliteMemoRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	return withTx(ctx, r.db, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM memo_tag WHERE memo_id = ?`, id); err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx, `DELETE FROM memo WHERE id = ?`, id)
+		if err != nil {
+			return err
+		}
+		if cnt, err := res.RowsAffected(); err == nil && cnt == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+}
+
+func (r *sqliteMemoRepository) SetFlag(ctx context.Context, id uuid.UUID, flag domain.MemoFlag, value bool) error {
+	column, ok := memoFlagColumns[flag]
+	if !ok {
+		return errUnknownMemoFlag
+	}
+	res, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE memo SET `+column+` = ? WHERE id = ?`, value, id)
+	if err != nil {
+		return err
+	}
+	if cnt, err := res.RowsAffected(); err == nil && cnt == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,322 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/domain/model"
+	domainRepo "github.com/peconote/peconote/internal/domain/repository"
+)
+
+// Observer is told about every call of an observed repository, e.g. to
+// record its latency. Start runs before the call; the returned function
+// runs after it with the call's error.
+type Observer interface {
+	Start(ctx context.Context, repository, method string) (context.Context, func(err error))
+}
+
+type observers []Observer
+
+// JoinObservers returns an Observer that tells each of os in turn, so that
+// the first one's context reaches the others.
+func JoinObservers(os ...Observer) Observer {
+	return observers(os)
+}
+
+func (os observers) Start(ctx context.Context, repository, method string) (context.Context, func(err error)) {
+	ends := make([]func(err error), len(os))
+	for i, o := range os {
+		ctx, ends[i] = o.Start(ctx, repository, method)
+	}
+	return ctx, func(err error) {
+		for i := len(ends) - 1; i >= 0; i-- {
+			ends[i](err)
+		}
+	}
+}
+
+func observe0(ctx context.Context, o Observer, repo, method string, fn func(ctx context.Context) error) error {
+	ctx, end := o.Start(ctx, repo, method)
+	err := fn(ctx)
+	end(err)
+	return err
+}
+
+func observe1[T any](ctx context.Context, o Observer, repo, method string, fn func(ctx context.Context) (T, error)) (T, error) {
+	ctx, end := o.Start(ctx, repo, method)
+	v, err := fn(ctx)
+	end(err)
+	return v, err
+}
+
+type observedMemoRepository struct {
+	r domainRepo.MemoRepository
+	o Observer
+}
+
+func ObserveMemoRepository(r domainRepo.MemoRepository, o Observer) domainRepo.MemoRepository {
+	return &observedMemoRepository{r: r, o: o}
+}
+
+func (r *observedMemoRepository) Create(ctx context.Context, m *domain.Memo) error {
+	return observe0(ctx, r.o, "memo", "Create", func(ctx context.Context) error { return r.r.Create(ctx, m) })
+}
+
+func (r *observedMemoRepository) List(ctx context.Context, f model.MemoFilter, s model.MemoSort, limit, offset int) ([]*domain.Memo, int, error) {
+	var total int
+	memos, err := observe1(ctx, r.o, "memo", "List", func(ctx context.Context) (memos []*domain.Memo, err error) {
+		memos, total, err = r.r.List(ctx, f, s, limit, offset)
+		return memos, err
+	})
+	return memos, total, err
+}
+
+func (r *observedMemoRepository) Get(ctx context.Context, id uuid.UUID) (*domain.Memo, error) {
+	return observe1(ctx, r.o, "memo", "Get", func(ctx context.Context) (*domain.Memo, error) { return r.r.Get(ctx, id) })
+}
+
+func (r *observedMemoRepository) Update(ctx context.Context, m *domain.Memo) error {
+	return observe0(ctx, r.o, "memo", "Update", func(ctx context.Context) error { return r.r.Update(ctx, m) })
+}
+
+func (r *observedMemoRepository) UpdateBody(ctx context.Context, id uuid.UUID, base, body string, updatedAt time.Time) error {
+	return observe0(ctx, r.o, "memo", "UpdateBody", func(ctx context.Context) error { return r.r.UpdateBody(ctx, id, base, body, updatedAt) })
+}
+
+func (r *observedMemoRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	return observe0(ctx, r.o, "memo", "Delete", func(ctx context.Context) error { return r.r.Delete(ctx, id) })
+}
+
+func (r *observedMemoRepository) SetFlag(ctx context.Context, id uuid.UUID, flag domain.MemoFlag, value bool) error {
+	return observe0(ctx, r.o, "memo", "SetFlag", func(ctx context.Context) error { return r.r.SetFlag(ctx, id, flag, value) })
+}
+
+func (r *observedMemoRepository) Stream(ctx context.Context, f model.MemoFilter, fn func(*domain.Memo) error) error {
+	return observe0(ctx, r.o, "memo", "Stream", func(ctx context.Context) error { return r.r.Stream(ctx, f, fn) })
+}
+
+func (r *observedMemoRepository) Stats(ctx context.Context) (domain.MemoStats, error) {
+	return observe1(ctx, r.o, "memo", "Stats", r.r.Stats)
+}
+
+type observedMemoLinkRepository struct {
+	r domainRepo.MemoLinkRepository
+	o Observer
+}
+
+func ObserveMemoLinkRepository(r domainRepo.MemoLinkRepository, o Observer) domainRepo.MemoLinkRepository {
+	return &observedMemoLinkRepository{r: r, o: o}
+}
+
+func (r *observedMemoLinkRepository) Resolve(ctx context.Context, refs []string) (map[string]uuid.UUID, error) {
+	return observe1(ctx, r.o, "memo_link", "Resolve", func(ctx context.Context) (map[string]uuid.UUID, error) { return r.r.Resolve(ctx, refs) })
+}
+
+func (r *observedMemoLinkRepository) Replace(ctx context.Context, sourceID uuid.UUID, links []domain.MemoLink) error {
+	return observe0(ctx, r.o, "memo_link", "Replace", func(ctx context.Context) error { return r.r.Replace(ctx, sourceID, links) })
+}
+
+func (r *observedMemoLinkRepository) Retarget(ctx context.Context, targetID uuid.UUID, title string) error {
+	return observe0(ctx, r.o, "memo_link", "Retarget", func(ctx context.Context) error { return r.r.Retarget(ctx, targetID, title) })
+}
+
+func (r *observedMemoLinkRepository) ListOutgoing(ctx context.Context, sourceID uuid.UUID) ([]domain.MemoLink, error) {
+	return observe1(ctx, r.o, "memo_link", "ListOutgoing", func(ctx context.Context) ([]domain.MemoLink, error) { return r.r.ListOutgoing(ctx, sourceID) })
+}
+
+func (r *observedMemoLinkRepository) ListBacklinks(ctx context.Context, targetID uuid.UUID) ([]domain.MemoLink, error) {
+	return observe1(ctx, r.o, "memo_link", "ListBacklinks", func(ctx context.Context) ([]domain.MemoLink, error) { return r.r.ListBacklinks(ctx, targetID) })
+}
+
+func (r *observedMemoLinkRepository) ListBroken(ctx context.Context) ([]domain.MemoLink, error) {
+	return observe1(ctx, r.o, "memo_link", "ListBroken", r.r.ListBroken)
+}
+
+type observedGraphRepository struct {
+	r domainRepo.GraphRepository
+	o Observer
+}
+
+func ObserveGraphRepository(r domainRepo.GraphRepository, o Observer) domainRepo.GraphRepository {
+	return &observedGraphRepository{r: r, o: o}
+}
+
+func (r *observedGraphRepository) StreamTags(ctx context.Context, f model.MemoFilter, fn func(tag string) error) error {
+	return observe0(ctx, r.o, "graph", "StreamTags", func(ctx context.Context) error { return r.r.StreamTags(ctx, f, fn) })
+}
+
+func (r *observedGraphRepository) StreamTagEdges(ctx context.Context, f model.MemoFilter, fn func(memoID uuid.UUID, tag string) error) error {
+	return observe0(ctx, r.o, "graph", "StreamTagEdges", func(ctx context.Context) error { return r.r.StreamTagEdges(ctx, f, fn) })
+}
+
+func (r *observedGraphRepository) StreamLinks(ctx context.Context, f model.MemoFilter, fn func(domain.MemoLink) error) error {
+	return observe0(ctx, r.o, "graph", "StreamLinks", func(ctx context.Context) error { return r.r.StreamLinks(ctx, f, fn) })
+}
+
+type observedMemoEventRepository struct {
+	r domainRepo.MemoEventRepository
+	o Observer
+}
+
+func ObserveMemoEventRepository(r domainRepo.MemoEventRepository, o Observer) domainRepo.MemoEventRepository {
+	return &observedMemoEventRepository{r: r, o: o}
+}
+
+func (r *observedMemoEventRepository) Append(ctx context.Context, e *domain.MemoEvent) error {
+	return observe0(ctx, r.o, "memo_event", "Append", func(ctx context.Context) error { return r.r.Append(ctx, e) })
+}
+
+func (r *observedMemoEventRepository) ListAfter(ctx context.Context, afterID int64, limit int) ([]domain.MemoEvent, error) {
+	return observe1(ctx, r.o, "memo_event", "ListAfter", func(ctx context.Context) ([]domain.MemoEvent, error) { return r.r.ListAfter(ctx, afterID, limit) })
+}
+
+func (r *observedMemoEventRepository) LastID(ctx context.Context) (int64, error) {
+	return observe1(ctx, r.o, "memo_event", "LastID", r.r.LastID)
+}
+
+type observedOutboxRepository struct {
+	r domainRepo.OutboxRepository
+	o Observer
+}
+
+func ObserveOutboxRepository(r domainRepo.OutboxRepository, o Observer) domainRepo.OutboxRepository {
+	return &observedOutboxRepository{r: r, o: o}
+}
+
+func (r *observedOutboxRepository) Append(ctx context.Context, m *domain.OutboxMessage) error {
+	return observe0(ctx, r.o, "outbox", "Append", func(ctx context.Context) error { return r.r.Append(ctx, m) })
+}
+
+func (r *observedOutboxRepository) Pending(ctx context.Context, now time.Time, limit int) ([]domain.OutboxMessage, error) {
+	return observe1(ctx, r.o, "outbox", "Pending", func(ctx context.Context) ([]domain.OutboxMessage, error) { return r.r.Pending(ctx, now, limit) })
+}
+
+func (r *observedOutboxRepository) Delete(ctx context.Context, id int64) error {
+	return observe0(ctx, r.o, "outbox", "Delete", func(ctx context.Context) error { return r.r.Delete(ctx, id) })
+}
+
+func (r *observedOutboxRepository) MarkFailed(ctx context.Context, m *domain.OutboxMessage, dead bool) error {
+	return observe0(ctx, r.o, "outbox", "MarkFailed", func(ctx context.Context) error { return r.r.MarkFailed(ctx, m, dead) })
+}
+
+// WithLock is observed as a whole, including fn.
+func (r *observedOutboxRepository) WithLock(ctx context.Context, fn func(ctx context.Context) error) (bool, error) {
+	return observe1(ctx, r.o, "outbox", "WithLock", func(ctx context.Context) (bool, error) { return r.r.WithLock(ctx, fn) })
+}
+
+type observedWebhookRepository struct {
+	r domainRepo.WebhookRepository
+	o Observer
+}
+
+func ObserveWebhookRepository(r domainRepo.WebhookRepository, o Observer) domainRepo.WebhookRepository {
+	return &observedWebhookRepository{r: r, o: o}
+}
+
+func (r *observedWebhookRepository) Create(ctx context.Context, w *domain.Webhook) error {
+	return observe0(ctx, r.o, "webhook", "Create", func(ctx context.Context) error { return r.r.Create(ctx, w) })
+}
+
+func (r *observedWebhookRepository) List(ctx context.Context) ([]domain.Webhook, error) {
+	return observe1(ctx, r.o, "webhook", "List", r.r.List)
+}
+
+func (r *observedWebhookRepository) Get(ctx context.Context, id uuid.UUID) (*domain.Webhook, error) {
+	return observe1(ctx, r.o, "webhook", "Get", func(ctx context.Context) (*domain.Webhook, error) { return r.r.Get(ctx, id) })
+}
+
+func (r *observedWebhookRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	return observe0(ctx, r.o, "webhook", "Delete", func(ctx context.Context) error { return r.r.Delete(ctx, id) })
+}
+
+type observedWebhookDeliveryRepository struct {
+	r domainRepo.WebhookDeliveryRepository
+	o Observer
+}
+
+func ObserveWebhookDeliveryRepository(r domainRepo.WebhookDeliveryRepository, o Observer) domainRepo.WebhookDeliveryRepository {
+	return &observedWebhookDeliveryRepository{r: r, o: o}
+}
+
+func (r *observedWebhookDeliveryRepository) Enqueue(ctx context.Context, d *domain.WebhookDelivery) error {
+	return observe0(ctx, r.o, "webhook_delivery", "Enqueue", func(ctx context.Context) error { return r.r.Enqueue(ctx, d) })
+}
+
+func (r *observedWebhookDeliveryRepository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]domain.WebhookDelivery, error) {
+	return observe1(ctx, r.o, "webhook_delivery", "ClaimDue", func(ctx context.Context) ([]domain.WebhookDelivery, error) {
+		return r.r.ClaimDue(ctx, now, lease, limit)
+	})
+}
+
+func (r *observedWebhookDeliveryRepository) RecordAttempt(ctx context.Context, d *domain.WebhookDelivery, a *domain.WebhookAttempt) error {
+	return observe0(ctx, r.o, "webhook_delivery", "RecordAttempt", func(ctx context.Context) error { return r.r.RecordAttempt(ctx, d, a) })
+}
+
+func (r *observedWebhookDeliveryRepository) Get(ctx context.Context, id int64) (*domain.WebhookDelivery, error) {
+	return observe1(ctx, r.o, "webhook_delivery", "Get", func(ctx context.Context) (*domain.WebhookDelivery, error) { return r.r.Get(ctx, id) })
+}
+
+func (r *observedWebhookDeliveryRepository) ListByWebhook(ctx context.Context, webhookID uuid.UUID, limit int) ([]domain.WebhookDelivery, error) {
+	return observe1(ctx, r.o, "webhook_delivery", "ListByWebhook", func(ctx context.Context) ([]domain.WebhookDelivery, error) {
+		return r.r.ListByWebhook(ctx, webhookID, limit)
+	})
+}
+
+func (r *observedWebhookDeliveryRepository) ListAttempts(ctx context.Context, deliveryID int64) ([]domain.WebhookAttempt, error) {
+	return observe1(ctx, r.o, "webhook_delivery", "ListAttempts", func(ctx context.Context) ([]domain.WebhookAttempt, error) {
+		return r.r.ListAttempts(ctx, deliveryID)
+	})
+}
+
+func (r *observedWebhookDeliveryRepository) Requeue(ctx context.Context, id int64, at time.Time) error {
+	return observe0(ctx, r.o, "webhook_delivery", "Requeue", func(ctx context.Context) error { return r.r.Requeue(ctx, id, at) })
+}
+
+type observedIdempotencyRepository struct {
+	r domainRepo.IdempotencyRepository
+	o Observer
+}
+
+func ObserveIdempotencyRepository(r domainRepo.IdempotencyRepository, o Observer) domainRepo.IdempotencyRepository {
+	return &observedIdempotencyRepository{r: r, o: o}
+}
+
+func (r *observedIdempotencyRepository) Reserve(ctx context.Context, rec *domain.IdempotencyRecord, now time.Time) (*domain.IdempotencyRecord, bool, error) {
+	var reserved bool
+	existing, err := observe1(ctx, r.o, "idempotency", "Reserve", func(ctx context.Context) (existing *domain.IdempotencyRecord, err error) {
+		existing, reserved, err = r.r.Reserve(ctx, rec, now)
+		return existing, err
+	})
+	return existing, reserved, err
+}
+
+func (r *observedIdempotencyRepository) Complete(ctx context.Context, userID, key string, statusCode int, location string, body []byte) error {
+	return observe0(ctx, r.o, "idempotency", "Complete", func(ctx context.Context) error {
+		return r.r.Complete(ctx, userID, key, statusCode, location, body)
+	})
+}
+
+func (r *observedIdempotencyRepository) Release(ctx context.Context, userID, key string) error {
+	return observe0(ctx, r.o, "idempotency", "Release", func(ctx context.Context) error { return r.r.Release(ctx, userID, key) })
+}
+
+type observedMemoImportRepository struct {
+	r domainRepo.MemoImportRepository
+	o Observer
+}
+
+func ObserveMemoImportRepository(r domainRepo.MemoImportRepository, o Observer) domainRepo.MemoImportRepository {
+	return &observedMemoImportRepository{r: r, o: o}
+}
+
+func (r *observedMemoImportRepository) IsImported(ctx context.Context, sourceKey string) (bool, error) {
+	return observe1(ctx, r.o, "memo_import", "IsImported", func(ctx context.Context) (bool, error) { return r.r.IsImported(ctx, sourceKey) })
+}
+
+func (r *observedMemoImportRepository) MarkImported(ctx context.Context, sourceKey, sourcePath string, memoID uuid.UUID) error {
+	return observe0(ctx, r.o, "memo_import", "MarkImported", func(ctx context.Context) error {
+		return r.r.MarkImported(ctx, sourceKey, sourcePath, memoID)
+	})
+}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/peconote/peconote/internal/domain"
+)
+
+type recordingObserver struct {
+	calls []string
+	errs  []error
+}
+
+func (o *recordingObserver) Start(ctx context.Context, repository, method string) (context.Context, func(err error)) {
+	o.calls = append(o.calls, repository+"."+method)
+	return ctx, func(err error) { o.errs = append(o.errs, err) }
+}
+
+func TestObserveMemoRepository(t *testing.T) {
+	ctx := context.Background()
+	o := &recordingObserver{}
+	repo := ObserveMemoRepository(NewMemoryMemoRepository(), o)
+	if err := repo.Create(ctx, &domain.Memo{ID: uuid.New(), Title: "t", Body: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Get(ctx, uuid.New()); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected sql.ErrNoRows, got %v", err)
+	}
+	if stats, err := repo.Stats(ctx); err != nil || stats.Memos != 1 {
+		t.Fatalf("unexpected stats %+v, %v", stats, err)
+	}
+	want := []string{"memo.Create", "memo.Get", "memo.Stats"}
+	if len(o.calls) != len(want) {
+		t.Fatalf("expected calls %v, got %v", want, o.calls)
+	}
+	for i := range want {
+		if o.calls[i] != want[i] {
+			t.Fatalf("expected calls %v, got %v", want, o.calls)
+		}
+	}
+	if o.errs[0] != nil || !errors.Is(o.errs[1], sql.ErrNoRows) || o.errs[2] != nil {
+		t.Fatalf("unexpected errors %v", o.errs)
+	}
+}
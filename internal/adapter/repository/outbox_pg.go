@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/peconote/peconote/internal/domain"
+	domainRepo "github.com/peconote/peconote/internal/domain/repository"
+)
+
+// outboxLockKey is the advisory lock held by the dispatcher that owns the
+// outbox.
+const outboxLockKey = 7_140_201
+
+type outboxRepository struct {
+	db *sqlx.DB
+}
+
+func NewOutboxRepository(db *sqlx.DB) domainRepo.OutboxRepository {
+	return &outboxRepository{db: db}
+}
+
+type outboxRow struct {
+	ID            int64     `db:"id"`
+	AggregateID   uuid.UUID `db:"aggregate_id"`
+	Name          string    `db:"name"`
+	Payload       []byte    `db:"payload"`
+	Attempts      int       `db:"attempts"`
+	NextAttemptAt time.Time `db:"next_attempt_at"`
+	LastError     string    `db:"last_error"`
+	CreatedAt     time.Time `db:"created_at"`
+}
+
+func (r *outboxRepository) Append(ctx context.Context, m *domain.OutboxMessage) error {
+	query := `INSERT INTO outbox_message (aggregate_id, name, payload, attempts, next_attempt_at, last_error, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id`
+	return conn(ctx, r.db).GetContext(ctx, &m.ID, query,
+		m.AggregateID, m.Name, m.Payload, m.Attempts, m.NextAttemptAt, m.LastError, m.CreatedAt)
+}
+
+// Pending skips messages queued behind one of the same memo that waits for
+// its retry, so messages in backoff neither fill the batch nor get
+// overtaken.
+func (r *outboxRepository) Pending(ctx context.Context, now time.Time, limit int) ([]domain.OutboxMessage, error) {
+	var rows []outboxRow
+	query := `SELECT id, aggregate_id, name, payload, attempts, next_attempt_at, last_error, created_at
+FROM outbox_message m
+WHERE NOT dead AND next_attempt_at <= $1
+AND NOT EXISTS (
+	SELECT 1 FROM outbox_message e
+	WHERE e.aggregate_id = m.aggregate_id AND e.id < m.id AND NOT e.dead AND e.next_attempt_at > $1
+)
+ORDER BY id LIMIT $2`
+	if err := conn(ctx, r.db).SelectContext(ctx, &rows, query, now, limit); err != nil {
+		return nil, err
+	}
+	out := make([]domain.OutboxMessage, len(rows))
+	for i, row := range rows {
+		out[i] = domain.OutboxMessage(row)
+	}
+	return out, nil
+}
+
+func (r *outboxRepository) Delete(ctx context.Context, id int64) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM outbox_message WHERE id = $1`, id)
+	return err
+}
+
+func (r *outboxRepository) MarkFailed(ctx context.Context, m *domain.OutboxMessage, dead bool) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx,
+		`UPDATE outbox_message SET attempts = $2, next_attempt_at = $3, last_error = $4, dead = $5 WHERE id = $1`,
+		m.ID, m.Attempts, m.NextAttemptAt, m.LastError, dead)
+	if err != nil {
+		return err
+	}
+	if cnt, err := res.RowsAffected(); err == nil && cnt == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// WithLock holds a session advisory lock on a dedicated connection while
+// fn runs, so only one replica dispatches at a time.
+func (r *outboxRepository) WithLock(ctx context.Context, fn func(ctx context.Context) error) (bool, error) {
+	c, err := r.db.Connx(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer c.Close()
+	var locked bool
+	if err := c.GetContext(ctx, &locked, `SELECT pg_try_advisory_lock($1)`, outboxLockKey); err != nil {
+		return false, err
+	}
+	if !locked {
+		return false, nil
+	}
+	// The lock must be released even when ctx is already cancelled.
+	defer c.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, outboxLockKey)
+	return true, fn(ctx)
+}
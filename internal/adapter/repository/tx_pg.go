@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+	domainRepo "github.com/peconote/peconote/internal/domain/repository"
+)
+
+type sqlxConn interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error)
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error)
+}
+
+type txKey struct{}
+
+type transactor struct {
+	db   *sqlx.DB
+	opts *sql.TxOptions
+}
+
+func NewTransactor(db *sqlx.DB) domainRepo.Transactor {
+	return &transactor{db: db}
+}
+
+// NewSnapshotTransactor returns a Transactor for read-only transactions in
+// which every query sees the database as of the first one.
+func NewSnapshotTransactor(db *sqlx.DB) domainRepo.Transactor {
+	return &transactor{db: db, opts: &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}}
+}
+
+func (t *transactor) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return withTxOptions(ctx, t.db, t.opts, func(tx *sqlx.Tx) error {
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
+}
+
+// withTx joins the transaction already in ctx, or runs fn in a new one.
+func withTx(ctx context.Context, db *sqlx.DB, fn func(tx *sqlx.Tx) error) error {
+	return withTxOptions(ctx, db, nil, fn)
+}
+
+func withTxOptions(ctx context.Context, db *sqlx.DB, opts *sql.TxOptions, fn func(tx *sqlx.Tx) error) error {
+	if tx, ok := ctx.Value(txKey{}).(*sqlx.Tx); ok {
+		return fn(tx)
+	}
+	tx, err := db.BeginTxx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func conn(ctx context.Context, db *sqlx.DB) sqlxConn {
+	if tx, ok := ctx.Value(txKey{}).(*sqlx.Tx); ok {
+		return tx
+	}
+	return db
+}
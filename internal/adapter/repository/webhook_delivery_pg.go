@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/peconote/peconote/internal/domain"
+	domainRepo "github.com/peconote/peconote/internal/domain/repository"
+)
+
+type webhookDeliveryRepository struct {
+	db *sqlx.DB
+}
+
+func NewWebhookDeliveryRepository(db *sqlx.DB) domainRepo.WebhookDeliveryRepository {
+	return &webhookDeliveryRepository{db: db}
+}
+
+type webhookDeliveryRow struct {
+	ID            int64     `db:"id"`
+	WebhookID     uuid.UUID `db:"webhook_id"`
+	EventID       int64     `db:"event_id"`
+	EventType     string    `db:"event_type"`
+	Payload       []byte    `db:"payload"`
+	Status        string    `db:"status"`
+	Attempts      int       `db:"attempts"`
+	NextAttemptAt time.Time `db:"next_attempt_at"`
+	LastError     string    `db:"last_error"`
+	CreatedAt     time.Time `db:"created_at"`
+	UpdatedAt     time.Time `db:"updated_at"`
+}
+
+func (row webhookDeliveryRow) delivery() domain.WebhookDelivery {
+	return domain.WebhookDelivery{
+		ID:            row.ID,
+		WebhookID:     row.WebhookID,
+		EventID:       row.EventID,
+		EventType:     domain.MemoEventType(row.EventType),
+		Payload:       row.Payload,
+		Status:        domain.WebhookDeliveryStatus(row.Status),
+		Attempts:      row.Attempts,
+		NextAttemptAt: row.NextAttemptAt,
+		LastError:     row.LastError,
+		CreatedAt:     row.CreatedAt,
+		UpdatedAt:     row.UpdatedAt,
+	}
+}
+
+func deliveries(rows []webhookDeliveryRow) []domain.WebhookDelivery {
+	out := make([]domain.WebhookDelivery, len(rows))
+	for i, row := range rows {
+		out[i] = row.delivery()
+	}
+	return out
+}
+
+const webhookDeliveryColumns = `id, webhook_id, event_id, event_type, payload, status, attempts, next_attempt_at, last_error, created_at, updated_at`
+
+func (r *webhookDeliveryRepository) Enqueue(ctx context.Context, d *domain.WebhookDelivery) error {
+	query := `INSERT INTO webhook_delivery (webhook_id, event_id, event_type, payload, status, attempts, next_attempt_at, last_error, created_at, updated_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+ON CONFLICT (webhook_id, event_id) DO NOTHING
+RETURNING id`
+	err := conn(ctx, r.db).GetContext(ctx, &d.ID, query,
+		d.WebhookID, d.EventID, d.EventType, d.Payload, d.Status, d.Attempts, d.NextAttemptAt, d.LastError, d.CreatedAt, d.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	return err
+}
+
+func (r *webhookDeliveryRepository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]domain.WebhookDelivery, error) {
+	query := `UPDATE webhook_delivery SET next_attempt_at = $2
+WHERE id IN (
+    SELECT id FROM webhook_delivery
+    WHERE status = 'pending' AND next_attempt_at <= $1
+    ORDER BY next_attempt_at, id
+    LIMIT $3
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING ` + webhookDeliveryColumns
+	var rows []webhookDeliveryRow
+	if err := conn(ctx, r.db).SelectContext(ctx, &rows, query, now, now.Add(lease), limit); err != nil {
+		return nil, err
+	}
+	return deliveries(rows), nil
+}
+
+func (r *webhookDeliveryRepository) RecordAttempt(ctx context.Context, d *domain.WebhookDelivery, a *domain.WebhookAttempt) error {
+	return withTx(ctx, r.db, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx,
+			`UPDATE webhook_delivery SET status = $2, attempts = $3, next_attempt_at = $4, last_error = $5, updated_at = $6 WHERE id = $1`,
+			d.ID, d.Status, d.Attempts, d.NextAttemptAt, d.LastError, d.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		if cnt, err := res.RowsAffected(); err == nil && cnt == 0 {
+			return sql.ErrNoRows
+		}
+		return tx.GetContext(ctx, &a.ID,
+			`INSERT INTO webhook_delivery_attempt (delivery_id, status_code, error, duration_ms, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+			d.ID, a.StatusCode, a.Error, a.Duration.Milliseconds(), a.CreatedAt)
+	})
+}
+
+func (r *webhookDeliveryRepository) Get(ctx context.Context, id int64) (*domain.WebhookDelivery, error) {
+	var row webhookDeliveryRow
+	if err := conn(ctx, r.db).GetContext(ctx, &row, `SELECT `+webhookDeliveryColumns+` FROM webhook_delivery WHERE id = $1`, id); err != nil {
+		return nil, err
+	}
+	d := row.delivery()
+	return &d, nil
+}
+
+func (r *webhookDeliveryRepository) ListByWebhook(ctx context.Context, webhookID uuid.UUID, limit int) ([]domain.WebhookDelivery, error) {
+	var rows []webhookDeliveryRow
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_delivery WHERE webhook_id = $1 ORDER BY id DESC LIMIT $2`
+	if err := conn(ctx, r.db).SelectContext(ctx, &rows, query, webhookID, limit); err != nil {
+		return nil, err
+	}
+	return deliveries(rows), nil
+}
+
+type webhookAttemptRow struct {
+	ID         int64     `db:"id"`
+	DeliveryID int64     `db:"delivery_id"`
+	StatusCode int       `db:"status_code"`
+	Error      string    `db:"error"`
+	DurationMS int64     `db:"duration_ms"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+func (r *webhookDeliveryRepository) ListAttempts(ctx context.Context, deliveryID int64) ([]domain.WebhookAttempt, error) {
+	var rows []webhookAttemptRow
+	query := `SELECT id, delivery_id, status_code, error, duration_ms, created_at FROM webhook_delivery_attempt WHERE delivery_id = $1 ORDER BY id`
+	if err := conn(ctx, r.db).SelectContext(ctx, &rows, query, deliveryID); err != nil {
+		return nil, err
+	}
+	attempts := make([]domain.WebhookAttempt, len(rows))
+	for i, row := range rows {
+		attempts[i] = domain.WebhookAttempt{
+			ID:         row.ID,
+			DeliveryID: row.DeliveryID,
+			StatusCode: row.StatusCode,
+			Error:      row.Error,
+			Duration:   time.Duration(row.DurationMS) * time.Millisecond,
+			CreatedAt:  row.CreatedAt,
+		}
+	}
+	return attempts, nil
+}
+
+func (r *webhookDeliveryRepository) Requeue(ctx context.Context, id int64, at time.Time) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx,
+		`UPDATE webhook_delivery SET status = 'pending', attempts = 0, next_attempt_at = $2, updated_at = $2 WHERE id = $1`, id, at)
+	if err != nil {
+		return err
+	}
+	if cnt, err := res.RowsAffected(); err == nil && cnt == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
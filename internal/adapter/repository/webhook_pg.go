@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/peconote/peconote/internal/domain"
+	domainRepo "github.com/peconote/peconote/internal/domain/repository"
+)
+
+type webhookRepository struct {
+	db *sqlx.DB
+}
+
+func NewWebhookRepository(db *sqlx.DB) domainRepo.WebhookRepository {
+	return &webhookRepository{db: db}
+}
+
+type webhookRow struct {
+	ID        uuid.UUID      `db:"id"`
+	URL       string         `db:"url"`
+	Events    pq.StringArray `db:"events"`
+	Tag       string         `db:"tag"`
+	Secret    string         `db:"secret"`
+	CreatedAt time.Time      `db:"created_at"`
+}
+
+func (row webhookRow) webhook() domain.Webhook {
+	w := domain.Webhook{ID: row.ID, URL: row.URL, Tag: row.Tag, Secret: row.Secret, CreatedAt: row.CreatedAt}
+	for _, e := range row.Events {
+		w.Events = append(w.Events, domain.MemoEventType(e))
+	}
+	return w
+}
+
+const webhookColumns = `id, url, events, tag, secret, created_at`
+
+func (r *webhookRepository) Create(ctx context.Context, w *domain.Webhook) error {
+	events := make(pq.StringArray, len(w.Events))
+	for i, e := range w.Events {
+		events[i] = string(e)
+	}
+	_, err := conn(ctx, r.db).ExecContext(ctx,
+		`INSERT INTO webhook (`+webhookColumns+`) VALUES ($1, $2, $3, $4, $5, $6)`,
+		w.ID, w.URL, events, w.Tag, w.Secret, w.CreatedAt)
+	return err
+}
+
+func (r *webhookRepository) List(ctx context.Context) ([]domain.Webhook, error) {
+	var rows []webhookRow
+	if err := conn(ctx, r.db).SelectContext(ctx, &rows, `SELECT `+webhookColumns+` FROM webhook ORDER BY created_at, id`); err != nil {
+		return nil, err
+	}
+	hooks := make([]domain.Webhook, len(rows))
+	for i, row := range rows {
+		hooks[i] = row.webhook()
+	}
+	return hooks, nil
+}
+
+func (r *webhookRepository) Get(ctx context.Context, id uuid.UUID) (*domain.Webhook, error) {
+	var row webhookRow
+	if err := conn(ctx, r.db).GetContext(ctx, &row, `SELECT `+webhookColumns+` FROM webhook WHERE id = $1`, id); err != nil {
+		return nil, err
+	}
+	w := row.webhook()
+	return &w, nil
+}
+
+func (r *webhookRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM webhook WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if cnt, err := res.RowsAffected(); err == nil && cnt == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+// Package webhook posts webhook deliveries over HTTP.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/peconote/peconote/internal/usecase"
+)
+
+const (
+	EventHeader     = "X-Peconote-Event"
+	DeliveryHeader  = "X-Peconote-Delivery"
+	TimestampHeader = "X-Peconote-Timestamp"
+	// SignatureHeader carries "sha256=" followed by the hex HMAC-SHA256 of
+	// the timestamp, a dot and the body, keyed with the webhook secret.
+	SignatureHeader = "X-Peconote-Signature"
+
+	DefaultTimeout = 10 * time.Second
+)
+
+// Sign returns the value of SignatureHeader for a request body sent at
+// timestamp (Unix seconds).
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature in constant time. Receivers should also reject
+// timestamps too far from their clock to prevent replays.
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// ErrForbiddenDestination is returned for webhook URLs resolving to a
+// loopback, private or link-local address, such as a cloud metadata
+// endpoint.
+var ErrForbiddenDestination = errors.New("webhook destination is not a public address")
+
+type Sender struct {
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewSender sends with client, or, if it is nil, with a client that only
+// connects to public addresses unless allowPrivate is set. The address is
+// checked when connecting, after DNS resolution and on every redirect, so
+// a host name cannot be pointed at an internal service later.
+func NewSender(client *http.Client, allowPrivate bool) *Sender {
+	if client == nil {
+		dialer := &net.Dialer{Timeout: DefaultTimeout}
+		if !allowPrivate {
+			dialer.Control = checkDestination
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		// A proxy would be dialed instead of the webhook's host.
+		transport.Proxy = nil
+		transport.DialContext = dialer.DialContext
+		client = &http.Client{Timeout: DefaultTimeout, Transport: transport}
+	}
+	return &Sender{client: client, now: time.Now}
+}
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+func checkDestination(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip) {
+		return fmt.Errorf("%w: %s", ErrForbiddenDestination, ip)
+	}
+	return nil
+}
+
+func (s *Sender) Send(ctx context.Context, req usecase.WebhookRequest) (int, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, req.URL, bytes.NewReader(req.Payload))
+	if err != nil {
+		return 0, err
+	}
+	ts := s.now().Unix()
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("User-Agent", "peconote-webhook")
+	httpReq.Header.Set(EventHeader, string(req.EventType))
+	httpReq.Header.Set(DeliveryHeader, strconv.FormatInt(req.DeliveryID, 10))
+	httpReq.Header.Set(TimestampHeader, strconv.FormatInt(ts, 10))
+	httpReq.Header.Set(SignatureHeader, Sign(req.Secret, ts, req.Payload))
+	resp, err := s.client.Do(httpReq)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drain a little of the body so the connection can be reused.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, nil
+}
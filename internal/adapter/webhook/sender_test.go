@@ -0,0 +1,98 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/usecase"
+)
+
+func TestSender_SignsRequest(t *testing.T) {
+	var got *http.Request
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	s := NewSender(srv.Client(), false)
+	s.now = func() time.Time { return time.Unix(1700000000, 0) }
+	payload := []byte(`{"id":1}`)
+	status, err := s.Send(context.Background(), usecase.WebhookRequest{URL: srv.URL, Secret: "s3cret", DeliveryID: 42, EventType: domain.MemoEventCreated, Payload: payload})
+	if err != nil || status != http.StatusAccepted {
+		t.Fatalf("unexpected result %d %v", status, err)
+	}
+	if string(body) != string(payload) || got.Header.Get(EventHeader) != "created" || got.Header.Get(DeliveryHeader) != "42" {
+		t.Fatalf("unexpected request %v %s", got.Header, body)
+	}
+	ts, _ := strconv.ParseInt(got.Header.Get(TimestampHeader), 10, 64)
+	if ts != 1700000000 || !Verify("s3cret", ts, body, got.Header.Get(SignatureHeader)) {
+		t.Fatalf("signature does not verify: %v", got.Header)
+	}
+	if Verify("other", ts, body, got.Header.Get(SignatureHeader)) || Verify("s3cret", ts+1, body, got.Header.Get(SignatureHeader)) {
+		t.Fatalf("signature verified with wrong inputs")
+	}
+}
+
+func TestSender_Failures(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	s := NewSender(srv.Client(), false)
+	status, err := s.Send(context.Background(), usecase.WebhookRequest{URL: srv.URL})
+	if err != nil || status != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected result %d %v", status, err)
+	}
+	srv.Close()
+	if _, err := s.Send(context.Background(), usecase.WebhookRequest{URL: srv.URL}); err == nil {
+		t.Fatalf("expected an error from a closed server")
+	}
+}
+
+func TestSender_RejectsPrivateDestinations(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer srv.Close()
+
+	for _, url := range []string{srv.URL, "http://169.254.169.254/latest/meta-data/", "http://10.0.0.1/", "http://[::1]:1/", "http://0.0.0.0:1/"} {
+		_, err := NewSender(nil, false).Send(context.Background(), usecase.WebhookRequest{URL: url})
+		if !errors.Is(err, ErrForbiddenDestination) {
+			t.Fatalf("%s: expected ErrForbiddenDestination, got %v", url, err)
+		}
+	}
+	if calls != 0 {
+		t.Fatalf("expected no request to reach the server, got %d", calls)
+	}
+	if status, err := NewSender(nil, true).Send(context.Background(), usecase.WebhookRequest{URL: srv.URL}); err != nil || status != http.StatusOK {
+		t.Fatalf("expected private destinations to be allowed, got %d %v", status, err)
+	}
+}
+
+func TestCheckDestination(t *testing.T) {
+	for addr, ok := range map[string]bool{
+		"93.184.216.34:443":          true,
+		"[2606:4700::6810:84e5]:443": true,
+		"127.0.0.1:80":               false,
+		"192.168.1.1:80":             false,
+		"172.16.0.1:80":              false,
+		"100.64.0.1:80":              false,
+		"[fe80::1]:80":               false,
+		"[fd00::1]:80":               false,
+		"[::ffff:127.0.0.1]:80":      false,
+	} {
+		if err := checkDestination("tcp", addr, nil); (err == nil) != ok {
+			t.Fatalf("%s: got %v", addr, err)
+		}
+	}
+}
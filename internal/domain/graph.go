@@ -0,0 +1,27 @@
+package domain
+
+type GraphNodeKind string
+
+const (
+	GraphNodeMemo GraphNodeKind = "memo"
+	GraphNodeTag  GraphNodeKind = "tag"
+)
+
+type GraphEdgeKind string
+
+const (
+	GraphEdgeTag  GraphEdgeKind = "tag"
+	GraphEdgeLink GraphEdgeKind = "link"
+)
+
+type GraphNode struct {
+	ID    string
+	Kind  GraphNodeKind
+	Label string
+}
+
+type GraphEdge struct {
+	Source string
+	Target string
+	Kind   GraphEdgeKind
+}
@@ -0,0 +1,15 @@
+package domain
+
+import "time"
+
+type IdempotencyRecord struct {
+	UserID       string
+	Key          string
+	Fingerprint  string
+	Completed    bool
+	StatusCode   int
+	Location     string
+	ResponseBody []byte
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+}
@@ -1,15 +1,83 @@
 package domain
 
 import (
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 )
 
+const (
+	MaxTitleLength = 200
+	// MaxBodyBytes is the maximum size of a memo body in bytes.
+	MaxBodyBytes = 2000
+)
+
+type MemoFlag string
+
+const (
+	MemoFlagPinned   MemoFlag = "pinned"
+	MemoFlagArchived MemoFlag = "archived"
+	MemoFlagFavorite MemoFlag = "favorite"
+)
+
+// MemoStats summarizes the stored memos.
+type MemoStats struct {
+	Memos int
+	// Tags is the number of distinct tags.
+	Tags int
+}
+
 type Memo struct {
 	ID        uuid.UUID
+	Title     string
 	Body      string
 	Tags      []string
+	Pinned    bool
+	Archived  bool
+	Favorite  bool
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
+
+// DeriveTitle returns the text of the first Markdown heading in body, falling
+// back to its first non-empty line.
+func DeriveTitle(body string) string {
+	var first string
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if text, ok := headingText(line); ok {
+			if text != "" {
+				return truncateTitle(text)
+			}
+			continue
+		}
+		if first == "" {
+			first = line
+		}
+	}
+	return truncateTitle(first)
+}
+
+func headingText(line string) (string, bool) {
+	level := len(line) - len(strings.TrimLeft(line, "#"))
+	if level < 1 || level > 6 {
+		return "", false
+	}
+	rest := line[level:]
+	if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimRight(strings.TrimSpace(rest), "#")), true
+}
+
+func truncateTitle(s string) string {
+	if utf8.RuneCountInString(s) > MaxTitleLength {
+		return string([]rune(s)[:MaxTitleLength])
+	}
+	return s
+}
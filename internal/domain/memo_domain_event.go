@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DomainEvent is a change relayed to handlers through the transactional
+// outbox.
+type DomainEvent interface {
+	EventName() string
+	AggregateID() uuid.UUID
+}
+
+const (
+	MemoCreatedEvent = "MemoCreated"
+	MemoUpdatedEvent = "MemoUpdated"
+	MemoDeletedEvent = "MemoDeleted"
+)
+
+// MemoCreated and MemoUpdated carry the logged change and the memo after
+// it.
+type MemoCreated struct {
+	Change MemoEvent
+	Memo   Memo
+}
+
+type MemoUpdated struct {
+	Change MemoEvent
+	Memo   Memo
+}
+
+// MemoDeleted carries the memo as it was before the deletion.
+type MemoDeleted struct {
+	Change MemoEvent
+	Memo   Memo
+}
+
+func (e MemoCreated) EventName() string      { return MemoCreatedEvent }
+func (e MemoCreated) AggregateID() uuid.UUID { return e.Memo.ID }
+func (e MemoUpdated) EventName() string      { return MemoUpdatedEvent }
+func (e MemoUpdated) AggregateID() uuid.UUID { return e.Memo.ID }
+func (e MemoDeleted) EventName() string      { return MemoDeletedEvent }
+func (e MemoDeleted) AggregateID() uuid.UUID { return e.Memo.ID }
+
+// NewMemoDomainEvent returns the domain event for a change of memo.
+func NewMemoDomainEvent(change MemoEvent, memo Memo) DomainEvent {
+	switch change.Type {
+	case MemoEventCreated:
+		return MemoCreated{Change: change, Memo: memo}
+	case MemoEventDeleted:
+		return MemoDeleted{Change: change, Memo: memo}
+	}
+	return MemoUpdated{Change: change, Memo: memo}
+}
+
+// OutboxMessage is a serialized domain event waiting to be dispatched.
+type OutboxMessage struct {
+	ID            int64
+	AggregateID   uuid.UUID
+	Name          string
+	Payload       []byte
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	CreatedAt     time.Time
+}
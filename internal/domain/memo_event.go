@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type MemoEventType string
+
+const (
+	MemoEventCreated MemoEventType = "created"
+	MemoEventUpdated MemoEventType = "updated"
+	MemoEventDeleted MemoEventType = "deleted"
+)
+
+// MemoEvent records one committed change to a memo. IDs increase with every
+// event; Version counts the events of a single memo starting at 1. Tags are
+// those of the memo after the change, or before it for deletions.
+type MemoEvent struct {
+	ID        int64
+	Type      MemoEventType
+	MemoID    uuid.UUID
+	Version   int64
+	Tags      []string
+	UserID    string
+	CreatedAt time.Time
+}
@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type MemoLink struct {
+	SourceID  uuid.UUID
+	TargetRef string
+	TargetID  *uuid.UUID
+}
+
+func (l MemoLink) Broken() bool {
+	return l.TargetID == nil
+}
+
+var linkRefPattern = regexp.MustCompile(`\[\[([^\[\]\n]+)\]\]`)
+
+func ParseLinkRefs(body string) []string {
+	matches := linkRefPattern.FindAllStringSubmatch(body, -1)
+	refs := make([]string, 0, len(matches))
+	seen := make(map[string]struct{}, len(matches))
+	for _, m := range matches {
+		ref := strings.TrimSpace(m[1])
+		if ref == "" {
+			continue
+		}
+		key := strings.ToLower(ref)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		refs = append(refs, ref)
+	}
+	return refs
+}
@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// Time bounds are inclusive for *After and exclusive for *Before.
+type MemoFilter struct {
+	Search        *string
+	Tag           *string
+	Pinned        *bool
+	Archived      *bool
+	Favorite      *bool
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	UpdatedAfter  *time.Time
+	UpdatedBefore *time.Time
+}
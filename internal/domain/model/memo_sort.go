@@ -0,0 +1,54 @@
+package model
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrInvalidMemoSort = errors.New("invalid memo sort")
+
+type MemoSortField string
+
+const (
+	MemoSortCreatedAt  MemoSortField = "created_at"
+	MemoSortUpdatedAt  MemoSortField = "updated_at"
+	MemoSortRelevance  MemoSortField = "relevance"
+	MemoSortBodyLength MemoSortField = "body_length"
+)
+
+// MemoSort is descending unless Asc is set, so the zero value lists the
+// newest memos first.
+type MemoSort struct {
+	Field MemoSortField
+	Asc   bool
+}
+
+var DefaultMemoSort = MemoSort{Field: MemoSortCreatedAt}
+
+// ParseMemoSort accepts a field name, optionally prefixed with "-" for
+// descending order, e.g. "-updated_at".
+func ParseMemoSort(s string) (MemoSort, error) {
+	sort := MemoSort{Asc: true}
+	if strings.HasPrefix(s, "-") {
+		sort.Asc = false
+		s = s[1:]
+	}
+	switch f := MemoSortField(s); f {
+	case MemoSortCreatedAt, MemoSortUpdatedAt, MemoSortRelevance, MemoSortBodyLength:
+		sort.Field = f
+	default:
+		return MemoSort{}, ErrInvalidMemoSort
+	}
+	return sort, nil
+}
+
+func (s MemoSort) String() string {
+	field := s.Field
+	if field == "" {
+		field = MemoSortCreatedAt
+	}
+	if s.Asc {
+		return string(field)
+	}
+	return "-" + string(field)
+}
@@ -1,8 +1,9 @@
 package model
 
 type Pagination struct {
-	Page       int `json:"page"`
-	PageSize   int `json:"page_size"`
-	TotalPages int `json:"total_pages"`
-	TotalCount int `json:"total_count"`
+	Page       int    `json:"page"`
+	PageSize   int    `json:"page_size"`
+	TotalPages int    `json:"total_pages"`
+	TotalCount int    `json:"total_count"`
+	Sort       string `json:"sort,omitempty"`
 }
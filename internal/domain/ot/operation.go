@@ -0,0 +1,328 @@
+// Package ot implements operational transformation for plain text.
+//
+// An Operation walks the whole document: it retains, inserts or deletes
+// runes until the end. Lengths are counted in Unicode code points.
+package ot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+var (
+	ErrBaseLength = errors.New("operation base length does not match")
+	ErrInvalid    = errors.New("invalid operation")
+)
+
+// Component is one step of an Operation. Exactly one field is set.
+type Component struct {
+	Retain int
+	Insert string
+	Delete int
+}
+
+type Operation struct {
+	components []Component
+	baseLen    int
+	targetLen  int
+}
+
+func (o *Operation) Components() []Component { return o.components }
+
+// BaseLen is the length of documents the operation applies to.
+func (o *Operation) BaseLen() int { return o.baseLen }
+
+// TargetLen is the length of the document after applying the operation.
+func (o *Operation) TargetLen() int { return o.targetLen }
+
+func (o *Operation) last() *Component {
+	if len(o.components) == 0 {
+		return nil
+	}
+	return &o.components[len(o.components)-1]
+}
+
+func (o *Operation) Retain(n int) *Operation {
+	if n <= 0 {
+		return o
+	}
+	o.baseLen += n
+	o.targetLen += n
+	if l := o.last(); l != nil && l.Retain > 0 {
+		l.Retain += n
+	} else {
+		o.components = append(o.components, Component{Retain: n})
+	}
+	return o
+}
+
+// Insert keeps inserts ahead of adjacent deletes, so that equivalent
+// operations always have the same components.
+func (o *Operation) Insert(s string) *Operation {
+	if s == "" {
+		return o
+	}
+	o.targetLen += utf8.RuneCountInString(s)
+	n := len(o.components)
+	switch {
+	case n > 0 && o.components[n-1].Insert != "":
+		o.components[n-1].Insert += s
+	case n > 0 && o.components[n-1].Delete > 0:
+		if n > 1 && o.components[n-2].Insert != "" {
+			o.components[n-2].Insert += s
+		} else {
+			o.components = append(o.components, o.components[n-1])
+			o.components[n-1] = Component{Insert: s}
+		}
+	default:
+		o.components = append(o.components, Component{Insert: s})
+	}
+	return o
+}
+
+func (o *Operation) Delete(n int) *Operation {
+	if n <= 0 {
+		return o
+	}
+	o.baseLen += n
+	if l := o.last(); l != nil && l.Delete > 0 {
+		l.Delete += n
+	} else {
+		o.components = append(o.components, Component{Delete: n})
+	}
+	return o
+}
+
+// Diff returns an operation that turns a into b, replacing the part between
+// their common prefix and suffix.
+func Diff(a, b string) *Operation {
+	ra, rb := []rune(a), []rune(b)
+	prefix := 0
+	for prefix < len(ra) && prefix < len(rb) && ra[prefix] == rb[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(ra)-prefix && suffix < len(rb)-prefix && ra[len(ra)-1-suffix] == rb[len(rb)-1-suffix] {
+		suffix++
+	}
+	return (&Operation{}).
+		Retain(prefix).
+		Insert(string(rb[prefix : len(rb)-suffix])).
+		Delete(len(ra) - prefix - suffix).
+		Retain(suffix)
+}
+
+// IsNoop reports whether the operation leaves every document unchanged.
+func (o *Operation) IsNoop() bool {
+	return len(o.components) == 0 || (len(o.components) == 1 && o.components[0].Retain > 0)
+}
+
+func (o *Operation) Apply(doc string) (string, error) {
+	runes := []rune(doc)
+	if len(runes) != o.baseLen {
+		return "", ErrBaseLength
+	}
+	out := make([]rune, 0, o.targetLen)
+	i := 0
+	for _, c := range o.components {
+		switch {
+		case c.Retain > 0:
+			out = append(out, runes[i:i+c.Retain]...)
+			i += c.Retain
+		case c.Insert != "":
+			out = append(out, []rune(c.Insert)...)
+		case c.Delete > 0:
+			i += c.Delete
+		}
+	}
+	return string(out), nil
+}
+
+// MarshalJSON encodes the operation as a list in which positive numbers
+// retain, negative numbers delete and strings insert, e.g. [3,"x",-2].
+func (o Operation) MarshalJSON() ([]byte, error) {
+	out := make([]interface{}, len(o.components))
+	for i, c := range o.components {
+		switch {
+		case c.Retain > 0:
+			out[i] = c.Retain
+		case c.Insert != "":
+			out[i] = c.Insert
+		default:
+			out[i] = -c.Delete
+		}
+	}
+	return json.Marshal(out)
+}
+
+func (o *Operation) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	*o = Operation{}
+	for _, r := range raw {
+		var n int
+		if err := json.Unmarshal(r, &n); err == nil {
+			switch {
+			case n > 0:
+				o.Retain(n)
+			case n < 0:
+				o.Delete(-n)
+			default:
+				return fmt.Errorf("%w: zero length component", ErrInvalid)
+			}
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(r, &s); err != nil || s == "" {
+			return fmt.Errorf("%w: component must be a non-zero number or a non-empty string", ErrInvalid)
+		}
+		o.Insert(s)
+	}
+	return nil
+}
+
+// cursor walks the components of an operation, allowing the current one to
+// be consumed partially.
+type cursor struct {
+	components []Component
+	i          int
+	cur        *Component
+	rest       Component
+}
+
+func newCursor(components []Component) *cursor {
+	c := &cursor{components: components}
+	c.next()
+	return c
+}
+
+func (c *cursor) next() {
+	if c.i >= len(c.components) {
+		c.cur = nil
+		return
+	}
+	c.rest = c.components[c.i]
+	c.cur = &c.rest
+	c.i++
+}
+
+// Transform returns a' and b' such that applying a then b' gives the same
+// document as applying b then a'. When both insert at the same position the
+// insert of a ends up first.
+func Transform(a, b *Operation) (*Operation, *Operation, error) {
+	if a.baseLen != b.baseLen {
+		return nil, nil, ErrBaseLength
+	}
+	aPrime, bPrime := &Operation{}, &Operation{}
+	c1, c2 := newCursor(a.components), newCursor(b.components)
+	for c1.cur != nil || c2.cur != nil {
+		if c1.cur != nil && c1.cur.Insert != "" {
+			aPrime.Insert(c1.cur.Insert)
+			bPrime.Retain(utf8.RuneCountInString(c1.cur.Insert))
+			c1.next()
+			continue
+		}
+		if c2.cur != nil && c2.cur.Insert != "" {
+			aPrime.Retain(utf8.RuneCountInString(c2.cur.Insert))
+			bPrime.Insert(c2.cur.Insert)
+			c2.next()
+			continue
+		}
+		if c1.cur == nil || c2.cur == nil {
+			return nil, nil, ErrInvalid
+		}
+		l1, l2 := length(*c1.cur), length(*c2.cur)
+		n := min(l1, l2)
+		switch {
+		case c1.cur.Retain > 0 && c2.cur.Retain > 0:
+			aPrime.Retain(n)
+			bPrime.Retain(n)
+		case c1.cur.Delete > 0 && c2.cur.Retain > 0:
+			aPrime.Delete(n)
+		case c1.cur.Retain > 0 && c2.cur.Delete > 0:
+			bPrime.Delete(n)
+		}
+		consume(c1, n)
+		consume(c2, n)
+	}
+	return aPrime, bPrime, nil
+}
+
+// Compose returns one operation with the effect of applying a then b.
+func Compose(a, b *Operation) (*Operation, error) {
+	if a.targetLen != b.baseLen {
+		return nil, ErrBaseLength
+	}
+	out := &Operation{}
+	c1, c2 := newCursor(a.components), newCursor(b.components)
+	for c1.cur != nil || c2.cur != nil {
+		if c1.cur != nil && c1.cur.Delete > 0 {
+			out.Delete(c1.cur.Delete)
+			c1.next()
+			continue
+		}
+		if c2.cur != nil && c2.cur.Insert != "" {
+			out.Insert(c2.cur.Insert)
+			c2.next()
+			continue
+		}
+		if c1.cur == nil || c2.cur == nil {
+			return nil, ErrInvalid
+		}
+		n := min(length(*c1.cur), length(*c2.cur))
+		switch {
+		case c1.cur.Retain > 0 && c2.cur.Retain > 0:
+			out.Retain(n)
+		case c1.cur.Insert != "" && c2.cur.Retain > 0:
+			out.Insert(string([]rune(c1.cur.Insert)[:n]))
+		case c1.cur.Retain > 0 && c2.cur.Delete > 0:
+			out.Delete(n)
+		}
+		// An insert deleted by b leaves nothing behind.
+		consume(c1, n)
+		consume(c2, n)
+	}
+	return out, nil
+}
+
+func length(c Component) int {
+	switch {
+	case c.Retain > 0:
+		return c.Retain
+	case c.Insert != "":
+		return utf8.RuneCountInString(c.Insert)
+	}
+	return c.Delete
+}
+
+func consume(c *cursor, n int) {
+	switch {
+	case c.cur.Retain > 0:
+		c.cur.Retain -= n
+		if c.cur.Retain == 0 {
+			c.next()
+		}
+	case c.cur.Insert != "":
+		runes := []rune(c.cur.Insert)
+		c.cur.Insert = string(runes[n:])
+		if c.cur.Insert == "" {
+			c.next()
+		}
+	default:
+		c.cur.Delete -= n
+		if c.cur.Delete == 0 {
+			c.next()
+		}
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
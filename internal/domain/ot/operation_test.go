@@ -0,0 +1,165 @@
+package ot
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestApply(t *testing.T) {
+	op := (&Operation{}).Retain(2).Insert("ü").Delete(1).Retain(2)
+	got, err := op.Apply("héllo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "héülo" {
+		t.Fatalf("got %q", got)
+	}
+	if _, err := op.Apply("hello!"); !errors.Is(err, ErrBaseLength) {
+		t.Fatalf("expected ErrBaseLength, got %v", err)
+	}
+}
+
+func TestBuilderNormalizesInsertBeforeDelete(t *testing.T) {
+	a := (&Operation{}).Retain(1).Delete(2).Insert("x").Delete(1).Insert("y")
+	b := (&Operation{}).Retain(1).Insert("xy").Delete(3)
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	if string(ja) != string(jb) {
+		t.Fatalf("%s != %s", ja, jb)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	for _, c := range [][2]string{{"", ""}, {"", "abc"}, {"abc", ""}, {"héllo wörld", "héllo there wörld"}, {"aaa", "aa"}, {"abc", "xbz"}} {
+		op := Diff(c[0], c[1])
+		got, err := op.Apply(c[0])
+		if err != nil || got != c[1] {
+			t.Fatalf("Diff(%q, %q) gives %q, %v", c[0], c[1], got, err)
+		}
+	}
+	if !Diff("same", "same").IsNoop() {
+		t.Fatal("expected a noop for equal documents")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var op Operation
+	if err := json.Unmarshal([]byte(`[3,"abc",-2,1]`), &op); err != nil {
+		t.Fatal(err)
+	}
+	if op.BaseLen() != 6 || op.TargetLen() != 7 {
+		t.Fatalf("lengths %d/%d", op.BaseLen(), op.TargetLen())
+	}
+	b, _ := json.Marshal(op)
+	if string(b) != `[3,"abc",-2,1]` {
+		t.Fatalf("got %s", b)
+	}
+	for _, in := range []string{`[0]`, `[""]`, `[true]`, `{}`} {
+		if err := json.Unmarshal([]byte(in), &op); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: expected ErrInvalid, got %v", in, err)
+		}
+	}
+}
+
+func TestTransformTieBreak(t *testing.T) {
+	a := (&Operation{}).Retain(1).Insert("a").Retain(1)
+	b := (&Operation{}).Retain(1).Insert("b").Retain(1)
+	ap, bp, err := Transform(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s1, _ := a.Apply("xy")
+	s1, _ = bp.Apply(s1)
+	s2, _ := b.Apply("xy")
+	s2, _ = ap.Apply(s2)
+	if s1 != "xaby" || s2 != s1 {
+		t.Fatalf("got %q and %q", s1, s2)
+	}
+}
+
+const alphabet = "abcé 日本\n"
+
+func randomString(r *rand.Rand, n int) string {
+	chars := []rune(alphabet)
+	out := make([]rune, n)
+	for i := range out {
+		out[i] = chars[r.Intn(len(chars))]
+	}
+	return string(out)
+}
+
+func randomOperation(r *rand.Rand, doc string) *Operation {
+	op := &Operation{}
+	left := utf8.RuneCountInString(doc)
+	for left > 0 {
+		n := r.Intn(left) + 1
+		switch r.Intn(3) {
+		case 0:
+			op.Retain(n)
+			left -= n
+		case 1:
+			op.Delete(n)
+			left -= n
+		default:
+			op.Insert(randomString(r, r.Intn(4)+1))
+		}
+	}
+	if r.Intn(2) == 0 {
+		op.Insert(randomString(r, r.Intn(3)+1))
+	}
+	return op
+}
+
+func TestTransformConverges(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		doc := randomString(r, r.Intn(20))
+		a, b := randomOperation(r, doc), randomOperation(r, doc)
+		ap, bp, err := Transform(a, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		left, err := a.Apply(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if left, err = bp.Apply(left); err != nil {
+			t.Fatal(err)
+		}
+		right, err := b.Apply(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if right, err = ap.Apply(right); err != nil {
+			t.Fatal(err)
+		}
+		if left != right {
+			t.Fatalf("doc %q a %v b %v: %q != %q", doc, a.Components(), b.Components(), left, right)
+		}
+	}
+}
+
+func TestCompose(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 2000; i++ {
+		doc := randomString(r, r.Intn(20))
+		a := randomOperation(r, doc)
+		mid, _ := a.Apply(doc)
+		b := randomOperation(r, mid)
+		want, _ := b.Apply(mid)
+		ab, err := Compose(a, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ab.Apply(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("doc %q: %q != %q", doc, got, want)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+package repository
+
+import "context"
+
+// AttachmentRepository stores binary files referenced from memo bodies.
+// Names are content addressed, so saving an existing name is a no-op.
+type AttachmentRepository interface {
+	Save(ctx context.Context, name string, data []byte) error
+}
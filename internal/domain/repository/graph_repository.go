@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/domain/model"
+)
+
+// GraphRepository streams the tags and links of the memos matching a
+// filter, without loading them into memory.
+type GraphRepository interface {
+	// StreamTags calls fn once for every distinct tag.
+	StreamTags(ctx context.Context, f model.MemoFilter, fn func(tag string) error) error
+	StreamTagEdges(ctx context.Context, f model.MemoFilter, fn func(memoID uuid.UUID, tag string) error) error
+	// StreamLinks calls fn for every resolved link whose source and target
+	// both match f.
+	StreamLinks(ctx context.Context, f model.MemoFilter, fn func(domain.MemoLink) error) error
+}
@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/peconote/peconote/internal/domain"
+)
+
+// IdempotencyRepository stores records by user and key, so that users
+// choosing the same key do not share them.
+type IdempotencyRepository interface {
+	// Reserve stores rec unless an unexpired record with the same user and
+	// key exists, in which case that record is returned and reserved is
+	// false.
+	Reserve(ctx context.Context, rec *domain.IdempotencyRecord, now time.Time) (existing *domain.IdempotencyRecord, reserved bool, err error)
+	Complete(ctx context.Context, userID, key string, statusCode int, location string, body []byte) error
+	Release(ctx context.Context, userID, key string) error
+}
@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/peconote/peconote/internal/domain"
+)
+
+// MemoEventResumeWindow is how many ids below the latest event seen a reader
+// of the log looks again when it resumes. Ids are assigned on insert, so an
+// event can be committed after one with a higher id.
+const MemoEventResumeWindow = 1000
+
+type MemoEventRepository interface {
+	// Append stores e and sets its ID and Version. It must run in the
+	// transaction that made the change, so the log only holds committed
+	// changes.
+	Append(ctx context.Context, e *domain.MemoEvent) error
+	// ListAfter returns up to limit committed events with an id above
+	// afterID, ordered by id.
+	ListAfter(ctx context.Context, afterID int64, limit int) ([]domain.MemoEvent, error)
+	// LastID returns the id of the latest event, or 0 when the log is empty.
+	LastID(ctx context.Context) (int64, error)
+}
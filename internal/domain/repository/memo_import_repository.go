@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// MemoImportRepository remembers which source files were already imported,
+// so an interrupted import can be run again without creating duplicates.
+type MemoImportRepository interface {
+	IsImported(ctx context.Context, sourceKey string) (bool, error)
+	MarkImported(ctx context.Context, sourceKey, sourcePath string, memoID uuid.UUID) error
+}
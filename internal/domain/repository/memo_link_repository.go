@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/peconote/peconote/internal/domain"
+)
+
+type MemoLinkRepository interface {
+	Resolve(ctx context.Context, refs []string) (map[string]uuid.UUID, error)
+	Replace(ctx context.Context, sourceID uuid.UUID, links []domain.MemoLink) error
+	// Retarget points the broken links whose reference is title or the memo
+	// id at the memo. Links to the memo by another reference, such as its
+	// title before a rename, are resolved again without it.
+	Retarget(ctx context.Context, targetID uuid.UUID, title string) error
+	ListOutgoing(ctx context.Context, sourceID uuid.UUID) ([]domain.MemoLink, error)
+	ListBacklinks(ctx context.Context, targetID uuid.UUID) ([]domain.MemoLink, error)
+	ListBroken(ctx context.Context) ([]domain.MemoLink, error)
+}
@@ -2,15 +2,31 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/domain/model"
 )
 
+// ErrMemoChanged is returned by UpdateBody when the stored body is not the
+// one the update was based on.
+var ErrMemoChanged = errors.New("memo changed")
+
 type MemoRepository interface {
 	Create(ctx context.Context, m *domain.Memo) error
-	List(ctx context.Context, tag *string, limit, offset int) ([]*domain.Memo, int, error)
+	List(ctx context.Context, f model.MemoFilter, sort model.MemoSort, limit, offset int) ([]*domain.Memo, int, error)
 	Get(ctx context.Context, id uuid.UUID) (*domain.Memo, error)
 	Update(ctx context.Context, m *domain.Memo) error
+	// UpdateBody replaces the body of a memo if it is still base, keeping
+	// its title and tags, and returns ErrMemoChanged otherwise.
+	UpdateBody(ctx context.Context, id uuid.UUID, base, body string, updatedAt time.Time) error
 	Delete(ctx context.Context, id uuid.UUID) error
+	SetFlag(ctx context.Context, id uuid.UUID, flag domain.MemoFlag, value bool) error
+	// Stream calls fn for every memo matching f, oldest first, without
+	// loading the whole result into memory. Returning an error from fn
+	// stops the iteration and is returned as is.
+	Stream(ctx context.Context, f model.MemoFilter, fn func(*domain.Memo) error) error
+	Stats(ctx context.Context) (domain.MemoStats, error)
 }
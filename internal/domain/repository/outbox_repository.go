@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/peconote/peconote/internal/domain"
+)
+
+type OutboxRepository interface {
+	// Append stores m and sets its ID. It must run in the transaction that
+	// made the change.
+	Append(ctx context.Context, m *domain.OutboxMessage) error
+	// Pending returns up to limit messages that are neither dispatched nor
+	// dead and are due at now, in the order they were appended. A message
+	// is left out while an earlier live message of the same aggregate is
+	// not due yet.
+	Pending(ctx context.Context, now time.Time, limit int) ([]domain.OutboxMessage, error)
+	// Delete removes a dispatched message.
+	Delete(ctx context.Context, id int64) error
+	// MarkFailed saves the attempts, next attempt and last error of m. Dead
+	// messages are kept for inspection but not returned by Pending.
+	MarkFailed(ctx context.Context, m *domain.OutboxMessage, dead bool) error
+	// WithLock runs fn unless another dispatcher holds the outbox lock and
+	// reports whether it ran.
+	WithLock(ctx context.Context, fn func(ctx context.Context) error) (bool, error)
+}
@@ -0,0 +1,267 @@
+// Package repotest holds conformance tests that every implementation of
+// a repository interface must pass.
+package repotest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/domain/model"
+	"github.com/peconote/peconote/internal/domain/repository"
+)
+
+// TestMemoRepository checks the behavior every MemoRepository shares.
+// newRepo must return an empty repository.
+func TestMemoRepository(t *testing.T, newRepo func(t *testing.T) repository.MemoRepository) {
+	ctx := context.Background()
+	// Postgres keeps microseconds.
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hours int) time.Time { return base.Add(time.Duration(hours) * time.Hour) }
+	newMemo := func(hours int, body string, tags ...string) *domain.Memo {
+		return &domain.Memo{ID: uuid.New(), Title: body, Body: body, Tags: tags, CreatedAt: at(hours), UpdatedAt: at(hours)}
+	}
+	ids := func(memos []*domain.Memo) []uuid.UUID {
+		out := make([]uuid.UUID, len(memos))
+		for i, m := range memos {
+			out[i] = m.ID
+		}
+		return out
+	}
+	sameIDs := func(t *testing.T, got []*domain.Memo, want ...*domain.Memo) {
+		t.Helper()
+		g, w := ids(got), ids(want)
+		if len(g) != len(w) {
+			t.Fatalf("got %d memos, want %d", len(g), len(w))
+		}
+		for i := range g {
+			if g[i] != w[i] {
+				t.Fatalf("memo %d: got %s, want %s", i, g[i], w[i])
+			}
+		}
+	}
+
+	t.Run("CreateGetUpdate", func(t *testing.T) {
+		repo := newRepo(t)
+		m := newMemo(1, "first memo", "b", "a")
+		m.Pinned = true
+		if err := repo.Create(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+		got, err := repo.Get(ctx, m.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Body != m.Body || got.Title != m.Title || !got.Pinned || got.Archived ||
+			len(got.Tags) != 2 || got.Tags[0] != "b" || got.Tags[1] != "a" ||
+			!got.CreatedAt.Equal(m.CreatedAt) || !got.UpdatedAt.Equal(m.UpdatedAt) {
+			t.Fatalf("unexpected memo %+v", got)
+		}
+
+		m.Body, m.Title, m.Tags, m.UpdatedAt = "changed", "changed", []string{"c"}, at(2)
+		if err := repo.Update(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.SetFlag(ctx, m.ID, domain.MemoFlagArchived, true); err != nil {
+			t.Fatal(err)
+		}
+		got, _ = repo.Get(ctx, m.ID)
+		if got.Body != "changed" || len(got.Tags) != 1 || got.Tags[0] != "c" || !got.Archived || !got.UpdatedAt.Equal(at(2)) || !got.CreatedAt.Equal(at(1)) {
+			t.Fatalf("unexpected updated memo %+v", got)
+		}
+	})
+
+	t.Run("UpdateBody", func(t *testing.T) {
+		repo := newRepo(t)
+		m := newMemo(1, "base", "a")
+		if err := repo.Create(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.UpdateBody(ctx, m.ID, "stale", "lost", at(2)); !errors.Is(err, repository.ErrMemoChanged) {
+			t.Fatalf("expected ErrMemoChanged, got %v", err)
+		}
+		if err := repo.UpdateBody(ctx, m.ID, "base", "merged", at(3)); err != nil {
+			t.Fatal(err)
+		}
+		got, _ := repo.Get(ctx, m.ID)
+		if got.Body != "merged" || got.Title != "base" || len(got.Tags) != 1 || !got.UpdatedAt.Equal(at(3)) {
+			t.Fatalf("unexpected updated memo %+v", got)
+		}
+		if err := repo.UpdateBody(ctx, uuid.New(), "base", "x", at(4)); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("expected sql.ErrNoRows, got %v", err)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		repo := newRepo(t)
+		missing := newMemo(1, "missing")
+		if _, err := repo.Get(ctx, missing.ID); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("Get: expected sql.ErrNoRows, got %v", err)
+		}
+		if err := repo.Update(ctx, missing); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("Update: expected sql.ErrNoRows, got %v", err)
+		}
+		if err := repo.Delete(ctx, missing.ID); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("Delete: expected sql.ErrNoRows, got %v", err)
+		}
+		if err := repo.SetFlag(ctx, missing.ID, domain.MemoFlagPinned, true); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("SetFlag: expected sql.ErrNoRows, got %v", err)
+		}
+
+		m := newMemo(1, "deleted", "x")
+		repo.Create(ctx, m)
+		if err := repo.Delete(ctx, m.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.Get(ctx, m.ID); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("Get after Delete: expected sql.ErrNoRows, got %v", err)
+		}
+		tag := "x"
+		if _, total, _ := repo.List(ctx, model.MemoFilter{Tag: &tag}, model.DefaultMemoSort, 10, 0); total != 0 {
+			t.Errorf("deleted memo is still listed by tag")
+		}
+	})
+
+	t.Run("ListOrderAndFilters", func(t *testing.T) {
+		repo := newRepo(t)
+		old := newMemo(1, "deploy the old service", "ops")
+		mid := newMemo(2, "grocery list", "home")
+		pinned := newMemo(3, "pinned note", "ops")
+		pinned.Pinned = true
+		newest := newMemo(4, "deploy deploy new service", "ops", "home")
+		archived := newMemo(5, "archived deploy", "ops")
+		archived.Archived = true
+		for _, m := range []*domain.Memo{old, mid, pinned, newest, archived} {
+			if err := repo.Create(ctx, m); err != nil {
+				t.Fatal(err)
+			}
+		}
+		no := false
+		active := model.MemoFilter{Archived: &no}
+
+		got, total, err := repo.List(ctx, active, model.DefaultMemoSort, 2, 0)
+		if err != nil || total != 4 {
+			t.Fatalf("expected 4 memos in total, got %d %v", total, err)
+		}
+		sameIDs(t, got, pinned, newest)
+		got, _, _ = repo.List(ctx, active, model.DefaultMemoSort, 2, 2)
+		sameIDs(t, got, mid, old)
+		got, total, _ = repo.List(ctx, active, model.DefaultMemoSort, 2, 10)
+		if len(got) != 0 || total != 4 {
+			t.Fatalf("expected an empty page with the total, got %d %d", len(got), total)
+		}
+
+		got, _, _ = repo.List(ctx, active, model.MemoSort{Field: model.MemoSortCreatedAt, Asc: true}, 10, 0)
+		sameIDs(t, got, pinned, old, mid, newest)
+		got, _, _ = repo.List(ctx, active, model.MemoSort{Field: model.MemoSortBodyLength}, 10, 0)
+		sameIDs(t, got, pinned, newest, old, mid)
+
+		tag := "home"
+		got, total, _ = repo.List(ctx, model.MemoFilter{Tag: &tag}, model.DefaultMemoSort, 10, 0)
+		if total != 2 {
+			t.Fatalf("expected 2 memos tagged home, got %d", total)
+		}
+		sameIDs(t, got, newest, mid)
+
+		search := "Deploy"
+		got, _, _ = repo.List(ctx, model.MemoFilter{Search: &search, Archived: &no}, model.MemoSort{Field: model.MemoSortRelevance}, 10, 0)
+		sameIDs(t, got, newest, old)
+
+		yes := true
+		got, _, _ = repo.List(ctx, model.MemoFilter{Archived: &yes}, model.DefaultMemoSort, 10, 0)
+		sameIDs(t, got, archived)
+		got, _, _ = repo.List(ctx, model.MemoFilter{Pinned: &yes}, model.DefaultMemoSort, 10, 0)
+		sameIDs(t, got, pinned)
+
+		after, before := at(2), at(4)
+		got, _, _ = repo.List(ctx, model.MemoFilter{CreatedAfter: &after, CreatedBefore: &before}, model.DefaultMemoSort, 10, 0)
+		sameIDs(t, got, pinned, mid)
+
+		var streamed []*domain.Memo
+		tag = "ops"
+		err = repo.Stream(ctx, model.MemoFilter{Tag: &tag}, func(m *domain.Memo) error {
+			streamed = append(streamed, m)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sameIDs(t, streamed, old, pinned, newest, archived)
+	})
+	t.Run("Stats", func(t *testing.T) {
+		repo := newRepo(t)
+		if stats, err := repo.Stats(ctx); err != nil || stats != (domain.MemoStats{}) {
+			t.Fatalf("expected empty stats, got %+v, %v", stats, err)
+		}
+		repo.Create(ctx, newMemo(1, "one", "a", "b"))
+		repo.Create(ctx, newMemo(2, "two", "b", "c"))
+		repo.Create(ctx, newMemo(3, "three"))
+		stats, err := repo.Stats(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats != (domain.MemoStats{Memos: 3, Tags: 3}) {
+			t.Fatalf("unexpected stats %+v", stats)
+		}
+	})
+
+	t.Run("StreamStopsOnError", func(t *testing.T) {
+		repo := newRepo(t)
+		for i := 0; i < 3; i++ {
+			repo.Create(ctx, newMemo(i, "memo"))
+		}
+		stop := errors.New("stop")
+		calls := 0
+		err := repo.Stream(ctx, model.MemoFilter{}, func(m *domain.Memo) error {
+			calls++
+			return stop
+		})
+		if err != stop || calls != 1 {
+			t.Fatalf("expected the callback's error after 1 call, got %v after %d", err, calls)
+		}
+	})
+
+	t.Run("Concurrency", func(t *testing.T) {
+		repo := newRepo(t)
+		shared := newMemo(0, "shared", "s")
+		if err := repo.Create(ctx, shared); err != nil {
+			t.Fatal(err)
+		}
+		const writers = 16
+		var wg sync.WaitGroup
+		errs := make(chan error, 4*writers)
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs <- repo.Create(ctx, newMemo(i+1, "concurrent", "c"))
+				update := *shared
+				update.Body, update.Tags, update.UpdatedAt = "shared", []string{"s", "c"}, at(i+1)
+				errs <- repo.Update(ctx, &update)
+				errs <- repo.SetFlag(ctx, shared.ID, domain.MemoFlagFavorite, i%2 == 0)
+				_, _, err := repo.List(ctx, model.MemoFilter{}, model.DefaultMemoSort, 5, 0)
+				errs <- err
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		tag := "c"
+		if _, total, err := repo.List(ctx, model.MemoFilter{Tag: &tag}, model.DefaultMemoSort, 1, 0); err != nil || total != writers+1 {
+			t.Fatalf("expected %d memos tagged c, got %d %v", writers+1, total, err)
+		}
+		got, err := repo.Get(ctx, shared.ID)
+		if err != nil || len(got.Tags) != 2 {
+			t.Fatalf("unexpected shared memo %+v %v", got, err)
+		}
+	})
+}
@@ -0,0 +1,9 @@
+package repository
+
+import "context"
+
+// Transactor runs fn in a transaction. Repositories called with the context
+// passed to fn take part in that transaction.
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/peconote/peconote/internal/domain"
+)
+
+type WebhookRepository interface {
+	Create(ctx context.Context, w *domain.Webhook) error
+	List(ctx context.Context) ([]domain.Webhook, error)
+	Get(ctx context.Context, id uuid.UUID) (*domain.Webhook, error)
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+type WebhookDeliveryRepository interface {
+	// Enqueue stores d and sets its ID. A delivery of the same event to the
+	// same webhook is stored only once.
+	Enqueue(ctx context.Context, d *domain.WebhookDelivery) error
+	// ClaimDue returns up to limit pending deliveries due at now and moves
+	// their next attempt to now+lease, so other workers skip them meanwhile.
+	ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]domain.WebhookDelivery, error)
+	// RecordAttempt saves the status, attempts, next attempt and last error
+	// of d together with the log entry a.
+	RecordAttempt(ctx context.Context, d *domain.WebhookDelivery, a *domain.WebhookAttempt) error
+	Get(ctx context.Context, id int64) (*domain.WebhookDelivery, error)
+	ListByWebhook(ctx context.Context, webhookID uuid.UUID, limit int) ([]domain.WebhookDelivery, error)
+	ListAttempts(ctx context.Context, deliveryID int64) ([]domain.WebhookAttempt, error)
+	// Requeue makes a delivery pending again with a fresh retry budget.
+	Requeue(ctx context.Context, id int64, at time.Time) error
+}
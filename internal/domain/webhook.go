@@ -0,0 +1,75 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	// WebhookDeliveryDead marks a delivery that failed too often. It is
+	// only retried when redelivered by hand.
+	WebhookDeliveryDead WebhookDeliveryStatus = "dead"
+)
+
+// Webhook subscribes a URL to memo events. Empty Events means all types;
+// a non-empty Tag limits it to memos with that tag.
+type Webhook struct {
+	ID        uuid.UUID
+	URL       string
+	Events    []MemoEventType
+	Tag       string
+	Secret    string
+	CreatedAt time.Time
+}
+
+func (w *Webhook) Matches(e MemoEvent) bool {
+	if len(w.Events) > 0 {
+		found := false
+		for _, t := range w.Events {
+			found = found || t == e.Type
+		}
+		if !found {
+			return false
+		}
+	}
+	if w.Tag == "" {
+		return true
+	}
+	for _, t := range e.Tags {
+		if t == w.Tag {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is one event queued for one webhook.
+type WebhookDelivery struct {
+	ID            int64
+	WebhookID     uuid.UUID
+	EventID       int64
+	EventType     MemoEventType
+	Payload       []byte
+	Status        WebhookDeliveryStatus
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// WebhookAttempt logs one try to send a delivery. StatusCode is 0 when no
+// response was received.
+type WebhookAttempt struct {
+	ID         int64
+	DeliveryID int64
+	StatusCode int
+	Error      string
+	Duration   time.Duration
+	CreatedAt  time.Time
+}
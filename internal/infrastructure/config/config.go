@@ -0,0 +1,445 @@
+// Package config loads the server configuration. Defaults are overridden
+// by the config file, then environment variables, then flags.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+
+	"github.com/peconote/peconote/internal/usecase"
+)
+
+type Config struct {
+	Server   Server   `yaml:"server" toml:"server"`
+	Database Database `yaml:"database" toml:"database"`
+	Storage  Storage  `yaml:"storage" toml:"storage"`
+	Limits   Limits   `yaml:"limits" toml:"limits"`
+	Metrics  Metrics  `yaml:"metrics" toml:"metrics"`
+	Tracing  Tracing  `yaml:"tracing" toml:"tracing"`
+	Webhooks Webhooks `yaml:"webhooks" toml:"webhooks"`
+}
+
+type Server struct {
+	// Addr is the address the HTTP server listens on.
+	Addr string `yaml:"addr" toml:"addr"`
+	// ReadTimeout, WriteTimeout and IdleTimeout bound the phases of an HTTP
+	// connection. Event streams, collaborative editing sessions, exports
+	// and the graph are exempt from WriteTimeout.
+	ReadTimeout  Duration `yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout  Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	// ImportTimeout bounds an import, upload included, in place of
+	// ReadTimeout and WriteTimeout.
+	ImportTimeout Duration `yaml:"import_timeout" toml:"import_timeout"`
+	// ShutdownTimeout is how long in-flight requests may take to finish
+	// after SIGTERM.
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+}
+
+type Database struct {
+	// URL selects the memo storage: a postgres://, mysql:// or sqlite: URL,
+	// or git:<dir>.
+	URL string `yaml:"url" toml:"url"`
+	// URLFile names a file holding URL, so that its password is kept out
+	// of the config file and the environment.
+	URLFile string `yaml:"url_file,omitempty" toml:"url_file,omitempty"`
+	// UsersPath is the SQLite file of the users database.
+	UsersPath   string `yaml:"users_path" toml:"users_path"`
+	AutoMigrate bool   `yaml:"auto_migrate" toml:"auto_migrate"`
+	// MaxOpenConns, MaxIdleConns and ConnMaxLifetime size the memo
+	// database's connection pool. Zero means no limit, except that zero
+	// MaxIdleConns keeps no idle connections.
+	MaxOpenConns    int      `yaml:"max_open_conns" toml:"max_open_conns"`
+	MaxIdleConns    int      `yaml:"max_idle_conns" toml:"max_idle_conns"`
+	ConnMaxLifetime Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime"`
+}
+
+type Storage struct {
+	// AttachmentsDir is where imported attachments are written and served
+	// from.
+	AttachmentsDir string `yaml:"attachments_dir" toml:"attachments_dir"`
+}
+
+type Limits struct {
+	MaxBodyBytes int `yaml:"max_body_bytes" toml:"max_body_bytes"`
+	MaxTags      int `yaml:"max_tags" toml:"max_tags"`
+	MaxPageSize  int `yaml:"max_page_size" toml:"max_page_size"`
+}
+
+// Duration is a time.Duration written like "30s" in config files.
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+type Metrics struct {
+	// Addr, when set, serves /metrics on its own listener instead of the
+	// API's, so that it can be kept off public networks.
+	Addr string `yaml:"addr,omitempty" toml:"addr,omitempty"`
+}
+
+// Tracing exporters.
+const (
+	TracingNone   = "none"
+	TracingOTLP   = "otlp"
+	TracingStdout = "stdout"
+)
+
+type Tracing struct {
+	// Exporter sends spans to an OTLP/HTTP collector at Endpoint, or to
+	// stdout. With none, requests still get trace ids for logs and
+	// responses, but no spans are recorded.
+	Exporter string `yaml:"exporter" toml:"exporter"`
+	Endpoint string `yaml:"endpoint" toml:"endpoint"`
+	// SampleRatio is the share of new traces recorded. Requests continuing
+	// a trace follow its sampling decision.
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio"`
+}
+
+type Webhooks struct {
+	// AllowPrivateDestinations lets webhooks post to loopback, private and
+	// link-local addresses, e.g. a receiver on localhost during
+	// development. Keep it off where webhook URLs are not trusted.
+	AllowPrivateDestinations bool `yaml:"allow_private_destinations" toml:"allow_private_destinations"`
+}
+
+func (l Limits) MemoLimits() usecase.MemoLimits {
+	return usecase.MemoLimits{MaxBodyBytes: l.MaxBodyBytes, MaxTags: l.MaxTags, MaxPageSize: l.MaxPageSize}
+}
+
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Addr:            ":8080",
+			ReadTimeout:     Duration(15 * time.Second),
+			WriteTimeout:    Duration(60 * time.Second),
+			IdleTimeout:     Duration(120 * time.Second),
+			ImportTimeout:   Duration(10 * time.Minute),
+			ShutdownTimeout: Duration(30 * time.Second),
+		},
+		Database: Database{
+			URL:             "postgres://postgres@localhost:5432/postgres?sslmode=disable",
+			UsersPath:       "app.db",
+			MaxOpenConns:    20,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: Duration(30 * time.Minute),
+		},
+		Storage: Storage{AttachmentsDir: "attachments"},
+		Tracing: Tracing{
+			Exporter:    TracingNone,
+			Endpoint:    "http://localhost:4318",
+			SampleRatio: 1,
+		},
+		Limits: Limits{
+			MaxBodyBytes: usecase.DefaultMemoLimits.MaxBodyBytes,
+			MaxTags:      usecase.DefaultMemoLimits.MaxTags,
+			MaxPageSize:  usecase.DefaultMemoLimits.MaxPageSize,
+		},
+	}
+}
+
+// setting is one configuration value, settable from the environment and a
+// flag.
+type setting struct {
+	env, flag, usage string
+	set              func(c *Config, v string) error
+}
+
+func stringSetting(field func(c *Config) *string) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		*field(c) = v
+		return nil
+	}
+}
+
+func intSetting(field func(c *Config) *int) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func durationSetting(field func(c *Config) *Duration) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		return field(c).UnmarshalText([]byte(v))
+	}
+}
+
+func boolSetting(field func(c *Config) *bool) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+func floatSetting(field func(c *Config) *float64) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return err
+		}
+		*field(c) = f
+		return nil
+	}
+}
+
+var settings = []setting{
+	{"PORT", "", "", func(c *Config, v string) error {
+		c.Server.Addr = ":" + v
+		return nil
+	}},
+	{"ADDR", "addr", "address to listen on", stringSetting(func(c *Config) *string { return &c.Server.Addr })},
+	{"READ_TIMEOUT", "read-timeout", "maximum duration for reading a request", durationSetting(func(c *Config) *Duration { return &c.Server.ReadTimeout })},
+	{"WRITE_TIMEOUT", "write-timeout", "maximum duration for writing a response", durationSetting(func(c *Config) *Duration { return &c.Server.WriteTimeout })},
+	{"IDLE_TIMEOUT", "idle-timeout", "how long idle keep-alive connections are kept", durationSetting(func(c *Config) *Duration { return &c.Server.IdleTimeout })},
+	{"IMPORT_TIMEOUT", "import-timeout", "maximum duration of an import, upload included", durationSetting(func(c *Config) *Duration { return &c.Server.ImportTimeout })},
+	{"SHUTDOWN_TIMEOUT", "shutdown-timeout", "how long in-flight requests may take after SIGTERM", durationSetting(func(c *Config) *Duration { return &c.Server.ShutdownTimeout })},
+	// Setting the URL or its file replaces the other, so that the one
+	// given last wins.
+	{"DATABASE_URL", "database-url", "memo storage URL", func(c *Config, v string) error {
+		c.Database.URL, c.Database.URLFile = v, ""
+		return nil
+	}},
+	{"DATABASE_URL_FILE", "database-url-file", "file holding the memo storage URL", func(c *Config, v string) error {
+		c.Database.URL, c.Database.URLFile = "", v
+		return nil
+	}},
+	{"USERS_DB_PATH", "users-db", "SQLite file of the users database", stringSetting(func(c *Config) *string { return &c.Database.UsersPath })},
+	{"AUTO_MIGRATE", "auto-migrate", "apply pending migrations on startup (true or false)", boolSetting(func(c *Config) *bool { return &c.Database.AutoMigrate })},
+	{"DB_MAX_OPEN_CONNS", "db-max-open-conns", "maximum open memo database connections, 0 for no limit", intSetting(func(c *Config) *int { return &c.Database.MaxOpenConns })},
+	{"DB_MAX_IDLE_CONNS", "db-max-idle-conns", "maximum idle memo database connections", intSetting(func(c *Config) *int { return &c.Database.MaxIdleConns })},
+	{"DB_CONN_MAX_LIFETIME", "db-conn-max-lifetime", "maximum lifetime of a memo database connection, 0 for no limit", durationSetting(func(c *Config) *Duration { return &c.Database.ConnMaxLifetime })},
+	{"ATTACHMENTS_DIR", "attachments-dir", "directory of imported attachments", stringSetting(func(c *Config) *string { return &c.Storage.AttachmentsDir })},
+	{"MAX_BODY_BYTES", "max-body-bytes", "maximum memo body size in bytes", intSetting(func(c *Config) *int { return &c.Limits.MaxBodyBytes })},
+	{"MAX_TAGS", "max-tags", "maximum number of tags per memo", intSetting(func(c *Config) *int { return &c.Limits.MaxTags })},
+	{"MAX_PAGE_SIZE", "max-page-size", "maximum page_size of memo listings", intSetting(func(c *Config) *int { return &c.Limits.MaxPageSize })},
+	{"METRICS_ADDR", "metrics-addr", "separate address to serve /metrics on", stringSetting(func(c *Config) *string { return &c.Metrics.Addr })},
+	{"TRACING_EXPORTER", "tracing-exporter", "where spans are sent: none, otlp or stdout", stringSetting(func(c *Config) *string { return &c.Tracing.Exporter })},
+	{"TRACING_ENDPOINT", "tracing-endpoint", "OTLP/HTTP collector URL", stringSetting(func(c *Config) *string { return &c.Tracing.Endpoint })},
+	{"TRACING_SAMPLE_RATIO", "tracing-sample-ratio", "share of new traces recorded, 0 to 1", floatSetting(func(c *Config) *float64 { return &c.Tracing.SampleRatio })},
+	{"WEBHOOK_ALLOW_PRIVATE_DESTINATIONS", "webhook-allow-private-destinations", "let webhooks post to loopback, private and link-local addresses (true or false)", boolSetting(func(c *Config) *bool { return &c.Webhooks.AllowPrivateDestinations })},
+}
+
+// Load registers the config flags on fs, parses args and returns the
+// validated configuration. The config file is named by the -config flag or
+// PECONOTE_CONFIG; its format follows its extension, .yaml, .yml or .toml.
+func Load(fs *flag.FlagSet, args []string, getenv func(string) string) (*Config, error) {
+	path := fs.String("config", "", "YAML or TOML config file")
+	flagValues := map[string]*string{}
+	for _, s := range settings {
+		if s.flag != "" {
+			flagValues[s.flag] = fs.String(s.flag, "", s.usage)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	c := Default()
+	if *path == "" {
+		*path = getenv("PECONOTE_CONFIG")
+	}
+	if *path != "" {
+		if err := c.readFile(*path); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range settings {
+		if v := getenv(s.env); v != "" {
+			if err := s.set(c, v); err != nil {
+				return nil, fmt.Errorf("%s: %w", s.env, err)
+			}
+		}
+	}
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag == f.Name && flagErr == nil {
+				if err := s.set(c, *flagValues[s.flag]); err != nil {
+					flagErr = fmt.Errorf("-%s: %w", s.flag, err)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return nil, flagErr
+	}
+
+	if c.Database.URLFile != "" {
+		b, err := os.ReadFile(c.Database.URLFile)
+		if err != nil {
+			return nil, err
+		}
+		c.Database.URL = strings.TrimSpace(string(b))
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// readFile decodes the file over c, so that every key it sets, zero and
+// false values included, overrides the default.
+func (c *Config) readFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	// The URL and its file replace each other, so the default URL is only
+	// kept when the file sets neither.
+	defaultURL := c.Database.URL
+	c.Database.URL = ""
+	switch ext := filepath.Ext(path); ext {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(strings.NewReader(string(b)))
+		dec.KnownFields(true)
+		err = dec.Decode(c)
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	case ".toml":
+		err = toml.NewDecoder(strings.NewReader(string(b))).DisallowUnknownFields().Decode(c)
+	default:
+		return fmt.Errorf("%s: unknown config format %q", path, ext)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if c.Database.URL != "" && c.Database.URLFile != "" {
+		return fmt.Errorf("%s: set only one of database.url and database.url_file", path)
+	}
+	if c.Database.URL == "" && c.Database.URLFile == "" {
+		c.Database.URL = defaultURL
+	}
+	return nil
+}
+
+const (
+	// mysqlMaxBodyBytes is the size of a MySQL TEXT column.
+	mysqlMaxBodyBytes = 65535
+	// defaultPageSize is the page size of memo listings without page_size.
+	defaultPageSize = 20
+)
+
+// Validate reports every invalid setting.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Server.Addr == "" {
+		errs = append(errs, errors.New("server.addr is empty"))
+	}
+	if c.Database.URL == "" {
+		errs = append(errs, errors.New("database.url is empty"))
+	}
+	if c.Database.UsersPath == "" {
+		errs = append(errs, errors.New("database.users_path is empty"))
+	}
+	if c.Storage.AttachmentsDir == "" {
+		errs = append(errs, errors.New("storage.attachments_dir is empty"))
+	}
+	for _, l := range []struct {
+		name  string
+		value int
+	}{
+		{"limits.max_body_bytes", c.Limits.MaxBodyBytes},
+		{"limits.max_tags", c.Limits.MaxTags},
+		{"limits.max_page_size", c.Limits.MaxPageSize},
+	} {
+		if l.value < 1 {
+			errs = append(errs, fmt.Errorf("%s must be positive, got %d", l.name, l.value))
+		}
+	}
+	for _, t := range []struct {
+		name  string
+		value Duration
+	}{
+		{"server.read_timeout", c.Server.ReadTimeout},
+		{"server.write_timeout", c.Server.WriteTimeout},
+		{"server.idle_timeout", c.Server.IdleTimeout},
+		{"server.shutdown_timeout", c.Server.ShutdownTimeout},
+		{"database.conn_max_lifetime", c.Database.ConnMaxLifetime},
+	} {
+		if t.value < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative, got %s", t.name, time.Duration(t.value)))
+		}
+	}
+	if c.Server.ImportTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("server.import_timeout must be positive, got %s", time.Duration(c.Server.ImportTimeout)))
+	}
+	if c.Database.MaxOpenConns < 0 {
+		errs = append(errs, fmt.Errorf("database.max_open_conns must not be negative, got %d", c.Database.MaxOpenConns))
+	}
+	if c.Database.MaxIdleConns < 0 {
+		errs = append(errs, fmt.Errorf("database.max_idle_conns must not be negative, got %d", c.Database.MaxIdleConns))
+	}
+	if c.Limits.MaxPageSize >= 1 && c.Limits.MaxPageSize < defaultPageSize {
+		errs = append(errs, fmt.Errorf("limits.max_page_size must be at least %d, the default page size", defaultPageSize))
+	}
+	if c.Metrics.Addr != "" && c.Metrics.Addr == c.Server.Addr {
+		errs = append(errs, errors.New("metrics.addr must differ from server.addr"))
+	}
+	switch c.Tracing.Exporter {
+	case TracingNone, TracingStdout:
+	case TracingOTLP:
+		if u, err := url.Parse(c.Tracing.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("tracing.endpoint must be an http or https URL, got %q", c.Tracing.Endpoint))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter must be none, otlp or stdout, got %q", c.Tracing.Exporter))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("tracing.sample_ratio must be between 0 and 1, got %g", c.Tracing.SampleRatio))
+	}
+	if strings.HasPrefix(c.Database.URL, "mysql://") && c.Limits.MaxBodyBytes > mysqlMaxBodyBytes {
+		errs = append(errs, fmt.Errorf("limits.max_body_bytes must be at most %d on MySQL", mysqlMaxBodyBytes))
+	}
+	return errors.Join(errs...)
+}
+
+const redacted = "xxxxx"
+
+var dsnPassword = regexp.MustCompile(`(password=)('[^']*'|\S+)`)
+
+// Redacted returns a copy of c with the password of the database URL
+// masked.
+func (c *Config) Redacted() *Config {
+	r := *c
+	if u, err := url.Parse(c.Database.URL); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		}
+		r.Database.URL = u.String()
+	}
+	// Postgres also takes key=value connection strings.
+	r.Database.URL = dsnPassword.ReplaceAllString(r.Database.URL, "${1}"+redacted)
+	return &r
+}
@@ -0,0 +1,191 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func load(t *testing.T, args []string, env map[string]string) (*Config, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	return Load(fs, args, func(k string) string { return env[k] })
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeFile(t, "peconote.yaml", `
+server:
+  addr: ":9000"
+  read_timeout: 5s
+database:
+  url: postgres://file@db/peconote
+limits:
+  max_tags: 5
+  max_page_size: 50
+`)
+	cfg, err := load(t, []string{"-config", path, "-max-page-size", "200", "-read-timeout", "2s"}, map[string]string{
+		"MAX_TAGS":      "7",
+		"MAX_PAGE_SIZE": "80",
+		"READ_TIMEOUT":  "3s",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Addr != ":9000" || cfg.Database.URL != "postgres://file@db/peconote" {
+		t.Fatalf("file values not applied: %+v", cfg)
+	}
+	if cfg.Limits.MaxTags != 7 || cfg.Limits.MaxPageSize != 200 || cfg.Limits.MaxBodyBytes != 2000 {
+		t.Fatalf("unexpected limits %+v", cfg.Limits)
+	}
+	if cfg.Server.ReadTimeout != Duration(2*time.Second) || cfg.Server.WriteTimeout != Duration(time.Minute) {
+		t.Fatalf("unexpected timeouts %+v", cfg.Server)
+	}
+	if cfg.Database.UsersPath != "app.db" {
+		t.Fatalf("default users path lost: %q", cfg.Database.UsersPath)
+	}
+}
+
+func TestLoad_TOMLAndURLFile(t *testing.T) {
+	secret := writeFile(t, "database_url", "postgres://app:s3cret@db/peconote\n")
+	path := writeFile(t, "peconote.toml", `
+[server]
+shutdown_timeout = "5s"
+
+[database]
+url = "postgres://ignored@db/peconote"
+max_open_conns = 4
+`)
+	cfg, err := load(t, nil, map[string]string{"PECONOTE_CONFIG": path, "DATABASE_URL_FILE": secret, "PORT": "3000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Database.URL != "postgres://app:s3cret@db/peconote" || cfg.Server.Addr != ":3000" {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+	if cfg.Server.ShutdownTimeout != Duration(5*time.Second) || cfg.Database.MaxOpenConns != 4 || cfg.Database.MaxIdleConns != 10 {
+		t.Fatalf("unexpected server or pool settings %+v %+v", cfg.Server, cfg.Database)
+	}
+	if got := cfg.Redacted().Database.URL; got != "postgres://app:xxxxx@db/peconote" {
+		t.Fatalf("unexpected redacted URL %q", got)
+	}
+	if cfg.Database.URL != "postgres://app:s3cret@db/peconote" {
+		t.Fatal("Redacted modified the config")
+	}
+}
+
+func TestLoad_FileZeroValues(t *testing.T) {
+	for name, content := range map[string]string{
+		"peconote.yaml": `
+database:
+  url_file: ""
+  auto_migrate: false
+  max_idle_conns: 0
+  conn_max_lifetime: 0s
+tracing:
+  sample_ratio: 0
+webhooks:
+  allow_private_destinations: false
+`,
+		"peconote.toml": `
+[database]
+auto_migrate = false
+max_idle_conns = 0
+conn_max_lifetime = "0s"
+
+[tracing]
+sample_ratio = 0.0
+
+[webhooks]
+allow_private_destinations = false
+`,
+	} {
+		cfg, err := load(t, []string{"-config", writeFile(t, name, content)}, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if cfg.Database.MaxIdleConns != 0 || cfg.Database.ConnMaxLifetime != 0 || cfg.Tracing.SampleRatio != 0 {
+			t.Fatalf("%s: zero values not applied: %+v %+v", name, cfg.Database, cfg.Tracing)
+		}
+		if cfg.Database.AutoMigrate || cfg.Webhooks.AllowPrivateDestinations {
+			t.Fatalf("%s: false values not applied: %+v %+v", name, cfg.Database, cfg.Webhooks)
+		}
+		// Keys the file leaves out keep their defaults.
+		def := Default()
+		if cfg.Database.URL != def.Database.URL || cfg.Database.MaxOpenConns != 20 || cfg.Tracing.Exporter != TracingNone || cfg.Server.WriteTimeout != def.Server.WriteTimeout {
+			t.Fatalf("%s: defaults lost: %+v %+v", name, cfg.Database, cfg.Tracing)
+		}
+	}
+
+	// A file's true values are replaced by false ones from the environment
+	// and flags.
+	path := writeFile(t, "on.yaml", "database:\n  auto_migrate: true\nwebhooks:\n  allow_private_destinations: true\n")
+	cfg, err := load(t, []string{"-config", path, "-auto-migrate", "false"}, map[string]string{"WEBHOOK_ALLOW_PRIVATE_DESTINATIONS": "false"})
+	if err != nil || cfg.Database.AutoMigrate || cfg.Webhooks.AllowPrivateDestinations {
+		t.Fatalf("expected false overrides, got %+v %+v %v", cfg.Database, cfg.Webhooks, err)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		args []string
+		env  map[string]string
+		want string
+	}{
+		{"limits", []string{"-max-tags", "0", "-max-page-size", "10"}, nil, "limits.max_tags must be positive"},
+		{"page size", []string{"-max-page-size", "10"}, nil, "at least 20"},
+		{"number", nil, map[string]string{"MAX_TAGS": "ten"}, "MAX_TAGS"},
+		{"mysql body", []string{"-database-url", "mysql://u@h/d", "-max-body-bytes", "100000"}, nil, "on MySQL"},
+		{"unknown key", []string{"-config", writeFile(t, "bad.yaml", "server:\n  port: 1\n")}, nil, "field port not found"},
+		{"duration", nil, map[string]string{"WRITE_TIMEOUT": "10"}, "WRITE_TIMEOUT"},
+		{"pool", []string{"-db-max-idle-conns", "-1"}, nil, "database.max_idle_conns must not be negative"},
+		{"import timeout", []string{"-import-timeout", "0s"}, nil, "server.import_timeout must be positive"},
+		{"metrics addr", []string{"-addr", ":9000", "-metrics-addr", ":9000"}, nil, "metrics.addr must differ"},
+		{"tracing exporter", []string{"-tracing-exporter", "jaeger"}, nil, "tracing.exporter must be"},
+		{"tracing endpoint", []string{"-tracing-exporter", "otlp", "-tracing-endpoint", "localhost:4318"}, nil, "tracing.endpoint must be"},
+		{"sample ratio", nil, map[string]string{"TRACING_SAMPLE_RATIO": "2"}, "tracing.sample_ratio"},
+		{"format", []string{"-config", writeFile(t, "bad.ini", "")}, nil, "unknown config format"},
+		{"url and file", []string{"-config", writeFile(t, "both.yaml", "database:\n  url: sqlite:a.db\n  url_file: /run/url\n")}, nil, "set only one"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := load(t, tc.args, tc.env)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestRedacted_KeyValueDSN(t *testing.T) {
+	cfg := Default()
+	cfg.Database.URL = "host=db user=app password=s3cret dbname=peconote"
+	if got := cfg.Redacted().Database.URL; got != "host=db user=app password=xxxxx dbname=peconote" {
+		t.Fatalf("unexpected redacted DSN %q", got)
+	}
+}
+
+func TestLoad_WebhookPrivateDestinations(t *testing.T) {
+	cfg, err := load(t, nil, nil)
+	if err != nil || cfg.Webhooks.AllowPrivateDestinations {
+		t.Fatalf("expected private destinations to be refused by default, got %+v %v", cfg, err)
+	}
+	path := writeFile(t, "peconote.toml", "[webhooks]\nallow_private_destinations = true\n")
+	if cfg, err = load(t, []string{"-config", path}, nil); err != nil || !cfg.Webhooks.AllowPrivateDestinations {
+		t.Fatalf("expected the file to allow private destinations, got %+v %v", cfg, err)
+	}
+	if cfg, err = load(t, nil, map[string]string{"WEBHOOK_ALLOW_PRIVATE_DESTINATIONS": "yes"}); err == nil {
+		t.Fatalf("expected an invalid boolean to be rejected")
+	}
+}
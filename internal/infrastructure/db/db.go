@@ -5,6 +5,12 @@ import (
 	"gorm.io/gorm"
 )
 
-func NewDB() (*gorm.DB, error) {
-	return gorm.Open(sqlite.Open("app.db"), &gorm.Config{})
+// NewDB opens the users database, the SQLite file at path. Like the memo
+// database, its statements are traced.
+func NewDB(path string) (*gorm.DB, error) {
+	sqlDB, err := open(DriverSQLite, path)
+	if err != nil {
+		return nil, err
+	}
+	return gorm.Open(&sqlite.Dialector{DSN: path, Conn: sqlDB.DB}, &gorm.Config{})
 }
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"github.com/jmoiron/sqlx"
+	"gorm.io/gorm"
+
+	"github.com/peconote/peconote/internal/infrastructure/migrate"
+	"github.com/peconote/peconote/migrations"
+)
+
+// MemoMigrator returns the migrator of the memo database, with the
+// migrations of its backend. memoDB should be opened with OpenMigrations.
+func MemoMigrator(memoDB *sqlx.DB) (*migrate.Migrator, error) {
+	dir := "postgres"
+	switch memoDB.DriverName() {
+	case DriverSQLite:
+		dir = "sqlite"
+	case DriverMySQL:
+		dir = "mysql"
+	}
+	ms, err := migrate.Load(migrations.FS, dir)
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(memoDB, ms), nil
+}
+
+// UserMigrator returns the migrator of the users database.
+func UserMigrator(gormDB *gorm.DB) (*migrate.Migrator, error) {
+	sqlDB, err := gormDB.DB()
+	if err != nil {
+		return nil, err
+	}
+	ms, err := migrate.Load(migrations.FS, "users")
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(sqlx.NewDb(sqlDB, DriverSQLite), ms), nil
+}
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/peconote/peconote/internal/infrastructure/migrate"
+)
+
+// TestSQLiteMigrationsRoundTrip applies, rolls back and reapplies the
+// embedded SQLite migrations.
+func TestSQLiteMigrationsRoundTrip(t *testing.T) {
+	memoDB, err := OpenSQLite(filepath.Join(t.TempDir(), "memo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer memoDB.Close()
+	gormDB, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "app.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	memoMigrator, err := MemoMigrator(memoDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userMigrator, err := UserMigrator(gormDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for _, m := range []*migrate.Migrator{memoMigrator, userMigrator} {
+		applied, err := m.Up(ctx)
+		if err != nil || len(applied) == 0 {
+			t.Fatalf("up: %v %v", applied, err)
+		}
+		if _, err := m.Down(ctx, len(applied)); err != nil {
+			t.Fatalf("down: %v", err)
+		}
+		if _, err := m.Up(ctx); err != nil {
+			t.Fatalf("up again: %v", err)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package db
+
+import "testing"
+
+func TestMySQLConfig(t *testing.T) {
+	cfg, err := mysqlConfig("mysql://peco:p@ss:word@db.local/peconote?tls=skip-verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.User != "peco" || cfg.Passwd != "p@ss:word" || cfg.Addr != "db.local:3306" || cfg.DBName != "peconote" {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+	if cfg.TLSConfig != "skip-verify" || !cfg.ParseTime || !cfg.ClientFoundRows || cfg.MultiStatements {
+		t.Fatalf("unexpected options %+v", cfg)
+	}
+	if cfg.Params["group_concat_max_len"] == "" {
+		t.Fatal("group_concat_max_len not set")
+	}
+}
@@ -0,0 +1,52 @@
+package eventbus
+
+import (
+	"sync"
+
+	"github.com/peconote/peconote/internal/domain"
+)
+
+// DefaultBuffer is how many events a subscriber may lag behind before it
+// is dropped.
+const DefaultBuffer = 256
+
+// Bus is an in-process MemoEventBus. Publish never blocks: a subscriber
+// whose buffer is full has its channel closed and must resume from the
+// event log.
+type Bus struct {
+	mu     sync.Mutex
+	subs   map[chan domain.MemoEvent]struct{}
+	buffer int
+}
+
+func New(buffer int) *Bus {
+	return &Bus{subs: make(map[chan domain.MemoEvent]struct{}), buffer: buffer}
+}
+
+func (b *Bus) Publish(e domain.MemoEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+func (b *Bus) Subscribe() (<-chan domain.MemoEvent, func()) {
+	ch := make(chan domain.MemoEvent, b.buffer)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package eventbus
+
+import (
+	"testing"
+
+	"github.com/peconote/peconote/internal/domain"
+)
+
+func TestBus_PublishAndDropSlowSubscriber(t *testing.T) {
+	b := New(1)
+	fast, cancelFast := b.Subscribe()
+	defer cancelFast()
+	slow, cancelSlow := b.Subscribe()
+	defer cancelSlow()
+
+	b.Publish(domain.MemoEvent{ID: 1})
+	if e := <-fast; e.ID != 1 {
+		t.Fatalf("unexpected event %+v", e)
+	}
+	b.Publish(domain.MemoEvent{ID: 2})
+	if e := <-fast; e.ID != 2 {
+		t.Fatalf("unexpected event %+v", e)
+	}
+	if e, ok := <-slow; !ok || e.ID != 1 {
+		t.Fatalf("expected buffered event, got %+v %v", e, ok)
+	}
+	if _, ok := <-slow; ok {
+		t.Fatalf("expected slow subscriber to be closed")
+	}
+}
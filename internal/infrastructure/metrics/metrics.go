@@ -0,0 +1,143 @@
+// Package metrics exposes Prometheus metrics of the HTTP server, the
+// repositories, the database connection pools and the stored memos.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/peconote/peconote/internal/domain"
+)
+
+const (
+	// statsTimeout bounds the queries behind the memo gauges at each scrape.
+	statsTimeout = 5 * time.Second
+	routeKey     = "metrics_route"
+	// unmatchedRoute labels requests that match no route, so that unknown
+	// paths do not create new series.
+	unmatchedRoute = "unmatched"
+)
+
+// Metrics holds the collectors of one server. Every label takes values
+// from a fixed set, such as route templates rather than request paths.
+type Metrics struct {
+	registry   *prometheus.Registry
+	requests   *prometheus.HistogramVec
+	repository *prometheus.HistogramVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "peconote_http_request_duration_seconds",
+			Help:    "Duration of HTTP requests by route template.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		repository: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "peconote_repository_call_duration_seconds",
+			Help:    "Duration of repository calls by method and result: ok, not_found or error.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"repository", "method", "result"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.repository,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// SetRoute names the route of a request gin did not match, such as one
+// dispatched from NoRoute.
+func SetRoute(c *gin.Context, route string) {
+	c.Set(routeKey, route)
+}
+
+// Middleware records the duration of every request.
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = c.GetString(routeKey)
+		}
+		if route == "" {
+			route = unmatchedRoute
+		}
+		m.requests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Start records the duration of a repository call. It implements the
+// repository adapters' Observer.
+func (m *Metrics) Start(ctx context.Context, repository, method string) (context.Context, func(err error)) {
+	start := time.Now()
+	return ctx, func(err error) {
+		result := "ok"
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			result = "not_found"
+		case err != nil:
+			result = "error"
+		}
+		m.repository.WithLabelValues(repository, method, result).Observe(time.Since(start).Seconds())
+	}
+}
+
+// RegisterDB exposes the connection pool statistics of db with the
+// db_name label name.
+func (m *Metrics) RegisterDB(name string, db *sql.DB) {
+	m.registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// RegisterMemoStats exposes the memo count and the number of distinct tags,
+// read from stats at every scrape.
+func (m *Metrics) RegisterMemoStats(stats func(ctx context.Context) (domain.MemoStats, error)) {
+	m.registry.MustRegister(&memoStatsCollector{
+		stats: stats,
+		memos: prometheus.NewDesc("peconote_memos", "Number of stored memos.", nil, nil),
+		tags:  prometheus.NewDesc("peconote_tags", "Number of distinct tags of the stored memos.", nil, nil),
+	})
+}
+
+type memoStatsCollector struct {
+	stats       func(ctx context.Context) (domain.MemoStats, error)
+	memos, tags *prometheus.Desc
+}
+
+func (c *memoStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.memos
+	ch <- c.tags
+}
+
+// Collect leaves the gauges out of a scrape when the stats cannot be read,
+// rather than failing the whole scrape.
+func (c *memoStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), statsTimeout)
+	defer cancel()
+	s, err := c.stats(ctx)
+	if err != nil {
+		log.Printf("metrics: memo stats: %v", err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.memos, prometheus.GaugeValue, float64(s.Memos))
+	ch <- prometheus.MustNewConstMetric(c.tags, prometheus.GaugeValue, float64(s.Tags))
+}
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/peconote/peconote/internal/domain"
+)
+
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("scrape failed with %d: %s", w.Code, w.Body.String())
+	}
+	return w.Body.String()
+}
+
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := New()
+	r := gin.New()
+	r.Use(m.Middleware())
+	r.GET("/api/memos/:id", func(c *gin.Context) { c.Status(http.StatusNotFound) })
+	for _, path := range []string{"/api/memos/1", "/api/memos/2", "/no/such/path"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	_, end := m.Start(context.Background(), "memo", "Get")
+	end(sql.ErrNoRows)
+	m.RegisterMemoStats(func(ctx context.Context) (domain.MemoStats, error) {
+		return domain.MemoStats{Memos: 3, Tags: 2}, nil
+	})
+
+	body := scrape(t, m)
+	for _, want := range []string{
+		`peconote_http_request_duration_seconds_count{method="GET",route="/api/memos/:id",status="404"} 2`,
+		`peconote_http_request_duration_seconds_count{method="GET",route="unmatched",status="404"} 1`,
+		`peconote_repository_call_duration_seconds_count{method="Get",repository="memo",result="not_found"} 1`,
+		"peconote_memos 3",
+		"peconote_tags 2",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %q", want)
+		}
+	}
+	if strings.Contains(body, "/api/memos/1") || strings.Contains(body, "/no/such/path") {
+		t.Error("metrics are labeled with raw paths")
+	}
+}
@@ -0,0 +1,138 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var testFS = fstest.MapFS{
+	"m/0001_create_a.up.sql":   {Data: []byte(`CREATE TABLE a (id INTEGER PRIMARY KEY);`)},
+	"m/0001_create_a.down.sql": {Data: []byte(`DROP TABLE a;`)},
+	"m/0002_create_b.up.sql":   {Data: []byte(`CREATE TABLE b (id INTEGER PRIMARY KEY); INSERT INTO b (id) VALUES (1);`)},
+	"m/0002_create_b.down.sql": {Data: []byte(`DROP TABLE b;`)},
+	"m/README.md":              {Data: []byte(`ignored`)},
+}
+
+func newTestMigrator(t *testing.T, fsys fstest.MapFS) (*Migrator, *sqlx.DB) {
+	t.Helper()
+	db, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	ms, err := Load(fsys, "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(db, ms), db
+}
+
+func tableExists(t *testing.T, db *sqlx.DB, name string) bool {
+	t.Helper()
+	var n int
+	if err := db.Get(&n, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, name); err != nil {
+		t.Fatal(err)
+	}
+	return n == 1
+}
+
+func TestLoad(t *testing.T) {
+	ms, err := Load(testFS, "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 2 || ms[0].Version != 1 || ms[0].Name != "create_a" || ms[1].Version != 2 || ms[1].Down == "" {
+		t.Fatalf("unexpected migrations %+v", ms)
+	}
+
+	if _, err := Load(fstest.MapFS{"m/0001_a.down.sql": {Data: []byte(`x`)}}, "m"); err == nil {
+		t.Fatal("expected error for a migration without up file")
+	}
+	if _, err := Load(fstest.MapFS{
+		"m/0001_a.up.sql":   {Data: []byte(`x`)},
+		"m/0001_b.down.sql": {Data: []byte(`x`)},
+	}, "m"); err == nil {
+		t.Fatal("expected error for mismatched names")
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	m, db := newTestMigrator(t, testFS)
+
+	done, err := m.Up(ctx)
+	if err != nil || len(done) != 2 {
+		t.Fatalf("up: %v %v", done, err)
+	}
+	if !tableExists(t, db, "a") || !tableExists(t, db, "b") {
+		t.Fatal("tables not created")
+	}
+	if done, err := m.Up(ctx); err != nil || len(done) != 0 {
+		t.Fatalf("second up: %v %v", done, err)
+	}
+
+	redone, err := m.Redo(ctx)
+	if err != nil || redone.Version != 2 {
+		t.Fatalf("redo: %v %v", redone, err)
+	}
+	var n int
+	if err := db.Get(&n, `SELECT COUNT(*) FROM b`); err != nil || n != 1 {
+		t.Fatalf("b after redo: %d %v", n, err)
+	}
+
+	done, err = m.Down(ctx, 1)
+	if err != nil || len(done) != 1 || done[0].Version != 2 {
+		t.Fatalf("down: %v %v", done, err)
+	}
+	if tableExists(t, db, "b") || !tableExists(t, db, "a") {
+		t.Fatal("down rolled back the wrong migration")
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 || statuses[0].AppliedAt == nil || statuses[1].AppliedAt != nil {
+		t.Fatalf("unexpected status %+v", statuses)
+	}
+
+	if _, err := m.Down(ctx, 5); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Down(ctx, 1); !errors.Is(err, ErrNoMigration) {
+		t.Fatalf("expected ErrNoMigration, got %v", err)
+	}
+	if _, err := m.Redo(ctx); !errors.Is(err, ErrNoMigration) {
+		t.Fatalf("expected ErrNoMigration, got %v", err)
+	}
+}
+
+func TestMigratorRollsBackFailedMigration(t *testing.T) {
+	ctx := context.Background()
+	fsys := fstest.MapFS{
+		"m/0001_create_a.up.sql": {Data: []byte(`CREATE TABLE a (id INTEGER PRIMARY KEY);`)},
+		"m/0002_broken.up.sql":   {Data: []byte(`CREATE TABLE c (id INTEGER); SELECT * FROM missing;`)},
+	}
+	m, db := newTestMigrator(t, fsys)
+
+	done, err := m.Up(ctx)
+	if err == nil || len(done) != 1 {
+		t.Fatalf("expected the second migration to fail: %v %v", done, err)
+	}
+	if tableExists(t, db, "c") {
+		t.Fatal("failed migration was not rolled back")
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statuses[0].AppliedAt == nil || statuses[1].AppliedAt != nil {
+		t.Fatalf("unexpected status %+v", statuses)
+	}
+}
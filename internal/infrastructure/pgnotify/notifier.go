@@ -0,0 +1,234 @@
+// Package pgnotify shares memo events between processes through Postgres
+// LISTEN/NOTIFY.
+package pgnotify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/domain/repository"
+	"github.com/peconote/peconote/internal/infrastructure/eventbus"
+)
+
+// Channel is the Postgres notification channel of memo events.
+const Channel = "memo_events"
+
+const (
+	minReconnect  = time.Second
+	maxReconnect  = time.Minute
+	pingInterval  = 90 * time.Second
+	notifyTimeout = 5 * time.Second
+	backfillPage  = 500
+	// recentEvents is how many event ids are remembered to drop events
+	// that arrive both from the log and as a notification.
+	recentEvents = 4096
+)
+
+// listener is the part of *pq.Listener used by the Notifier.
+type listener interface {
+	Listen(channel string) error
+	NotificationChannel() <-chan *pq.Notification
+	Ping() error
+	Close() error
+}
+
+// Notifier is a MemoEventBus shared by every process using the database.
+// Publish announces an event with NOTIFY, and each process, this one
+// included, fans the notifications it LISTENs to out to its local
+// subscribers, such as SSE streams and caches. After the listener
+// reconnects, events committed in the meantime are read back from the
+// event log.
+type Notifier struct {
+	local    *eventbus.Bus
+	events   repository.MemoEventRepository
+	listener listener
+	notify   func(ctx context.Context, payload string) error
+	// retryDelay is the first wait after a failed backfill; it doubles up
+	// to maxReconnect.
+	retryDelay time.Duration
+
+	mu     sync.Mutex
+	last   int64
+	start  int64
+	synced bool
+	recent map[int64]struct{}
+	order  []int64
+}
+
+// New returns a Notifier listening on dsn. It does not connect until Run
+// is called.
+func New(dsn string, db *sqlx.DB, events repository.MemoEventRepository, buffer int) *Notifier {
+	l := pq.NewListener(dsn, minReconnect, maxReconnect, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("pgnotify: listener: %v", err)
+		}
+	})
+	return newNotifier(l, events, buffer, func(ctx context.Context, payload string) error {
+		_, err := db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, Channel, payload)
+		return err
+	})
+}
+
+func newNotifier(l listener, events repository.MemoEventRepository, buffer int, notify func(ctx context.Context, payload string) error) *Notifier {
+	return &Notifier{
+		local:      eventbus.New(buffer),
+		events:     events,
+		listener:   l,
+		notify:     notify,
+		retryDelay: minReconnect,
+		recent:     make(map[int64]struct{}, recentEvents),
+	}
+}
+
+// Publish announces e to all processes. When the notification cannot be
+// sent, e still reaches the subscribers of this process.
+func (n *Notifier) Publish(e domain.MemoEvent) {
+	payload, err := json.Marshal(e)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		err = n.notify(ctx, string(payload))
+		cancel()
+	}
+	if err != nil {
+		log.Printf("pgnotify: notify event %d: %v", e.ID, err)
+		n.deliver(e)
+	}
+}
+
+func (n *Notifier) Subscribe() (<-chan domain.MemoEvent, func()) {
+	return n.local.Subscribe()
+}
+
+// Run listens for notifications until ctx is done.
+func (n *Notifier) Run(ctx context.Context) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		n.listener.Close()
+	}()
+	// Listen blocks until the first connection is made.
+	if err := n.listener.Listen(Channel); err != nil {
+		if ctx.Err() == nil {
+			log.Printf("pgnotify: listen: %v", err)
+		}
+		return
+	}
+	n.catchUp(ctx)
+
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case msg, ok := <-n.listener.NotificationChannel():
+			if !ok {
+				return
+			}
+			// The listener sends nil after it reconnected.
+			if msg == nil {
+				n.catchUp(ctx)
+				continue
+			}
+			var e domain.MemoEvent
+			if err := json.Unmarshal([]byte(msg.Extra), &e); err != nil {
+				log.Printf("pgnotify: decode notification: %v", err)
+				continue
+			}
+			n.deliver(e)
+		case <-ticker.C:
+			// A ping makes the listener notice a dead connection.
+			go n.listener.Ping()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// catchUp runs backfill until it succeeds or ctx is done, waiting longer
+// after each failure. Giving up would skip the events logged meanwhile for
+// good, as the next backfill starts from the events delivered since.
+func (n *Notifier) catchUp(ctx context.Context) {
+	delay := n.retryDelay
+	for {
+		err := n.backfill(ctx)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		log.Printf("pgnotify: %v; retrying in %s", err, delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+		if delay *= 2; delay > maxReconnect {
+			delay = maxReconnect
+		}
+	}
+}
+
+// backfill delivers the events logged while the listener was disconnected.
+// It reads from a window below the latest event delivered, since events can
+// commit out of id order, and drops the ones delivered before. The first
+// successful call only records where the log ends.
+func (n *Notifier) backfill(ctx context.Context) error {
+	n.mu.Lock()
+	synced, last := n.synced, n.last-repository.MemoEventResumeWindow
+	if last < n.start {
+		last = n.start
+	}
+	n.mu.Unlock()
+	if !synced {
+		id, err := n.events.LastID(ctx)
+		if err != nil {
+			return fmt.Errorf("read event log: %w", err)
+		}
+		n.mu.Lock()
+		n.synced, n.start = true, id
+		if id > n.last {
+			n.last = id
+		}
+		n.mu.Unlock()
+		return nil
+	}
+	for {
+		events, err := n.events.ListAfter(ctx, last, backfillPage)
+		if err != nil {
+			return fmt.Errorf("backfill after %d: %w", last, err)
+		}
+		for _, e := range events {
+			n.deliver(e)
+			last = e.ID
+		}
+		if len(events) < backfillPage {
+			return nil
+		}
+	}
+}
+
+func (n *Notifier) deliver(e domain.MemoEvent) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, ok := n.recent[e.ID]; ok {
+		return
+	}
+	if len(n.order) == recentEvents {
+		delete(n.recent, n.order[0])
+		n.order = n.order[1:]
+	}
+	n.recent[e.ID] = struct{}{}
+	n.order = append(n.order, e.ID)
+	if e.ID > n.last {
+		n.last = e.ID
+	}
+	n.local.Publish(e)
+}
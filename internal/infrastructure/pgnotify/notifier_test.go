@@ -0,0 +1,225 @@
+package pgnotify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/peconote/peconote/internal/domain"
+)
+
+type fakeListener struct {
+	ch chan *pq.Notification
+}
+
+func (l *fakeListener) Listen(channel string) error                  { return nil }
+func (l *fakeListener) NotificationChannel() <-chan *pq.Notification { return l.ch }
+func (l *fakeListener) Ping() error                                  { return nil }
+func (l *fakeListener) Close() error                                 { return nil }
+
+type fakeEventLog struct {
+	mu     sync.Mutex
+	events []domain.MemoEvent
+}
+
+func (f *fakeEventLog) Append(ctx context.Context, e *domain.MemoEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e.ID = int64(len(f.events) + 1)
+	f.events = append(f.events, *e)
+	return nil
+}
+
+// commitLate adds an event whose id was assigned before the last one's.
+func (f *fakeEventLog) commitLate(e domain.MemoEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i := len(f.events)
+	for i > 0 && f.events[i-1].ID > e.ID {
+		i--
+	}
+	f.events = append(f.events[:i], append([]domain.MemoEvent{e}, f.events[i:]...)...)
+}
+
+func (f *fakeEventLog) ListAfter(ctx context.Context, afterID int64, limit int) ([]domain.MemoEvent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []domain.MemoEvent
+	for _, e := range f.events {
+		if e.ID > afterID && len(out) < limit {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeEventLog) LastID(ctx context.Context) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return int64(len(f.events)), nil
+}
+
+func receive(t *testing.T, ch <-chan domain.MemoEvent) domain.MemoEvent {
+	t.Helper()
+	select {
+	case e := <-ch:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+	return domain.MemoEvent{}
+}
+
+func TestNotifier_FanOutAndBackfill(t *testing.T) {
+	l := &fakeListener{ch: make(chan *pq.Notification, 8)}
+	events := &fakeEventLog{}
+	ctx := context.Background()
+	// An event logged before the process started is not replayed.
+	events.Append(ctx, &domain.MemoEvent{Type: domain.MemoEventCreated})
+
+	var failNotify bool
+	n := newNotifier(l, events, 8, func(ctx context.Context, payload string) error {
+		if failNotify {
+			return errors.New("connection refused")
+		}
+		l.ch <- &pq.Notification{Channel: Channel, Extra: payload}
+		return nil
+	})
+	sub, cancel := n.Subscribe()
+	defer cancel()
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	go n.Run(runCtx)
+
+	e := domain.MemoEvent{Type: domain.MemoEventUpdated, Tags: []string{"ops"}}
+	events.Append(ctx, &e)
+	n.Publish(e)
+	if got := receive(t, sub); got.ID != 2 || got.Tags[0] != "ops" {
+		t.Fatalf("unexpected event %+v", got)
+	}
+
+	// Events committed by another replica while the listener was
+	// disconnected are read from the log after it reconnects.
+	for i := 0; i < 2; i++ {
+		events.Append(ctx, &domain.MemoEvent{Type: domain.MemoEventDeleted})
+	}
+	l.ch <- nil
+	for _, want := range []int64{3, 4} {
+		if got := receive(t, sub); got.ID != want {
+			t.Fatalf("expected event %d, got %+v", want, got)
+		}
+	}
+	// A late notification of a backfilled event is dropped.
+	payload, _ := json.Marshal(domain.MemoEvent{ID: 4})
+	l.ch <- &pq.Notification{Channel: Channel, Extra: string(payload)}
+
+	// An event committed after a later one while disconnected is found
+	// below the latest id delivered.
+	events.commitLate(domain.MemoEvent{ID: 6})
+	events.commitLate(domain.MemoEvent{ID: 5})
+	l.ch <- nil
+	for _, want := range []int64{5, 6} {
+		if got := receive(t, sub); got.ID != want {
+			t.Fatalf("expected event %d, got %+v", want, got)
+		}
+	}
+	events.commitLate(domain.MemoEvent{ID: 8})
+	l.ch <- nil
+	if got := receive(t, sub); got.ID != 8 {
+		t.Fatalf("expected event 8, got %+v", got)
+	}
+	events.commitLate(domain.MemoEvent{ID: 7})
+	l.ch <- nil
+	if got := receive(t, sub); got.ID != 7 {
+		t.Fatalf("expected late event 7, got %+v", got)
+	}
+
+	failNotify = true
+	e = domain.MemoEvent{Type: domain.MemoEventCreated}
+	events.Append(ctx, &e)
+	n.Publish(e)
+	if got := receive(t, sub); got.ID != 9 {
+		t.Fatalf("expected local delivery of event 9, got %+v", got)
+	}
+}
+
+// flakyEventLog fails the next reads of the event log.
+type flakyEventLog struct {
+	*fakeEventLog
+	lastIDFailures, listFailures atomic.Int32
+}
+
+func (f *flakyEventLog) ListAfter(ctx context.Context, afterID int64, limit int) ([]domain.MemoEvent, error) {
+	if f.listFailures.Add(-1) >= 0 {
+		return nil, errors.New("connection reset")
+	}
+	return f.fakeEventLog.ListAfter(ctx, afterID, limit)
+}
+
+func (f *flakyEventLog) LastID(ctx context.Context) (int64, error) {
+	if f.lastIDFailures.Add(-1) >= 0 {
+		return 0, errors.New("connection reset")
+	}
+	return f.fakeEventLog.LastID(ctx)
+}
+
+func TestNotifier_RetriesBackfill(t *testing.T) {
+	l := &fakeListener{ch: make(chan *pq.Notification, 8)}
+	events := &flakyEventLog{fakeEventLog: &fakeEventLog{}}
+	events.lastIDFailures.Store(2)
+	ctx := context.Background()
+	events.Append(ctx, &domain.MemoEvent{Type: domain.MemoEventCreated})
+
+	n := newNotifier(l, events, 8, func(ctx context.Context, payload string) error {
+		l.ch <- &pq.Notification{Channel: Channel, Extra: payload}
+		return nil
+	})
+	n.retryDelay = time.Millisecond
+	sub, cancel := n.Subscribe()
+	defer cancel()
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	go n.Run(runCtx)
+
+	// Notifications are read once the end of the log is known.
+	e := domain.MemoEvent{Type: domain.MemoEventUpdated}
+	events.Append(ctx, &e)
+	n.Publish(e)
+	if got := receive(t, sub); got.ID != 2 {
+		t.Fatalf("expected event 2, got %+v", got)
+	}
+
+	events.listFailures.Store(3)
+	for i := 0; i < 2; i++ {
+		events.Append(ctx, &domain.MemoEvent{Type: domain.MemoEventDeleted})
+	}
+	l.ch <- nil
+	for _, want := range []int64{3, 4} {
+		if got := receive(t, sub); got.ID != want {
+			t.Fatalf("expected event %d, got %+v", want, got)
+		}
+	}
+}
+
+func TestNotifier_BackfillStopsWithContext(t *testing.T) {
+	events := &flakyEventLog{fakeEventLog: &fakeEventLog{}}
+	events.lastIDFailures.Store(1 << 30)
+	n := newNotifier(&fakeListener{ch: make(chan *pq.Notification)}, events, 8, nil)
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		n.Run(ctx)
+		close(done)
+	}()
+	stop()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after ctx was done")
+	}
+}
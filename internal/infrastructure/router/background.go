@@ -0,0 +1,80 @@
+package router
+
+import (
+	"context"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Background tracks what outlives a single request: worker goroutines and
+// long-lived streams. http.Server.Shutdown neither ends streams nor waits
+// for hijacked connections, so the server ends them with EndStreams when
+// shutdown begins and waits for everything with Stop before closing the
+// databases.
+type Background struct {
+	streams     context.Context
+	endStreams  context.CancelFunc
+	workers     context.Context
+	stopWorkers context.CancelFunc
+	wg          sync.WaitGroup
+}
+
+func NewBackground() *Background {
+	b := &Background{}
+	b.streams, b.endStreams = context.WithCancel(context.Background())
+	b.workers, b.stopWorkers = context.WithCancel(context.Background())
+	return b
+}
+
+// Go runs fn until Stop cancels its context.
+func (b *Background) Go(fn func(ctx context.Context)) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		fn(b.workers)
+	}()
+}
+
+// Stream is middleware for long-lived routes. Their request context ends
+// with EndStreams, and Stop waits for their handlers to return.
+func (b *Background) Stream() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		b.wg.Add(1)
+		defer b.wg.Done()
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		defer cancel()
+		go func() {
+			select {
+			case <-b.streams.Done():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// EndStreams cancels the requests of long-lived routes.
+func (b *Background) EndStreams() {
+	b.endStreams()
+}
+
+// Stop ends streams and workers and waits for them to return, or for ctx
+// to end.
+func (b *Background) Stop(ctx context.Context) error {
+	b.endStreams()
+	b.stopWorkers()
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,44 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBackground_StopEndsStreamsAndWorkers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	bg := NewBackground()
+	workerDone := make(chan struct{})
+	bg.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		close(workerDone)
+	})
+
+	r := gin.New()
+	started, streamDone := make(chan struct{}), make(chan struct{})
+	r.GET("/stream", bg.Stream(), func(c *gin.Context) {
+		close(started)
+		<-c.Request.Context().Done()
+		close(streamDone)
+	})
+	go r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/stream", nil))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := bg.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for name, done := range map[string]chan struct{}{"worker": workerDone, "stream": streamDone} {
+		select {
+		case <-done:
+		default:
+			t.Fatalf("%s still running after Stop", name)
+		}
+	}
+}
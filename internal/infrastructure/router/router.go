@@ -1,21 +1,150 @@
 package router
 
 import (
+	"context"
 	"encoding/json"
+	"net/http"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
 	"gorm.io/gorm"
 
 	adapterhandler "github.com/peconote/peconote/internal/adapter/handler"
+	"github.com/peconote/peconote/internal/adapter/importer"
 	adapterrepo "github.com/peconote/peconote/internal/adapter/repository"
+	"github.com/peconote/peconote/internal/adapter/webhook"
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/domain/repository"
+	"github.com/peconote/peconote/internal/infrastructure/config"
+	"github.com/peconote/peconote/internal/infrastructure/db"
+	"github.com/peconote/peconote/internal/infrastructure/eventbus"
+	"github.com/peconote/peconote/internal/infrastructure/metrics"
 	"github.com/peconote/peconote/internal/infrastructure/persistence"
+	"github.com/peconote/peconote/internal/infrastructure/pgnotify"
+	"github.com/peconote/peconote/internal/infrastructure/tracing"
 	"github.com/peconote/peconote/internal/interfaces/controller"
 	"github.com/peconote/peconote/internal/usecase"
 )
 
-func NewRouter(gormDB *gorm.DB, sqlxDB *sqlx.DB) *gin.Engine {
+// NewRouter serves the memo storage in sqlxDB. Its workers and long-lived
+// streams run under bg, and it records into m.
+func NewRouter(bg *Background, m *metrics.Metrics, cfg *config.Config, gormDB *gorm.DB, sqlxDB *sqlx.DB) (*gin.Engine, error) {
+	r, err := newEngine(cfg, m, gormDB, sqlxDB)
+	if err != nil {
+		return nil, err
+	}
+	limits := cfg.Limits.MemoLimits()
+
+	memoTx := adapterrepo.NewTransactor(sqlxDB)
+	if sqlxDB.DriverName() != db.DriverPostgres {
+		// Only memos are stored in SQLite and MySQL. Links, the event log,
+		// imports, idempotency keys and webhooks need Postgres.
+		memoRepo := adapterrepo.NewSQLiteMemoRepository(sqlxDB)
+		if sqlxDB.DriverName() == db.DriverMySQL {
+			memoRepo = adapterrepo.NewMySQLMemoRepository(sqlxDB)
+		}
+		registerMemoOnlyRoutes(r, bg, m, memoRepo, memoTx, limits)
+		return r, nil
+	}
+
+	repoObserver := adapterrepo.JoinObservers(tracing.NewObserver("repository"), m)
+	usecaseObserver := tracing.NewObserver("usecase")
+	memoRepo := adapterrepo.ObserveMemoRepository(adapterrepo.NewMemoRepository(sqlxDB), repoObserver)
+	m.RegisterMemoStats(memoRepo.Stats)
+	memoLinkRepo := adapterrepo.ObserveMemoLinkRepository(adapterrepo.NewMemoLinkRepository(sqlxDB), repoObserver)
+	memoEventRepo := adapterrepo.ObserveMemoEventRepository(adapterrepo.NewMemoEventRepository(sqlxDB), repoObserver)
+	memoEventBus := pgnotify.New(cfg.Database.URL, sqlxDB, memoEventRepo, eventbus.DefaultBuffer)
+	bg.Go(memoEventBus.Run)
+	outboxRepo := adapterrepo.ObserveOutboxRepository(adapterrepo.NewOutboxRepository(sqlxDB), repoObserver)
+	outboxDispatcher := usecase.NewOutboxDispatcher(outboxRepo, memoEventBus)
+	memoUsecase := usecase.ObserveMemoUsecase(usecase.NewMemoUsecase(memoRepo, memoLinkRepo, memoTx, memoEventRepo, outboxRepo, memoEventBus, limits), usecaseObserver)
+	memoHandler := adapterhandler.NewMemoHandler(memoUsecase)
+	memoEventUsecase := usecase.NewMemoEventUsecase(memoEventRepo, memoEventBus)
+	memoEventHandler := adapterhandler.NewMemoEventHandler(memoEventUsecase, adapterhandler.DefaultMemoEventHeartbeat)
+
+	idempotencyRepo := adapterrepo.ObserveIdempotencyRepository(adapterrepo.NewIdempotencyRepository(sqlxDB), repoObserver)
+	idempotencyUsecase := usecase.NewIdempotencyUsecase(idempotencyRepo, usecase.DefaultIdempotencyTTL)
+
+	registerMemoRoutes(r, bg, memoHandler, memoUsecase, limits, adapterhandler.Idempotency(idempotencyUsecase))
+	r.GET("/api/memos/events", bg.Stream(), memoEventHandler.Stream)
+
+	graphRepo := adapterrepo.ObserveGraphRepository(adapterrepo.NewGraphRepository(sqlxDB), repoObserver)
+	graphUsecase := usecase.ObserveGraphUsecase(usecase.NewGraphUsecase(memoRepo, graphRepo, adapterrepo.NewSnapshotTransactor(sqlxDB)), usecaseObserver)
+	graphHandler := adapterhandler.NewGraphHandler(graphUsecase)
+
+	r.GET("/api/graph", graphHandler.GetGraph)
+
+	memoImportRepo := adapterrepo.ObserveMemoImportRepository(adapterrepo.NewMemoImportRepository(sqlxDB), repoObserver)
+	attachmentDir := cfg.Storage.AttachmentsDir
+	attachmentRepo := adapterrepo.NewFileAttachmentRepository(attachmentDir)
+	importUsecase := usecase.ObserveImportUsecase(usecase.NewImportUsecase(memoRepo, memoLinkRepo, memoTx, memoEventRepo, outboxRepo, memoEventBus, memoImportRepo, attachmentRepo, limits), usecaseObserver)
+	importHandler := adapterhandler.NewImportHandler(importUsecase, time.Duration(cfg.Server.ImportTimeout))
+
+	r.POST("/api/import", importHandler.Import)
+	attachmentHandler := adapterhandler.NewAttachmentHandler(attachmentDir)
+	r.GET(importer.AttachmentURLPrefix+":name", attachmentHandler.GetAttachment)
+	r.HEAD(importer.AttachmentURLPrefix+":name", attachmentHandler.GetAttachment)
+
+	registerExportRoutes(r, memoRepo)
+
+	webhookRepo := adapterrepo.ObserveWebhookRepository(adapterrepo.NewWebhookRepository(sqlxDB), repoObserver)
+	webhookDeliveryRepo := adapterrepo.ObserveWebhookDeliveryRepository(adapterrepo.NewWebhookDeliveryRepository(sqlxDB), repoObserver)
+	webhookUsecase := usecase.ObserveWebhookUsecase(usecase.NewWebhookUsecase(webhookRepo, webhookDeliveryRepo, webhook.NewSender(nil, cfg.Webhooks.AllowPrivateDestinations)), usecaseObserver)
+	webhookHandler := adapterhandler.NewWebhookHandler(webhookUsecase)
+	outboxDispatcher.Register(usecase.OutboxHandlerFunc(webhookUsecase.EnqueueEvent))
+	bg.Go(func(ctx context.Context) { webhookUsecase.Run(ctx, usecase.DefaultWebhookPollInterval) })
+	bg.Go(func(ctx context.Context) { outboxDispatcher.Run(ctx, usecase.DefaultOutboxPollInterval) })
+
+	r.POST("/api/webhooks", webhookHandler.CreateWebhook)
+	r.GET("/api/webhooks", webhookHandler.ListWebhooks)
+	r.DELETE("/api/webhooks/:id", webhookHandler.DeleteWebhook)
+	r.GET("/api/webhooks/:id/deliveries", webhookHandler.ListDeliveries)
+	r.GET("/api/webhooks/:id/deliveries/:delivery_id", webhookHandler.GetDelivery)
+	r.POST("/api/webhooks/:id/deliveries/:delivery_id/redeliver", webhookHandler.Redeliver)
+
+	return r, nil
+}
+
+// NewGitRouter serves memos stored as Markdown files in the git repository
+// at dir. Like SQLite, it serves only the memo endpoints and the export.
+func NewGitRouter(bg *Background, m *metrics.Metrics, cfg *config.Config, gormDB *gorm.DB, dir string) (*gin.Engine, error) {
+	memoRepo, err := adapterrepo.NewGitMemoRepository(dir)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newEngine(cfg, m, gormDB, nil)
+	if err != nil {
+		return nil, err
+	}
+	registerMemoOnlyRoutes(r, bg, m, memoRepo, nil, cfg.Limits.MemoLimits())
+	return r, nil
+}
+
+// newEngine serves the user, health and, unless it has its own listener,
+// metrics endpoints. Readiness and pool metrics cover the users database
+// and, unless it is nil, the memo database.
+func newEngine(cfg *config.Config, m *metrics.Metrics, gormDB *gorm.DB, memoDB *sqlx.DB) (*gin.Engine, error) {
+	usersDB, err := gormDB.DB()
+	if err != nil {
+		return nil, err
+	}
 	r := gin.New()
-	r.Use(gin.Recovery(), jsonLogger())
+	// Metrics come first to see the status of recovered panics.
+	r.Use(m.Middleware(), gin.Recovery(), jsonLogger(), tracing.Middleware(), adapterhandler.UserID())
+
+	checks := map[string]adapterhandler.Pinger{"users": usersDB}
+	m.RegisterDB("users", usersDB)
+	if memoDB != nil {
+		checks["memo"] = memoDB
+		m.RegisterDB("memo", memoDB.DB)
+	}
+	if cfg.Metrics.Addr == "" {
+		r.GET("/metrics", gin.WrapH(m.Handler()))
+	}
+	healthHandler := adapterhandler.NewHealthHandler(adapterhandler.DefaultReadinessTimeout, checks)
+	r.GET("/healthz", healthHandler.Live)
+	r.GET("/readyz", healthHandler.Ready)
 
 	userRepo := persistence.NewUserRepository(gormDB)
 	userUsecase := usecase.NewUserUsecase(userRepo)
@@ -23,18 +152,55 @@ func NewRouter(gormDB *gorm.DB, sqlxDB *sqlx.DB) *gin.Engine {
 
 	r.GET("/users", userController.GetUsers)
 	r.POST("/users", userController.CreateUser)
+	return r, nil
+}
 
-	memoRepo := adapterrepo.NewMemoRepository(sqlxDB)
-	memoUsecase := usecase.NewMemoUsecase(memoRepo)
-	memoHandler := adapterhandler.NewMemoHandler(memoUsecase)
+// registerMemoOnlyRoutes serves backends that store nothing but memos.
+func registerMemoOnlyRoutes(r *gin.Engine, bg *Background, m *metrics.Metrics, memoRepo repository.MemoRepository, memoTx repository.Transactor, limits usecase.MemoLimits) {
+	memoRepo = adapterrepo.ObserveMemoRepository(memoRepo, adapterrepo.JoinObservers(tracing.NewObserver("repository"), m))
+	m.RegisterMemoStats(memoRepo.Stats)
+	memoUsecase := usecase.ObserveMemoUsecase(usecase.NewMemoUsecase(memoRepo, nil, memoTx, nil, nil, nil, limits), tracing.NewObserver("usecase"))
+	registerMemoRoutes(r, bg, adapterhandler.NewMemoHandler(memoUsecase), memoUsecase, limits)
+	registerExportRoutes(r, memoRepo)
+}
 
-	r.POST("/api/memos", memoHandler.CreateMemo)
+// registerMemoRoutes registers the memo endpoints every backend serves.
+// create runs before memo creation.
+func registerMemoRoutes(r *gin.Engine, bg *Background, memoHandler *adapterhandler.MemoHandler, memoUsecase usecase.MemoUsecase, limits usecase.MemoLimits, create ...gin.HandlerFunc) {
+	collabUsecase := usecase.NewCollabUsecase(memoUsecase, usecase.DefaultCollabSnapshotInterval, limits.MaxBodyBytes)
+	collabHandler := adapterhandler.NewCollabHandler(collabUsecase)
+
+	r.POST("/api/memos", append(create, memoHandler.CreateMemo)...)
 	r.GET("/api/memos", memoHandler.ListMemos)
 	r.GET("/api/memos/:id", memoHandler.GetMemo)
 	r.PUT("/api/memos/:id", memoHandler.UpdateMemo)
 	r.DELETE("/api/memos/:id", memoHandler.DeleteMemo)
+	for _, flag := range []domain.MemoFlag{domain.MemoFlagPinned, domain.MemoFlagArchived, domain.MemoFlagFavorite} {
+		r.PUT("/api/memos/:id/"+string(flag), memoHandler.SetFlag(flag, true))
+		r.DELETE("/api/memos/:id/"+string(flag), memoHandler.SetFlag(flag, false))
+	}
+	r.GET("/api/memos/:id/links", memoHandler.ListLinks)
+	r.GET("/api/memos/:id/backlinks", memoHandler.ListBacklinks)
+	r.GET("/api/memos/:id/collab", bg.Stream(), collabHandler.Connect)
+	r.GET("/api/links/broken", memoHandler.ListBrokenLinks)
 
-	return r
+	// gin cannot register a literal ':' inside a path segment, so the
+	// custom-method style batch endpoint is dispatched from NoRoute.
+	r.NoRoute(func(c *gin.Context) {
+		if c.Request.Method == http.MethodPost && c.Request.URL.Path == "/api/memos:batch" {
+			metrics.SetRoute(c, "/api/memos:batch")
+			memoHandler.Batch(c)
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+	})
+}
+
+func registerExportRoutes(r *gin.Engine, memoRepo repository.MemoRepository) {
+	exportUsecase := usecase.ObserveExportUsecase(usecase.NewExportUsecase(memoRepo), tracing.NewObserver("usecase"))
+	exportHandler := adapterhandler.NewExportHandler(exportUsecase)
+
+	r.GET("/api/export", exportHandler.Export)
 }
 
 func jsonLogger() gin.HandlerFunc {
@@ -55,10 +221,11 @@ func jsonLogger() gin.HandlerFunc {
 		if v := q.Get("tag"); v != "" {
 			m["tag"] = v
 		}
-		if v := param.Request.Context().Value("trace_id"); v != nil {
-			if s, ok := v.(string); ok {
-				m["trace_id"] = s
-			}
+		if v := q.Get("sort"); v != "" {
+			m["sort"] = v
+		}
+		if traceID, spanID := tracing.IDs(param.Request.Context()); traceID != "" {
+			m["trace_id"], m["span_id"] = traceID, spanID
 		}
 		b, _ := json.Marshal(m)
 		return string(b) + "\n"
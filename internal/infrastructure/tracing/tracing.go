@@ -0,0 +1,143 @@
+// Package tracing sets up OpenTelemetry tracing and creates the spans of
+// HTTP requests and of usecase and repository calls.
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/peconote/peconote/internal/infrastructure/config"
+)
+
+const (
+	instrumentationName = "github.com/peconote/peconote"
+	serviceName         = "peconote"
+)
+
+// Setup installs the global tracer provider and the W3C trace context
+// propagator. Spans of the stdout exporter are written to stdout. The
+// returned function flushes pending spans and stops the exporter.
+func Setup(ctx context.Context, cfg config.Tracing, stdout io.Writer) (func(ctx context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, err
+	}
+	// Without an exporter, ids are still generated for logs and responses.
+	sampler := sdktrace.NeverSample()
+	var exporter sdktrace.SpanExporter
+	switch cfg.Exporter {
+	case config.TracingOTLP:
+		u, err := url.Parse(cfg.Endpoint)
+		if err != nil {
+			return nil, err
+		}
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host)}
+		if u.Scheme == "http" {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		if u.Path != "" && u.Path != "/" {
+			opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+		if err != nil {
+			return nil, err
+		}
+	case config.TracingStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(stdout))
+		if err != nil {
+			return nil, err
+		}
+	}
+	opts := []sdktrace.TracerProviderOption{sdktrace.WithResource(res)}
+	if exporter != nil {
+		sampler = sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+	tp := sdktrace.NewTracerProvider(append(opts, sdktrace.WithSampler(sampler))...)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// IDs returns the trace and span ids of the span in ctx, or empty strings
+// without one.
+func IDs(ctx context.Context) (traceID, spanID string) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return "", ""
+	}
+	return sc.TraceID().String(), sc.SpanID().String()
+}
+
+// Middleware continues the trace of the request's traceparent header, or
+// starts one, in a span named by the route template. The request context
+// carries the span, and the response's traceparent header names it.
+func Middleware() gin.HandlerFunc {
+	tracer := otel.Tracer(instrumentationName)
+	return func(c *gin.Context) {
+		propagator := otel.GetTextMapPropagator()
+		ctx := propagator.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		route := c.FullPath()
+		name := c.Request.Method
+		if route != "" {
+			name += " " + route
+		}
+		ctx, span := tracer.Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPMethod(c.Request.Method), semconv.HTTPRoute(route)))
+		defer span.End()
+		propagator.Inject(ctx, propagation.HeaderCarrier(c.Writer.Header()))
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPStatusCode(status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, "")
+		}
+	}
+}
+
+// Observer starts a span for every observed call. It implements
+// usecase.Observer and the Observer of the repository adapters.
+type Observer struct {
+	tracer trace.Tracer
+	layer  string
+}
+
+// NewObserver names spans "<layer> <component>.<method>".
+func NewObserver(layer string) *Observer {
+	return &Observer{tracer: otel.Tracer(instrumentationName), layer: layer}
+}
+
+// Start records errors other than sql.ErrNoRows, which repositories return
+// for missing rows, on the span. Calls outside a trace, such as those of
+// background workers polling, start no span.
+func (o *Observer) Start(ctx context.Context, component, method string) (context.Context, func(err error)) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, func(error) {}
+	}
+	ctx, span := o.tracer.Start(ctx, o.layer+" "+component+"."+method)
+	return ctx, func(err error) {
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
@@ -0,0 +1,66 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestMiddlewareAndObserver(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer tp.Shutdown(context.Background())
+
+	o := NewObserver("usecase")
+	if _, end := o.Start(context.Background(), "memo", "GetMemo"); end != nil {
+		end(nil)
+	}
+	if n := len(recorder.Ended()); n != 0 {
+		t.Fatalf("expected no span outside a trace, got %d", n)
+	}
+
+	var traceID, spanID string
+	r := gin.New()
+	r.Use(Middleware())
+	r.GET("/api/memos/:id", func(c *gin.Context) {
+		traceID, spanID = IDs(c.Request.Context())
+		_, end := o.Start(c.Request.Context(), "memo", "GetMemo")
+		end(errors.New("boom"))
+		c.Status(http.StatusInternalServerError)
+	})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/memos/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(w, req)
+
+	if traceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("trace not continued, got trace id %q", traceID)
+	}
+	if got := w.Header().Get("traceparent"); !strings.Contains(got, traceID+"-"+spanID) {
+		t.Fatalf("unexpected traceparent response header %q", got)
+	}
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	child, server := spans[0], spans[1]
+	if server.Name() != "GET /api/memos/:id" || server.Status().Code != codes.Error || server.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Fatalf("unexpected server span %q %v", server.Name(), server.Status())
+	}
+	if child.Name() != "usecase memo.GetMemo" || child.Parent().SpanID() != server.SpanContext().SpanID() || child.Status().Description != "boom" {
+		t.Fatalf("unexpected child span %q %v", child.Name(), child.Status())
+	}
+}
@@ -0,0 +1,411 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/peconote/peconote/internal/domain/ot"
+)
+
+var (
+	ErrCollabRevision  = errors.New("unknown revision")
+	ErrCollabOperation = errors.New("invalid operation")
+	ErrCollabSession   = errors.New("not joined to memo")
+)
+
+const (
+	DefaultCollabSnapshotInterval = 5 * time.Second
+	// collabHistory is how many past operations are kept to transform late
+	// submissions against. Clients further behind must rejoin.
+	collabHistory = 1000
+)
+
+// CollabPeer is a client connected to a memo.
+type CollabPeer struct {
+	ClientID string
+	UserID   string
+}
+
+// CollabClient receives the updates of a collaboration session. Its methods
+// are called while the memo is locked, so they must not block.
+type CollabClient interface {
+	// Operation delivers an operation of another client at revision rev.
+	Operation(rev int, op *ot.Operation, clientID string)
+	// Ack confirms that the client's pending operation became revision rev.
+	Ack(rev int)
+	Presence(peers []CollabPeer)
+	// Close ends the session, e.g. because the memo was deleted.
+	Close(err error)
+}
+
+type CollabSnapshot struct {
+	Revision int
+	Body     string
+	Peers    []CollabPeer
+}
+
+// CollabUsecase lets several clients edit the body of a memo at the same
+// time. Edits are operations (see package ot) against a revision of the
+// document; the server transforms them against everything applied since and
+// broadcasts the result. The body is written back periodically and when the
+// last client leaves. Changes saved meanwhile by other means, such as an
+// update request or a session on another server, are merged into the
+// session as operations of no client.
+type CollabUsecase interface {
+	Join(ctx context.Context, memoID uuid.UUID, clientID, userID string, client CollabClient) (CollabSnapshot, error)
+	Submit(ctx context.Context, memoID uuid.UUID, clientID string, rev int, op *ot.Operation) error
+	Leave(memoID uuid.UUID, clientID string)
+}
+
+type collabUsecase struct {
+	memos        MemoUsecase
+	interval     time.Duration
+	maxBodyBytes int
+
+	mu   sync.Mutex
+	docs map[uuid.UUID]*collabDoc
+}
+
+type collabMember struct {
+	peer   CollabPeer
+	client CollabClient
+}
+
+type collabDoc struct {
+	id uuid.UUID
+
+	mu      sync.Mutex
+	body    string
+	rev     int
+	history []*ot.Operation // operations base+1 … rev
+	base    int
+	members []*collabMember
+	editor  string
+	closed  bool
+
+	// stored is the body last read from or written to the memo. bridge
+	// turns it into the document at storedRev; it is nil when stored is
+	// that document.
+	stored    string
+	storedRev int
+	bridge    *ot.Operation
+
+	persistMu sync.Mutex
+	stopOnce  sync.Once
+	stop      chan struct{}
+}
+
+func NewCollabUsecase(memos MemoUsecase, interval time.Duration, maxBodyBytes int) CollabUsecase {
+	return &collabUsecase{memos: memos, interval: interval, maxBodyBytes: maxBodyBytes, docs: make(map[uuid.UUID]*collabDoc)}
+}
+
+func (u *collabUsecase) Join(ctx context.Context, memoID uuid.UUID, clientID, userID string, client CollabClient) (CollabSnapshot, error) {
+	for {
+		doc, err := u.open(ctx, memoID)
+		if err != nil {
+			return CollabSnapshot{}, err
+		}
+		doc.mu.Lock()
+		if !doc.closed {
+			defer doc.mu.Unlock()
+			return doc.join(clientID, userID, client)
+		}
+		// The document was closed after it was looked up; the next one
+		// reads the memo again.
+		doc.mu.Unlock()
+	}
+}
+
+// open returns the document of a memo, reading the memo for a new one. The
+// memo is read without holding u.mu so that a slow read does not hold up
+// other memos' sessions.
+func (u *collabUsecase) open(ctx context.Context, memoID uuid.UUID) (*collabDoc, error) {
+	u.mu.Lock()
+	doc, ok := u.docs[memoID]
+	u.mu.Unlock()
+	if ok {
+		return doc, nil
+	}
+	memo, err := u.memos.GetMemo(ctx, memoID)
+	if err != nil {
+		return nil, err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if doc, ok := u.docs[memoID]; ok {
+		return doc, nil
+	}
+	doc = &collabDoc{id: memoID, body: memo.Body, stored: memo.Body, stop: make(chan struct{})}
+	u.docs[memoID] = doc
+	go u.persistLoop(doc)
+	return doc, nil
+}
+
+// join adds a member to the document. d.mu must be held.
+func (d *collabDoc) join(clientID, userID string, client CollabClient) (CollabSnapshot, error) {
+	for _, m := range d.members {
+		if m.peer.ClientID == clientID {
+			return CollabSnapshot{}, fmt.Errorf("client %q already joined", clientID)
+		}
+	}
+	d.members = append(d.members, &collabMember{peer: CollabPeer{ClientID: clientID, UserID: userID}, client: client})
+	peers := d.peers()
+	for _, m := range d.members[:len(d.members)-1] {
+		m.client.Presence(peers)
+	}
+	return CollabSnapshot{Revision: d.rev, Body: d.body, Peers: peers}, nil
+}
+
+func (u *collabUsecase) Submit(ctx context.Context, memoID uuid.UUID, clientID string, rev int, op *ot.Operation) error {
+	u.mu.Lock()
+	doc, ok := u.docs[memoID]
+	u.mu.Unlock()
+	if !ok {
+		return ErrCollabSession
+	}
+
+	doc.mu.Lock()
+	defer doc.mu.Unlock()
+	if doc.closed {
+		return ErrMemoNotFound
+	}
+	var sender *collabMember
+	for _, m := range doc.members {
+		if m.peer.ClientID == clientID {
+			sender = m
+		}
+	}
+	if sender == nil {
+		return ErrCollabSession
+	}
+	if rev < doc.base || rev > doc.rev {
+		return fmt.Errorf("%w: %d", ErrCollabRevision, rev)
+	}
+	for _, concurrent := range doc.history[rev-doc.base:] {
+		var err error
+		if op, _, err = ot.Transform(op, concurrent); err != nil {
+			return fmt.Errorf("%w: %v", ErrCollabOperation, err)
+		}
+	}
+	body, err := op.Apply(doc.body)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCollabOperation, err)
+	}
+	if len(body) > u.maxBodyBytes {
+		return fmt.Errorf("%w: body would be %d bytes, max %d", ErrCollabOperation, len(body), u.maxBodyBytes)
+	}
+
+	doc.editor = sender.peer.UserID
+	doc.apply(body, op, sender)
+	return nil
+}
+
+// apply makes op, which turns the document into body, the next revision and
+// sends it to the members. sender is nil for changes made outside the
+// session.
+func (d *collabDoc) apply(body string, op *ot.Operation, sender *collabMember) {
+	d.body = body
+	d.rev++
+	d.history = append(d.history, op)
+	// Operations since storedRev are kept to merge changes of the stored
+	// memo.
+	if drop := len(d.history) - collabHistory; drop > 0 {
+		if keep := d.storedRev - d.base; drop > keep {
+			drop = keep
+		}
+		d.history = append([]*ot.Operation(nil), d.history[drop:]...)
+		d.base += drop
+	}
+	clientID := ""
+	if sender != nil {
+		clientID = sender.peer.ClientID
+	}
+	for _, m := range d.members {
+		if m == sender {
+			m.client.Ack(d.rev)
+		} else {
+			m.client.Operation(d.rev, op, clientID)
+		}
+	}
+}
+
+func (u *collabUsecase) Leave(memoID uuid.UUID, clientID string) {
+	u.mu.Lock()
+	doc, ok := u.docs[memoID]
+	u.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	doc.mu.Lock()
+	for i, m := range doc.members {
+		if m.peer.ClientID == clientID {
+			doc.members = append(doc.members[:i:i], doc.members[i+1:]...)
+			break
+		}
+	}
+	empty := len(doc.members) == 0
+	peers := doc.peers()
+	for _, m := range doc.members {
+		m.client.Presence(peers)
+	}
+	doc.mu.Unlock()
+	if !empty {
+		return
+	}
+
+	// Write the final state back before forgetting the document. A client
+	// joining meanwhile keeps the in-memory copy alive instead.
+	u.persist(doc)
+	u.mu.Lock()
+	doc.mu.Lock()
+	if len(doc.members) == 0 && u.docs[memoID] == doc {
+		delete(u.docs, memoID)
+		doc.closed = true
+		doc.stopOnce.Do(func() { close(doc.stop) })
+	}
+	doc.mu.Unlock()
+	u.mu.Unlock()
+}
+
+func (u *collabUsecase) persistLoop(doc *collabDoc) {
+	ticker := time.NewTicker(u.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			u.persist(doc)
+		case <-doc.stop:
+			return
+		}
+	}
+}
+
+// collabPersistAttempts bounds how often persist merges and retries when the
+// memo keeps changing while it is written.
+const collabPersistAttempts = 3
+
+// persist merges changes of the stored memo into the session and writes
+// the body back when it differs. Failed writes are retried on the next tick.
+func (u *collabUsecase) persist(doc *collabDoc) {
+	doc.persistMu.Lock()
+	defer doc.persistMu.Unlock()
+
+	for i := 0; i < collabPersistAttempts; i++ {
+		ctx := context.Background()
+		memo, err := u.memos.GetMemo(ctx, doc.id)
+		if errors.Is(err, ErrMemoNotFound) {
+			u.close(doc, err)
+			return
+		}
+		if err != nil {
+			return
+		}
+
+		doc.mu.Lock()
+		if doc.closed {
+			doc.mu.Unlock()
+			return
+		}
+		if memo.Body != doc.stored {
+			if err := doc.merge(memo.Body); err != nil {
+				doc.mu.Unlock()
+				u.close(doc, err)
+				return
+			}
+		}
+		if doc.body == doc.stored {
+			doc.storedRev, doc.bridge = doc.rev, nil
+		}
+		if doc.body == doc.stored || strings.TrimSpace(doc.body) == "" {
+			doc.mu.Unlock()
+			return
+		}
+		base, body, rev, editor := doc.stored, doc.body, doc.rev, doc.editor
+		doc.mu.Unlock()
+
+		if editor != "" {
+			ctx = WithUserID(ctx, editor)
+		}
+		err = u.memos.ReplaceMemoBody(ctx, doc.id, base, body)
+		switch {
+		case err == nil:
+			doc.mu.Lock()
+			doc.stored, doc.storedRev, doc.bridge = body, rev, nil
+			doc.mu.Unlock()
+			return
+		case errors.Is(err, ErrMemoNotFound):
+			u.close(doc, err)
+			return
+		case !errors.Is(err, ErrMemoConflict):
+			return
+		}
+	}
+}
+
+// merge applies the change from stored to body, made outside the session,
+// as the next revision. The change is transformed against the operations
+// since storedRev, and the bridge against it, so that body becomes the new
+// stored body.
+func (d *collabDoc) merge(body string) error {
+	op := ot.Diff(d.stored, body)
+	bridge := d.bridge
+	if bridge == nil {
+		bridge = (&ot.Operation{}).Retain(utf8.RuneCountInString(d.stored))
+	}
+	op, bridge, err := ot.Transform(op, bridge)
+	if err != nil {
+		return err
+	}
+	for _, concurrent := range d.history[d.storedRev-d.base:] {
+		var next *ot.Operation
+		if op, next, err = ot.Transform(op, concurrent); err != nil {
+			return err
+		}
+		if bridge, err = ot.Compose(bridge, next); err != nil {
+			return err
+		}
+	}
+	merged, err := op.Apply(d.body)
+	if err != nil {
+		return err
+	}
+	if !op.IsNoop() {
+		d.apply(merged, op, nil)
+	}
+	d.stored, d.storedRev, d.bridge = body, d.rev, bridge
+	return nil
+}
+
+// close disconnects every client, e.g. of a memo that no longer exists.
+func (u *collabUsecase) close(doc *collabDoc, err error) {
+	u.mu.Lock()
+	if u.docs[doc.id] == doc {
+		delete(u.docs, doc.id)
+	}
+	u.mu.Unlock()
+
+	doc.mu.Lock()
+	doc.closed = true
+	for _, m := range doc.members {
+		m.client.Close(err)
+	}
+	doc.members = nil
+	doc.mu.Unlock()
+	doc.stopOnce.Do(func() { close(doc.stop) })
+}
+
+func (d *collabDoc) peers() []CollabPeer {
+	peers := make([]CollabPeer, len(d.members))
+	for i, m := range d.members {
+		peers[i] = m.peer
+	}
+	return peers
+}
@@ -0,0 +1,412 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/domain/ot"
+)
+
+type simMessage struct {
+	ack bool
+	rev int
+	op  *ot.Operation
+}
+
+type simSubmission struct {
+	rev int
+	op  *ot.Operation
+}
+
+// simClient follows the usual OT client protocol: at most one operation is
+// in flight, further local edits are composed into a buffer, and incoming
+// operations are transformed against both. Messages in either direction are
+// queued so that the test decides when they arrive.
+type simClient struct {
+	id          string
+	doc         string
+	rev         int
+	outstanding *ot.Operation
+	buffer      *ot.Operation
+	outbox      []simSubmission
+	inbox       []simMessage
+	peers       []CollabPeer
+	closed      error
+}
+
+func (c *simClient) Operation(rev int, op *ot.Operation, clientID string) {
+	c.inbox = append(c.inbox, simMessage{rev: rev, op: op})
+}
+
+func (c *simClient) Ack(rev int) { c.inbox = append(c.inbox, simMessage{ack: true, rev: rev}) }
+
+func (c *simClient) Presence(peers []CollabPeer) { c.peers = peers }
+
+func (c *simClient) Close(err error) { c.closed = err }
+
+func (c *simClient) edit(t *testing.T, r *rand.Rand) {
+	op := &ot.Operation{}
+	n := utf8.RuneCountInString(c.doc)
+	pos := r.Intn(n + 1)
+	op.Retain(pos)
+	if n-pos > 0 && (r.Intn(2) == 0 || n > 200) {
+		del := r.Intn(n-pos) + 1
+		if del > 5 {
+			del = 5
+		}
+		op.Delete(del)
+		pos += del
+	} else {
+		op.Insert(string(rune('a' + r.Intn(26))))
+	}
+	op.Retain(n - pos)
+	doc, err := op.Apply(c.doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.doc = doc
+	switch {
+	case c.outstanding == nil:
+		c.outstanding = op
+		c.outbox = append(c.outbox, simSubmission{rev: c.rev, op: op})
+	case c.buffer == nil:
+		c.buffer = op
+	default:
+		if c.buffer, err = ot.Compose(c.buffer, op); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func (c *simClient) send(t *testing.T, u CollabUsecase, memoID uuid.UUID) {
+	if len(c.outbox) == 0 {
+		return
+	}
+	s := c.outbox[0]
+	c.outbox = c.outbox[1:]
+	if err := u.Submit(context.Background(), memoID, c.id, s.rev, s.op); err != nil {
+		t.Fatalf("%s: submit: %v", c.id, err)
+	}
+}
+
+func (c *simClient) receive(t *testing.T) {
+	if len(c.inbox) == 0 {
+		return
+	}
+	m := c.inbox[0]
+	c.inbox = c.inbox[1:]
+	c.rev = m.rev
+	if m.ack {
+		c.outstanding, c.buffer = c.buffer, nil
+		if c.outstanding != nil {
+			c.outbox = append(c.outbox, simSubmission{rev: c.rev, op: c.outstanding})
+		}
+		return
+	}
+	op := m.op
+	var err error
+	if c.outstanding != nil {
+		if c.outstanding, op, err = ot.Transform(c.outstanding, op); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.buffer != nil {
+		if c.buffer, op, err = ot.Transform(c.buffer, op); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.doc, err = op.Apply(c.doc); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *simClient) idle() bool { return len(c.outbox) == 0 && len(c.inbox) == 0 }
+
+func newCollabTest(body string) (*mockMemoRepository, CollabUsecase, uuid.UUID) {
+	id := uuid.New()
+	repo := &mockMemoRepository{memo: &domain.Memo{ID: id, Title: "Shared", Body: body, Tags: []string{"team"}}}
+	// A long interval leaves persisting to Leave, keeping the tests
+	// single-threaded.
+	return repo, NewCollabUsecase(NewMemoUsecase(repo, nil, nil, nil, nil, nil, DefaultMemoLimits), time.Hour, DefaultMemoLimits.MaxBodyBytes), id
+}
+
+func joinSim(t *testing.T, u CollabUsecase, memoID uuid.UUID, id string) *simClient {
+	c := &simClient{id: id}
+	snap, err := u.Join(context.Background(), memoID, id, "user-"+id, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.doc, c.rev = snap.Body, snap.Revision
+	return c
+}
+
+func TestCollab_Converges(t *testing.T) {
+	for seed := int64(1); seed <= 25; seed++ {
+		repo, u, memoID := newCollabTest("hello world")
+		clients := []*simClient{joinSim(t, u, memoID, "a"), joinSim(t, u, memoID, "b"), joinSim(t, u, memoID, "c")}
+
+		r := rand.New(rand.NewSource(seed))
+		for step := 0; step < 400; step++ {
+			c := clients[r.Intn(len(clients))]
+			switch r.Intn(3) {
+			case 0:
+				c.edit(t, r)
+			case 1:
+				c.send(t, u, memoID)
+			default:
+				c.receive(t)
+			}
+		}
+		for busy := true; busy; {
+			for _, c := range clients {
+				c.send(t, u, memoID)
+				for len(c.inbox) > 0 {
+					c.receive(t)
+				}
+			}
+			busy = false
+			for _, c := range clients {
+				busy = busy || !c.idle()
+			}
+		}
+
+		observer := joinSim(t, u, memoID, "observer")
+		for _, c := range clients {
+			if c.doc != observer.doc || c.rev != observer.rev {
+				t.Fatalf("seed %d: client %s has %q at %d, server %q at %d", seed, c.id, c.doc, c.rev, observer.doc, observer.rev)
+			}
+		}
+
+		for _, c := range append(clients, observer) {
+			u.Leave(memoID, c.id)
+		}
+		if observer.doc == "" {
+			continue
+		}
+		if repo.memo.Body != observer.doc || repo.memo.Title != "Shared" || len(repo.memo.Tags) != 1 {
+			t.Fatalf("seed %d: persisted %+v, want body %q", seed, repo.memo, observer.doc)
+		}
+	}
+}
+
+func TestCollab_Presence(t *testing.T) {
+	_, u, memoID := newCollabTest("x")
+	a := joinSim(t, u, memoID, "a")
+	b := joinSim(t, u, memoID, "b")
+	if len(a.peers) != 2 || a.peers[1] != (CollabPeer{ClientID: "b", UserID: "user-b"}) {
+		t.Fatalf("unexpected peers %+v", a.peers)
+	}
+	u.Leave(memoID, "a")
+	if len(b.peers) != 1 || b.peers[0].ClientID != "b" {
+		t.Fatalf("unexpected peers %+v", b.peers)
+	}
+}
+
+func TestCollab_Errors(t *testing.T) {
+	repo, u, memoID := newCollabTest("x")
+	a := joinSim(t, u, memoID, "a")
+	op := (&ot.Operation{}).Retain(1).Insert("y")
+	if err := u.Submit(context.Background(), memoID, "a", 5, op); !errors.Is(err, ErrCollabRevision) {
+		t.Fatalf("expected ErrCollabRevision, got %v", err)
+	}
+	if err := u.Submit(context.Background(), memoID, "a", 0, (&ot.Operation{}).Retain(3)); !errors.Is(err, ErrCollabOperation) {
+		t.Fatalf("expected ErrCollabOperation, got %v", err)
+	}
+	big := (&ot.Operation{}).Retain(1).Insert(string(make([]byte, domain.MaxBodyBytes)))
+	if err := u.Submit(context.Background(), memoID, "a", 0, big); !errors.Is(err, ErrCollabOperation) {
+		t.Fatalf("expected ErrCollabOperation, got %v", err)
+	}
+	if err := u.Submit(context.Background(), memoID, "nobody", 0, op); !errors.Is(err, ErrCollabSession) {
+		t.Fatalf("expected ErrCollabSession, got %v", err)
+	}
+	if err := u.Submit(context.Background(), memoID, "a", 0, op); err != nil {
+		t.Fatal(err)
+	}
+
+	repo.err = sql.ErrNoRows
+	cu := u.(*collabUsecase)
+	cu.persist(cu.docs[memoID])
+	if !errors.Is(a.closed, ErrMemoNotFound) {
+		t.Fatalf("expected client to be closed, got %v", a.closed)
+	}
+	if _, err := u.Join(context.Background(), memoID, "b", "", &simClient{}); !errors.Is(err, ErrMemoNotFound) {
+		t.Fatalf("expected ErrMemoNotFound, got %v", err)
+	}
+}
+
+// racingMemoRepository runs beforeUpdateBody before each conditional write,
+// e.g. to change the memo meanwhile, and fails the write if it returns an
+// error.
+type racingMemoRepository struct {
+	*mockMemoRepository
+	beforeUpdateBody func() error
+}
+
+func (r *racingMemoRepository) UpdateBody(ctx context.Context, id uuid.UUID, base, body string, updatedAt time.Time) error {
+	if r.beforeUpdateBody != nil {
+		if err := r.beforeUpdateBody(); err != nil {
+			return err
+		}
+	}
+	return r.mockMemoRepository.UpdateBody(ctx, id, base, body, updatedAt)
+}
+
+func settle(t *testing.T, clients ...*simClient) {
+	for _, c := range clients {
+		for len(c.inbox) > 0 {
+			c.receive(t)
+		}
+	}
+}
+
+func TestCollab_MergesExternalChanges(t *testing.T) {
+	mock, _, memoID := newCollabTest("hello world")
+	repo := &racingMemoRepository{mockMemoRepository: mock}
+	memos := NewMemoUsecase(repo, nil, nil, nil, nil, nil, DefaultMemoLimits)
+	u := NewCollabUsecase(memos, time.Hour, DefaultMemoLimits.MaxBodyBytes).(*collabUsecase)
+	a := joinSim(t, u, memoID, "a")
+	b := joinSim(t, u, memoID, "b")
+	put := func(body string) {
+		t.Helper()
+		if err := memos.UpdateMemo(context.Background(), memoID, "Shared", body, []string{"team"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// An update request while the session edits the memo.
+	a.doc = "hello world!"
+	a.outbox = append(a.outbox, simSubmission{rev: a.rev, op: (&ot.Operation{}).Retain(11).Insert("!")})
+	a.outstanding = a.outbox[0].op
+	a.send(t, u, memoID)
+	put("Hello world")
+	u.persist(u.docs[memoID])
+	settle(t, a, b)
+	if mock.memo.Body != "Hello world!" || a.doc != "Hello world!" || b.doc != "Hello world!" {
+		t.Fatalf("stored %q, a has %q, b has %q", mock.memo.Body, a.doc, b.doc)
+	}
+
+	// The memo changes again between reading and writing it.
+	c := (&ot.Operation{}).Insert(">").Retain(12)
+	if err := u.Submit(context.Background(), memoID, "b", b.rev, c); err != nil {
+		t.Fatal(err)
+	}
+	b.doc, _ = c.Apply(b.doc)
+	raced := false
+	repo.beforeUpdateBody = func() error {
+		if !raced {
+			raced = true
+			put("Hello world! (edited)")
+		}
+		return nil
+	}
+	u.persist(u.docs[memoID])
+	settle(t, a, b)
+	if want := ">Hello world! (edited)"; mock.memo.Body != want || a.doc != want || b.doc != want {
+		t.Fatalf("stored %q, a has %q, b has %q", mock.memo.Body, a.doc, b.doc)
+	}
+
+	// A write fails after a merge, and the memo changes again before the
+	// next one.
+	c = (&ot.Operation{}).Retain(22).Insert(" <")
+	if err := u.Submit(context.Background(), memoID, "a", a.rev, c); err != nil {
+		t.Fatal(err)
+	}
+	a.doc, _ = c.Apply(a.doc)
+	repo.beforeUpdateBody = func() error { return errors.New("database unavailable") }
+	put(">Hi world! (edited)")
+	u.persist(u.docs[memoID])
+	repo.beforeUpdateBody = nil
+	put(">Hi world! (edited twice)")
+	u.persist(u.docs[memoID])
+	settle(t, a, b)
+	if want := ">Hi world! (edited twice) <"; mock.memo.Body != want || a.doc != want || b.doc != want {
+		t.Fatalf("stored %q, a has %q, b has %q", mock.memo.Body, a.doc, b.doc)
+	}
+}
+
+// slowMemoUsecase holds reads of one memo until release is closed.
+type slowMemoUsecase struct {
+	MemoUsecase
+	slow    uuid.UUID
+	reading chan struct{}
+	release chan struct{}
+}
+
+func (s *slowMemoUsecase) GetMemo(ctx context.Context, id uuid.UUID) (*domain.Memo, error) {
+	if id == s.slow {
+		close(s.reading)
+		<-s.release
+	}
+	return s.MemoUsecase.GetMemo(ctx, id)
+}
+
+func TestCollab_JoinReadsMemoOutsideLock(t *testing.T) {
+	repo := &mockMemoRepository{memo: &domain.Memo{Body: "x"}}
+	memos := &slowMemoUsecase{MemoUsecase: NewMemoUsecase(repo, nil, nil, nil, nil, nil, DefaultMemoLimits), slow: uuid.New(), reading: make(chan struct{}), release: make(chan struct{})}
+	u := NewCollabUsecase(memos, time.Hour, DefaultMemoLimits.MaxBodyBytes)
+
+	slow := make(chan error, 1)
+	go func() {
+		_, err := u.Join(context.Background(), memos.slow, "a", "", &simClient{})
+		slow <- err
+	}()
+	<-memos.reading
+	other := make(chan error, 1)
+	go func() {
+		_, err := u.Join(context.Background(), uuid.New(), "b", "", &simClient{})
+		other <- err
+	}()
+	select {
+	case err := <-other:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("joining another memo waited for a slow read")
+	}
+	close(memos.release)
+	if err := <-slow; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollab_JoinRetriesClosedDocument(t *testing.T) {
+	_, u, memoID := newCollabTest("x")
+	cu := u.(*collabUsecase)
+	joinSim(t, u, memoID, "a")
+	stale := cu.docs[memoID]
+
+	// The join finds the document and waits for it while it is closed, as
+	// close does.
+	stale.mu.Lock()
+	joined := make(chan error, 1)
+	go func() {
+		_, err := u.Join(context.Background(), memoID, "b", "", &simClient{})
+		joined <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cu.mu.Lock()
+	delete(cu.docs, memoID)
+	cu.mu.Unlock()
+	stale.closed = true
+	stale.members = nil
+	stale.mu.Unlock()
+	stale.stopOnce.Do(func() { close(stale.stop) })
+
+	if err := <-joined; err != nil {
+		t.Fatal(err)
+	}
+	cu.mu.Lock()
+	doc := cu.docs[memoID]
+	cu.mu.Unlock()
+	if doc == nil || doc == stale || len(doc.members) != 1 || doc.members[0].peer.ClientID != "b" {
+		t.Fatalf("expected b to join a new document, got %+v", doc)
+	}
+}
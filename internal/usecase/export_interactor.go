@@ -0,0 +1,41 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/domain/model"
+	"github.com/peconote/peconote/internal/domain/repository"
+)
+
+var ErrInvalidExportQuery = errors.New("invalid export query")
+
+type ExportUsecase interface {
+	// ExportMemos calls fn for every memo matching f, archived ones
+	// included unless f says otherwise, oldest first.
+	ExportMemos(ctx context.Context, f model.MemoFilter, fn func(*domain.Memo) error) error
+}
+
+type exportUsecase struct {
+	repo repository.MemoRepository
+}
+
+func NewExportUsecase(r repository.MemoRepository) ExportUsecase {
+	return &exportUsecase{repo: r}
+}
+
+func (u *exportUsecase) ExportMemos(ctx context.Context, f model.MemoFilter, fn func(*domain.Memo) error) error {
+	if f.Tag != nil {
+		t := strings.TrimSpace(*f.Tag)
+		if t == "" || len(t) > 30 {
+			return ErrInvalidExportQuery
+		}
+		f.Tag = &t
+	}
+	if !validTimeRange(f.CreatedAfter, f.CreatedBefore) || !validTimeRange(f.UpdatedAfter, f.UpdatedBefore) {
+		return ErrInvalidExportQuery
+	}
+	return u.repo.Stream(ctx, f, fn)
+}
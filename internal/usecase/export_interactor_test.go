@@ -0,0 +1,38 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/domain/model"
+)
+
+func TestExportMemos(t *testing.T) {
+	repo := &mockMemoRepository{listItems: []*domain.Memo{{Body: "a"}, {Body: "b"}}}
+	u := NewExportUsecase(repo)
+	tag := " work "
+	var got []string
+	err := u.ExportMemos(context.Background(), model.MemoFilter{Tag: &tag}, func(m *domain.Memo) error {
+		got = append(got, m.Body)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 2 || *repo.listFilter.Tag != "work" || repo.listFilter.Archived != nil {
+		t.Fatalf("unexpected export %v %+v", got, repo.listFilter)
+	}
+}
+
+func TestExportMemos_InvalidQuery(t *testing.T) {
+	u := NewExportUsecase(&mockMemoRepository{})
+	after := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	before := after.Add(-time.Hour)
+	err := u.ExportMemos(context.Background(), model.MemoFilter{UpdatedAfter: &after, UpdatedBefore: &before}, func(*domain.Memo) error { return nil })
+	if !errors.Is(err, ErrInvalidExportQuery) {
+		t.Fatalf("expected invalid query, got %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/domain/model"
+	"github.com/peconote/peconote/internal/domain/repository"
+)
+
+var ErrInvalidGraphQuery = errors.New("invalid graph query")
+
+type GraphQuery struct {
+	Tag           *string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+}
+
+type GraphSink interface {
+	Node(n domain.GraphNode) error
+	Edge(e domain.GraphEdge) error
+}
+
+type GraphUsecase interface {
+	StreamGraph(ctx context.Context, q GraphQuery, sink GraphSink) error
+}
+
+type graphUsecase struct {
+	repo  repository.MemoRepository
+	graph repository.GraphRepository
+	tx    repository.Transactor
+}
+
+// NewGraphUsecase reads each graph within a transaction of tx, which should
+// give all its queries the same snapshot so that edges never point at nodes
+// that were not sent.
+func NewGraphUsecase(r repository.MemoRepository, gr repository.GraphRepository, tx repository.Transactor) GraphUsecase {
+	return &graphUsecase{repo: r, graph: gr, tx: tx}
+}
+
+// StreamGraph sends all nodes before any edge, as the JSON format needs,
+// reading memos once and tags and links from the repository.
+func (u *graphUsecase) StreamGraph(ctx context.Context, q GraphQuery, sink GraphSink) error {
+	if q.Tag != nil {
+		t := strings.TrimSpace(*q.Tag)
+		if t == "" || len(t) > 30 {
+			return ErrInvalidGraphQuery
+		}
+		q.Tag = &t
+	}
+	if !validTimeRange(q.CreatedAfter, q.CreatedBefore) {
+		return ErrInvalidGraphQuery
+	}
+	f := model.MemoFilter{Tag: q.Tag, CreatedAfter: q.CreatedAfter, CreatedBefore: q.CreatedBefore}
+	return u.withinTx(ctx, func(ctx context.Context) error {
+		err := u.repo.Stream(ctx, f, func(m *domain.Memo) error {
+			return sink.Node(domain.GraphNode{ID: memoNodeID(m.ID), Kind: domain.GraphNodeMemo, Label: memoLabel(m)})
+		})
+		if err != nil || u.graph == nil {
+			return err
+		}
+		err = u.graph.StreamTags(ctx, f, func(tag string) error {
+			return sink.Node(domain.GraphNode{ID: tagNodeID(tag), Kind: domain.GraphNodeTag, Label: tag})
+		})
+		if err != nil {
+			return err
+		}
+		err = u.graph.StreamTagEdges(ctx, f, func(memoID uuid.UUID, tag string) error {
+			return sink.Edge(domain.GraphEdge{Source: memoNodeID(memoID), Target: tagNodeID(tag), Kind: domain.GraphEdgeTag})
+		})
+		if err != nil {
+			return err
+		}
+		return u.graph.StreamLinks(ctx, f, func(l domain.MemoLink) error {
+			return sink.Edge(domain.GraphEdge{Source: memoNodeID(l.SourceID), Target: memoNodeID(*l.TargetID), Kind: domain.GraphEdgeLink})
+		})
+	})
+}
+
+func (u *graphUsecase) withinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if u.tx == nil {
+		return fn(ctx)
+	}
+	return u.tx.WithinTx(ctx, fn)
+}
+
+func memoNodeID(id uuid.UUID) string {
+	return "memo:" + id.String()
+}
+
+func tagNodeID(tag string) string {
+	return "tag:" + tag
+}
+
+func memoLabel(m *domain.Memo) string {
+	label := m.Title
+	if label == "" {
+		label = domain.DeriveTitle(m.Body)
+	}
+	if utf8.RuneCountInString(label) > 80 {
+		label = string([]rune(label)[:80])
+	}
+	return label
+}
@@ -0,0 +1,108 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/domain/model"
+)
+
+type recordingGraphSink struct {
+	nodes []domain.GraphNode
+	edges []domain.GraphEdge
+}
+
+func (s *recordingGraphSink) Node(n domain.GraphNode) error {
+	s.nodes = append(s.nodes, n)
+	return nil
+}
+
+func (s *recordingGraphSink) Edge(e domain.GraphEdge) error {
+	s.edges = append(s.edges, e)
+	return nil
+}
+
+type mockGraphRepository struct {
+	tags     []string
+	tagEdges map[uuid.UUID][]string
+	links    []domain.MemoLink
+	filter   model.MemoFilter
+}
+
+func (m *mockGraphRepository) StreamTags(ctx context.Context, f model.MemoFilter, fn func(tag string) error) error {
+	m.filter = f
+	for _, t := range m.tags {
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockGraphRepository) StreamTagEdges(ctx context.Context, f model.MemoFilter, fn func(memoID uuid.UUID, tag string) error) error {
+	for id, tags := range m.tagEdges {
+		for _, t := range tags {
+			if err := fn(id, t); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *mockGraphRepository) StreamLinks(ctx context.Context, f model.MemoFilter, fn func(domain.MemoLink) error) error {
+	for _, l := range m.links {
+		if err := fn(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestStreamGraph_Success(t *testing.T) {
+	now := time.Now()
+	a := &domain.Memo{ID: uuid.New(), Body: "# Alpha\nsee [[Beta]]", Tags: []string{"x", "y"}, CreatedAt: now}
+	b := &domain.Memo{ID: uuid.New(), Body: "Beta", Tags: []string{"x"}, CreatedAt: now.Add(-time.Hour)}
+	repo := &mockMemoRepository{listItems: []*domain.Memo{a, b}, total: 2}
+	graph := &mockGraphRepository{
+		tags:     []string{"x", "y"},
+		tagEdges: map[uuid.UUID][]string{a.ID: a.Tags, b.ID: b.Tags},
+		links:    []domain.MemoLink{{SourceID: a.ID, TargetRef: "Beta", TargetID: &b.ID}},
+	}
+	tx := &mockTransactor{}
+	u := NewGraphUsecase(repo, graph, tx)
+	after := now.Add(-24 * time.Hour)
+	sink := &recordingGraphSink{}
+	if err := u.StreamGraph(context.Background(), GraphQuery{CreatedAfter: &after}, sink); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tx.calls != 1 {
+		t.Fatalf("expected the graph to be read in one transaction, got %d", tx.calls)
+	}
+	if len(sink.nodes) != 4 {
+		t.Fatalf("expected 2 memo and 2 tag nodes, got %+v", sink.nodes)
+	}
+	if repo.listFilter.CreatedAfter == nil || !repo.listFilter.CreatedAfter.Equal(after) || graph.filter.CreatedAfter != repo.listFilter.CreatedAfter {
+		t.Fatalf("expected date filter to be passed to the repositories")
+	}
+	if sink.nodes[0].Label != "Alpha" || sink.nodes[2].ID != "tag:x" {
+		t.Fatalf("unexpected nodes %+v", sink.nodes)
+	}
+	if len(sink.edges) != 4 || sink.edges[3].Kind != domain.GraphEdgeLink {
+		t.Fatalf("expected 3 tag edges and 1 link edge, got %+v", sink.edges)
+	}
+}
+
+func TestStreamGraph_Validation(t *testing.T) {
+	u := NewGraphUsecase(&mockMemoRepository{}, nil, nil)
+	now := time.Now()
+	before := now.Add(-time.Hour)
+	err := u.StreamGraph(context.Background(), GraphQuery{CreatedAfter: &now, CreatedBefore: &before}, &recordingGraphSink{})
+	if !errors.Is(err, ErrInvalidGraphQuery) {
+		t.Fatalf("expected validation error")
+	}
+}
@@ -0,0 +1,84 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/domain/repository"
+)
+
+var ErrInvalidIdempotencyKey = errors.New("invalid idempotency key")
+var ErrIdempotencyKeyReused = errors.New("idempotency key reused with a different request")
+var ErrIdempotencyInProgress = errors.New("request with this idempotency key is in progress")
+
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// IdempotencyUsecase keeps the keys of each user, taken from the context
+// (see WithUserID), apart.
+type IdempotencyUsecase interface {
+	// Begin returns the stored record when the request was already handled
+	// and should be replayed, or nil when the caller should proceed.
+	Begin(ctx context.Context, key, fingerprint string) (*domain.IdempotencyRecord, error)
+	Complete(ctx context.Context, key string, statusCode int, location string, body []byte) error
+	Abort(ctx context.Context, key string) error
+}
+
+type idempotencyUsecase struct {
+	repo repository.IdempotencyRepository
+	ttl  time.Duration
+	now  func() time.Time
+}
+
+func NewIdempotencyUsecase(r repository.IdempotencyRepository, ttl time.Duration) IdempotencyUsecase {
+	return &idempotencyUsecase{repo: r, ttl: ttl, now: time.Now}
+}
+
+func (u *idempotencyUsecase) Begin(ctx context.Context, key, fingerprint string) (*domain.IdempotencyRecord, error) {
+	if !validIdempotencyKey(key) {
+		return nil, ErrInvalidIdempotencyKey
+	}
+	now := u.now().UTC()
+	rec := &domain.IdempotencyRecord{
+		UserID:      UserIDFromContext(ctx),
+		Key:         key,
+		Fingerprint: fingerprint,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(u.ttl),
+	}
+	existing, reserved, err := u.repo.Reserve(ctx, rec, now)
+	if err != nil {
+		return nil, err
+	}
+	if reserved {
+		return nil, nil
+	}
+	if existing.Fingerprint != fingerprint {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if !existing.Completed {
+		return nil, ErrIdempotencyInProgress
+	}
+	return existing, nil
+}
+
+func (u *idempotencyUsecase) Complete(ctx context.Context, key string, statusCode int, location string, body []byte) error {
+	return u.repo.Complete(ctx, UserIDFromContext(ctx), key, statusCode, location, body)
+}
+
+func (u *idempotencyUsecase) Abort(ctx context.Context, key string) error {
+	return u.repo.Release(ctx, UserIDFromContext(ctx), key)
+}
+
+func validIdempotencyKey(key string) bool {
+	if key == "" || len(key) > 255 {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x21 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,103 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/peconote/peconote/internal/domain"
+)
+
+type mockIdempotencyRepository struct {
+	records map[[2]string]*domain.IdempotencyRecord
+}
+
+func (m *mockIdempotencyRepository) Reserve(ctx context.Context, rec *domain.IdempotencyRecord, now time.Time) (*domain.IdempotencyRecord, bool, error) {
+	k := [2]string{rec.UserID, rec.Key}
+	if existing, ok := m.records[k]; ok && !existing.ExpiresAt.Before(now) {
+		return existing, false, nil
+	}
+	m.records[k] = rec
+	return nil, true, nil
+}
+
+func (m *mockIdempotencyRepository) Complete(ctx context.Context, userID, key string, statusCode int, location string, body []byte) error {
+	rec := m.records[[2]string{userID, key}]
+	rec.Completed, rec.StatusCode, rec.Location, rec.ResponseBody = true, statusCode, location, body
+	return nil
+}
+
+func (m *mockIdempotencyRepository) Release(ctx context.Context, userID, key string) error {
+	if rec, ok := m.records[[2]string{userID, key}]; ok && !rec.Completed {
+		delete(m.records, [2]string{userID, key})
+	}
+	return nil
+}
+
+func TestIdempotency_Replay(t *testing.T) {
+	repo := &mockIdempotencyRepository{records: map[[2]string]*domain.IdempotencyRecord{}}
+	u := NewIdempotencyUsecase(repo, time.Hour)
+	ctx := context.Background()
+
+	if rec, err := u.Begin(ctx, "k1", "fp"); err != nil || rec != nil {
+		t.Fatalf("expected to proceed, got %v %v", rec, err)
+	}
+	if _, err := u.Begin(ctx, "k1", "fp"); !errors.Is(err, ErrIdempotencyInProgress) {
+		t.Fatalf("expected in progress, got %v", err)
+	}
+	if err := u.Complete(ctx, "k1", 201, "/api/memos/x", []byte(`{"id":"x"}`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rec, err := u.Begin(ctx, "k1", "fp")
+	if err != nil || rec == nil || rec.StatusCode != 201 || rec.Location != "/api/memos/x" {
+		t.Fatalf("expected replay, got %+v %v", rec, err)
+	}
+	if _, err := u.Begin(ctx, "k1", "other"); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Fatalf("expected key reuse error, got %v", err)
+	}
+}
+
+func TestIdempotency_AbortAndExpiry(t *testing.T) {
+	repo := &mockIdempotencyRepository{records: map[[2]string]*domain.IdempotencyRecord{}}
+	u := NewIdempotencyUsecase(repo, time.Hour).(*idempotencyUsecase)
+	now := time.Now()
+	u.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	u.Begin(ctx, "k", "fp")
+	if err := u.Abort(ctx, "k"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec, err := u.Begin(ctx, "k", "other"); err != nil || rec != nil {
+		t.Fatalf("expected aborted key to be reusable, got %v %v", rec, err)
+	}
+	u.Complete(ctx, "k", 201, "", nil)
+	now = now.Add(2 * time.Hour)
+	if rec, err := u.Begin(ctx, "k", "third"); err != nil || rec != nil {
+		t.Fatalf("expected expired key to be reusable, got %v %v", rec, err)
+	}
+	if _, err := u.Begin(ctx, "bad key", "fp"); !errors.Is(err, ErrInvalidIdempotencyKey) {
+		t.Fatalf("expected invalid key error")
+	}
+}
+
+func TestIdempotency_ScopedByUser(t *testing.T) {
+	repo := &mockIdempotencyRepository{records: map[[2]string]*domain.IdempotencyRecord{}}
+	u := NewIdempotencyUsecase(repo, time.Hour)
+	alice, bob := WithUserID(context.Background(), "alice"), WithUserID(context.Background(), "bob")
+
+	u.Begin(alice, "1", "fp")
+	if err := u.Complete(alice, "1", 201, "/api/memos/a", nil); err != nil {
+		t.Fatal(err)
+	}
+	if rec, err := u.Begin(bob, "1", "fp"); err != nil || rec != nil {
+		t.Fatalf("expected another user's key to be free, got %+v %v", rec, err)
+	}
+	if err := u.Abort(bob, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if rec, err := u.Begin(alice, "1", "fp"); err != nil || rec == nil || rec.Location != "/api/memos/a" {
+		t.Fatalf("expected alice's response to be kept, got %+v %v", rec, err)
+	}
+}
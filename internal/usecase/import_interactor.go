@@ -0,0 +1,204 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/domain/repository"
+)
+
+// ImportItem is one note read from an import source. Err is set when the
+// source could not parse the file; the item is then reported as failed.
+// SourceID is the memo id recorded in the source, if any. It is not
+// preserved: every imported memo gets a new id.
+type ImportItem struct {
+	Path      string
+	SourceID  string
+	Title     string
+	Body      string
+	Tags      []string
+	Pinned    bool
+	Archived  bool
+	Favorite  bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// Attachments are files the body links to by name; they are saved
+	// before the memo is created.
+	Attachments []ImportAttachment
+	Err         error
+}
+
+type ImportAttachment struct {
+	Name string
+	Data []byte
+}
+
+// SourceKey identifies the item across runs so that an interrupted import
+// can be resumed without duplicating memos.
+func (it ImportItem) SourceKey() string {
+	sum := sha256.Sum256([]byte(it.Path + "\x00" + it.Body))
+	return hex.EncodeToString(sum[:])
+}
+
+type ImportSource interface {
+	Each(ctx context.Context, fn func(ImportItem) error) error
+}
+
+type ImportFileError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// ImportReport summarizes an import. ReassignedIDs counts imported notes
+// whose source carried an id that was replaced by a new one.
+type ImportReport struct {
+	DryRun        bool              `json:"dry_run"`
+	Total         int               `json:"total"`
+	Imported      int               `json:"imported"`
+	Skipped       int               `json:"skipped"`
+	Failed        int               `json:"failed"`
+	Attachments   int               `json:"attachments"`
+	ReassignedIDs int               `json:"reassigned_ids"`
+	Errors        []ImportFileError `json:"errors"`
+}
+
+type ImportUsecase interface {
+	Import(ctx context.Context, src ImportSource, dryRun bool) (*ImportReport, error)
+}
+
+type importUsecase struct {
+	memos       *memoUsecase
+	imports     repository.MemoImportRepository
+	attachments repository.AttachmentRepository
+}
+
+func NewImportUsecase(r repository.MemoRepository, lr repository.MemoLinkRepository, tx repository.Transactor, er repository.MemoEventRepository, ob repository.OutboxRepository, bus MemoEventBus, ir repository.MemoImportRepository, ar repository.AttachmentRepository, limits MemoLimits) ImportUsecase {
+	return &importUsecase{memos: &memoUsecase{repo: r, links: lr, tx: tx, events: er, outbox: ob, bus: bus, limits: limits}, imports: ir, attachments: ar}
+}
+
+type importedMemo struct {
+	id    uuid.UUID
+	title string
+	body  string
+}
+
+func (u *importUsecase) Import(ctx context.Context, src ImportSource, dryRun bool) (*ImportReport, error) {
+	report := &ImportReport{DryRun: dryRun, Errors: []ImportFileError{}}
+	var imported []importedMemo
+	err := src.Each(ctx, func(it ImportItem) error {
+		report.Total++
+		if it.Err == nil {
+			it.Tags = normalizeImportTags(it.Tags)
+			it.Err = validateMemo(u.memos.limits, it.Title, it.Body, it.Tags)
+		}
+		if it.Err != nil {
+			report.Failed++
+			report.Errors = append(report.Errors, ImportFileError{Path: it.Path, Error: it.Err.Error()})
+			return nil
+		}
+		key := it.SourceKey()
+		done, err := u.imports.IsImported(ctx, key)
+		if err != nil {
+			return err
+		}
+		if done {
+			report.Skipped++
+			return nil
+		}
+		report.Attachments += len(it.Attachments)
+		if it.SourceID != "" {
+			report.ReassignedIDs++
+		}
+		if dryRun {
+			report.Imported++
+			return nil
+		}
+		if err := u.saveAttachments(ctx, it.Attachments); err != nil {
+			return err
+		}
+		id, err := u.importItem(ctx, key, it)
+		if err != nil {
+			return err
+		}
+		imported = append(imported, importedMemo{id: id, title: memoTitle(it.Title, it.Body), body: it.Body})
+		report.Imported++
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	// Links may point at notes that appear later in the source, so they are
+	// resolved again once every memo exists.
+	for _, m := range imported {
+		err := u.memos.withinTx(ctx, func(ctx context.Context) error {
+			return u.memos.syncLinks(ctx, m.id, m.title, m.body)
+		})
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+func (u *importUsecase) importItem(ctx context.Context, key string, it ImportItem) (uuid.UUID, error) {
+	now := time.Now().UTC()
+	memo := &domain.Memo{
+		ID:        uuid.New(),
+		Title:     memoTitle(it.Title, it.Body),
+		Body:      it.Body,
+		Tags:      it.Tags,
+		Pinned:    it.Pinned,
+		Archived:  it.Archived,
+		Favorite:  it.Favorite,
+		CreatedAt: it.CreatedAt.UTC(),
+		UpdatedAt: it.UpdatedAt.UTC(),
+	}
+	if memo.CreatedAt.IsZero() {
+		memo.CreatedAt = now
+	}
+	if memo.UpdatedAt.IsZero() || memo.UpdatedAt.Before(memo.CreatedAt) {
+		memo.UpdatedAt = memo.CreatedAt
+	}
+	err := u.memos.withinTx(ctx, func(ctx context.Context) error {
+		if err := u.memos.repo.Create(ctx, memo); err != nil {
+			return err
+		}
+		if err := u.imports.MarkImported(ctx, key, it.Path, memo.ID); err != nil {
+			return err
+		}
+		return u.memos.recordEvent(ctx, domain.MemoEventCreated, memo)
+	})
+	return memo.ID, err
+}
+
+func (u *importUsecase) saveAttachments(ctx context.Context, attachments []ImportAttachment) error {
+	if u.attachments == nil {
+		return nil
+	}
+	for _, a := range attachments {
+		if err := u.attachments.Save(ctx, a.Name, a.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func normalizeImportTags(tags []string) []string {
+	out := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, t := range tags {
+		t = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(t), "#"))
+		if t == "" || seen[strings.ToLower(t)] {
+			continue
+		}
+		seen[strings.ToLower(t)] = true
+		out = append(out, t)
+	}
+	return out
+}
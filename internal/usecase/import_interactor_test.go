@@ -0,0 +1,104 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type mockMemoImportRepository struct {
+	keys map[string]uuid.UUID
+}
+
+func (m *mockMemoImportRepository) IsImported(ctx context.Context, sourceKey string) (bool, error) {
+	_, ok := m.keys[sourceKey]
+	return ok, nil
+}
+
+func (m *mockMemoImportRepository) MarkImported(ctx context.Context, sourceKey, sourcePath string, memoID uuid.UUID) error {
+	m.keys[sourceKey] = memoID
+	return nil
+}
+
+type sliceImportSource []ImportItem
+
+func (s sliceImportSource) Each(ctx context.Context, fn func(ImportItem) error) error {
+	for _, it := range s {
+		if err := fn(it); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestImport_ReportAndResume(t *testing.T) {
+	created := time.Date(2023, 4, 1, 9, 0, 0, 0, time.UTC)
+	src := sliceImportSource{
+		{Path: "a.md", SourceID: "5f0c6c1e-2b57-4b0e-9a53-2f7b1c0d9e11", Title: "a", Body: "hello", Tags: []string{"#go", "go", " notes "}, CreatedAt: created},
+		{Path: "big.md", Body: strings.Repeat("x", 2001)},
+		{Path: "tags.md", Body: "many", Tags: strings.Split("1,2,3,4,5,6,7,8,9,10,11", ",")},
+	}
+	repo := &mockMemoRepository{}
+	imports := &mockMemoImportRepository{keys: map[string]uuid.UUID{}}
+	u := NewImportUsecase(repo, nil, &mockTransactor{}, nil, nil, nil, imports, nil, DefaultMemoLimits)
+
+	report, err := u.Import(context.Background(), src, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !report.DryRun || report.Imported != 1 || report.Failed != 2 || report.ReassignedIDs != 1 || repo.memo != nil {
+		t.Fatalf("unexpected dry run report %+v", report)
+	}
+	if report.Errors[0].Path != "big.md" || !strings.Contains(report.Errors[0].Error, "max 2000") {
+		t.Fatalf("unexpected errors %+v", report.Errors)
+	}
+
+	report, err = u.Import(context.Background(), src, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Imported != 1 || report.Failed != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	m := repo.memo
+	if m == nil || m.ID.String() == src[0].SourceID || !m.CreatedAt.Equal(created) || !m.UpdatedAt.Equal(created) || strings.Join(m.Tags, ",") != "go,notes" {
+		t.Fatalf("unexpected memo %+v", m)
+	}
+
+	report, err = u.Import(context.Background(), src, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Imported != 0 || report.Skipped != 1 {
+		t.Fatalf("expected resumed import to skip, got %+v", report)
+	}
+}
+
+type mockAttachmentRepository struct {
+	saved map[string][]byte
+}
+
+func (m *mockAttachmentRepository) Save(ctx context.Context, name string, data []byte) error {
+	m.saved[name] = data
+	return nil
+}
+
+func TestImport_Attachments(t *testing.T) {
+	src := sliceImportSource{{Path: "n.enex#1", Body: "![a](/attachments/h.png)", Attachments: []ImportAttachment{{Name: "h.png", Data: []byte("png")}}}}
+	attachments := &mockAttachmentRepository{saved: map[string][]byte{}}
+	u := NewImportUsecase(&mockMemoRepository{}, nil, nil, nil, nil, nil, &mockMemoImportRepository{keys: map[string]uuid.UUID{}}, attachments, DefaultMemoLimits)
+
+	report, err := u.Import(context.Background(), src, true)
+	if err != nil || report.Attachments != 1 || len(attachments.saved) != 0 {
+		t.Fatalf("unexpected dry run %+v %v", report, err)
+	}
+	if _, err := u.Import(context.Background(), src, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(attachments.saved["h.png"]) != "png" {
+		t.Fatalf("attachment not saved: %v", attachments.saved)
+	}
+}
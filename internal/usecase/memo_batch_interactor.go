@@ -0,0 +1,121 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidBatch = errors.New("invalid batch")
+var ErrBatchAborted = errors.New("batch aborted")
+
+// ErrAtomicBatchUnsupported is returned for atomic batches on a backend
+// without transactions, which could not roll back earlier operations.
+var ErrAtomicBatchUnsupported = errors.New("atomic batches are not supported by this storage backend")
+
+const MaxBatchOperations = 100
+
+type BatchOp string
+
+const (
+	BatchCreate    BatchOp = "create"
+	BatchUpdate    BatchOp = "update"
+	BatchDelete    BatchOp = "delete"
+	BatchAddTag    BatchOp = "add_tag"
+	BatchRemoveTag BatchOp = "remove_tag"
+)
+
+type BatchOperation struct {
+	Op    BatchOp
+	ID    uuid.UUID
+	Title string
+	Body  string
+	Tags  []string
+	Tag   string
+}
+
+// BatchResult holds the outcome of one operation. In atomic mode every
+// operation that did not itself fail reports ErrBatchAborted once any
+// operation fails, because its effects were rolled back.
+type BatchResult struct {
+	ID  uuid.UUID
+	Err error
+}
+
+func (u *memoUsecase) Batch(ctx context.Context, ops []BatchOperation, atomic bool) ([]BatchResult, error) {
+	if len(ops) == 0 || len(ops) > MaxBatchOperations {
+		return nil, ErrInvalidBatch
+	}
+	results := make([]BatchResult, len(ops))
+	if !atomic {
+		for i, op := range ops {
+			results[i] = u.applyBatchOperation(ctx, op)
+		}
+		return results, nil
+	}
+	if u.tx == nil {
+		return nil, ErrAtomicBatchUnsupported
+	}
+
+	failed := -1
+	err := u.withinTx(ctx, func(ctx context.Context) error {
+		for i, op := range ops {
+			results[i] = u.applyBatchOperation(ctx, op)
+			if results[i].Err != nil {
+				failed = i
+				return results[i].Err
+			}
+		}
+		return nil
+	})
+	if err != nil && failed < 0 {
+		return nil, err
+	}
+	if failed >= 0 {
+		for i := range results {
+			if i != failed {
+				results[i].Err = ErrBatchAborted
+			}
+		}
+	}
+	return results, nil
+}
+
+func (u *memoUsecase) applyBatchOperation(ctx context.Context, op BatchOperation) BatchResult {
+	switch op.Op {
+	case BatchCreate:
+		id, err := u.CreateMemo(ctx, op.Title, op.Body, op.Tags)
+		return BatchResult{ID: id, Err: err}
+	case BatchUpdate:
+		return BatchResult{ID: op.ID, Err: u.UpdateMemo(ctx, op.ID, op.Title, op.Body, op.Tags)}
+	case BatchDelete:
+		return BatchResult{ID: op.ID, Err: u.DeleteMemo(ctx, op.ID)}
+	case BatchAddTag, BatchRemoveTag:
+		return BatchResult{ID: op.ID, Err: u.retag(ctx, op)}
+	default:
+		return BatchResult{ID: op.ID, Err: ErrInvalidBatch}
+	}
+}
+
+func (u *memoUsecase) retag(ctx context.Context, op BatchOperation) error {
+	memo, err := u.GetMemo(ctx, op.ID)
+	if err != nil {
+		return err
+	}
+	tags := make([]string, 0, len(memo.Tags)+1)
+	found := false
+	for _, t := range memo.Tags {
+		if t == op.Tag {
+			found = true
+			if op.Op == BatchRemoveTag {
+				continue
+			}
+		}
+		tags = append(tags, t)
+	}
+	if op.Op == BatchAddTag && !found {
+		tags = append(tags, op.Tag)
+	}
+	return u.UpdateMemo(ctx, memo.ID, memo.Title, memo.Body, tags)
+}
@@ -0,0 +1,91 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/peconote/peconote/internal/domain"
+)
+
+type mockTransactor struct {
+	calls int
+}
+
+func (m *mockTransactor) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	m.calls++
+	return fn(ctx)
+}
+
+func TestBatch_Atomic(t *testing.T) {
+	tx := &mockTransactor{}
+	u := NewMemoUsecase(&mockMemoRepository{}, nil, tx, nil, nil, nil, DefaultMemoLimits)
+	results, err := u.Batch(context.Background(), []BatchOperation{
+		{Op: BatchCreate, Body: "a"},
+		{Op: BatchCreate, Body: ""},
+		{Op: BatchDelete, ID: uuid.New()},
+	}, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !errors.Is(results[0].Err, ErrBatchAborted) || !errors.Is(results[1].Err, ErrInvalidMemo) || !errors.Is(results[2].Err, ErrBatchAborted) {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	if tx.calls == 0 {
+		t.Fatalf("expected a transaction")
+	}
+}
+
+func TestBatch_AtomicWithoutTransactor(t *testing.T) {
+	repo := &mockMemoRepository{}
+	u := NewMemoUsecase(repo, nil, nil, nil, nil, nil, DefaultMemoLimits)
+	_, err := u.Batch(context.Background(), []BatchOperation{{Op: BatchCreate, Body: "a"}, {Op: BatchCreate, Body: ""}}, true)
+	if !errors.Is(err, ErrAtomicBatchUnsupported) {
+		t.Fatalf("expected unsupported error, got %v", err)
+	}
+	if repo.memo != nil {
+		t.Fatalf("expected no operation to run")
+	}
+}
+
+func TestBatch_BestEffort(t *testing.T) {
+	u := NewMemoUsecase(&mockMemoRepository{err: sql.ErrNoRows}, nil, nil, nil, nil, nil, DefaultMemoLimits)
+	results, err := u.Batch(context.Background(), []BatchOperation{
+		{Op: BatchCreate, Body: ""},
+		{Op: BatchDelete, ID: uuid.New()},
+	}, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !errors.Is(results[0].Err, ErrInvalidMemo) || !errors.Is(results[1].Err, ErrMemoNotFound) {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+}
+
+func TestBatch_Retag(t *testing.T) {
+	id := uuid.New()
+	repo := &mockMemoRepository{memo: &domain.Memo{ID: id, Title: "t", Body: "b", Tags: []string{"a", "b"}}}
+	u := NewMemoUsecase(repo, nil, nil, nil, nil, nil, DefaultMemoLimits)
+	results, err := u.Batch(context.Background(), []BatchOperation{
+		{Op: BatchRemoveTag, ID: id, Tag: "a"},
+		{Op: BatchAddTag, ID: id, Tag: "c"},
+	}, false)
+	if err != nil || results[0].Err != nil || results[1].Err != nil {
+		t.Fatalf("unexpected error: %v %+v", err, results)
+	}
+	if got := repo.memo.Tags; len(got) != 2 || got[0] != "b" || got[1] != "c" {
+		t.Fatalf("unexpected tags %v", got)
+	}
+}
+
+func TestBatch_Validation(t *testing.T) {
+	u := NewMemoUsecase(&mockMemoRepository{}, nil, nil, nil, nil, nil, DefaultMemoLimits)
+	if _, err := u.Batch(context.Background(), nil, true); !errors.Is(err, ErrInvalidBatch) {
+		t.Fatalf("expected validation error")
+	}
+	if _, err := u.Batch(context.Background(), make([]BatchOperation, MaxBatchOperations+1), true); !errors.Is(err, ErrInvalidBatch) {
+		t.Fatalf("expected validation error")
+	}
+}
@@ -0,0 +1,142 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/domain/repository"
+)
+
+const memoEventReplayPage = 500
+
+// MemoEventBus fans committed memo events out to live subscribers.
+type MemoEventBus interface {
+	Publish(e domain.MemoEvent)
+	// Subscribe returns the events published from now on. The channel is
+	// closed when cancel is called or when the subscriber falls too far
+	// behind; it should then resume from the event log.
+	Subscribe() (events <-chan domain.MemoEvent, cancel func())
+}
+
+type userIDKey struct{}
+
+// WithUserID attaches the id of the user making a request to ctx. Memo
+// events record it so that subscribers can filter by user.
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDKey{}, userID)
+}
+
+func UserIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(userIDKey{}).(string)
+	return id
+}
+
+type MemoEventQuery struct {
+	// After resumes after the event with this id. When nil only events
+	// published from now on are sent.
+	After  *int64
+	UserID string
+}
+
+type MemoEventUsecase interface {
+	// StreamEvents sends matching events, first from the log and then live,
+	// until ctx is done or the stream falls behind. The channel is closed
+	// when streaming stops. A resumed stream may repeat events up to
+	// MemoEventResumeWindow ids before After.
+	StreamEvents(ctx context.Context, q MemoEventQuery) (<-chan domain.MemoEvent, error)
+}
+
+type memoEventUsecase struct {
+	repo repository.MemoEventRepository
+	bus  MemoEventBus
+}
+
+func NewMemoEventUsecase(r repository.MemoEventRepository, bus MemoEventBus) MemoEventUsecase {
+	return &memoEventUsecase{repo: r, bus: bus}
+}
+
+func (u *memoEventUsecase) StreamEvents(ctx context.Context, q MemoEventQuery) (<-chan domain.MemoEvent, error) {
+	// Subscribe before reading the log so nothing committed in between is
+	// missed; duplicates are dropped by id below.
+	var live <-chan domain.MemoEvent
+	cancel := func() {}
+	if u.bus != nil {
+		live, cancel = u.bus.Subscribe()
+	}
+	var backlog []domain.MemoEvent
+	if q.After != nil {
+		// Events committed after the client's last one can have lower ids,
+		// so the replay starts a window below it.
+		from := *q.After - repository.MemoEventResumeWindow
+		if from < 0 {
+			from = 0
+		}
+		var err error
+		if backlog, err = u.repo.ListAfter(ctx, from, memoEventReplayPage); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+
+	out := make(chan domain.MemoEvent)
+	go func() {
+		defer close(out)
+		defer cancel()
+		send := func(e domain.MemoEvent) bool {
+			if q.UserID != "" && e.UserID != q.UserID {
+				return true
+			}
+			select {
+			case out <- e:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		// Live events are dropped when they were replayed. Ids far enough
+		// below the replayed ones cannot arrive live again and are
+		// forgotten.
+		replayed := map[int64]bool{}
+		var last int64
+		for len(backlog) > 0 {
+			for _, e := range backlog {
+				if !send(e) {
+					return
+				}
+				replayed[e.ID] = true
+				last = e.ID
+			}
+			for id := range replayed {
+				if id <= last-repository.MemoEventResumeWindow {
+					delete(replayed, id)
+				}
+			}
+			if len(backlog) < memoEventReplayPage {
+				break
+			}
+			var err error
+			if backlog, err = u.repo.ListAfter(ctx, last, memoEventReplayPage); err != nil {
+				return
+			}
+		}
+
+		for {
+			select {
+			case e, ok := <-live:
+				if !ok {
+					return
+				}
+				if replayed[e.ID] {
+					continue
+				}
+				if !send(e) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
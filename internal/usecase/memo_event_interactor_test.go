@@ -0,0 +1,144 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/peconote/peconote/internal/domain"
+)
+
+type mockMemoEventRepository struct {
+	events []domain.MemoEvent
+}
+
+func (m *mockMemoEventRepository) Append(ctx context.Context, e *domain.MemoEvent) error {
+	e.ID = int64(len(m.events) + 1)
+	for _, prev := range m.events {
+		if prev.MemoID == e.MemoID {
+			e.Version = prev.Version
+		}
+	}
+	e.Version++
+	m.events = append(m.events, *e)
+	return nil
+}
+
+func (m *mockMemoEventRepository) ListAfter(ctx context.Context, afterID int64, limit int) ([]domain.MemoEvent, error) {
+	var out []domain.MemoEvent
+	for _, e := range m.events {
+		if e.ID > afterID && len(out) < limit {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockMemoEventRepository) LastID(ctx context.Context) (int64, error) {
+	return int64(len(m.events)), nil
+}
+
+type mockMemoEventBus struct {
+	published []domain.MemoEvent
+	ch        chan domain.MemoEvent
+}
+
+func (m *mockMemoEventBus) Publish(e domain.MemoEvent) {
+	m.published = append(m.published, e)
+	if m.ch != nil {
+		m.ch <- e
+	}
+}
+
+func (m *mockMemoEventBus) Subscribe() (<-chan domain.MemoEvent, func()) {
+	return m.ch, func() {}
+}
+
+type failingTransactor struct{}
+
+func (failingTransactor) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := fn(ctx); err != nil {
+		return err
+	}
+	return errors.New("commit failed")
+}
+
+func TestMemoEvents_PublishedAfterCommit(t *testing.T) {
+	events := &mockMemoEventRepository{}
+	bus := &mockMemoEventBus{}
+	u := NewMemoUsecase(&mockMemoRepository{}, nil, &mockTransactor{}, events, nil, bus, DefaultMemoLimits)
+	ctx := WithUserID(context.Background(), "alice")
+
+	id, err := u.CreateMemo(ctx, "", "hello", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := u.UpdateMemo(ctx, id, "", "hello again", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(bus.published) != 2 || bus.published[1].Type != domain.MemoEventUpdated || bus.published[1].Version != 2 || bus.published[1].UserID != "alice" {
+		t.Fatalf("unexpected events %+v", bus.published)
+	}
+
+	u = NewMemoUsecase(&mockMemoRepository{memo: &domain.Memo{ID: id}}, nil, failingTransactor{}, events, nil, bus, DefaultMemoLimits)
+	if err := u.DeleteMemo(ctx, id); err == nil {
+		t.Fatalf("expected commit error")
+	}
+	if len(bus.published) != 2 {
+		t.Fatalf("rolled back change was published: %+v", bus.published)
+	}
+}
+
+func TestMemoEvents_AtomicBatchPublishesOnce(t *testing.T) {
+	bus := &mockMemoEventBus{}
+	u := NewMemoUsecase(&mockMemoRepository{}, nil, &mockTransactor{}, &mockMemoEventRepository{}, nil, bus, DefaultMemoLimits)
+	results, err := u.Batch(context.Background(), []BatchOperation{{Op: BatchCreate, Body: "a"}, {Op: BatchCreate, Body: ""}}, true)
+	if err != nil || results[1].Err == nil {
+		t.Fatalf("unexpected batch result %+v %v", results, err)
+	}
+	if len(bus.published) != 0 {
+		t.Fatalf("events of an aborted batch were published: %+v", bus.published)
+	}
+}
+
+func TestStreamEvents_ResumeAndFilter(t *testing.T) {
+	repo := &mockMemoEventRepository{}
+	for _, user := range []string{"alice", "bob", "alice"} {
+		repo.Append(context.Background(), &domain.MemoEvent{Type: domain.MemoEventCreated, UserID: user})
+	}
+	bus := &mockMemoEventBus{ch: make(chan domain.MemoEvent, 4)}
+	u := NewMemoEventUsecase(repo, bus)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	after := int64(1)
+	events, err := u.StreamEvents(ctx, MemoEventQuery{After: &after, UserID: "alice"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Event 3 is both in the log and delivered live; it must be sent once.
+	// Event 4 commits after event 5 and is still sent.
+	bus.Publish(repo.events[2])
+	bus.Publish(domain.MemoEvent{ID: 5, UserID: "alice"})
+	bus.Publish(domain.MemoEvent{ID: 6, UserID: "bob"})
+	bus.Publish(domain.MemoEvent{ID: 4, UserID: "alice"})
+
+	var got []int64
+	timeout := time.After(time.Second)
+	for len(got) < 4 {
+		select {
+		case e := <-events:
+			got = append(got, e.ID)
+		case <-timeout:
+			t.Fatalf("timed out, got %v", got)
+		}
+	}
+	// Event 1 is in the window replayed below the resume point.
+	if got[0] != 1 || got[1] != 3 || got[2] != 5 || got[3] != 4 {
+		t.Fatalf("unexpected events %v", got)
+	}
+	cancel()
+	for range events {
+	}
+}
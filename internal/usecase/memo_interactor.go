@@ -4,8 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/peconote/peconote/internal/domain"
@@ -16,63 +18,142 @@ import (
 var ErrInvalidMemo = errors.New("invalid memo")
 var ErrInvalidMemoQuery = errors.New("invalid memo query")
 var ErrMemoNotFound = errors.New("memo not found")
+var ErrMemoConflict = errors.New("memo was changed concurrently")
+
+// ErrLinksUnsupported is returned for link queries on a backend that does
+// not store links.
+var ErrLinksUnsupported = errors.New("links are not supported by this storage backend")
+
+// MemoLimits bounds the size of memos and of listing pages.
+type MemoLimits struct {
+	// MaxBodyBytes is the maximum size of a memo body in bytes.
+	MaxBodyBytes int
+	MaxTags      int
+	MaxPageSize  int
+}
+
+var DefaultMemoLimits = MemoLimits{MaxBodyBytes: domain.MaxBodyBytes, MaxTags: 10, MaxPageSize: 100}
 
 type MemoUsecase interface {
-	CreateMemo(ctx context.Context, body string, tags []string) (uuid.UUID, error)
-	ListMemos(ctx context.Context, page, pageSize int, tag *string) ([]*domain.Memo, *model.Pagination, error)
+	CreateMemo(ctx context.Context, title, body string, tags []string) (uuid.UUID, error)
+	ListMemos(ctx context.Context, page, pageSize int, f model.MemoFilter, sort model.MemoSort) ([]*domain.Memo, *model.Pagination, error)
 	GetMemo(ctx context.Context, id uuid.UUID) (*domain.Memo, error)
-	UpdateMemo(ctx context.Context, id uuid.UUID, body string, tags []string) error
+	UpdateMemo(ctx context.Context, id uuid.UUID, title, body string, tags []string) error
+	// ReplaceMemoBody sets the body of a memo whose body is still base,
+	// keeping its title and tags, and returns ErrMemoConflict otherwise.
+	ReplaceMemoBody(ctx context.Context, id uuid.UUID, base, body string) error
 	DeleteMemo(ctx context.Context, id uuid.UUID) error
+	SetMemoFlag(ctx context.Context, id uuid.UUID, flag domain.MemoFlag, value bool) error
+	ListLinks(ctx context.Context, id uuid.UUID) ([]domain.MemoLink, error)
+	ListBacklinks(ctx context.Context, id uuid.UUID) ([]domain.MemoLink, error)
+	ListBrokenLinks(ctx context.Context) ([]domain.MemoLink, error)
+	Batch(ctx context.Context, ops []BatchOperation, atomic bool) ([]BatchResult, error)
 }
 
 type memoUsecase struct {
-	repo repository.MemoRepository
+	repo   repository.MemoRepository
+	links  repository.MemoLinkRepository
+	tx     repository.Transactor
+	events repository.MemoEventRepository
+	outbox repository.OutboxRepository
+	bus    MemoEventBus
+	limits MemoLimits
 }
 
-func NewMemoUsecase(r repository.MemoRepository) MemoUsecase {
-	return &memoUsecase{repo: r}
+func NewMemoUsecase(r repository.MemoRepository, lr repository.MemoLinkRepository, tx repository.Transactor, er repository.MemoEventRepository, ob repository.OutboxRepository, bus MemoEventBus, limits MemoLimits) MemoUsecase {
+	return &memoUsecase{repo: r, links: lr, tx: tx, events: er, outbox: ob, bus: bus, limits: limits}
 }
 
-func (u *memoUsecase) CreateMemo(ctx context.Context, body string, tags []string) (uuid.UUID, error) {
-	if strings.TrimSpace(body) == "" || len(body) > 2000 {
-		return uuid.Nil, ErrInvalidMemo
-	}
-	if len(tags) > 10 {
-		return uuid.Nil, ErrInvalidMemo
-	}
-	for _, t := range tags {
-		if l := len(t); l < 1 || l > 30 {
-			return uuid.Nil, ErrInvalidMemo
-		}
+func (u *memoUsecase) CreateMemo(ctx context.Context, title, body string, tags []string) (uuid.UUID, error) {
+	if err := validateMemo(u.limits, title, body, tags); err != nil {
+		return uuid.Nil, err
 	}
 	id := uuid.New()
 	now := time.Now().UTC()
 	memo := &domain.Memo{
 		ID:        id,
+		Title:     memoTitle(title, body),
 		Body:      body,
 		Tags:      tags,
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
-	if err := u.repo.Create(ctx, memo); err != nil {
+	err := u.withinTx(ctx, func(ctx context.Context) error {
+		if err := u.repo.Create(ctx, memo); err != nil {
+			return err
+		}
+		if err := u.syncLinks(ctx, id, memo.Title, body); err != nil {
+			return err
+		}
+		return u.recordEvent(ctx, domain.MemoEventCreated, memo)
+	})
+	if err != nil {
 		return uuid.Nil, err
 	}
 	return id, nil
 }
 
-func (u *memoUsecase) ListMemos(ctx context.Context, page, pageSize int, tag *string) ([]*domain.Memo, *model.Pagination, error) {
-	if pageSize < 1 || pageSize > 100 {
-		return nil, nil, ErrInvalidMemoQuery
+func validateMemo(limits MemoLimits, title, body string, tags []string) error {
+	if utf8.RuneCountInString(title) > domain.MaxTitleLength {
+		return fmt.Errorf("%w: title exceeds %d characters", ErrInvalidMemo, domain.MaxTitleLength)
+	}
+	if strings.TrimSpace(body) == "" {
+		return fmt.Errorf("%w: body is empty", ErrInvalidMemo)
 	}
-	if tag != nil {
-		t := strings.TrimSpace(*tag)
+	if len(body) > limits.MaxBodyBytes {
+		return fmt.Errorf("%w: body is %d bytes, max %d", ErrInvalidMemo, len(body), limits.MaxBodyBytes)
+	}
+	if len(tags) > limits.MaxTags {
+		return fmt.Errorf("%w: %d tags, max %d", ErrInvalidMemo, len(tags), limits.MaxTags)
+	}
+	for _, t := range tags {
+		if l := len(t); l < 1 || l > 30 {
+			return fmt.Errorf("%w: tag %q must be 1 to 30 bytes", ErrInvalidMemo, t)
+		}
+	}
+	return nil
+}
+
+func memoTitle(title, body string) string {
+	if t := strings.TrimSpace(title); t != "" {
+		return t
+	}
+	return domain.DeriveTitle(body)
+}
+
+func (u *memoUsecase) ListMemos(ctx context.Context, page, pageSize int, f model.MemoFilter, sort model.MemoSort) ([]*domain.Memo, *model.Pagination, error) {
+	if pageSize < 1 || pageSize > u.limits.MaxPageSize {
+		return nil, nil, fmt.Errorf("%w: page_size must be 1 to %d", ErrInvalidMemoQuery, u.limits.MaxPageSize)
+	}
+	if f.Tag != nil {
+		t := strings.TrimSpace(*f.Tag)
 		if t == "" || len(t) > 30 {
 			return nil, nil, ErrInvalidMemoQuery
 		}
-		*tag = t
+		f.Tag = &t
+	}
+	if f.Search != nil {
+		q := strings.TrimSpace(*f.Search)
+		if q == "" || len(q) > 200 {
+			return nil, nil, ErrInvalidMemoQuery
+		}
+		f.Search = &q
+	}
+	if f.Archived == nil {
+		archived := false
+		f.Archived = &archived
+	}
+	if !validTimeRange(f.CreatedAfter, f.CreatedBefore) || !validTimeRange(f.UpdatedAfter, f.UpdatedBefore) {
+		return nil, nil, ErrInvalidMemoQuery
+	}
+	if sort.Field == "" {
+		sort = model.DefaultMemoSort
+	}
+	if sort.Field == model.MemoSortRelevance && f.Search == nil {
+		return nil, nil, ErrInvalidMemoQuery
 	}
 	offset := (page - 1) * pageSize
-	items, total, err := u.repo.List(ctx, tag, pageSize, offset)
+	items, total, err := u.repo.List(ctx, f, sort, pageSize, offset)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -85,10 +166,15 @@ func (u *memoUsecase) ListMemos(ctx context.Context, page, pageSize int, tag *st
 		PageSize:   pageSize,
 		TotalPages: totalPages,
 		TotalCount: total,
+		Sort:       sort.String(),
 	}
 	return items, p, nil
 }
 
+func validTimeRange(after, before *time.Time) bool {
+	return after == nil || before == nil || after.Before(*before)
+}
+
 func (u *memoUsecase) GetMemo(ctx context.Context, id uuid.UUID) (*domain.Memo, error) {
 	memo, err := u.repo.Get(ctx, id)
 	if err != nil {
@@ -100,39 +186,210 @@ func (u *memoUsecase) GetMemo(ctx context.Context, id uuid.UUID) (*domain.Memo,
 	return memo, nil
 }
 
-func (u *memoUsecase) UpdateMemo(ctx context.Context, id uuid.UUID, body string, tags []string) error {
-	if strings.TrimSpace(body) == "" || len(body) > 2000 {
-		return ErrInvalidMemo
-	}
-	if len(tags) > 10 {
-		return ErrInvalidMemo
-	}
-	for _, t := range tags {
-		if l := len(t); l < 1 || l > 30 {
-			return ErrInvalidMemo
-		}
+func (u *memoUsecase) UpdateMemo(ctx context.Context, id uuid.UUID, title, body string, tags []string) error {
+	if err := validateMemo(u.limits, title, body, tags); err != nil {
+		return err
 	}
 	memo := &domain.Memo{
 		ID:        id,
+		Title:     memoTitle(title, body),
 		Body:      body,
 		Tags:      tags,
 		UpdatedAt: time.Now().UTC(),
 	}
-	if err := u.repo.Update(ctx, memo); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return ErrMemoNotFound
+	return u.withinTx(ctx, func(ctx context.Context) error {
+		if err := u.repo.Update(ctx, memo); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrMemoNotFound
+			}
+			return err
+		}
+		if err := u.syncLinks(ctx, id, memo.Title, body); err != nil {
+			return err
 		}
+		return u.recordChange(ctx, domain.MemoEventUpdated, id)
+	})
+}
+
+func (u *memoUsecase) ReplaceMemoBody(ctx context.Context, id uuid.UUID, base, body string) error {
+	if err := validateMemo(u.limits, "", body, nil); err != nil {
 		return err
 	}
-	return nil
+	return u.withinTx(ctx, func(ctx context.Context) error {
+		if err := u.repo.UpdateBody(ctx, id, base, body, time.Now().UTC()); err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrMemoNotFound
+			case errors.Is(err, repository.ErrMemoChanged):
+				return ErrMemoConflict
+			}
+			return err
+		}
+		memo, err := u.GetMemo(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := u.syncLinks(ctx, id, memo.Title, body); err != nil {
+			return err
+		}
+		return u.recordEvent(ctx, domain.MemoEventUpdated, memo)
+	})
 }
 
 func (u *memoUsecase) DeleteMemo(ctx context.Context, id uuid.UUID) error {
-	if err := u.repo.Delete(ctx, id); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return ErrMemoNotFound
+	return u.withinTx(ctx, func(ctx context.Context) error {
+		memo, err := u.eventMemo(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := u.repo.Delete(ctx, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrMemoNotFound
+			}
+			return err
 		}
+		return u.recordEvent(ctx, domain.MemoEventDeleted, memo)
+	})
+}
+
+func (u *memoUsecase) SetMemoFlag(ctx context.Context, id uuid.UUID, flag domain.MemoFlag, value bool) error {
+	switch flag {
+	case domain.MemoFlagPinned, domain.MemoFlagArchived, domain.MemoFlagFavorite:
+	default:
+		return ErrInvalidMemo
+	}
+	return u.withinTx(ctx, func(ctx context.Context) error {
+		if err := u.repo.SetFlag(ctx, id, flag, value); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrMemoNotFound
+			}
+			return err
+		}
+		return u.recordChange(ctx, domain.MemoEventUpdated, id)
+	})
+}
+
+func (u *memoUsecase) ListLinks(ctx context.Context, id uuid.UUID) ([]domain.MemoLink, error) {
+	if u.links == nil {
+		return nil, ErrLinksUnsupported
+	}
+	if _, err := u.GetMemo(ctx, id); err != nil {
+		return nil, err
+	}
+	return u.links.ListOutgoing(ctx, id)
+}
+
+func (u *memoUsecase) ListBacklinks(ctx context.Context, id uuid.UUID) ([]domain.MemoLink, error) {
+	if u.links == nil {
+		return nil, ErrLinksUnsupported
+	}
+	if _, err := u.GetMemo(ctx, id); err != nil {
+		return nil, err
+	}
+	return u.links.ListBacklinks(ctx, id)
+}
+
+func (u *memoUsecase) ListBrokenLinks(ctx context.Context) ([]domain.MemoLink, error) {
+	if u.links == nil {
+		return nil, ErrLinksUnsupported
+	}
+	return u.links.ListBroken(ctx)
+}
+
+// withinTx runs fn in a transaction. Events recorded by fn are published
+// once the outermost withinTx has committed, so subscribers never see
+// changes that were rolled back.
+func (u *memoUsecase) withinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(pendingEventsKey{}).(*pendingEvents); ok {
+		return u.runTx(ctx, fn)
+	}
+	pending := &pendingEvents{}
+	if err := u.runTx(context.WithValue(ctx, pendingEventsKey{}, pending), fn); err != nil {
 		return err
 	}
+	if u.bus != nil {
+		for _, e := range pending.events {
+			u.bus.Publish(e)
+		}
+	}
+	return nil
+}
+
+func (u *memoUsecase) runTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if u.tx == nil {
+		return fn(ctx)
+	}
+	return u.tx.WithinTx(ctx, fn)
+}
+
+type pendingEventsKey struct{}
+
+type pendingEvents struct {
+	events []domain.MemoEvent
+}
+
+// recordEvent logs a change of memo and stores it in the outbox, both in
+// the transaction that made the change.
+func (u *memoUsecase) recordEvent(ctx context.Context, typ domain.MemoEventType, memo *domain.Memo) error {
+	if memo == nil {
+		return nil
+	}
+	e := domain.MemoEvent{Type: typ, MemoID: memo.ID, Tags: memo.Tags, UserID: UserIDFromContext(ctx), CreatedAt: time.Now().UTC()}
+	if u.events != nil {
+		if err := u.events.Append(ctx, &e); err != nil {
+			return err
+		}
+		if pending, ok := ctx.Value(pendingEventsKey{}).(*pendingEvents); ok {
+			pending.events = append(pending.events, e)
+		}
+	}
+	if u.outbox != nil {
+		m, err := NewOutboxMessage(domain.NewMemoDomainEvent(e, *memo), e.CreatedAt)
+		if err != nil {
+			return err
+		}
+		return u.outbox.Append(ctx, m)
+	}
 	return nil
 }
+
+// recordChange records an event with the memo as it is after the change.
+func (u *memoUsecase) recordChange(ctx context.Context, typ domain.MemoEventType, id uuid.UUID) error {
+	memo, err := u.eventMemo(ctx, id)
+	if err != nil {
+		return err
+	}
+	return u.recordEvent(ctx, typ, memo)
+}
+
+// eventMemo loads a memo for an event when changes are logged.
+func (u *memoUsecase) eventMemo(ctx context.Context, id uuid.UUID) (*domain.Memo, error) {
+	if u.events == nil && u.outbox == nil {
+		return nil, nil
+	}
+	return u.GetMemo(ctx, id)
+}
+
+// syncLinks stores the links of the memo's body and points the broken links
+// of other memos that name it at the memo.
+func (u *memoUsecase) syncLinks(ctx context.Context, id uuid.UUID, title, body string) error {
+	if u.links == nil {
+		return nil
+	}
+	if err := u.links.Retarget(ctx, id, title); err != nil {
+		return err
+	}
+	refs := domain.ParseLinkRefs(body)
+	resolved, err := u.links.Resolve(ctx, refs)
+	if err != nil {
+		return err
+	}
+	links := make([]domain.MemoLink, len(refs))
+	for i, ref := range refs {
+		links[i] = domain.MemoLink{SourceID: id, TargetRef: ref}
+		if target, ok := resolved[ref]; ok {
+			links[i].TargetID = &target
+		}
+	}
+	return u.links.Replace(ctx, id, links)
+}
@@ -4,18 +4,23 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/domain/model"
+	"github.com/peconote/peconote/internal/domain/repository"
 )
 
 type mockMemoRepository struct {
-	memo      *domain.Memo
-	err       error
-	listItems []*domain.Memo
-	total     int
+	memo       *domain.Memo
+	err        error
+	listItems  []*domain.Memo
+	total      int
+	listFilter model.MemoFilter
+	listSort   model.MemoSort
 }
 
 func (m *mockMemoRepository) Create(ctx context.Context, mem *domain.Memo) error {
@@ -23,7 +28,9 @@ func (m *mockMemoRepository) Create(ctx context.Context, mem *domain.Memo) error
 	return m.err
 }
 
-func (m *mockMemoRepository) List(ctx context.Context, tag *string, limit, offset int) ([]*domain.Memo, int, error) {
+func (m *mockMemoRepository) List(ctx context.Context, f model.MemoFilter, sort model.MemoSort, limit, offset int) ([]*domain.Memo, int, error) {
+	m.listFilter = f
+	m.listSort = sort
 	return m.listItems, m.total, m.err
 }
 
@@ -36,15 +43,49 @@ func (m *mockMemoRepository) Update(ctx context.Context, memo *domain.Memo) erro
 	return m.err
 }
 
+func (m *mockMemoRepository) UpdateBody(ctx context.Context, id uuid.UUID, base, body string, updatedAt time.Time) error {
+	if m.err != nil {
+		return m.err
+	}
+	if m.memo == nil || m.memo.Body != base {
+		return repository.ErrMemoChanged
+	}
+	updated := *m.memo
+	updated.Body, updated.UpdatedAt = body, updatedAt
+	m.memo = &updated
+	return nil
+}
+
 func (m *mockMemoRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	return m.err
 }
 
+func (m *mockMemoRepository) SetFlag(ctx context.Context, id uuid.UUID, flag domain.MemoFlag, value bool) error {
+	return m.err
+}
+
+func (m *mockMemoRepository) Stats(ctx context.Context) (domain.MemoStats, error) {
+	return domain.MemoStats{Memos: m.total}, m.err
+}
+
+func (m *mockMemoRepository) Stream(ctx context.Context, f model.MemoFilter, fn func(*domain.Memo) error) error {
+	m.listFilter = f
+	if m.err != nil {
+		return m.err
+	}
+	for _, memo := range m.listItems {
+		if err := fn(memo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func TestCreateMemo_Success(t *testing.T) {
 	repo := &mockMemoRepository{}
-	u := NewMemoUsecase(repo)
+	u := NewMemoUsecase(repo, nil, nil, nil, nil, nil, DefaultMemoLimits)
 
-	id, err := u.CreateMemo(context.Background(), "hello", []string{"tag"})
+	id, err := u.CreateMemo(context.Background(), "", "hello", []string{"tag"})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -58,48 +99,94 @@ func TestCreateMemo_Success(t *testing.T) {
 
 func TestCreateMemo_Validation(t *testing.T) {
 	repo := &mockMemoRepository{}
-	u := NewMemoUsecase(repo)
+	u := NewMemoUsecase(repo, nil, nil, nil, nil, nil, DefaultMemoLimits)
 
-	_, err := u.CreateMemo(context.Background(), "", nil)
+	_, err := u.CreateMemo(context.Background(), "", "", nil)
 	if !errors.Is(err, ErrInvalidMemo) {
 		t.Fatalf("expected validation error")
 	}
 }
 
+func TestCreateMemo_Limits(t *testing.T) {
+	repo := &mockMemoRepository{}
+	u := NewMemoUsecase(repo, nil, nil, nil, nil, nil, MemoLimits{MaxBodyBytes: 5, MaxTags: 1, MaxPageSize: 30})
+
+	if _, err := u.CreateMemo(context.Background(), "", "123456", nil); !errors.Is(err, ErrInvalidMemo) {
+		t.Fatalf("expected body limit error, got %v", err)
+	}
+	if _, err := u.CreateMemo(context.Background(), "", "12345", []string{"a", "b"}); !errors.Is(err, ErrInvalidMemo) {
+		t.Fatalf("expected tag limit error, got %v", err)
+	}
+	if _, _, err := u.ListMemos(context.Background(), 1, 31, model.MemoFilter{}, model.MemoSort{}); !errors.Is(err, ErrInvalidMemoQuery) {
+		t.Fatalf("expected page size error, got %v", err)
+	}
+	if _, err := u.CreateMemo(context.Background(), "", "12345", []string{"a"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestCreateMemo_Title(t *testing.T) {
+	repo := &mockMemoRepository{}
+	u := NewMemoUsecase(repo, nil, nil, nil, nil, nil, DefaultMemoLimits)
+
+	if _, err := u.CreateMemo(context.Background(), "", "intro\n## Weekly sync ##\nbody", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if repo.memo.Title != "Weekly sync" {
+		t.Fatalf("expected derived title, got %q", repo.memo.Title)
+	}
+	if _, err := u.CreateMemo(context.Background(), " Explicit ", "# Heading", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if repo.memo.Title != "Explicit" {
+		t.Fatalf("expected explicit title, got %q", repo.memo.Title)
+	}
+}
+
 func TestListMemos_Success(t *testing.T) {
 	now := time.Now()
 	repo := &mockMemoRepository{listItems: []*domain.Memo{{ID: uuid.New(), Body: "b", CreatedAt: now, UpdatedAt: now}}, total: 1}
-	u := NewMemoUsecase(repo)
-	items, p, err := u.ListMemos(context.Background(), 1, 20, nil)
+	u := NewMemoUsecase(repo, nil, nil, nil, nil, nil, DefaultMemoLimits)
+	items, p, err := u.ListMemos(context.Background(), 1, 20, model.MemoFilter{}, model.MemoSort{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	if len(items) != 1 || p.TotalCount != 1 {
 		t.Fatalf("unexpected result")
 	}
+	if repo.listFilter.Archived == nil || *repo.listFilter.Archived {
+		t.Fatalf("expected archived memos to be excluded by default")
+	}
+	if repo.listSort != model.DefaultMemoSort || p.Sort != "-created_at" {
+		t.Fatalf("expected default sort, got %+v", repo.listSort)
+	}
 }
 
 func TestListMemos_Validation(t *testing.T) {
 	repo := &mockMemoRepository{}
-	u := NewMemoUsecase(repo)
-	if _, _, err := u.ListMemos(context.Background(), 1, 101, nil); !errors.Is(err, ErrInvalidMemoQuery) {
+	u := NewMemoUsecase(repo, nil, nil, nil, nil, nil, DefaultMemoLimits)
+	if _, _, err := u.ListMemos(context.Background(), 1, 101, model.MemoFilter{}, model.MemoSort{}); !errors.Is(err, ErrInvalidMemoQuery) {
 		t.Fatalf("expected validation error")
 	}
 	tag := ""
-	if _, _, err := u.ListMemos(context.Background(), 1, 10, &tag); !errors.Is(err, ErrInvalidMemoQuery) {
+	if _, _, err := u.ListMemos(context.Background(), 1, 10, model.MemoFilter{Tag: &tag}, model.MemoSort{}); !errors.Is(err, ErrInvalidMemoQuery) {
 		t.Fatalf("expected validation error")
 	}
 	longTag := "1234567890123456789012345678901"
-	if _, _, err := u.ListMemos(context.Background(), 1, 10, &longTag); !errors.Is(err, ErrInvalidMemoQuery) {
+	if _, _, err := u.ListMemos(context.Background(), 1, 10, model.MemoFilter{Tag: &longTag}, model.MemoSort{}); !errors.Is(err, ErrInvalidMemoQuery) {
 		t.Fatalf("expected validation error")
 	}
+	relevance := model.MemoSort{Field: model.MemoSortRelevance}
+	if _, _, err := u.ListMemos(context.Background(), 1, 10, model.MemoFilter{}, relevance); !errors.Is(err, ErrInvalidMemoQuery) {
+		t.Fatalf("expected relevance without search to be rejected")
+	}
 }
 
 func TestGetMemo_Success(t *testing.T) {
 	now := time.Now()
 	memo := &domain.Memo{ID: uuid.New(), Body: "b", CreatedAt: now, UpdatedAt: now}
 	repo := &mockMemoRepository{memo: memo}
-	u := NewMemoUsecase(repo)
+	u := NewMemoUsecase(repo, nil, nil, nil, nil, nil, DefaultMemoLimits)
 	got, err := u.GetMemo(context.Background(), memo.ID)
 	if err != nil || got.ID != memo.ID {
 		t.Fatalf("unexpected result")
@@ -108,7 +195,7 @@ func TestGetMemo_Success(t *testing.T) {
 
 func TestGetMemo_NotFound(t *testing.T) {
 	repo := &mockMemoRepository{err: sql.ErrNoRows}
-	u := NewMemoUsecase(repo)
+	u := NewMemoUsecase(repo, nil, nil, nil, nil, nil, DefaultMemoLimits)
 	if _, err := u.GetMemo(context.Background(), uuid.New()); !errors.Is(err, ErrMemoNotFound) {
 		t.Fatalf("expected not found")
 	}
@@ -116,16 +203,156 @@ func TestGetMemo_NotFound(t *testing.T) {
 
 func TestUpdateMemo_Validation(t *testing.T) {
 	repo := &mockMemoRepository{}
-	u := NewMemoUsecase(repo)
-	if err := u.UpdateMemo(context.Background(), uuid.New(), "", nil); !errors.Is(err, ErrInvalidMemo) {
+	u := NewMemoUsecase(repo, nil, nil, nil, nil, nil, DefaultMemoLimits)
+	if err := u.UpdateMemo(context.Background(), uuid.New(), "", "", nil); !errors.Is(err, ErrInvalidMemo) {
 		t.Fatalf("expected validation error")
 	}
 }
 
+func TestSetMemoFlag(t *testing.T) {
+	u := NewMemoUsecase(&mockMemoRepository{}, nil, nil, nil, nil, nil, DefaultMemoLimits)
+	if err := u.SetMemoFlag(context.Background(), uuid.New(), domain.MemoFlag("hidden"), true); !errors.Is(err, ErrInvalidMemo) {
+		t.Fatalf("expected validation error")
+	}
+	u = NewMemoUsecase(&mockMemoRepository{err: sql.ErrNoRows}, nil, nil, nil, nil, nil, DefaultMemoLimits)
+	if err := u.SetMemoFlag(context.Background(), uuid.New(), domain.MemoFlagPinned, true); !errors.Is(err, ErrMemoNotFound) {
+		t.Fatalf("expected not found")
+	}
+}
+
 func TestDeleteMemo_NotFound(t *testing.T) {
 	repo := &mockMemoRepository{err: sql.ErrNoRows}
-	u := NewMemoUsecase(repo)
+	u := NewMemoUsecase(repo, nil, nil, nil, nil, nil, DefaultMemoLimits)
 	if err := u.DeleteMemo(context.Background(), uuid.New()); !errors.Is(err, ErrMemoNotFound) {
 		t.Fatalf("expected not found")
 	}
 }
+
+type mockMemoLinkRepository struct {
+	resolved map[string]uuid.UUID
+	replaced []domain.MemoLink
+}
+
+func (m *mockMemoLinkRepository) Resolve(ctx context.Context, refs []string) (map[string]uuid.UUID, error) {
+	return m.resolved, nil
+}
+
+func (m *mockMemoLinkRepository) Replace(ctx context.Context, sourceID uuid.UUID, links []domain.MemoLink) error {
+	kept := links
+	for _, l := range m.replaced {
+		if l.SourceID != sourceID {
+			kept = append(kept, l)
+		}
+	}
+	m.replaced = kept
+	return nil
+}
+
+func (m *mockMemoLinkRepository) Retarget(ctx context.Context, targetID uuid.UUID, title string) error {
+	for i, l := range m.replaced {
+		matches := strings.EqualFold(l.TargetRef, title) || strings.EqualFold(l.TargetRef, targetID.String())
+		switch {
+		case l.Broken() && matches:
+			id := targetID
+			m.replaced[i].TargetID = &id
+		case !l.Broken() && *l.TargetID == targetID && !matches:
+			m.replaced[i].TargetID = nil
+		}
+	}
+	return nil
+}
+
+func (m *mockMemoLinkRepository) ListOutgoing(ctx context.Context, sourceID uuid.UUID) ([]domain.MemoLink, error) {
+	return m.replaced, nil
+}
+
+func (m *mockMemoLinkRepository) ListBacklinks(ctx context.Context, targetID uuid.UUID) ([]domain.MemoLink, error) {
+	return nil, nil
+}
+
+func (m *mockMemoLinkRepository) ListBroken(ctx context.Context) ([]domain.MemoLink, error) {
+	return nil, nil
+}
+
+func TestCreateMemo_SyncsLinks(t *testing.T) {
+	target := uuid.New()
+	links := &mockMemoLinkRepository{resolved: map[string]uuid.UUID{"Weekly": target}}
+	u := NewMemoUsecase(&mockMemoRepository{}, links, nil, nil, nil, nil, DefaultMemoLimits)
+
+	if _, err := u.CreateMemo(context.Background(), "", "see [[Weekly]] and [[missing]] and [[weekly]]", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(links.replaced) != 2 {
+		t.Fatalf("expected 2 links got %d", len(links.replaced))
+	}
+	if links.replaced[0].TargetID == nil || *links.replaced[0].TargetID != target {
+		t.Fatalf("expected resolved link")
+	}
+	if !links.replaced[1].Broken() || links.replaced[1].TargetRef != "missing" {
+		t.Fatalf("expected broken link")
+	}
+}
+
+func TestCreateMemo_ResolvesBrokenLinks(t *testing.T) {
+	links := &mockMemoLinkRepository{}
+	u := NewMemoUsecase(&mockMemoRepository{}, links, nil, nil, nil, nil, DefaultMemoLimits)
+
+	if _, err := u.CreateMemo(context.Background(), "", "see [[Later]]", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(links.replaced) != 1 || !links.replaced[0].Broken() {
+		t.Fatalf("expected broken link, got %+v", links.replaced)
+	}
+	id, err := u.CreateMemo(context.Background(), "later", "written second", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(links.replaced) != 1 || links.replaced[0].TargetID == nil || *links.replaced[0].TargetID != id {
+		t.Fatalf("expected link to the new memo, got %+v", links.replaced)
+	}
+}
+
+func TestUpdateMemo_RenameBreaksLinksToOldTitle(t *testing.T) {
+	links := &mockMemoLinkRepository{}
+	repo := &mockMemoRepository{}
+	u := NewMemoUsecase(repo, links, nil, nil, nil, nil, DefaultMemoLimits)
+	ctx := context.Background()
+
+	if _, err := u.CreateMemo(ctx, "", "see [[Plan]]", nil); err != nil {
+		t.Fatal(err)
+	}
+	id, err := u.CreateMemo(ctx, "Plan", "the plan", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if links.replaced[0].Broken() {
+		t.Fatalf("expected link to the plan, got %+v", links.replaced)
+	}
+	repo.memo = &domain.Memo{ID: id, Title: "Plan", Body: "the plan"}
+	if err := u.UpdateMemo(ctx, id, "Roadmap", "the plan", nil); err != nil {
+		t.Fatal(err)
+	}
+	if !links.replaced[0].Broken() || links.replaced[0].TargetRef != "Plan" {
+		t.Fatalf("expected the link to the old title to be broken, got %+v", links.replaced)
+	}
+}
+
+func TestListLinks_Unsupported(t *testing.T) {
+	u := NewMemoUsecase(&mockMemoRepository{memo: &domain.Memo{}}, nil, nil, nil, nil, nil, DefaultMemoLimits)
+	if _, err := u.ListLinks(context.Background(), uuid.New()); !errors.Is(err, ErrLinksUnsupported) {
+		t.Fatalf("expected ErrLinksUnsupported, got %v", err)
+	}
+	if _, err := u.ListBacklinks(context.Background(), uuid.New()); !errors.Is(err, ErrLinksUnsupported) {
+		t.Fatalf("expected ErrLinksUnsupported, got %v", err)
+	}
+	if _, err := u.ListBrokenLinks(context.Background()); !errors.Is(err, ErrLinksUnsupported) {
+		t.Fatalf("expected ErrLinksUnsupported, got %v", err)
+	}
+}
+
+func TestListBacklinks_NotFound(t *testing.T) {
+	u := NewMemoUsecase(&mockMemoRepository{err: sql.ErrNoRows}, &mockMemoLinkRepository{}, nil, nil, nil, nil, DefaultMemoLimits)
+	if _, err := u.ListBacklinks(context.Background(), uuid.New()); !errors.Is(err, ErrMemoNotFound) {
+		t.Fatalf("expected not found")
+	}
+}
@@ -0,0 +1,184 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/domain/model"
+)
+
+// Observer is told about every call of an observed usecase, e.g. to trace
+// it. Start runs before the call; the returned function runs after it with
+// the call's error.
+type Observer interface {
+	Start(ctx context.Context, component, method string) (context.Context, func(err error))
+}
+
+func observe0(ctx context.Context, o Observer, component, method string, fn func(ctx context.Context) error) error {
+	ctx, end := o.Start(ctx, component, method)
+	err := fn(ctx)
+	end(err)
+	return err
+}
+
+func observe1[T any](ctx context.Context, o Observer, component, method string, fn func(ctx context.Context) (T, error)) (T, error) {
+	ctx, end := o.Start(ctx, component, method)
+	v, err := fn(ctx)
+	end(err)
+	return v, err
+}
+
+type observedMemoUsecase struct {
+	u MemoUsecase
+	o Observer
+}
+
+func ObserveMemoUsecase(u MemoUsecase, o Observer) MemoUsecase {
+	return &observedMemoUsecase{u: u, o: o}
+}
+
+func (u *observedMemoUsecase) CreateMemo(ctx context.Context, title, body string, tags []string) (uuid.UUID, error) {
+	return observe1(ctx, u.o, "memo", "CreateMemo", func(ctx context.Context) (uuid.UUID, error) { return u.u.CreateMemo(ctx, title, body, tags) })
+}
+
+func (u *observedMemoUsecase) ListMemos(ctx context.Context, page, pageSize int, f model.MemoFilter, sort model.MemoSort) ([]*domain.Memo, *model.Pagination, error) {
+	var pagination *model.Pagination
+	memos, err := observe1(ctx, u.o, "memo", "ListMemos", func(ctx context.Context) (memos []*domain.Memo, err error) {
+		memos, pagination, err = u.u.ListMemos(ctx, page, pageSize, f, sort)
+		return memos, err
+	})
+	return memos, pagination, err
+}
+
+func (u *observedMemoUsecase) GetMemo(ctx context.Context, id uuid.UUID) (*domain.Memo, error) {
+	return observe1(ctx, u.o, "memo", "GetMemo", func(ctx context.Context) (*domain.Memo, error) { return u.u.GetMemo(ctx, id) })
+}
+
+func (u *observedMemoUsecase) UpdateMemo(ctx context.Context, id uuid.UUID, title, body string, tags []string) error {
+	return observe0(ctx, u.o, "memo", "UpdateMemo", func(ctx context.Context) error { return u.u.UpdateMemo(ctx, id, title, body, tags) })
+}
+
+func (u *observedMemoUsecase) ReplaceMemoBody(ctx context.Context, id uuid.UUID, base, body string) error {
+	return observe0(ctx, u.o, "memo", "ReplaceMemoBody", func(ctx context.Context) error { return u.u.ReplaceMemoBody(ctx, id, base, body) })
+}
+
+func (u *observedMemoUsecase) DeleteMemo(ctx context.Context, id uuid.UUID) error {
+	return observe0(ctx, u.o, "memo", "DeleteMemo", func(ctx context.Context) error { return u.u.DeleteMemo(ctx, id) })
+}
+
+func (u *observedMemoUsecase) SetMemoFlag(ctx context.Context, id uuid.UUID, flag domain.MemoFlag, value bool) error {
+	return observe0(ctx, u.o, "memo", "SetMemoFlag", func(ctx context.Context) error { return u.u.SetMemoFlag(ctx, id, flag, value) })
+}
+
+func (u *observedMemoUsecase) ListLinks(ctx context.Context, id uuid.UUID) ([]domain.MemoLink, error) {
+	return observe1(ctx, u.o, "memo", "ListLinks", func(ctx context.Context) ([]domain.MemoLink, error) { return u.u.ListLinks(ctx, id) })
+}
+
+func (u *observedMemoUsecase) ListBacklinks(ctx context.Context, id uuid.UUID) ([]domain.MemoLink, error) {
+	return observe1(ctx, u.o, "memo", "ListBacklinks", func(ctx context.Context) ([]domain.MemoLink, error) { return u.u.ListBacklinks(ctx, id) })
+}
+
+func (u *observedMemoUsecase) ListBrokenLinks(ctx context.Context) ([]domain.MemoLink, error) {
+	return observe1(ctx, u.o, "memo", "ListBrokenLinks", u.u.ListBrokenLinks)
+}
+
+func (u *observedMemoUsecase) Batch(ctx context.Context, ops []BatchOperation, atomic bool) ([]BatchResult, error) {
+	return observe1(ctx, u.o, "memo", "Batch", func(ctx context.Context) ([]BatchResult, error) { return u.u.Batch(ctx, ops, atomic) })
+}
+
+type observedGraphUsecase struct {
+	u GraphUsecase
+	o Observer
+}
+
+func ObserveGraphUsecase(u GraphUsecase, o Observer) GraphUsecase {
+	return &observedGraphUsecase{u: u, o: o}
+}
+
+func (u *observedGraphUsecase) StreamGraph(ctx context.Context, q GraphQuery, sink GraphSink) error {
+	return observe0(ctx, u.o, "graph", "StreamGraph", func(ctx context.Context) error { return u.u.StreamGraph(ctx, q, sink) })
+}
+
+type observedExportUsecase struct {
+	u ExportUsecase
+	o Observer
+}
+
+func ObserveExportUsecase(u ExportUsecase, o Observer) ExportUsecase {
+	return &observedExportUsecase{u: u, o: o}
+}
+
+func (u *observedExportUsecase) ExportMemos(ctx context.Context, f model.MemoFilter, fn func(*domain.Memo) error) error {
+	return observe0(ctx, u.o, "export", "ExportMemos", func(ctx context.Context) error { return u.u.ExportMemos(ctx, f, fn) })
+}
+
+type observedImportUsecase struct {
+	u ImportUsecase
+	o Observer
+}
+
+func ObserveImportUsecase(u ImportUsecase, o Observer) ImportUsecase {
+	return &observedImportUsecase{u: u, o: o}
+}
+
+func (u *observedImportUsecase) Import(ctx context.Context, src ImportSource, dryRun bool) (*ImportReport, error) {
+	return observe1(ctx, u.o, "import", "Import", func(ctx context.Context) (*ImportReport, error) { return u.u.Import(ctx, src, dryRun) })
+}
+
+type observedWebhookUsecase struct {
+	u WebhookUsecase
+	o Observer
+}
+
+// ObserveWebhookUsecase observes every method but Run, which lasts until
+// shutdown.
+func ObserveWebhookUsecase(u WebhookUsecase, o Observer) WebhookUsecase {
+	return &observedWebhookUsecase{u: u, o: o}
+}
+
+func (u *observedWebhookUsecase) CreateWebhook(ctx context.Context, rawURL string, events []domain.MemoEventType, tag, secret string) (*domain.Webhook, error) {
+	return observe1(ctx, u.o, "webhook", "CreateWebhook", func(ctx context.Context) (*domain.Webhook, error) {
+		return u.u.CreateWebhook(ctx, rawURL, events, tag, secret)
+	})
+}
+
+func (u *observedWebhookUsecase) ListWebhooks(ctx context.Context) ([]domain.Webhook, error) {
+	return observe1(ctx, u.o, "webhook", "ListWebhooks", u.u.ListWebhooks)
+}
+
+func (u *observedWebhookUsecase) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	return observe0(ctx, u.o, "webhook", "DeleteWebhook", func(ctx context.Context) error { return u.u.DeleteWebhook(ctx, id) })
+}
+
+func (u *observedWebhookUsecase) ListDeliveries(ctx context.Context, webhookID uuid.UUID, limit int) ([]domain.WebhookDelivery, error) {
+	return observe1(ctx, u.o, "webhook", "ListDeliveries", func(ctx context.Context) ([]domain.WebhookDelivery, error) {
+		return u.u.ListDeliveries(ctx, webhookID, limit)
+	})
+}
+
+func (u *observedWebhookUsecase) GetDelivery(ctx context.Context, webhookID uuid.UUID, id int64) (*domain.WebhookDelivery, []domain.WebhookAttempt, error) {
+	var attempts []domain.WebhookAttempt
+	d, err := observe1(ctx, u.o, "webhook", "GetDelivery", func(ctx context.Context) (d *domain.WebhookDelivery, err error) {
+		d, attempts, err = u.u.GetDelivery(ctx, webhookID, id)
+		return d, err
+	})
+	return d, attempts, err
+}
+
+func (u *observedWebhookUsecase) Redeliver(ctx context.Context, webhookID uuid.UUID, id int64) error {
+	return observe0(ctx, u.o, "webhook", "Redeliver", func(ctx context.Context) error { return u.u.Redeliver(ctx, webhookID, id) })
+}
+
+func (u *observedWebhookUsecase) EnqueueEvent(ctx context.Context, e domain.DomainEvent) error {
+	return observe0(ctx, u.o, "webhook", "EnqueueEvent", func(ctx context.Context) error { return u.u.EnqueueEvent(ctx, e) })
+}
+
+func (u *observedWebhookUsecase) DeliverDue(ctx context.Context) (int, error) {
+	return observe1(ctx, u.o, "webhook", "DeliverDue", u.u.DeliverDue)
+}
+
+func (u *observedWebhookUsecase) Run(ctx context.Context, interval time.Duration) {
+	u.u.Run(ctx, interval)
+}
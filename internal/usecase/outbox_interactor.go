@@ -0,0 +1,196 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/domain/repository"
+)
+
+const (
+	DefaultOutboxPollInterval = 5 * time.Second
+	// OutboxMaxAttempts is how often a message is handed to the handlers
+	// before it is dead-lettered. Retries back off from 5s up to 10m.
+	OutboxMaxAttempts = 10
+	outboxBaseBackoff = 5 * time.Second
+	outboxMaxBackoff  = 10 * time.Minute
+	outboxBatch       = 100
+)
+
+// OutboxHandler reacts to domain events. Messages are delivered at least
+// once, so handlers must be idempotent.
+type OutboxHandler interface {
+	Handle(ctx context.Context, e domain.DomainEvent) error
+}
+
+type OutboxHandlerFunc func(ctx context.Context, e domain.DomainEvent) error
+
+func (f OutboxHandlerFunc) Handle(ctx context.Context, e domain.DomainEvent) error {
+	return f(ctx, e)
+}
+
+type OutboxDispatcher interface {
+	// Register adds a handler for every domain event. A message is retried
+	// until all handlers accepted it in the same attempt.
+	Register(h OutboxHandler)
+	// DispatchPending hands pending messages to the handlers and returns
+	// how many were dispatched. Messages of a memo are handled in order; a
+	// failing message holds back the later ones until it succeeds or is
+	// dead-lettered.
+	DispatchPending(ctx context.Context) (int, error)
+	// Run dispatches messages until ctx is done. It wakes up on every memo
+	// event and at least every interval.
+	Run(ctx context.Context, interval time.Duration)
+}
+
+type outboxDispatcher struct {
+	outbox   repository.OutboxRepository
+	bus      MemoEventBus
+	mu       sync.RWMutex
+	handlers []OutboxHandler
+	now      func() time.Time
+}
+
+func NewOutboxDispatcher(ob repository.OutboxRepository, bus MemoEventBus) OutboxDispatcher {
+	return &outboxDispatcher{outbox: ob, bus: bus, now: time.Now}
+}
+
+// NewOutboxMessage serializes e for the outbox.
+func NewOutboxMessage(e domain.DomainEvent, now time.Time) (*domain.OutboxMessage, error) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.OutboxMessage{AggregateID: e.AggregateID(), Name: e.EventName(), Payload: payload, NextAttemptAt: now, CreatedAt: now}, nil
+}
+
+func decodeDomainEvent(m *domain.OutboxMessage) (domain.DomainEvent, error) {
+	switch m.Name {
+	case domain.MemoCreatedEvent:
+		var e domain.MemoCreated
+		err := json.Unmarshal(m.Payload, &e)
+		return e, err
+	case domain.MemoUpdatedEvent:
+		var e domain.MemoUpdated
+		err := json.Unmarshal(m.Payload, &e)
+		return e, err
+	case domain.MemoDeletedEvent:
+		var e domain.MemoDeleted
+		err := json.Unmarshal(m.Payload, &e)
+		return e, err
+	}
+	return nil, fmt.Errorf("unknown domain event %q", m.Name)
+}
+
+func (d *outboxDispatcher) Register(h OutboxHandler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.handlers = append(d.handlers, h)
+}
+
+func (d *outboxDispatcher) DispatchPending(ctx context.Context) (int, error) {
+	dispatched := 0
+	_, err := d.outbox.WithLock(ctx, func(ctx context.Context) error {
+		now := d.now().UTC()
+		msgs, err := d.outbox.Pending(ctx, now, outboxBatch)
+		if err != nil {
+			return err
+		}
+		blocked := map[uuid.UUID]bool{}
+		for i := range msgs {
+			m := &msgs[i]
+			if blocked[m.AggregateID] {
+				continue
+			}
+			// A message that cannot be decoded is dead-lettered at once.
+			e, err := decodeDomainEvent(m)
+			undecodable := err != nil
+			if err == nil {
+				err = d.handle(ctx, e)
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				blocked[m.AggregateID] = true
+				m.Attempts++
+				m.LastError = err.Error()
+				m.NextAttemptAt = now.Add(outboxBackoff(m.Attempts))
+				if err := d.outbox.MarkFailed(ctx, m, undecodable || m.Attempts >= OutboxMaxAttempts); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := d.outbox.Delete(ctx, m.ID); err != nil {
+				return err
+			}
+			dispatched++
+		}
+		return nil
+	})
+	return dispatched, err
+}
+
+func (d *outboxDispatcher) handle(ctx context.Context, e domain.DomainEvent) error {
+	d.mu.RLock()
+	handlers := d.handlers
+	d.mu.RUnlock()
+	for _, h := range handlers {
+		if err := h.Handle(ctx, e); err != nil {
+			return fmt.Errorf("%s: %w", e.EventName(), err)
+		}
+	}
+	return nil
+}
+
+// outboxBackoff is the delay after the given number of failed attempts.
+func outboxBackoff(attempts int) time.Duration {
+	d := outboxBaseBackoff
+	for i := 1; i < attempts && d < outboxMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > outboxMaxBackoff {
+		d = outboxMaxBackoff
+	}
+	return d
+}
+
+func (d *outboxDispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var wake <-chan domain.MemoEvent
+	cancel := func() {}
+	defer func() { cancel() }()
+	for {
+		if wake == nil && d.bus != nil {
+			wake, cancel = d.bus.Subscribe()
+		}
+		for ctx.Err() == nil {
+			n, err := d.DispatchPending(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("outbox: dispatch: %v", err)
+			}
+			if err != nil || n < outboxBatch {
+				break
+			}
+		}
+		select {
+		case _, ok := <-wake:
+			// A subscription dropped for falling behind is renewed; the
+			// messages themselves are read from the outbox.
+			if !ok {
+				cancel()
+				wake = nil
+			}
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
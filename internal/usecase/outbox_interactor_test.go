@@ -0,0 +1,210 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/peconote/peconote/internal/domain"
+)
+
+type mockOutboxRepository struct {
+	messages []domain.OutboxMessage
+	dead     map[int64]bool
+	locked   bool
+}
+
+func (m *mockOutboxRepository) Append(ctx context.Context, msg *domain.OutboxMessage) error {
+	msg.ID = int64(len(m.messages) + 1)
+	m.messages = append(m.messages, *msg)
+	return nil
+}
+
+func (m *mockOutboxRepository) Pending(ctx context.Context, now time.Time, limit int) ([]domain.OutboxMessage, error) {
+	var out []domain.OutboxMessage
+	waiting := map[uuid.UUID]bool{}
+	for _, msg := range m.messages {
+		if msg.ID == 0 || m.dead[msg.ID] {
+			continue
+		}
+		if msg.NextAttemptAt.After(now) {
+			waiting[msg.AggregateID] = true
+		} else if !waiting[msg.AggregateID] && len(out) < limit {
+			out = append(out, msg)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockOutboxRepository) Delete(ctx context.Context, id int64) error {
+	m.messages[id-1].ID = 0
+	return nil
+}
+
+func (m *mockOutboxRepository) MarkFailed(ctx context.Context, msg *domain.OutboxMessage, dead bool) error {
+	m.messages[msg.ID-1] = *msg
+	if dead {
+		if m.dead == nil {
+			m.dead = map[int64]bool{}
+		}
+		m.dead[msg.ID] = true
+	}
+	return nil
+}
+
+func (m *mockOutboxRepository) WithLock(ctx context.Context, fn func(ctx context.Context) error) (bool, error) {
+	if m.locked {
+		return false, nil
+	}
+	return true, fn(ctx)
+}
+
+func TestOutbox_MemoChangesAreStoredInTx(t *testing.T) {
+	outbox := &mockOutboxRepository{}
+	repo := &mockMemoRepository{}
+	u := NewMemoUsecase(repo, nil, &mockTransactor{}, &mockMemoEventRepository{}, outbox, nil, DefaultMemoLimits)
+	ctx := context.Background()
+	id, err := u.CreateMemo(ctx, "", "# Plan\nbody", []string{"work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.memo = &domain.Memo{ID: id, Title: "Plan", Body: "# Plan\nbody", Tags: []string{"work"}}
+	if err := u.DeleteMemo(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewOutboxDispatcher(outbox, nil)
+	var got []domain.DomainEvent
+	d.Register(OutboxHandlerFunc(func(ctx context.Context, e domain.DomainEvent) error {
+		got = append(got, e)
+		return nil
+	}))
+	if n, err := d.DispatchPending(ctx); err != nil || n != 2 {
+		t.Fatalf("expected 2 dispatched messages, got %d %v", n, err)
+	}
+	created, ok := got[0].(domain.MemoCreated)
+	if !ok || created.Memo.ID != id || created.Memo.Title != "Plan" || created.Change.Type != domain.MemoEventCreated {
+		t.Fatalf("unexpected first event %#v", got[0])
+	}
+	deleted, ok := got[1].(domain.MemoDeleted)
+	if !ok || deleted.AggregateID() != id || deleted.Memo.Tags[0] != "work" {
+		t.Fatalf("unexpected second event %#v", got[1])
+	}
+	if n, _ := d.DispatchPending(ctx); n != 0 {
+		t.Fatalf("dispatched messages were handed over again")
+	}
+}
+
+func TestOutbox_RetriesInOrderPerMemo(t *testing.T) {
+	outbox := &mockOutboxRepository{}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	a, b := uuid.New(), uuid.New()
+	for _, e := range []domain.DomainEvent{
+		domain.MemoCreated{Change: domain.MemoEvent{ID: 1}, Memo: domain.Memo{ID: a}},
+		domain.MemoCreated{Change: domain.MemoEvent{ID: 2}, Memo: domain.Memo{ID: b}},
+		domain.MemoUpdated{Change: domain.MemoEvent{ID: 3}, Memo: domain.Memo{ID: a}},
+	} {
+		m, _ := NewOutboxMessage(e, now)
+		outbox.Append(context.Background(), m)
+	}
+	outbox.Append(context.Background(), &domain.OutboxMessage{AggregateID: b, Name: "Renamed", Payload: []byte("{}"), NextAttemptAt: now})
+
+	d := NewOutboxDispatcher(outbox, nil).(*outboxDispatcher)
+	d.now = func() time.Time { return now }
+	failing := true
+	var handled []int64
+	d.Register(OutboxHandlerFunc(func(ctx context.Context, e domain.DomainEvent) error {
+		if e.AggregateID() == a && failing {
+			return errors.New("unavailable")
+		}
+		switch e := e.(type) {
+		case domain.MemoCreated:
+			handled = append(handled, e.Change.ID)
+		case domain.MemoUpdated:
+			handled = append(handled, e.Change.ID)
+		}
+		return nil
+	}))
+
+	ctx := context.Background()
+	if n, err := d.DispatchPending(ctx); err != nil || n != 1 {
+		t.Fatalf("expected 1 dispatched message, got %d %v", n, err)
+	}
+	if len(handled) != 1 || handled[0] != 2 {
+		t.Fatalf("the update of a later memo must not wait, got %v", handled)
+	}
+	if m := outbox.messages[0]; m.Attempts != 1 || m.LastError == "" || !m.NextAttemptAt.Equal(now.Add(outboxBaseBackoff)) {
+		t.Fatalf("unexpected failed message %+v", m)
+	}
+	if m := outbox.messages[2]; m.Attempts != 0 {
+		t.Fatalf("a message was handled before an earlier one of the same memo: %+v", m)
+	}
+	if !outbox.dead[4] {
+		t.Fatalf("an unknown event must be dead-lettered")
+	}
+
+	failing = false
+	if n, _ := d.DispatchPending(ctx); n != 0 {
+		t.Fatalf("message retried before its backoff elapsed")
+	}
+	now = now.Add(outboxBaseBackoff)
+	if n, err := d.DispatchPending(ctx); err != nil || n != 2 {
+		t.Fatalf("expected 2 dispatched messages, got %d %v", n, err)
+	}
+	if len(handled) != 3 || handled[1] != 1 || handled[2] != 3 {
+		t.Fatalf("messages of a memo were handled out of order: %v", handled)
+	}
+}
+
+func TestOutbox_DeadLetter(t *testing.T) {
+	outbox := &mockOutboxRepository{}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m, _ := NewOutboxMessage(domain.MemoDeleted{Memo: domain.Memo{ID: uuid.New()}}, now)
+	outbox.Append(context.Background(), m)
+	d := NewOutboxDispatcher(outbox, nil).(*outboxDispatcher)
+	d.now = func() time.Time { return now }
+	d.Register(OutboxHandlerFunc(func(ctx context.Context, e domain.DomainEvent) error {
+		return errors.New("unavailable")
+	}))
+	for i := 0; i < OutboxMaxAttempts; i++ {
+		d.DispatchPending(context.Background())
+		now = now.Add(outboxMaxBackoff)
+	}
+	if !outbox.dead[1] || outbox.messages[0].Attempts != OutboxMaxAttempts {
+		t.Fatalf("expected a dead message, got %+v", outbox.messages[0])
+	}
+
+	outbox.locked = true
+	if _, err := d.DispatchPending(context.Background()); err != nil {
+		t.Fatalf("a held lock must not be an error: %v", err)
+	}
+}
+
+func TestOutbox_BackedOffMessagesDoNotFillTheBatch(t *testing.T) {
+	outbox := &mockOutboxRepository{}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := uuid.New()
+	for i := 0; i < outboxBatch; i++ {
+		m, _ := NewOutboxMessage(domain.MemoUpdated{Memo: domain.Memo{ID: a}}, now)
+		outbox.Append(context.Background(), m)
+	}
+	outbox.messages[0].Attempts, outbox.messages[0].NextAttemptAt = 1, now.Add(outboxBaseBackoff)
+	m, _ := NewOutboxMessage(domain.MemoCreated{Memo: domain.Memo{ID: uuid.New()}}, now)
+	outbox.Append(context.Background(), m)
+
+	d := NewOutboxDispatcher(outbox, nil).(*outboxDispatcher)
+	d.now = func() time.Time { return now }
+	var handled []domain.DomainEvent
+	d.Register(OutboxHandlerFunc(func(ctx context.Context, e domain.DomainEvent) error {
+		handled = append(handled, e)
+		return nil
+	}))
+	if n, err := d.DispatchPending(context.Background()); err != nil || n != 1 {
+		t.Fatalf("expected 1 dispatched message, got %d %v", n, err)
+	}
+	if _, ok := handled[0].(domain.MemoCreated); !ok {
+		t.Fatalf("expected the message of the other memo, got %#v", handled[0])
+	}
+}
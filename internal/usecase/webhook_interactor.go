@@ -0,0 +1,393 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/peconote/peconote/internal/domain"
+	"github.com/peconote/peconote/internal/domain/repository"
+)
+
+var (
+	ErrInvalidWebhook          = errors.New("invalid webhook")
+	ErrWebhookNotFound         = errors.New("webhook not found")
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+)
+
+const (
+	DefaultWebhookPollInterval = 5 * time.Second
+	// WebhookMaxAttempts is how often a delivery is tried before it is
+	// dead-lettered. Retries back off exponentially from 30s up to 1h.
+	WebhookMaxAttempts  = 10
+	webhookBaseBackoff  = 30 * time.Second
+	webhookMaxBackoff   = time.Hour
+	webhookLease        = time.Minute
+	webhookBatch        = 100
+	maxWebhookSecretLen = 256
+)
+
+// WebhookRequest is one signed POST of a delivery's payload.
+type WebhookRequest struct {
+	URL        string
+	Secret     string
+	DeliveryID int64
+	EventType  domain.MemoEventType
+	Payload    []byte
+}
+
+type WebhookSender interface {
+	// Send posts req and returns the response status code. err is set when
+	// no response was received.
+	Send(ctx context.Context, req WebhookRequest) (statusCode int, err error)
+}
+
+// WebhookPayload is the JSON body sent to webhooks. Memo is the memo as it
+// was after the change and is omitted for deletions.
+type WebhookPayload struct {
+	ID        int64        `json:"id"`
+	Type      string       `json:"type"`
+	MemoID    string       `json:"memo_id"`
+	Version   int64        `json:"version"`
+	Tags      []string     `json:"tags"`
+	UserID    string       `json:"user_id,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+	Memo      *WebhookMemo `json:"memo,omitempty"`
+}
+
+type WebhookMemo struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	Tags      []string  `json:"tags"`
+	Pinned    bool      `json:"pinned"`
+	Archived  bool      `json:"archived"`
+	Favorite  bool      `json:"favorite"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type WebhookUsecase interface {
+	// CreateWebhook generates a secret when secret is empty.
+	CreateWebhook(ctx context.Context, rawURL string, events []domain.MemoEventType, tag, secret string) (*domain.Webhook, error)
+	ListWebhooks(ctx context.Context) ([]domain.Webhook, error)
+	DeleteWebhook(ctx context.Context, id uuid.UUID) error
+	ListDeliveries(ctx context.Context, webhookID uuid.UUID, limit int) ([]domain.WebhookDelivery, error)
+	GetDelivery(ctx context.Context, webhookID uuid.UUID, id int64) (*domain.WebhookDelivery, []domain.WebhookAttempt, error)
+	// Redeliver queues a delivery again, including dead-lettered ones.
+	Redeliver(ctx context.Context, webhookID uuid.UUID, id int64) error
+	// EnqueueEvent queues deliveries of a memo event to the matching
+	// webhooks. It is an OutboxHandler; queuing the same event again is a
+	// no-op.
+	EnqueueEvent(ctx context.Context, e domain.DomainEvent) error
+	// DeliverDue sends the deliveries that are due and returns how many
+	// were attempted.
+	DeliverDue(ctx context.Context) (int, error)
+	// Run sends deliveries until ctx is done. It wakes up whenever
+	// deliveries are queued and at least every interval.
+	Run(ctx context.Context, interval time.Duration)
+}
+
+type webhookUsecase struct {
+	hooks      repository.WebhookRepository
+	deliveries repository.WebhookDeliveryRepository
+	sender     WebhookSender
+	wake       chan struct{}
+	now        func() time.Time
+}
+
+func NewWebhookUsecase(hr repository.WebhookRepository, dr repository.WebhookDeliveryRepository, sender WebhookSender) WebhookUsecase {
+	return &webhookUsecase{hooks: hr, deliveries: dr, sender: sender, wake: make(chan struct{}, 1), now: time.Now}
+}
+
+func (u *webhookUsecase) CreateWebhook(ctx context.Context, rawURL string, events []domain.MemoEventType, tag, secret string) (*domain.Webhook, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhook)
+	}
+	var types []domain.MemoEventType
+	seen := map[domain.MemoEventType]bool{}
+	for _, e := range events {
+		switch e {
+		case domain.MemoEventCreated, domain.MemoEventUpdated, domain.MemoEventDeleted:
+		default:
+			return nil, fmt.Errorf("%w: unknown event %q", ErrInvalidWebhook, e)
+		}
+		if !seen[e] {
+			seen[e] = true
+			types = append(types, e)
+		}
+	}
+	if len(tag) > 30 {
+		return nil, fmt.Errorf("%w: tag must be at most 30 bytes", ErrInvalidWebhook)
+	}
+	if len(secret) > maxWebhookSecretLen {
+		return nil, fmt.Errorf("%w: secret must be at most %d bytes", ErrInvalidWebhook, maxWebhookSecretLen)
+	}
+	if secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		secret = hex.EncodeToString(b)
+	}
+	w := &domain.Webhook{ID: uuid.New(), URL: rawURL, Events: types, Tag: tag, Secret: secret, CreatedAt: u.now().UTC()}
+	if err := u.hooks.Create(ctx, w); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (u *webhookUsecase) ListWebhooks(ctx context.Context) ([]domain.Webhook, error) {
+	return u.hooks.List(ctx)
+}
+
+func (u *webhookUsecase) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	if err := u.hooks.Delete(ctx, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrWebhookNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (u *webhookUsecase) getWebhook(ctx context.Context, id uuid.UUID) (*domain.Webhook, error) {
+	w, err := u.hooks.Get(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, err
+	}
+	return w, nil
+}
+
+func (u *webhookUsecase) ListDeliveries(ctx context.Context, webhookID uuid.UUID, limit int) ([]domain.WebhookDelivery, error) {
+	if _, err := u.getWebhook(ctx, webhookID); err != nil {
+		return nil, err
+	}
+	return u.deliveries.ListByWebhook(ctx, webhookID, limit)
+}
+
+func (u *webhookUsecase) getDelivery(ctx context.Context, webhookID uuid.UUID, id int64) (*domain.WebhookDelivery, error) {
+	d, err := u.deliveries.Get(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrWebhookDeliveryNotFound
+		}
+		return nil, err
+	}
+	if d.WebhookID != webhookID {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+	return d, nil
+}
+
+func (u *webhookUsecase) GetDelivery(ctx context.Context, webhookID uuid.UUID, id int64) (*domain.WebhookDelivery, []domain.WebhookAttempt, error) {
+	d, err := u.getDelivery(ctx, webhookID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	attempts, err := u.deliveries.ListAttempts(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return d, attempts, nil
+}
+
+func (u *webhookUsecase) Redeliver(ctx context.Context, webhookID uuid.UUID, id int64) error {
+	if _, err := u.getDelivery(ctx, webhookID, id); err != nil {
+		return err
+	}
+	if err := u.deliveries.Requeue(ctx, id, u.now().UTC()); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrWebhookDeliveryNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (u *webhookUsecase) EnqueueEvent(ctx context.Context, de domain.DomainEvent) error {
+	var (
+		e    domain.MemoEvent
+		memo *domain.Memo
+	)
+	switch de := de.(type) {
+	case domain.MemoCreated:
+		e, memo = de.Change, &de.Memo
+	case domain.MemoUpdated:
+		e, memo = de.Change, &de.Memo
+	case domain.MemoDeleted:
+		e = de.Change
+	default:
+		return nil
+	}
+	hooks, err := u.hooks.List(ctx)
+	if err != nil {
+		return err
+	}
+	var payload []byte
+	now := u.now().UTC()
+	queued := false
+	for i := range hooks {
+		if !hooks[i].Matches(e) {
+			continue
+		}
+		if payload == nil {
+			if payload, err = webhookPayload(e, memo); err != nil {
+				return err
+			}
+		}
+		d := &domain.WebhookDelivery{
+			WebhookID:     hooks[i].ID,
+			EventID:       e.ID,
+			EventType:     e.Type,
+			Payload:       payload,
+			Status:        domain.WebhookDeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		if err := u.deliveries.Enqueue(ctx, d); err != nil {
+			return err
+		}
+		queued = true
+	}
+	if queued {
+		select {
+		case u.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func webhookPayload(e domain.MemoEvent, memo *domain.Memo) ([]byte, error) {
+	p := WebhookPayload{
+		ID:        e.ID,
+		Type:      string(e.Type),
+		MemoID:    e.MemoID.String(),
+		Version:   e.Version,
+		Tags:      e.Tags,
+		UserID:    e.UserID,
+		CreatedAt: e.CreatedAt,
+	}
+	if p.Tags == nil {
+		p.Tags = []string{}
+	}
+	if memo != nil {
+		p.Memo = &WebhookMemo{
+			ID:        memo.ID.String(),
+			Title:     memo.Title,
+			Body:      memo.Body,
+			Tags:      memo.Tags,
+			Pinned:    memo.Pinned,
+			Archived:  memo.Archived,
+			Favorite:  memo.Favorite,
+			CreatedAt: memo.CreatedAt,
+			UpdatedAt: memo.UpdatedAt,
+		}
+		if p.Memo.Tags == nil {
+			p.Memo.Tags = []string{}
+		}
+	}
+	return json.Marshal(p)
+}
+
+func (u *webhookUsecase) DeliverDue(ctx context.Context) (int, error) {
+	due, err := u.deliveries.ClaimDue(ctx, u.now().UTC(), webhookLease, webhookBatch)
+	if err != nil {
+		return 0, err
+	}
+	hooks := map[uuid.UUID]*domain.Webhook{}
+	for i := range due {
+		d := &due[i]
+		w, ok := hooks[d.WebhookID]
+		if !ok {
+			w, err = u.hooks.Get(ctx, d.WebhookID)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return i, err
+			}
+			hooks[d.WebhookID] = w
+		}
+		// The webhook was deleted, together with its deliveries.
+		if w == nil {
+			continue
+		}
+		if err := u.deliver(ctx, w, d); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return i + 1, err
+		}
+	}
+	return len(due), nil
+}
+
+func (u *webhookUsecase) deliver(ctx context.Context, w *domain.Webhook, d *domain.WebhookDelivery) error {
+	start := u.now()
+	status, err := u.sender.Send(ctx, WebhookRequest{URL: w.URL, Secret: w.Secret, DeliveryID: d.ID, EventType: d.EventType, Payload: d.Payload})
+	end := u.now()
+	a := &domain.WebhookAttempt{DeliveryID: d.ID, StatusCode: status, Duration: end.Sub(start), CreatedAt: start.UTC()}
+	switch {
+	case err != nil:
+		a.Error = err.Error()
+	case status < 200 || status > 299:
+		a.Error = fmt.Sprintf("unexpected status %d", status)
+	}
+
+	d.Attempts++
+	d.LastError = a.Error
+	d.UpdatedAt = end.UTC()
+	switch {
+	case a.Error == "":
+		d.Status = domain.WebhookDeliverySucceeded
+	case d.Attempts >= WebhookMaxAttempts:
+		d.Status = domain.WebhookDeliveryDead
+	default:
+		d.Status = domain.WebhookDeliveryPending
+		d.NextAttemptAt = end.Add(webhookBackoff(d.Attempts)).UTC()
+	}
+	return u.deliveries.RecordAttempt(ctx, d, a)
+}
+
+// webhookBackoff is the delay after the given number of failed attempts.
+func webhookBackoff(attempts int) time.Duration {
+	d := webhookBaseBackoff
+	for i := 1; i < attempts && d < webhookMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > webhookMaxBackoff {
+		d = webhookMaxBackoff
+	}
+	return d
+}
+
+func (u *webhookUsecase) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for ctx.Err() == nil {
+			n, err := u.DeliverDue(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("webhook: deliver: %v", err)
+			}
+			if err != nil || n < webhookBatch {
+				break
+			}
+		}
+		select {
+		case <-u.wake:
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/peconote/peconote/internal/domain"
+)
+
+type mockWebhookRepository struct {
+	hooks []domain.Webhook
+}
+
+func (m *mockWebhookRepository) Create(ctx context.Context, w *domain.Webhook) error {
+	m.hooks = append(m.hooks, *w)
+	return nil
+}
+
+func (m *mockWebhookRepository) List(ctx context.Context) ([]domain.Webhook, error) {
+	return m.hooks, nil
+}
+
+func (m *mockWebhookRepository) Get(ctx context.Context, id uuid.UUID) (*domain.Webhook, error) {
+	for i := range m.hooks {
+		if m.hooks[i].ID == id {
+			return &m.hooks[i], nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockWebhookRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	for i := range m.hooks {
+		if m.hooks[i].ID == id {
+			m.hooks = append(m.hooks[:i], m.hooks[i+1:]...)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+type mockWebhookDeliveryRepository struct {
+	deliveries []domain.WebhookDelivery
+	attempts   []domain.WebhookAttempt
+}
+
+func (m *mockWebhookDeliveryRepository) Enqueue(ctx context.Context, d *domain.WebhookDelivery) error {
+	for _, q := range m.deliveries {
+		if q.WebhookID == d.WebhookID && q.EventID == d.EventID {
+			return nil
+		}
+	}
+	d.ID = int64(len(m.deliveries) + 1)
+	m.deliveries = append(m.deliveries, *d)
+	return nil
+}
+
+func (m *mockWebhookDeliveryRepository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]domain.WebhookDelivery, error) {
+	var out []domain.WebhookDelivery
+	for i := range m.deliveries {
+		d := &m.deliveries[i]
+		if d.Status == domain.WebhookDeliveryPending && !d.NextAttemptAt.After(now) && len(out) < limit {
+			d.NextAttemptAt = now.Add(lease)
+			out = append(out, *d)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockWebhookDeliveryRepository) RecordAttempt(ctx context.Context, d *domain.WebhookDelivery, a *domain.WebhookAttempt) error {
+	m.deliveries[d.ID-1] = *d
+	a.ID = int64(len(m.attempts) + 1)
+	m.attempts = append(m.attempts, *a)
+	return nil
+}
+
+func (m *mockWebhookDeliveryRepository) Get(ctx context.Context, id int64) (*domain.WebhookDelivery, error) {
+	if id < 1 || int(id) > len(m.deliveries) {
+		return nil, sql.ErrNoRows
+	}
+	d := m.deliveries[id-1]
+	return &d, nil
+}
+
+func (m *mockWebhookDeliveryRepository) ListByWebhook(ctx context.Context, webhookID uuid.UUID, limit int) ([]domain.WebhookDelivery, error) {
+	var out []domain.WebhookDelivery
+	for _, d := range m.deliveries {
+		if d.WebhookID == webhookID {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockWebhookDeliveryRepository) ListAttempts(ctx context.Context, deliveryID int64) ([]domain.WebhookAttempt, error) {
+	var out []domain.WebhookAttempt
+	for _, a := range m.attempts {
+		if a.DeliveryID == deliveryID {
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockWebhookDeliveryRepository) Requeue(ctx context.Context, id int64, at time.Time) error {
+	d := &m.deliveries[id-1]
+	d.Status, d.Attempts, d.NextAttemptAt = domain.WebhookDeliveryPending, 0, at
+	return nil
+}
+
+// httpSender posts payloads without signing them; signing is covered by the
+// webhook adapter.
+type httpSender struct{}
+
+func (httpSender) Send(ctx context.Context, req WebhookRequest) (int, error) {
+	resp, err := http.Post(req.URL, "application/json", bytes.NewReader(req.Payload))
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+type webhookTest struct {
+	u          *webhookUsecase
+	hooks      *mockWebhookRepository
+	deliveries *mockWebhookDeliveryRepository
+	now        time.Time
+}
+
+func newWebhookTest() *webhookTest {
+	wt := &webhookTest{
+		hooks:      &mockWebhookRepository{},
+		deliveries: &mockWebhookDeliveryRepository{},
+		now:        time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	wt.u = NewWebhookUsecase(wt.hooks, wt.deliveries, httpSender{}).(*webhookUsecase)
+	wt.u.now = func() time.Time { return wt.now }
+	return wt
+}
+
+func TestWebhook_DeliversWithRetries(t *testing.T) {
+	var received []WebhookPayload
+	failures := 2
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var p WebhookPayload
+		json.NewDecoder(r.Body).Decode(&p)
+		received = append(received, p)
+	}))
+	defer srv.Close()
+
+	memo := domain.Memo{ID: uuid.New(), Title: "Deploy", Body: "ship it", Tags: []string{"ci"}}
+	memoID := memo.ID
+	wt := newWebhookTest()
+	ctx := context.Background()
+	hook, err := wt.u.CreateWebhook(ctx, srv.URL, []domain.MemoEventType{domain.MemoEventCreated}, "ci", "")
+	if err != nil || len(hook.Secret) != 64 {
+		t.Fatalf("unexpected webhook %+v %v", hook, err)
+	}
+	created := domain.MemoCreated{Change: domain.MemoEvent{ID: 1, Type: domain.MemoEventCreated, MemoID: memoID, Tags: []string{"ci"}}, Memo: memo}
+	for _, e := range []domain.DomainEvent{
+		created,
+		domain.MemoCreated{Change: domain.MemoEvent{ID: 2, Type: domain.MemoEventCreated, Tags: []string{"other"}}},
+		domain.MemoDeleted{Change: domain.MemoEvent{ID: 3, Type: domain.MemoEventDeleted, MemoID: memoID, Tags: []string{"ci"}}, Memo: memo},
+		// The outbox may hand an event over again.
+		created,
+	} {
+		if err := wt.u.EnqueueEvent(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(wt.deliveries.deliveries) != 1 {
+		t.Fatalf("expected 1 delivery, got %+v", wt.deliveries.deliveries)
+	}
+
+	for i, wait := range []time.Duration{0, 30 * time.Second, time.Minute} {
+		wt.now = wt.now.Add(wait)
+		if n, err := wt.u.DeliverDue(ctx); err != nil || n != 1 {
+			t.Fatalf("attempt %d: got %d %v", i+1, n, err)
+		}
+		// Nothing is due again before the backoff elapsed.
+		if n, _ := wt.u.DeliverDue(ctx); n != 0 {
+			t.Fatalf("attempt %d: delivery retried without backoff", i+1)
+		}
+	}
+
+	d, attempts, err := wt.u.GetDelivery(ctx, hook.ID, 1)
+	if err != nil || d.Status != domain.WebhookDeliverySucceeded || d.Attempts != 3 || len(attempts) != 3 {
+		t.Fatalf("unexpected delivery %+v %+v %v", d, attempts, err)
+	}
+	if attempts[0].StatusCode != http.StatusInternalServerError || attempts[0].Error == "" || attempts[2].Error != "" {
+		t.Fatalf("unexpected attempts %+v", attempts)
+	}
+	if len(received) != 1 || received[0].MemoID != memoID.String() || received[0].Memo == nil || received[0].Memo.Title != "Deploy" {
+		t.Fatalf("unexpected payloads %+v", received)
+	}
+}
+
+func TestWebhook_DeadLetterAndRedeliver(t *testing.T) {
+	wt := newWebhookTest()
+	ctx := context.Background()
+	// Nothing listens on this address once the server is closed.
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	hook, err := wt.u.CreateWebhook(ctx, srv.URL, nil, "", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt.u.EnqueueEvent(ctx, domain.MemoDeleted{Change: domain.MemoEvent{ID: 1, Type: domain.MemoEventDeleted, MemoID: uuid.New()}})
+
+	for i := 0; i < WebhookMaxAttempts; i++ {
+		if n, _ := wt.u.DeliverDue(ctx); n != 1 {
+			t.Fatalf("attempt %d was not made", i+1)
+		}
+		wt.now = wt.now.Add(webhookMaxBackoff)
+	}
+	d, _, _ := wt.u.GetDelivery(ctx, hook.ID, 1)
+	if d.Status != domain.WebhookDeliveryDead || d.LastError == "" {
+		t.Fatalf("expected a dead delivery, got %+v", d)
+	}
+	if n, _ := wt.u.DeliverDue(ctx); n != 0 {
+		t.Fatalf("dead delivery was retried")
+	}
+
+	if err := wt.u.Redeliver(ctx, uuid.New(), 1); !errors.Is(err, ErrWebhookDeliveryNotFound) {
+		t.Fatalf("expected ErrWebhookDeliveryNotFound, got %v", err)
+	}
+	if err := wt.u.Redeliver(ctx, hook.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := wt.u.DeliverDue(ctx); n != 1 {
+		t.Fatalf("redelivery was not attempted")
+	}
+	if d, _, _ := wt.u.GetDelivery(ctx, hook.ID, 1); d.Status != domain.WebhookDeliveryPending || d.Attempts != 1 {
+		t.Fatalf("unexpected delivery after redelivery %+v", d)
+	}
+}
+
+func TestWebhook_Validation(t *testing.T) {
+	wt := newWebhookTest()
+	for _, tc := range []struct {
+		url    string
+		events []domain.MemoEventType
+	}{
+		{"ftp://example.com", nil},
+		{"/relative", nil},
+		{"https://example.com", []domain.MemoEventType{"renamed"}},
+	} {
+		if _, err := wt.u.CreateWebhook(context.Background(), tc.url, tc.events, "", ""); !errors.Is(err, ErrInvalidWebhook) {
+			t.Errorf("%s %v: expected ErrInvalidWebhook, got %v", tc.url, tc.events, err)
+		}
+	}
+	if err := wt.u.DeleteWebhook(context.Background(), uuid.New()); !errors.Is(err, ErrWebhookNotFound) {
+		t.Fatalf("expected ErrWebhookNotFound, got %v", err)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{1: 30 * time.Second, 2: time.Minute, 4: 4 * time.Minute, 9: time.Hour} {
+		if got := webhookBackoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+// Package migrations holds the SQL migrations of every database. Each
+// directory holds one database's migrations as NNNN_name.up.sql and
+// NNNN_name.down.sql pairs.
+package migrations
+
+import "embed"
+
+// FS holds the postgres, sqlite and mysql migrations of the memo database
+// and the users migrations of the users database.
+//
+//go:embed postgres/*.sql sqlite/*.sql mysql/*.sql users/*.sql
+var FS embed.FS
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS memo (
+    id CHAR(36) NOT NULL PRIMARY KEY,
+    title VARCHAR(255) NOT NULL DEFAULT '',
+    body TEXT NOT NULL,
+    pinned BOOLEAN NOT NULL DEFAULT FALSE,
+    archived BOOLEAN NOT NULL DEFAULT FALSE,
+    favorite BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at DATETIME(6) NOT NULL,
+    updated_at DATETIME(6) NOT NULL,
+    INDEX idx_memo_listing (archived, pinned, created_at),
+    -- The ngram parser tokenizes text without spaces between words, such
+    -- as Japanese, as well as English.
+    FULLTEXT INDEX idx_memo_search (title, body) WITH PARSER ngram
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_unicode_ci;
+
+-- Tags compare exactly, as they do in Postgres.
+CREATE TABLE IF NOT EXISTS memo_tag (
+    memo_id CHAR(36) NOT NULL,
+    position INT NOT NULL,
+    tag VARCHAR(255) NOT NULL COLLATE utf8mb4_bin,
+    PRIMARY KEY (memo_id, position),
+    INDEX idx_memo_tag_tag (tag, memo_id),
+    FOREIGN KEY (memo_id) REFERENCES memo (id) ON DELETE CASCADE
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_unicode_ci;
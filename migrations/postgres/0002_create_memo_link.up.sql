@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS memo_link (
+    source_id UUID NOT NULL REFERENCES memo (id) ON DELETE CASCADE,
+    target_ref TEXT NOT NULL,
+    target_id UUID REFERENCES memo (id) ON DELETE SET NULL,
+    PRIMARY KEY (source_id, target_ref)
+);
+
+CREATE INDEX IF NOT EXISTS idx_memo_link_target ON memo_link (target_id);
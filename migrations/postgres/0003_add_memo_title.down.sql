@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_memo_title_lower;
+ALTER TABLE memo DROP COLUMN IF EXISTS title;
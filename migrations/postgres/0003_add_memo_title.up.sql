@@ -0,0 +1,9 @@
+ALTER TABLE memo ADD COLUMN IF NOT EXISTS title TEXT NOT NULL DEFAULT '';
+
+UPDATE memo SET title = left(coalesce(
+    btrim(substring(body from '(?n)^#{1,6}[ \t]+([^\n]*)')),
+    btrim(split_part(body, E'\n', 1))
+), 200)
+WHERE title = '';
+
+CREATE INDEX IF NOT EXISTS idx_memo_title_lower ON memo (lower(title));
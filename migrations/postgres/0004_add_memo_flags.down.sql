@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_memo_listing;
+ALTER TABLE memo DROP COLUMN IF EXISTS favorite;
+ALTER TABLE memo DROP COLUMN IF EXISTS archived;
+ALTER TABLE memo DROP COLUMN IF EXISTS pinned;
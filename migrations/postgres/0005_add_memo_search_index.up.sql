@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS idx_memo_search ON memo USING GIN (to_tsvector('simple', title || ' ' || body));
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS memo_import (
+    source_key TEXT PRIMARY KEY,
+    memo_id UUID NOT NULL REFERENCES memo (id) ON DELETE CASCADE,
+    source_path TEXT NOT NULL,
+    imported_at TIMESTAMPTZ NOT NULL
+);
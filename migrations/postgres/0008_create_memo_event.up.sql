@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS memo_event (
+    id BIGSERIAL PRIMARY KEY,
+    type TEXT NOT NULL,
+    memo_id UUID NOT NULL,
+    version BIGINT NOT NULL,
+    user_id TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL,
+    UNIQUE (memo_id, version)
+);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS webhook_cursor;
+DROP TABLE IF EXISTS webhook_delivery_attempt;
+DROP TABLE IF EXISTS webhook_delivery;
+DROP TABLE IF EXISTS webhook;
+ALTER TABLE memo_event DROP COLUMN IF EXISTS tags;
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS outbox_message;
+
+CREATE TABLE IF NOT EXISTS webhook_cursor (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    last_event_id BIGINT NOT NULL
+);
+
+INSERT INTO webhook_cursor (id, last_event_id)
+SELECT TRUE, COALESCE(MAX(id), 0) FROM memo_event
+ON CONFLICT (id) DO NOTHING;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS outbox_message (
+    id BIGSERIAL PRIMARY KEY,
+    aggregate_id UUID NOT NULL,
+    name TEXT NOT NULL,
+    payload BYTEA NOT NULL,
+    dead BOOLEAN NOT NULL DEFAULT FALSE,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_message_pending ON outbox_message (id) WHERE NOT dead;
+
+-- Webhook deliveries are queued from the outbox now.
+DROP TABLE IF EXISTS webhook_cursor;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_memo_link_broken;
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS idx_memo_link_broken ON memo_link (lower(target_ref)) WHERE target_id IS NULL;
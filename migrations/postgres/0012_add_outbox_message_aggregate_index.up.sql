@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS idx_outbox_message_aggregate ON outbox_message (aggregate_id, id) WHERE NOT dead;
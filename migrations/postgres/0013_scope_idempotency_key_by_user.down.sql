@@ -0,0 +1,4 @@
+DELETE FROM idempotency_key WHERE user_id <> '';
+ALTER TABLE idempotency_key DROP CONSTRAINT IF EXISTS idempotency_key_pkey;
+ALTER TABLE idempotency_key ADD PRIMARY KEY (key);
+ALTER TABLE idempotency_key DROP COLUMN IF EXISTS user_id;
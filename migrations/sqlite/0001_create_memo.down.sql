@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS memo_tag;
+DROP TABLE IF EXISTS memo;
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS memo (
+    id TEXT PRIMARY KEY,
+    title TEXT NOT NULL DEFAULT '',
+    body TEXT NOT NULL,
+    pinned BOOLEAN NOT NULL DEFAULT FALSE,
+    archived BOOLEAN NOT NULL DEFAULT FALSE,
+    favorite BOOLEAN NOT NULL DEFAULT FALSE,
+    -- Unix nanoseconds, so that comparisons and ordering are numeric.
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_memo_listing ON memo (archived, pinned DESC, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS memo_tag (
+    memo_id TEXT NOT NULL REFERENCES memo (id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    tag TEXT NOT NULL,
+    PRIMARY KEY (memo_id, position)
+);
+
+CREATE INDEX IF NOT EXISTS idx_memo_tag_tag ON memo_tag (tag, memo_id);
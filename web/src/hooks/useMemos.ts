@@ -1,3 +1,4 @@
+import { useEffect } from 'react';
 import { useQuery, useMutation, useQueryClient } from '@tanstack/react-query';
 import client from '../api/client';
 
@@ -35,3 +36,31 @@ export function useCreateMemo() {
     },
   });
 }
+
+export type MemoEventType = 'created' | 'updated' | 'deleted';
+
+export interface MemoEvent {
+  id: number;
+  type: MemoEventType;
+  memo_id: string;
+  version: number;
+  user_id?: string;
+  created_at: string;
+}
+
+// useMemoEvents invalidates memo queries when the server reports a change.
+// EventSource reconnects on its own and resumes with Last-Event-ID.
+export function useMemoEvents(onEvent?: (event: MemoEvent) => void) {
+  const qc = useQueryClient();
+  useEffect(() => {
+    const source = new EventSource(`${import.meta.env.VITE_API_BASE ?? ''}/memos/events`);
+    const handle = (e: MessageEvent<string>) => {
+      const event = JSON.parse(e.data) as MemoEvent;
+      qc.invalidateQueries({ queryKey: ['memos'] });
+      onEvent?.(event);
+    };
+    const types: MemoEventType[] = ['created', 'updated', 'deleted'];
+    types.forEach((type) => source.addEventListener(type, handle));
+    return () => source.close();
+  }, [qc, onEvent]);
+}
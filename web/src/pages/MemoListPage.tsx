@@ -1,7 +1,8 @@
-import { useListMemos } from '../hooks/useMemos';
+import { useListMemos, useMemoEvents } from '../hooks/useMemos';
 
 function MemoListPage() {
   const { data } = useListMemos({});
+  useMemoEvents();
 
   return (
     <div>